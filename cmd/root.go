@@ -27,6 +27,9 @@ import (
 )
 
 var runParser *parser.RunParser
+var checksumParser *parser.ChecksumParser
+var checksumApplyFixParser *parser.ChecksumApplyFixParser
+var reportParser *parser.ReportParser
 var mysqlConfig *setting.MysqlConfig
 var logConfig *setting.LogConfig
 
@@ -63,10 +66,48 @@ var runCmd = &cobra.Command{
     --checksum-fix-paraller=1 \
     --binlog-apply-water-mark=10000 \
     --row-copy-water-mark=100 \
+    --queue-high-water-mb=512 \
+    --queue-low-water-mb=256 \
+    --queue-high-water-rows=10000 \
+    --queue-low-water-rows=2000 \
     --row-copy-limit=1000 \
+    --row-copy-chunk-time=0 \
+    --row-copy-min-limit=100 \
+    --row-copy-max-limit=100000 \
+    --row-copy-chunk-max-bytes=67108864 \
+    --row-copy-schedule=random \
+    --row-copy-table-paraller=0 \
+    --row-copy-split-count=0 \
+    --row-copy-split-min-rows=1000000 \
+    --row-copy-writer=insert \
+    --checksum-algorithm=md5 \
+    --checksum-level=crc \
+    --checksum-wait-apply-timeout=60 \
+    --checksum-fix-mode=bisect \
+    --checksum-bisect-rows=64 \
+    --checksum-delete-extra-dry-run=false \
+    --checksum-fix-sql-file="" \
+    --checksum-go-compare=false \
+    --checksum-diff-sample-rows=10 \
+    --enable-rolling-checksum=false \
+    --rolling-checksum-chunk-interval=1 \
+    --rolling-checksum-round-interval=3600 \
     --heartbeat-schema=dbmonitor \
     --heartbeat-table=heartbeat_table \
     --err-retry-count=60 \
+    --enable-target-checkpoint=false \
+    --target-checkpoint-schema=d_bus \
+    --target-checkpoint-table=d_bus_checkpoint \
+    --enable-snapshot=false \
+    --max-source-threads-running=0 \
+    --max-target-threads-running=0 \
+    --max-replica-lag=0 \
+    --throttle-replicas="127.0.0.1:3307,127.0.0.1:3308" \
+    --throttle-query="" \
+    --throttle-binlog-apply=false \
+    --row-copy-max-rows-per-sec=0 \
+    --row-copy-max-bytes-per-sec=0 \
+    --apply-binlog-max-rows-per-sec=0 \
     --mysql-host=127.0.0.1 \
     --mysql-port=3306 \
     --mysql-username="root" \
@@ -109,6 +150,157 @@ var runCmd = &cobra.Command{
 	},
 }
 
+// 不启动迁移单独进行数据校验, checksumCmd 是 rootCmd 的一个子命令
+var checksumCmd = &cobra.Command{
+	Use:   "checksum",
+	Short: "单独对任务的数据进行校验",
+	Long: `不需要启动迁移任务, 单独对任务的源和目标数据进行校验, 有不一致的数据退出码为 1:
+
+./go-d-bus checksum --task-uuid=20180204151900nb6VqFhl
+
+./go-d-bus checksum \
+    --task-uuid=20180204151900nb6VqFhl \
+    --tables="db1.table1,db1.table2" \
+    --fix=false \
+    --checksum-paraller=1 \
+    --checksum-fix-paraller=1 \
+    --checksum-limit=1000 \
+    --checksum-algorithm=md5 \
+    --checksum-level=crc \
+    --checksum-fix-mode=bisect \
+    --checksum-bisect-rows=64 \
+    --checksum-delete-extra-dry-run=false \
+    --checksum-fix-sql-file="" \
+    --checksum-go-compare=false \
+    --checksum-diff-sample-rows=10 \
+    --err-retry-count=60 \
+    --mysql-host=127.0.0.1 \
+    --mysql-port=3306 \
+    --mysql-username="root" \
+    --mysql-password="root" \
+    --mysql-database="d_bus" \
+    --log-filename="./go_d_bus.log" \
+    --log-level="info" \
+    --log-console=false
+    `,
+	Run: func(cmd *cobra.Command, args []string) {
+		// 初始化日志
+		logger.InitLogger(logConfig)
+
+		// 初始化orm实例
+		if err := parser.InitOrmDB(mysqlConfig); err != nil {
+			logger.M.Fatal(err)
+		}
+
+		// 检测命令行输入的参数
+		if err := checksumParser.Parse(); err != nil {
+			logger.M.Fatal(err)
+		}
+		logger.M.Info(common.ToJsonStrPretty(checksumParser))
+
+		// 开始校验, 有不一致的数据退出码为 1
+		summary := service.StartChecksumVerify(checksumParser)
+		logger.M.Info(summary.String())
+		fmt.Println(summary.String())
+		if !summary.IsConsistent() {
+			os.Exit(1)
+		}
+	},
+}
+
+// 执行人工审核过的修复sql文件, checksumApplyFixCmd 是 checksumCmd 的一个子命令
+var checksumApplyFixCmd = &cobra.Command{
+	Use:   "apply-fix",
+	Short: "执行人工审核过的修复sql文件",
+	Long: `按顺序执行 --checksum-fix-sql-file 生成的修复sql, 执行前再次比较每一行源和目标的数据,
+和生成修复sql时一样才执行, 数据发生了变化的修复sql不执行, 退出码为 1:
+
+./go-d-bus checksum apply-fix --task-uuid=20180204151900nb6VqFhl --file=./fix.sql
+
+./go-d-bus checksum apply-fix \
+    --task-uuid=20180204151900nb6VqFhl \
+    --file=./fix.sql \
+    --checksum-algorithm=md5 \
+    --err-retry-count=60 \
+    --mysql-host=127.0.0.1 \
+    --mysql-port=3306 \
+    --mysql-username="root" \
+    --mysql-password="root" \
+    --mysql-database="d_bus" \
+    --log-filename="./go_d_bus.log" \
+    --log-level="info" \
+    --log-console=false
+    `,
+	Run: func(cmd *cobra.Command, args []string) {
+		// 初始化日志
+		logger.InitLogger(logConfig)
+
+		// 初始化orm实例
+		if err := parser.InitOrmDB(mysqlConfig); err != nil {
+			logger.M.Fatal(err)
+		}
+
+		// 检测命令行输入的参数
+		if err := checksumApplyFixParser.Parse(); err != nil {
+			logger.M.Fatal(err)
+		}
+		logger.M.Info(common.ToJsonStrPretty(checksumApplyFixParser))
+
+		// 执行修复sql, 有数据发生了变化或者sql被修改过没有执行的修复sql退出码为 1
+		summary := service.StartChecksumApplyFix(checksumApplyFixParser)
+		logger.M.Info(summary.String())
+		fmt.Println(summary.String())
+		if summary.HasChanged() || summary.HasModified() {
+			os.Exit(1)
+		}
+	},
+}
+
+// 生成任务的 checksum 报告, reportCmd 是 rootCmd 的一个子命令
+var reportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "生成任务的 checksum 报告",
+	Long: `生成任务的 checksum 报告, 包含每个表源和目标的行数, 校验的范围数, 不一致和修复的范围数,
+还没有修复的范围, 耗时, 以及不一致数据的样例. 格式为 json, csv, html:
+
+./go-d-bus report --task-uuid=20180204151900nb6VqFhl --format=html --output=./report.html
+
+./go-d-bus report \
+    --task-uuid=20180204151900nb6VqFhl \
+    --format=json \
+    --output="" \
+    --count-rows=true \
+    --mysql-host=127.0.0.1 \
+    --mysql-port=3306 \
+    --mysql-username="root" \
+    --mysql-password="root" \
+    --mysql-database="d_bus" \
+    --log-filename="./go_d_bus.log" \
+    --log-level="info" \
+    --log-console=false
+    `,
+	Run: func(cmd *cobra.Command, args []string) {
+		// 初始化日志
+		logger.InitLogger(logConfig)
+
+		// 初始化orm实例
+		if err := parser.InitOrmDB(mysqlConfig); err != nil {
+			logger.M.Fatal(err)
+		}
+
+		// 检测命令行输入的参数
+		if err := reportParser.Parse(); err != nil {
+			logger.M.Fatal(err)
+		}
+		logger.M.Info(common.ToJsonStrPretty(reportParser))
+
+		// 生成报告
+		report := service.StartReport(reportParser)
+		logger.M.Infof("报告生成完成. 表数: %v, 还没有修复的范围数: %v, 不一致数据样例行数: %v",
+			len(report.Tables), len(report.RemainDiffRanges), len(report.DiffRowSamples))
+	},
+}
+
 // 用于回滚数据, rollbackCmd 是 rootCmd 的一个子命令
 var rollbackCmd = &cobra.Command{
 	Use:   "rollback",
@@ -134,12 +326,20 @@ func Execute() {
 }
 
 func init() {
-	// 添加 run, rollabck 子命令
-	rootCmd.AddCommand(runCmd, rollbackCmd)
+	// 添加 run, checksum, report, rollabck 子命令
+	rootCmd.AddCommand(runCmd, checksumCmd, reportCmd, rollbackCmd)
+	checksumCmd.AddCommand(checksumApplyFixCmd)
 
 	// 接收 run 命令 flags
 	initRunParser()
 
+	// 接收 checksum 命令 flags
+	initChecksumParser()
+	initChecksumApplyFixParser()
+
+	// 接收 report 命令 flags
+	initReportParser()
+
 	// 初始化 mysql 配置信息
 	initMysqlConfig()
 
@@ -166,10 +366,86 @@ func initRunParser() {
 	runCmd.Flags().IntVar(&runParser.ChecksumFixParaller, "checksum-fix-paraller", -1, "进行checksum修复数据的并发数")
 	runCmd.Flags().IntVar(&runParser.ApplyBinlogHighWaterMark, "binlog-apply-water-mark", -1, "应用binlog队列缓存最大个数")
 	runCmd.Flags().IntVar(&runParser.RowCopyHighWaterMark, "row-copy-water-mark", -1, "数据拷贝(row copy)队列缓存最大个数")
+	runCmd.Flags().IntVar(&runParser.QueueHighWaterMB, "queue-high-water-mb", -1, "应用binlog队列中缓存的数据超过多少MB暂停解析binlog, 0 不检测. 没有指定则使用任务中的设置, 默认 512")
+	runCmd.Flags().IntVar(&runParser.QueueLowWaterMB, "queue-low-water-mb", -1, "应用binlog队列中缓存的数据少于多少MB继续解析binlog. 没有指定则使用任务中的设置, 默认 256")
+	runCmd.Flags().IntVar(&runParser.QueueHighWaterRows, "queue-high-water-rows", -1, "应用binlog队列中缓存超过多少行暂停解析binlog, 0 不检测. 没有指定则使用 task.row_high_water_mark")
+	runCmd.Flags().IntVar(&runParser.QueueLowWaterRows, "queue-low-water-rows", -1, "应用binlog队列中缓存少于多少行继续解析binlog. 没有指定则使用 task.row_low_water_mark")
 	runCmd.Flags().IntVar(&runParser.RowCopyLimit, "row-copy-limit", -1, "每次数据拷贝(row copy)的行数")
+	runCmd.Flags().Float64Var(&runParser.RowCopyChunkTime, "row-copy-chunk-time", 0, "自适应数据拷贝(row copy)每次期望的耗时(秒), 根据查询和插入耗时调整每次的行数. 0 不开启")
+	runCmd.Flags().IntVar(&runParser.RowCopyMinLimit, "row-copy-min-limit", parser.ROW_COPY_MIN_LIMIT, "自适应数据拷贝(row copy)每次最少行数")
+	runCmd.Flags().IntVar(&runParser.RowCopyMaxLimit, "row-copy-max-limit", parser.ROW_COPY_MAX_LIMIT, "自适应数据拷贝(row copy)每次最多行数")
+	runCmd.Flags().IntVar(&runParser.RowCopyChunkMaxBytes, "row-copy-chunk-max-bytes", parser.ROW_COPY_CHUNK_MAX_BYTES, "自适应数据拷贝(row copy)每次最多字节数")
+	runCmd.Flags().StringVar(&runParser.RowCopySchedule, "row-copy-schedule", "", "数据拷贝(row copy)表调度策略. random, smallest-first, largest-first, priority, round-robin. 没有指定则使用任务中的设置")
+	runCmd.Flags().IntVar(&runParser.RowCopyTableParaller, "row-copy-table-paraller", 0, "每个表最多同时进行数据拷贝(row copy)的范围个数, 0 不限制. 可以在 table_map.row_copy_paraller 中单独指定")
+	runCmd.Flags().IntVar(&runParser.RowCopySplitCount, "row-copy-split-count", 0, "大表拆分成多少个范围并发数据拷贝(row copy), 0 不拆分. 可以在 table_map.row_copy_split_count 中单独指定")
+	runCmd.Flags().IntVar(&runParser.RowCopySplitMinRows, "row-copy-split-min-rows", parser.ROW_COPY_SPLIT_MIN_ROWS, "表的行数(估算)超过多少才拆分成多个范围")
+	runCmd.Flags().StringVar(&runParser.RowCopyWriter, "row-copy-writer", "", "数据拷贝(row copy)写入目标的方式. insert: INSERT IGNORE, load-data: LOAD DATA LOCAL INFILE. 没有指定则使用任务中的设置")
+	runCmd.Flags().StringVar(&runParser.ChecksumAlgorithm, "checksum-algorithm", "", "checksum 每行数据使用的 hash 算法. crc32, md5, sha1, sha256. 没有指定则使用任务中的设置, 默认 md5")
+	runCmd.Flags().StringVar(&runParser.ChecksumLevel, "checksum-level", "", "checksum 级别. count: 每个范围只比较行数. crc: 每个范围比较每行的 hash 值. full: 和 crc 一样. 所有级别都会比较每个表源和目标的最小和最大主键值. 默认 crc")
+	runCmd.Flags().IntVar(&runParser.ChecksumWaitApplyTimeout, "checksum-wait-apply-timeout", parser.CHECKSUM_WAIT_APPLY_TIMEOUT, "checksum 读取源数据后, 等待应用binlog追上读取时的位点再读取目标数据, 最多等待多少秒. 0 不等待")
+	runCmd.Flags().StringVar(&runParser.ChecksumFixMode, "checksum-fix-mode", parser.CHECKSUM_FIX_MODE_BISECT, "checksum 修复数据的方式. row: 逐行比较源表范围中的每一行, bisect: 二分查找不一致的行, 可以发现只在目标存在的行")
+	runCmd.Flags().IntVar(&runParser.ChecksumBisectRows, "checksum-bisect-rows", parser.CHECKSUM_BISECT_ROWS, "checksum 二分修复数据时, 范围行数少于多少逐行比较")
+	runCmd.Flags().BoolVar(&runParser.ChecksumDeleteExtraDryRun, "checksum-delete-extra-dry-run", false, "checksum 修复数据时, 只在目标存在的行只打印不删除")
+	runCmd.Flags().StringVar(&runParser.ChecksumFixSqlFile, "checksum-fix-sql-file", "", "checksum 修复数据时不直接修改目标, 把修复sql和修复前后的数据写入该文件, 审核后使用 checksum apply-fix 执行")
+	runCmd.Flags().BoolVar(&runParser.ChecksumGoCompare, "checksum-go-compare", false, "checksum 不一致时, 在Go中逐行比较源和目标的数据(数字比较数值, 时间比较时间), 一致则不算不一致. 源和目标字段类型不一样时使用")
+	runCmd.Flags().IntVar(&runParser.ChecksumDiffSampleRows, "checksum-diff-sample-rows", parser.CHECKSUM_DIFF_SAMPLE_ROWS, "checksum 修复数据时每个表最多保存多少行不一致数据的样例, 用于 report 命令生成报告. 0 不保存")
+	runCmd.Flags().BoolVar(&runParser.EnableRollingChecksum, "enable-rolling-checksum", false, "row copy 完成后是否循环对所有的表进行滚动校验, 发现不一致进行告警并保存不一致记录")
+	runCmd.Flags().Float64Var(&runParser.RollingChecksumChunkInterval, "rolling-checksum-chunk-interval", parser.ROLLING_CHECKSUM_CHUNK_INTERVAL, "滚动校验每个范围之间间隔多少秒, 控制校验的速度")
+	runCmd.Flags().IntVar(&runParser.RollingChecksumRoundInterval, "rolling-checksum-round-interval", parser.ROLLING_CHECKSUM_ROUND_INTERVAL, "滚动校验所有的表校验完一轮后间隔多少秒开始下一轮")
 	runCmd.Flags().StringVar(&runParser.HeartbeatSchema, "heartbeat-schema", "", "心跳数据库")
 	runCmd.Flags().StringVar(&runParser.HeartbeatTable, "heartbeat-table", "", "心跳表 该表的数据不会被应用, 主要是为了解析的位点能不段变, 应用的位点有可能不变")
 	runCmd.Flags().IntVar(&runParser.ErrRetryCount, "err-retry-count", 60, "错误重试次数. 默认60次")
+	runCmd.Flags().BoolVar(&runParser.EnableTargetCheckpoint, "enable-target-checkpoint", false, "是否将应用binlog的位点和数据在同一个事务中保存到目标实例, 重启时从目标实例的位点开始")
+	runCmd.Flags().StringVar(&runParser.TargetCheckpointSchema, "target-checkpoint-schema", parser.TARGET_CHECKPOINT_SCHEMA, "目标实例保存 checkpoint 的库")
+	runCmd.Flags().StringVar(&runParser.TargetCheckpointTable, "target-checkpoint-table", parser.TARGET_CHECKPOINT_TABLE, "目标实例保存 checkpoint 的表")
+	runCmd.Flags().BoolVar(&runParser.EnableSnapshot, "enable-snapshot", false, "是否使用一致性快照进行数据拷贝(row copy), 应用binlog从快照位点开始")
+	runCmd.Flags().IntVar(&runParser.MaxSourceThreadsRunning, "max-source-threads-running", 0, "源实例 Threads_running 超过该值暂停数据拷贝(row copy), 0 不检测. 可以在 task_throttle 中运行时修改")
+	runCmd.Flags().IntVar(&runParser.MaxTargetThreadsRunning, "max-target-threads-running", 0, "目标实例 Threads_running 超过该值暂停数据拷贝(row copy), 0 不检测. 可以在 task_throttle 中运行时修改")
+	runCmd.Flags().IntVar(&runParser.MaxReplicaLag, "max-replica-lag", 0, "目标从库延时(秒)超过该值暂停数据拷贝(row copy), 0 不检测. 可以在 task_throttle 中运行时修改")
+	runCmd.Flags().StringVar(&runParser.ThrottleReplicas, "throttle-replicas", "", "需要检测延时的目标从库, 多个用逗号隔开: host1:port1,host2:port2. 使用目标实例的用户名和密码链接")
+	runCmd.Flags().StringVar(&runParser.ThrottleQuery, "throttle-query", "", "在目标实例执行的自定义限流检测sql, 返回一个整数, 大于0进行限流")
+	runCmd.Flags().BoolVar(&runParser.ThrottleBinlogApply, "throttle-binlog-apply", false, "限流时是否同时暂停应用binlog")
+	runCmd.Flags().Int64Var(&runParser.RowCopyMaxRowsPerSec, "row-copy-max-rows-per-sec", 0, "数据拷贝(row copy)每秒最多从源读取的行数, 0 不限制. 可以在 task.row_copy_max_rows_per_sec 中运行时修改")
+	runCmd.Flags().Int64Var(&runParser.RowCopyMaxBytesPerSec, "row-copy-max-bytes-per-sec", 0, "数据拷贝(row copy)每秒最多从源读取的字节数, 0 不限制. 可以在 task.row_copy_max_bytes_per_sec 中运行时修改")
+	runCmd.Flags().Int64Var(&runParser.ApplyBinlogMaxRowsPerSec, "apply-binlog-max-rows-per-sec", 0, "应用binlog每秒最多写入目标的行数, 0 不限制. 可以在 task.binlog_max_rows_per_sec 中运行时修改")
+}
+
+func initChecksumParser() {
+	// 接收 checksum 命令 flags
+	checksumParser = new(parser.ChecksumParser)
+	checksumCmd.Flags().StringVar(&checksumParser.TaskUUID, "task-uuid", "", "需要校验的任务 UUID")
+	checksumCmd.Flags().StringVar(&checksumParser.Tables, "tables", "", "需要校验的表, 多个用逗号隔开: schema1.table1,schema2.table2. 没有指定则校验任务所有需要迁移的表")
+	checksumCmd.Flags().BoolVar(&checksumParser.Fix, "fix", false, "是否修复不一致的数据. 不修复只对不一致的范围再次校验")
+	checksumCmd.Flags().IntVar(&checksumParser.ChecksumParaller, "checksum-paraller", -1, "进行checksum的并发数, 没有指定时 count 级别默认 16")
+	checksumCmd.Flags().IntVar(&checksumParser.ChecksumFixParaller, "checksum-fix-paraller", -1, "进行checksum修复数据的并发数")
+	checksumCmd.Flags().IntVar(&checksumParser.RowCopyLimit, "checksum-limit", -1, "每个校验范围的行数. 没有指定则使用任务中每次 row copy 的行数")
+	checksumCmd.Flags().StringVar(&checksumParser.ChecksumAlgorithm, "checksum-algorithm", "", "checksum 每行数据使用的 hash 算法. crc32, md5, sha1, sha256. 没有指定则使用任务中的设置, 默认 md5")
+	checksumCmd.Flags().StringVar(&checksumParser.ChecksumLevel, "checksum-level", "", "checksum 级别. count: 每个范围只比较行数. crc: 每个范围比较每行的 hash 值. full: 和 crc 一样. 所有级别都会比较每个表源和目标的最小和最大主键值. 默认 crc")
+	checksumCmd.Flags().StringVar(&checksumParser.ChecksumFixMode, "checksum-fix-mode", parser.CHECKSUM_FIX_MODE_BISECT, "checksum 修复数据的方式. row: 逐行比较源表范围中的每一行, bisect: 二分查找不一致的行, 可以发现只在目标存在的行")
+	checksumCmd.Flags().IntVar(&checksumParser.ChecksumBisectRows, "checksum-bisect-rows", parser.CHECKSUM_BISECT_ROWS, "checksum 二分修复数据时, 范围行数少于多少逐行比较")
+	checksumCmd.Flags().BoolVar(&checksumParser.ChecksumDeleteExtraDryRun, "checksum-delete-extra-dry-run", false, "checksum 修复数据时, 只在目标存在的行只打印不删除")
+	checksumCmd.Flags().StringVar(&checksumParser.ChecksumFixSqlFile, "checksum-fix-sql-file", "", "checksum 修复数据时不直接修改目标, 把修复sql和修复前后的数据写入该文件, 审核后使用 checksum apply-fix 执行. 指定后 --fix 为 true")
+	checksumCmd.Flags().BoolVar(&checksumParser.ChecksumGoCompare, "checksum-go-compare", false, "checksum 不一致时, 在Go中逐行比较源和目标的数据(数字比较数值, 时间比较时间), 一致则不算不一致. 源和目标字段类型不一样时使用")
+	checksumCmd.Flags().IntVar(&checksumParser.ChecksumDiffSampleRows, "checksum-diff-sample-rows", parser.CHECKSUM_DIFF_SAMPLE_ROWS, "checksum 修复数据时每个表最多保存多少行不一致数据的样例, 用于 report 命令生成报告. 0 不保存")
+	checksumCmd.Flags().IntVar(&checksumParser.ErrRetryCount, "err-retry-count", 60, "错误重试次数. 默认60次")
+}
+
+func initChecksumApplyFixParser() {
+	// 接收 checksum apply-fix 命令 flags
+	checksumApplyFixParser = new(parser.ChecksumApplyFixParser)
+	checksumApplyFixCmd.Flags().StringVar(&checksumApplyFixParser.TaskUUID, "task-uuid", "", "修复sql所属的任务 UUID")
+	checksumApplyFixCmd.Flags().StringVar(&checksumApplyFixParser.File, "file", "", "需要执行的修复sql文件, 由 --checksum-fix-sql-file 生成")
+	checksumApplyFixCmd.Flags().StringVar(&checksumApplyFixParser.ChecksumAlgorithm, "checksum-algorithm", "", "checksum 每行数据使用的 hash 算法, 需要和生成修复sql时一样. 没有指定则使用任务中的设置, 默认 md5")
+	checksumApplyFixCmd.Flags().IntVar(&checksumApplyFixParser.ErrRetryCount, "err-retry-count", 60, "错误重试次数. 默认60次")
+}
+
+func initReportParser() {
+	// 接收 report 命令 flags
+	reportParser = new(parser.ReportParser)
+	reportCmd.Flags().StringVar(&reportParser.TaskUUID, "task-uuid", "", "需要生成报告的任务 UUID")
+	reportCmd.Flags().StringVar(&reportParser.Format, "format", parser.REPORT_FORMAT_JSON, "报告格式. json, csv, html")
+	reportCmd.Flags().StringVar(&reportParser.Output, "output", "", "报告输出的文件, 没有指定则输出到标准输出")
+	reportCmd.Flags().BoolVar(&reportParser.CountRows, "count-rows", true, "是否 SELECT COUNT(*) 获取源和目标表的行数, 大表比较耗时")
 }
 
 func initMysqlConfig() {
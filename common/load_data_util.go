@@ -0,0 +1,120 @@
+package common
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+)
+
+const (
+	LOAD_DATA_FIELD_SEP = '\t' // LOAD DATA 字段分隔符
+	LOAD_DATA_LINE_SEP  = '\n' // LOAD DATA 行分隔符
+	LOAD_DATA_ESCAPE    = '\\' // LOAD DATA 转义符
+)
+
+/* 将一行数据按 LOAD DATA 格式追加到 buf 中
+FIELDS TERMINATED BY '\t' ESCAPED BY '\\' LINES TERMINATED BY '\n'
+Params:
+    _buf: 需要追加的 buf
+    _row: 一行数据
+    _bitColumns: 哪些字段是 bit 类型, bit 类型的值会转化成数字
+    _binaryColumns: 哪些字段是二进制类型, 二进制类型的值会转化成十六进制, 不会被当做字符集中的字符解析
+*/
+func AppendLoadDataRow(buf []byte, row []interface{}, bitColumns []bool, binaryColumns []bool) ([]byte, error) {
+	var err error
+	for i, value := range row {
+		if i > 0 {
+			buf = append(buf, LOAD_DATA_FIELD_SEP)
+		}
+
+		isBit := i < len(bitColumns) && bitColumns[i]
+		isBinary := i < len(binaryColumns) && binaryColumns[i]
+		if buf, err = AppendLoadDataValue(buf, value, isBit, isBinary); err != nil {
+			return nil, err
+		}
+	}
+
+	return append(buf, LOAD_DATA_LINE_SEP), nil
+}
+
+/* 将一个字段的值按 LOAD DATA 格式追加到 buf 中
+NULL 使用 \N, 字符串和二进制数据中的转义符, 分隔符, \r 和 \0 需要转义
+Params:
+    _buf: 需要追加的 buf
+    _value: 字段值
+    _isBit: 是否是 bit 类型
+    _isBinary: 是否是二进制类型
+*/
+func AppendLoadDataValue(buf []byte, value interface{}, isBit bool, isBinary bool) ([]byte, error) {
+	switch v := value.(type) {
+	case nil:
+		return append(buf, LOAD_DATA_ESCAPE, 'N'), nil
+	case int64:
+		return strconv.AppendInt(buf, v, 10), nil
+	case int:
+		return strconv.AppendInt(buf, int64(v), 10), nil
+	case uint64:
+		return strconv.AppendUint(buf, v, 10), nil
+	case float64:
+		return strconv.AppendFloat(buf, v, 'g', -1, 64), nil
+	case string:
+		if isBit {
+			return strconv.AppendUint(buf, BitBytes2Uint64([]byte(v)), 10), nil
+		}
+		if isBinary {
+			return AppendLoadDataHex(buf, []byte(v)), nil
+		}
+		return AppendLoadDataEscape(buf, v), nil
+	case []byte:
+		if isBit {
+			return strconv.AppendUint(buf, BitBytes2Uint64(v), 10), nil
+		}
+		if isBinary {
+			return AppendLoadDataHex(buf, v), nil
+		}
+		return AppendLoadDataEscape(buf, string(v)), nil
+	}
+
+	return nil, fmt.Errorf("LOAD DATA 不支持的数据类型: %T. %v", value, value)
+}
+
+// 对字符串进行 LOAD DATA 转义, 按字节处理, 二进制数据不会被修改
+func AppendLoadDataEscape(buf []byte, value string) []byte {
+	for i := 0; i < len(value); i++ {
+		switch c := value[i]; c {
+		case LOAD_DATA_ESCAPE:
+			buf = append(buf, LOAD_DATA_ESCAPE, LOAD_DATA_ESCAPE)
+		case LOAD_DATA_FIELD_SEP:
+			buf = append(buf, LOAD_DATA_ESCAPE, 't')
+		case LOAD_DATA_LINE_SEP:
+			buf = append(buf, LOAD_DATA_ESCAPE, 'n')
+		case '\r':
+			buf = append(buf, LOAD_DATA_ESCAPE, 'r')
+		case 0:
+			buf = append(buf, LOAD_DATA_ESCAPE, '0')
+		default:
+			buf = append(buf, c)
+		}
+	}
+
+	return buf
+}
+
+// bit 类型查询出来的是大端字节, 转化成数字
+func BitBytes2Uint64(data []byte) uint64 {
+	var result uint64
+	for _, b := range data {
+		result = result<<8 | uint64(b)
+	}
+
+	return result
+}
+
+// 将二进制数据转化成十六进制追加到 buf 中, LOAD DATA 中通过 UNHEX 还原
+func AppendLoadDataHex(buf []byte, value []byte) []byte {
+	start := len(buf)
+	buf = append(buf, make([]byte, hex.EncodedLen(len(value)))...)
+	hex.Encode(buf[start:], value)
+
+	return buf
+}
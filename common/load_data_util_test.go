@@ -0,0 +1,21 @@
+package common
+
+import (
+	"testing"
+)
+
+func TestAppendLoadDataRow(t *testing.T) {
+	row := []interface{}{int64(-1), uint64(2), 1.5, nil, "", "a\tb\nc\\d\re\x00f", "\x00\x01", "枚举", "\x01\x02", []byte("\xff\x00\t"), nil}
+	bitColumns := []bool{false, false, false, false, false, false, false, false, true, false, false}
+	binaryColumns := []bool{false, false, false, false, false, false, false, false, false, true, true}
+
+	buf, err := AppendLoadDataRow(nil, row, bitColumns, binaryColumns)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "-1\t2\t1.5\t\\N\t\ta\\tb\\nc\\\\d\\re\\0f\t\\0\x01\t枚举\t258\tff0009\t\\N\n"
+	if string(buf) != expected {
+		t.Fatalf("LOAD DATA 格式不正确. %q != %q", string(buf), expected)
+	}
+}
@@ -415,3 +415,40 @@ func GetSqlValue(data interface{}, wrapStr string) (interface{}, error) {
 
 	return data, nil
 }
+
+// 实例的 host 和 port
+type HostPort struct {
+	Host string
+	Port int
+}
+
+func (this *HostPort) String() string {
+	return fmt.Sprintf("%v:%v", this.Host, this.Port)
+}
+
+/* 解析逗号隔开的多个实例, 如: 127.0.0.1:3306,127.0.0.1:3307
+Params:
+    _str: 需要解析的字符串, 为空返回空切片
+*/
+func ParseHostPorts(str string) ([]*HostPort, error) {
+	hostPorts := make([]*HostPort, 0)
+	for _, item := range strings.Split(str, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		index := strings.LastIndex(item, ":")
+		if index <= 0 || index == len(item)-1 {
+			return nil, fmt.Errorf("实例格式不正确, 应该为 host:port. %v", item)
+		}
+		port, err := strconv.Atoi(item[index+1:])
+		if err != nil || port <= 0 {
+			return nil, fmt.Errorf("实例端口不正确. %v", item)
+		}
+
+		hostPorts = append(hostPorts, &HostPort{Host: item[:index], Port: port})
+	}
+
+	return hostPorts, nil
+}
@@ -81,3 +81,17 @@ func TestGetCurrentTimestampMS(t *testing.T) {
 		fmt.Println(GetCurrentTimestampMS())
 	}
 }
+
+func TestParseHostPorts(t *testing.T) {
+	hostPorts, err := ParseHostPorts(" 10.0.0.1:3306, 10.0.0.2:3307,")
+	if err != nil {
+		t.Fatalf("解析实例失败. %v", err)
+	}
+	if len(hostPorts) != 2 || hostPorts[1].Host != "10.0.0.2" || hostPorts[1].Port != 3307 {
+		t.Fatalf("解析实例结果不正确. %v", hostPorts)
+	}
+
+	if _, err := ParseHostPorts("10.0.0.1"); err == nil {
+		t.Fatalf("没有端口的实例应该解析失败")
+	}
+}
@@ -18,6 +18,7 @@ type ConfigMap struct {
 	ColumnMapMap                       map[string]*model.ColumnMap                       // 数据库字段映射信息, key 为 源数据库的 schema.table.column
 	IgnoreColumnMap                    map[string]*model.IgnoreColumn                    // 不需要同步的列
 	BinlogDeleteWhereExternalColumnMap map[string]*model.BinlogDeleteWhereExternalColumn // 消费 binlog WHERE 条件而外需要添加的字段
+	ChecksumColumnRuleMap              map[string][]*model.ChecksumColumnRule            // checksum 字段规范化规则, key 为 源数据库的 schema.table.column
 
 	RunQuota *model.Task // 获取运行任务的参数
 }
@@ -187,6 +188,20 @@ func (this *ConfigMap) InitBinlogDeleteWhereExternalMap() error {
 	return nil
 }
 
+// 设置 checksum 字段规范化规则
+func (this *ConfigMap) InitChecksumColumnRuleMap() error {
+	checksumColumnRuleDao := new(dao.ChecksumColumnRuleDao)
+
+	rules, err := checksumColumnRuleDao.FindByTaskUUID(this.TaskUUID, "*")
+	if err != nil {
+		return err
+	}
+
+	this.ChecksumColumnRuleMap = MakeChecksumColumnRuleMap(rules)
+
+	return nil
+}
+
 /* 通过指定的表名, 获取不需要迁移的列名
 Params:
     _schemaName: 哪个数据库
@@ -277,6 +292,11 @@ func NewConfigMap(taskUUID string) (*ConfigMap, error) {
 		return nil, err
 	}
 
+	// 设置 checksum 字段规范化规则
+	if err := configMap.InitChecksumColumnRuleMap(); err != nil {
+		return nil, err
+	}
+
 	return configMap, nil
 }
 
@@ -57,6 +57,18 @@ func MakeBinlogDeleteWhereExternalColumnMap(externalColumns []*model.BinlogDelet
 	return externalColumnMap
 }
 
+// 创建 checksum 字段规范化规则 Map, Map 的key为源端的: schema.table.column, 同一个字段的规则保持 id 顺序
+func MakeChecksumColumnRuleMap(rules []*model.ChecksumColumnRule) map[string][]*model.ChecksumColumnRule {
+	ruleMap := make(map[string][]*model.ChecksumColumnRule)
+
+	for _, rule := range rules {
+		key := fmt.Sprintf("%v.%v.%v", rule.Schema.String, rule.Table.String, rule.Column.String)
+		ruleMap[key] = append(ruleMap[key], rule)
+	}
+
+	return ruleMap
+}
+
 /* 获取数据库map的key
 Params:
     _schema: 数据库名
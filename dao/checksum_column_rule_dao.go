@@ -0,0 +1,25 @@
+package dao
+
+import (
+	"github.com/daiguadaidai/go-d-bus/gdbc"
+	"github.com/daiguadaidai/go-d-bus/model"
+	"github.com/jinzhu/gorm"
+)
+
+type ChecksumColumnRuleDao struct{}
+
+// 获取任务所有的 checksum 字段规范化规则, 按 id 顺序
+func (this *ChecksumColumnRuleDao) FindByTaskUUID(taskUUID string, columnStr string) ([]*model.ChecksumColumnRule, error) {
+	ormDB := gdbc.GetOrmInstance()
+
+	var rules []*model.ChecksumColumnRule
+	err := ormDB.Select(columnStr).Where("task_uuid = ?", taskUUID).Order("id").Find(&rules).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return rules, nil
+		}
+		return nil, err
+	}
+
+	return rules, nil
+}
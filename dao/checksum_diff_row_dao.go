@@ -0,0 +1,35 @@
+package dao
+
+import (
+	"github.com/daiguadaidai/go-d-bus/gdbc"
+	"github.com/daiguadaidai/go-d-bus/model"
+	"github.com/jinzhu/gorm"
+)
+
+type ChecksumDiffRowDao struct{}
+
+// 保存一行不一致数据的样例
+func (this *ChecksumDiffRowDao) Create(checksumDiffRow *model.ChecksumDiffRow) error {
+	ormDB := gdbc.GetOrmInstance()
+
+	return ormDB.Create(checksumDiffRow).Error
+}
+
+/* 获取任务所有不一致数据的样例, 按保存的顺序
+Params:
+    taskUUID: 任务ID
+*/
+func (this *ChecksumDiffRowDao) FindByTaskUUID(taskUUID string) ([]*model.ChecksumDiffRow, error) {
+	ormDB := gdbc.GetOrmInstance()
+
+	var checksumDiffRows []*model.ChecksumDiffRow
+	err := ormDB.Where("`task_uuid`=?", taskUUID).Order("id").Find(&checksumDiffRows).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return checksumDiffRows, nil
+		}
+		return nil, err
+	}
+
+	return checksumDiffRows, nil
+}
@@ -0,0 +1,62 @@
+package dao
+
+import (
+	"github.com/daiguadaidai/go-d-bus/gdbc"
+	"github.com/daiguadaidai/go-d-bus/model"
+	"github.com/jinzhu/gorm"
+)
+
+type ChecksumTableStatDao struct{}
+
+/* 累加表的 checksum 统计, 表还没有统计记录则新增
+Params:
+    taskUUID: 任务ID
+    schema: 数据库名
+    table: 表名
+    chunkCount: 增加的第一次校验的范围数
+    diffChunkCount: 增加的第一次校验不一致的范围数
+    fixedChunkCount: 增加的修复或再次校验后一致的范围数
+    checksumElapsedMs: 增加的多行校验耗时(毫秒)
+    fixElapsedMs: 增加的修复数据耗时(毫秒)
+*/
+func (this *ChecksumTableStatDao) Incr(
+	taskUUID string,
+	schema string,
+	table string,
+	chunkCount int64,
+	diffChunkCount int64,
+	fixedChunkCount int64,
+	checksumElapsedMs int64,
+	fixElapsedMs int64,
+) error {
+	ormDB := gdbc.GetOrmInstance()
+
+	sql := "/* go-d-bus */ INSERT INTO `checksum_table_stat`(`task_uuid`, `schema`, `table`, `chunk_count`, `diff_chunk_count`, `fixed_chunk_count`, `checksum_elapsed_ms`, `fix_elapsed_ms`) " +
+		"VALUES(?, ?, ?, ?, ?, ?, ?, ?) ON DUPLICATE KEY UPDATE " +
+		"`chunk_count` = `chunk_count` + VALUES(`chunk_count`), " +
+		"`diff_chunk_count` = `diff_chunk_count` + VALUES(`diff_chunk_count`), " +
+		"`fixed_chunk_count` = `fixed_chunk_count` + VALUES(`fixed_chunk_count`), " +
+		"`checksum_elapsed_ms` = `checksum_elapsed_ms` + VALUES(`checksum_elapsed_ms`), " +
+		"`fix_elapsed_ms` = `fix_elapsed_ms` + VALUES(`fix_elapsed_ms`)"
+
+	return ormDB.Exec(sql, taskUUID, schema, table, chunkCount, diffChunkCount, fixedChunkCount, checksumElapsedMs, fixElapsedMs).Error
+}
+
+/* 获取任务所有表的 checksum 统计
+Params:
+    taskUUID: 任务ID
+*/
+func (this *ChecksumTableStatDao) FindByTaskUUID(taskUUID string) ([]*model.ChecksumTableStat, error) {
+	ormDB := gdbc.GetOrmInstance()
+
+	var stats []*model.ChecksumTableStat
+	err := ormDB.Where("`task_uuid`=?", taskUUID).Order("id").Find(&stats).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return stats, nil
+		}
+		return nil, err
+	}
+
+	return stats, nil
+}
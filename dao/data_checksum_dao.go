@@ -49,6 +49,24 @@ func (this *DataChecksumDao) FindNoFixByTaskUUID(taskUUID string, columnStr stri
 	return dataChecksums, nil
 }
 
+/* 获取一个范围还没修复的不一致记录数
+Params:
+    _taskUUID: 任务ID
+    _sourceSchema: 源库名
+    _sourceTable: 源表名
+    _minIDValue: 范围最小值(json)
+    _maxIDValue: 范围最大值(json)
+*/
+func (this *DataChecksumDao) CountNoFixByRange(_taskUUID string, _sourceSchema string, _sourceTable string, _minIDValue string, _maxIDValue string) int {
+	ormDB := gdbc.GetOrmInstance()
+
+	count := 0
+	ormDB.Model(&model.DataChecksum{}).Where("task_uuid = ? AND source_schema = ? AND source_table = ? AND min_id_value = ? AND max_id_value = ? AND is_fix = 0",
+		_taskUUID, _sourceSchema, _sourceTable, _minIDValue, _maxIDValue).Count(&count)
+
+	return count
+}
+
 /* 保存数据
 Params:
     _taskUUID: 任务ID
@@ -78,3 +96,44 @@ func (this *DataChecksumDao) FixCompletedByID(id int64) int {
 
 	return int(affected)
 }
+
+/* 标记checksum不一致的已经修复, 并记录修复时发现的不一致行数
+Params:
+    _id: 主键ID
+    _missingRows: 源有目标没有的行数
+    _extraRows: 目标有源没有的行数
+    _diffRows: 源和目标都有但是数据不一致的行数
+*/
+func (this *DataChecksumDao) FixCompletedWithCountByID(_id int64, _missingRows int, _extraRows int, _diffRows int) int {
+	ormDB := gdbc.GetOrmInstance()
+
+	updateDataChecksum := model.DataChecksum{
+		IsFix:       sql.NullInt64{1, true},
+		MissingRows: sql.NullInt64{int64(_missingRows), true},
+		ExtraRows:   sql.NullInt64{int64(_extraRows), true},
+		DiffRows:    sql.NullInt64{int64(_diffRows), true},
+	}
+	affected := ormDB.Model(&model.DataChecksum{}).Where("`id`=?", _id).Updates(updateDataChecksum).RowsAffected
+
+	return int(affected)
+}
+
+/* 记录修复时发现的不一致行数, 不标记修复
+Params:
+    _id: 主键ID
+    _missingRows: 源有目标没有的行数
+    _extraRows: 目标有源没有的行数
+    _diffRows: 源和目标都有但是数据不一致的行数
+*/
+func (this *DataChecksumDao) UpdateCountByID(_id int64, _missingRows int, _extraRows int, _diffRows int) int {
+	ormDB := gdbc.GetOrmInstance()
+
+	updateDataChecksum := model.DataChecksum{
+		MissingRows: sql.NullInt64{Int64: int64(_missingRows), Valid: true},
+		ExtraRows:   sql.NullInt64{Int64: int64(_extraRows), Valid: true},
+		DiffRows:    sql.NullInt64{Int64: int64(_diffRows), Valid: true},
+	}
+	affected := ormDB.Model(&model.DataChecksum{}).Where("`id`=?", _id).Updates(updateDataChecksum).RowsAffected
+
+	return int(affected)
+}
@@ -0,0 +1,104 @@
+package dao
+
+import (
+	"github.com/daiguadaidai/go-d-bus/gdbc"
+	"github.com/daiguadaidai/go-d-bus/model"
+	"github.com/jinzhu/gorm"
+)
+
+type RowCopyChunkDao struct{}
+
+// 保存一个 row copy chunk
+func (this *RowCopyChunkDao) Create(rowCopyChunk *model.RowCopyChunk) error {
+	ormDB := gdbc.GetOrmInstance()
+
+	return ormDB.Create(rowCopyChunk).Error
+}
+
+/* 获取表(或者拆分后的一个范围)还没有完成的 chunk, 按生成的顺序排序
+Params:
+    taskUUID: 任务ID
+    schema: 数据库名
+    table: 表名
+    rangeNo: 范围编号, 没有拆分为0
+*/
+func (this *RowCopyChunkDao) FindWaitingByTable(taskUUID string, schema string, table string, rangeNo int) ([]*model.RowCopyChunk, error) {
+	ormDB := gdbc.GetOrmInstance()
+
+	var rowCopyChunks []*model.RowCopyChunk
+	err := ormDB.Where("`task_uuid`=? AND `schema`=? AND `source`=? AND `range_no`=? AND `status`=?",
+		taskUUID, schema, table, rangeNo, model.ROW_COPY_CHUNK_STATUS_WAITING).Order("id").Find(&rowCopyChunks).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return rowCopyChunks, nil
+		}
+		return nil, err
+	}
+
+	return rowCopyChunks, nil
+}
+
+/* 获取表(或者拆分后的一个范围)最后生成的 chunk, 没有返回 nil
+Params:
+    taskUUID: 任务ID
+    schema: 数据库名
+    table: 表名
+    rangeNo: 范围编号, 没有拆分为0
+*/
+func (this *RowCopyChunkDao) GetLastByTable(taskUUID string, schema string, table string, rangeNo int) (*model.RowCopyChunk, error) {
+	ormDB := gdbc.GetOrmInstance()
+
+	rowCopyChunk := new(model.RowCopyChunk)
+	err := ormDB.Where("`task_uuid`=? AND `schema`=? AND `source`=? AND `range_no`=?",
+		taskUUID, schema, table, rangeNo).Order("id DESC").First(rowCopyChunk).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return rowCopyChunk, nil
+}
+
+/* 获取任务的所有 chunk, 用于统计和对指定 chunk 进行 checksum
+Params:
+    taskUUID: 任务ID
+*/
+func (this *RowCopyChunkDao) FindByTaskUUID(taskUUID string) ([]*model.RowCopyChunk, error) {
+	ormDB := gdbc.GetOrmInstance()
+
+	var rowCopyChunks []*model.RowCopyChunk
+	err := ormDB.Where("`task_uuid`=?", taskUUID).Order("id").Find(&rowCopyChunks).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return rowCopyChunks, nil
+		}
+		return nil, err
+	}
+
+	return rowCopyChunks, nil
+}
+
+/* 标记 chunk row copy 完成, 并记录行数和耗时
+Params:
+    taskUUID: 任务ID
+    schema: 数据库名
+    table: 表名
+    chunkHash: chunk 的时间戳
+    rowCount: row copy 的行数
+    elapsedMs: row copy 耗时(毫秒)
+*/
+func (this *RowCopyChunkDao) TagChunkComplete(taskUUID, schema, table, chunkHash string, rowCount int, elapsedMs int64) int {
+	ormDB := gdbc.GetOrmInstance()
+
+	updateRowCopyChunk := map[string]interface{}{
+		"status":     model.ROW_COPY_CHUNK_STATUS_COMPLETE,
+		"row_count":  rowCount,
+		"elapsed_ms": elapsedMs,
+	}
+	affected := ormDB.Model(&model.RowCopyChunk{}).Where("`task_uuid`=? AND `schema`=? AND `source`=? AND `chunk_hash`=?",
+		taskUUID, schema, table, chunkHash).Updates(updateRowCopyChunk).RowsAffected
+
+	return int(affected)
+}
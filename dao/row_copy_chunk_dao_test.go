@@ -0,0 +1,18 @@
+package dao
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestRowCopyChunkDao_FindWaitingByTable(t *testing.T) {
+	rowCopyChunkDao := &RowCopyChunkDao{}
+
+	var taskUUID string = "20180204151900nb6VqFhl"
+	rowCopyChunks, err := rowCopyChunkDao.FindWaitingByTable(taskUUID, "employees", "employees_bak", 0)
+	if err != nil {
+		fmt.Println(err)
+	}
+
+	fmt.Println(rowCopyChunks)
+}
@@ -133,3 +133,17 @@ func (this *SourceDao) UpdateStartLogPosInfo(taskUUID string, startLogFile strin
 
 	return ormDB.Model(&model.Source{}).Where("`task_uuid`=?", taskUUID).Updates(updateSource).Error
 }
+
+/* 更新序列化后的应用位点
+Params:
+	taskUUID: 任务ID
+	applyPosition: 序列化后的位点
+*/
+func (this *SourceDao) UpdateApplyPosition(taskUUID string, applyPosition string) int {
+	ormDB := gdbc.GetOrmInstance()
+
+	affected := ormDB.Model(&model.Source{}).Where("`task_uuid`=?", taskUUID).
+		Update("apply_position", applyPosition).RowsAffected
+
+	return int(affected)
+}
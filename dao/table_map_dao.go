@@ -60,6 +60,22 @@ func (this *TableMapDao) UpdateCurrIDValue(taskUUID, schema, table, jsonData str
 	return int(affected)
 }
 
+/* 更新没有主键的表 row copy 使用的快照位点
+Params:
+    taskUUID: 任务ID
+    schema: 数据库名
+    table: 表名
+    snapshotPosition: 序列化后的快照位点
+*/
+func (this *TableMapDao) UpdateSnapshotPosition(taskUUID, schema, table, snapshotPosition string) int {
+	ormDB := gdbc.GetOrmInstance()
+
+	updateTableMap := model.TableMap{SnapshotPosition: sql.NullString{snapshotPosition, true}}
+	affected := ormDB.Model(&model.TableMap{}).Where("`task_uuid`=? AND `schema`=? AND `source`=?", taskUUID, schema, table).Updates(updateTableMap).RowsAffected
+
+	return int(affected)
+}
+
 /* 跟新表row copy 截止的主键值
 Params:
     taskUUID: 任务ID
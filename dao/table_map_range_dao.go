@@ -0,0 +1,68 @@
+package dao
+
+import (
+	"database/sql"
+	"github.com/daiguadaidai/go-d-bus/gdbc"
+	"github.com/daiguadaidai/go-d-bus/model"
+	"github.com/jinzhu/gorm"
+)
+
+type TableMapRangeDao struct{}
+
+// 获取表拆分后的所有范围, 按范围编号排序
+func (this *TableMapRangeDao) FindByTable(taskUUID string, schema string, table string) ([]*model.TableMapRange, error) {
+	ormDB := gdbc.GetOrmInstance()
+
+	var tableMapRanges []*model.TableMapRange
+	err := ormDB.Where("`task_uuid`=? AND `schema`=? AND `source`=?", taskUUID, schema, table).Order("range_no").Find(&tableMapRanges).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return tableMapRanges, nil
+		}
+		return nil, err
+	}
+
+	return tableMapRanges, nil
+}
+
+// 保存表拆分后的所有范围, 在同一个事务中保存
+func (this *TableMapRangeDao) CreateRanges(tableMapRanges []*model.TableMapRange) error {
+	ormDB := gdbc.GetOrmInstance()
+
+	tx := ormDB.Begin()
+	for _, tableMapRange := range tableMapRanges {
+		if err := tx.Create(tableMapRange).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit().Error
+}
+
+// 标记表的一个范围 row copy 完成
+func (this *TableMapRangeDao) TagRangeRowCopyComplete(taskUUID string, schema string, table string, rangeNo int) int {
+	ormDB := gdbc.GetOrmInstance()
+
+	updateTableMapRange := model.TableMapRange{RowCopyComplete: sql.NullInt64{Int64: 1, Valid: true}}
+	affected := ormDB.Model(&model.TableMapRange{}).Where("`task_uuid`=? AND `schema`=? AND `source`=? AND `range_no`=?", taskUUID, schema, table, rangeNo).Updates(updateTableMapRange).RowsAffected
+
+	return int(affected)
+}
+
+/* 跟新表的一个范围当前row copy 到的主键值
+Params:
+    taskUUID: 任务ID
+    schema: 数据库名
+    table: 表名
+    rangeNo: 范围编号
+    jsonData: 需要更新的数据
+*/
+func (this *TableMapRangeDao) UpdateCurrIDValue(taskUUID, schema, table string, rangeNo int, jsonData string) int {
+	ormDB := gdbc.GetOrmInstance()
+
+	updateTableMapRange := model.TableMapRange{CurrIDValue: sql.NullString{String: jsonData, Valid: true}}
+	affected := ormDB.Model(&model.TableMapRange{}).Where("`task_uuid`=? AND `schema`=? AND `source`=? AND `range_no`=?", taskUUID, schema, table, rangeNo).Updates(updateTableMapRange).RowsAffected
+
+	return int(affected)
+}
@@ -0,0 +1,18 @@
+package dao
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestTableMapRangeDao_FindByTable(t *testing.T) {
+	tableMapRangeDao := &TableMapRangeDao{}
+
+	var taskUUID string = "20180204151900nb6VqFhl"
+	tableMapRanges, err := tableMapRangeDao.FindByTable(taskUUID, "employees", "employees_bak")
+	if err != nil {
+		fmt.Println(err)
+	}
+
+	fmt.Println(tableMapRanges)
+}
@@ -0,0 +1,63 @@
+package dao
+
+import (
+	"github.com/daiguadaidai/go-d-bus/gdbc"
+	"github.com/daiguadaidai/go-d-bus/model"
+	"github.com/jinzhu/gorm"
+)
+
+type TaskThrottleDao struct{}
+
+/* 获取任务的限流设置, 没有返回 nil
+Params:
+    taskUUID: 任务ID
+*/
+func (this *TaskThrottleDao) GetByTaskUUID(taskUUID string) (*model.TaskThrottle, error) {
+	ormDB := gdbc.GetOrmInstance()
+
+	taskThrottle := new(model.TaskThrottle)
+	err := ormDB.Where("`task_uuid`=?", taskUUID).First(taskThrottle).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return taskThrottle, nil
+}
+
+/* 任务没有限流记录则创建一条, 用于保存限流状态
+Params:
+    taskUUID: 任务ID
+*/
+func (this *TaskThrottleDao) FirstOrCreate(taskUUID string) error {
+	ormDB := gdbc.GetOrmInstance()
+
+	taskThrottle := new(model.TaskThrottle)
+	return ormDB.Where("`task_uuid`=?", taskUUID).Attrs(map[string]interface{}{"task_uuid": taskUUID}).
+		FirstOrCreate(taskThrottle).Error
+}
+
+/* 更新任务当前的限流状态
+Params:
+    taskUUID: 任务ID
+    isThrottled: 是否正在限流
+    reason: 限流原因
+*/
+func (this *TaskThrottleDao) UpdateState(taskUUID string, isThrottled bool, reason string) int {
+	ormDB := gdbc.GetOrmInstance()
+
+	throttled := 0
+	if isThrottled {
+		throttled = 1
+	}
+	updateTaskThrottle := map[string]interface{}{
+		"is_throttled":    throttled,
+		"throttle_reason": reason,
+	}
+	affected := ormDB.Model(&model.TaskThrottle{}).Where("`task_uuid`=?", taskUUID).
+		Updates(updateTaskThrottle).RowsAffected
+
+	return int(affected)
+}
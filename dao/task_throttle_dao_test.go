@@ -0,0 +1,18 @@
+package dao
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestTaskThrottleDao_GetByTaskUUID(t *testing.T) {
+	taskThrottleDao := &TaskThrottleDao{}
+
+	var taskUUID string = "20180204151900nb6VqFhl"
+	taskThrottle, err := taskThrottleDao.GetByTaskUUID(taskUUID)
+	if err != nil {
+		fmt.Println(err)
+	}
+
+	fmt.Println(taskThrottle)
+}
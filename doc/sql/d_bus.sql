@@ -38,6 +38,9 @@ CREATE TABLE `data_checksum` (
   `min_id_value` varchar(200) DEFAULT NULL COMMENT 'id范围最小值',
   `max_id_value` varchar(200) DEFAULT NULL COMMENT 'id范围最大值',
   `is_fix` tinyint(4) NOT NULL DEFAULT '0' COMMENT '是否修复',
+  `missing_rows` int(11) DEFAULT NULL COMMENT '修复时发现源有目标没有的行数',
+  `extra_rows` int(11) DEFAULT NULL COMMENT '修复时发现目标有源没有的行数',
+  `diff_rows` int(11) DEFAULT NULL COMMENT '修复时发现源和目标都有但是数据不一致的行数',
   `updated_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
   `created_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
   PRIMARY KEY (`id`),
@@ -49,6 +52,34 @@ CREATE TABLE `data_checksum` (
 ) ENGINE=InnoDB AUTO_INCREMENT=3 DEFAULT CHARSET=utf8mb4;
 /*!40101 SET character_set_client = @saved_cs_client */;
 
+--
+-- Table structure for table `row_copy_chunk`
+--
+
+DROP TABLE IF EXISTS `row_copy_chunk`;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `row_copy_chunk` (
+  `id` bigint(20) NOT NULL AUTO_INCREMENT COMMENT '自增ID',
+  `task_uuid` varchar(22) NOT NULL COMMENT '迁移任务UUID',
+  `schema` varchar(100) NOT NULL COMMENT '源 schema 名称',
+  `source` varchar(100) NOT NULL COMMENT '源 table 名称',
+  `range_no` int(11) NOT NULL DEFAULT '0' COMMENT '表拆分后的第几个范围, 没有拆分为0',
+  `chunk_hash` varchar(30) NOT NULL COMMENT '生成该 chunk 的时间戳',
+  `min_id_value` varchar(200) DEFAULT NULL COMMENT 'chunk 最小主键值',
+  `max_id_value` varchar(200) DEFAULT NULL COMMENT 'chunk 最大主键值',
+  `status` tinyint(4) NOT NULL DEFAULT '0' COMMENT '0: 等待 row copy, 1: row copy 完成',
+  `row_count` int(11) NOT NULL DEFAULT '0' COMMENT 'row copy 的行数',
+  `elapsed_ms` int(11) NOT NULL DEFAULT '0' COMMENT 'row copy 查询和插入的耗时(毫秒)',
+  `updated_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
+  `created_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `udx_uuid_schema_source_hash` (`task_uuid`,`schema`,`source`,`chunk_hash`),
+  KEY `idx_uuid_schema_source_range_status` (`task_uuid`,`schema`,`source`,`range_no`,`status`),
+  KEY `idx_created_at` (`created_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+/*!40101 SET character_set_client = @saved_cs_client */;
+
 --
 -- Table structure for table `schema_map`
 --
@@ -94,6 +125,9 @@ CREATE TABLE `source` (
   `parse_log_pos` bigint(20) DEFAULT NULL COMMENT '解析到binlog应用位点',
   `stop_log_file` varchar(20) DEFAULT NULL COMMENT '停止binlog应用位点',
   `stop_log_pos` bigint(20) DEFAULT NULL COMMENT '停止binlog应用位点',
+  `apply_position` text COMMENT '当前binlog应用位点(序列化的, 包含 GTID 和 server uuid)',
+  `read_host` varchar(15) DEFAULT NULL COMMENT 'row copy 和 checksum 读取数据的从库 host, 为空则读取源实例',
+  `read_port` smallint(6) DEFAULT NULL COMMENT 'row copy 和 checksum 读取数据的从库 port',
   PRIMARY KEY (`id`),
   KEY `idx_task_uuid` (`task_uuid`),
   KEY `idx_created_at` (`created_at`)
@@ -116,6 +150,11 @@ CREATE TABLE `table_map` (
   `row_copy_complete` tinyint(4) NOT NULL DEFAULT '0' COMMENT '表 row copy 是否完成',
   `max_id_value` varchar(200) DEFAULT NULL COMMENT '表需要row copy 到哪一行',
   `curr_id_value` varchar(200) DEFAULT NULL COMMENT '表当前row copy到哪一行',
+  `chunk_column` varchar(100) DEFAULT NULL COMMENT '没有主键和唯一键的表 row copy 分块字段, 为空则在快照中 LIMIT OFFSET 全表扫描',
+  `row_copy_priority` int(11) NOT NULL DEFAULT '0' COMMENT 'row copy 优先级, 调度策略为 priority 时越大越先拷贝',
+  `row_copy_paraller` int(11) NOT NULL DEFAULT '0' COMMENT '该表最多同时进行 row copy 的范围个数, 0 使用任务的设置',
+  `row_copy_split_count` int(11) NOT NULL DEFAULT '0' COMMENT '该表拆分成多少个范围并发 row copy, 0 使用任务的设置',
+  `snapshot_position` text COMMENT '没有主键的表 row copy 使用的快照位点(序列化的), 应用binlog跳过该表在这个位点之前的事务',
   `updated_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
   `created_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
   PRIMARY KEY (`id`),
@@ -125,6 +164,30 @@ CREATE TABLE `table_map` (
 ) ENGINE=InnoDB AUTO_INCREMENT=185 DEFAULT CHARSET=utf8mb4;
 /*!40101 SET character_set_client = @saved_cs_client */;
 
+--
+-- Table structure for table `table_map_range`
+--
+
+DROP TABLE IF EXISTS `table_map_range`;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `table_map_range` (
+  `id` bigint(20) NOT NULL AUTO_INCREMENT COMMENT '自增ID',
+  `task_uuid` varchar(22) NOT NULL COMMENT '迁移任务UUID',
+  `schema` varchar(100) NOT NULL COMMENT '源 schema 名称',
+  `source` varchar(100) NOT NULL COMMENT '源 table 名称',
+  `range_no` int(11) NOT NULL COMMENT '表拆分后的第几个范围',
+  `row_copy_complete` tinyint(4) NOT NULL DEFAULT '0' COMMENT '该范围 row copy 是否完成',
+  `max_id_value` varchar(200) DEFAULT NULL COMMENT '该范围需要row copy 到哪一行',
+  `curr_id_value` varchar(200) DEFAULT NULL COMMENT '该范围当前row copy到哪一行',
+  `updated_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
+  `created_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `udx_uuid_schema_source_range` (`task_uuid`,`schema`,`source`,`range_no`),
+  KEY `created_at` (`created_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+/*!40101 SET character_set_client = @saved_cs_client */;
+
 --
 -- Table structure for table `target`
 --
@@ -179,6 +242,14 @@ CREATE TABLE `task` (
   `binlog_paraller` tinyint(3) unsigned NOT NULL DEFAULT '15' COMMENT '应用binlog 并发数',
   `checksum_paraller` tinyint(3) unsigned NOT NULL DEFAULT '1' COMMENT 'checksum 并发数',
   `checksum_fix_paraller` tinyint(3) unsigned NOT NULL DEFAULT '1' COMMENT 'checksum 修复数据并发数',
+  `row_copy_schedule` varchar(20) DEFAULT NULL COMMENT 'row copy 表调度策略: random, smallest-first, largest-first, priority, round-robin',
+  `row_copy_writer` varchar(20) DEFAULT NULL COMMENT 'row copy 写入目标的方式: insert, load-data',
+  `row_copy_max_rows_per_sec` int(11) DEFAULT NULL COMMENT 'row copy 每秒最多从源读取的行数, 0 不限制, NULL 使用命令行的值, 运行时修改生效',
+  `row_copy_max_bytes_per_sec` bigint(20) DEFAULT NULL COMMENT 'row copy 每秒最多从源读取的字节数, 0 不限制, NULL 使用命令行的值, 运行时修改生效',
+  `binlog_max_rows_per_sec` int(11) DEFAULT NULL COMMENT '应用binlog 每秒最多写入目标的行数, 0 不限制, NULL 使用命令行的值, 运行时修改生效',
+  `queue_high_water_mb` int(11) DEFAULT NULL COMMENT '应用binlog 队列中缓存超过多少MB暂停解析binlog, 0 不检测, NULL 使用默认值 512',
+  `queue_low_water_mb` int(11) DEFAULT NULL COMMENT '应用binlog 队列中缓存少于多少MB继续解析binlog, NULL 使用默认值 256',
+  `checksum_algorithm` varchar(20) DEFAULT NULL COMMENT 'checksum 每行数据使用的 hash 算法: crc32, md5, sha1, sha256. NULL 使用 md5',
   PRIMARY KEY (`id`),
   UNIQUE KEY `udx_task_uuid` (`task_uuid`),
   KEY `idx_name` (`name`),
@@ -238,6 +309,32 @@ CREATE TABLE `task_run_history` (
   KEY `idx_task_uuid` (`task_uuid`)
 ) ENGINE=InnoDB AUTO_INCREMENT=19 DEFAULT CHARSET=utf8mb4 COMMENT='任务启动记录';
 
+--
+-- Table structure for table `task_throttle`
+--
+
+DROP TABLE IF EXISTS `task_throttle`;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `task_throttle` (
+  `id` bigint(20) NOT NULL AUTO_INCREMENT COMMENT '自增ID',
+  `task_uuid` varchar(22) NOT NULL COMMENT '迁移任务UUID',
+  `max_source_threads_running` int(11) DEFAULT NULL COMMENT '源实例 Threads_running 超过该值进行限流, 0 不检测, NULL 使用命令行的值',
+  `max_target_threads_running` int(11) DEFAULT NULL COMMENT '目标实例 Threads_running 超过该值进行限流, 0 不检测, NULL 使用命令行的值',
+  `max_replica_lag` int(11) DEFAULT NULL COMMENT '目标从库延时(秒)超过该值进行限流, 0 不检测, NULL 使用命令行的值',
+  `throttle_replicas` varchar(500) DEFAULT NULL COMMENT '需要检测延时的目标从库, 多个用逗号隔开: host1:port1,host2:port2, NULL 使用命令行的值',
+  `throttle_query` varchar(1000) DEFAULT NULL COMMENT '在目标实例执行的自定义检测sql, 返回值大于0进行限流, NULL 使用命令行的值',
+  `throttle_binlog_apply` tinyint(4) DEFAULT NULL COMMENT '限流时是否暂停应用binlog: 0:否, 1:是, NULL 使用命令行的值',
+  `force_throttle` tinyint(4) NOT NULL DEFAULT '0' COMMENT '手动限流: 0:否, 1:是',
+  `is_throttled` tinyint(4) NOT NULL DEFAULT '0' COMMENT '当前是否正在限流: 0:否, 1:是',
+  `throttle_reason` varchar(500) DEFAULT NULL COMMENT '当前限流的原因',
+  `updated_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
+  `created_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `udx_task_uuid` (`task_uuid`),
+  KEY `idx_created_at` (`created_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='任务限流设置和状态';
+
 CREATE TABLE `binlog_delete_where_external_column` (
     `id` bigint NOT NULL AUTO_INCREMENT COMMENT '自增ID',
     `task_uuid` varchar(22) NOT NULL COMMENT '迁移任务UUID',
@@ -251,4 +348,66 @@ CREATE TABLE `binlog_delete_where_external_column` (
     KEY `idx_uuid_tbl_che_src` (`task_uuid`,`schema`,`table`,`source`),
     KEY `idx_uuid_tbl_che_std` (`task_uuid`,`schema`,`table`,`target`),
     KEY `created_at` (`created_at`)
-) COMMENT='消费binlog delete where条件而外需要的字段';
\ No newline at end of file
+) COMMENT='消费binlog delete where条件而外需要的字段';
+
+CREATE TABLE `checksum_column_rule` (
+    `id` bigint NOT NULL AUTO_INCREMENT COMMENT '自增ID',
+    `task_uuid` varchar(22) NOT NULL COMMENT '迁移任务UUID',
+    `schema` varchar(100) NOT NULL COMMENT '源 schema 名称',
+    `table` varchar(100) NOT NULL COMMENT '源 table 名称',
+    `column` varchar(100) NOT NULL COMMENT '源 column 名称',
+    `side` varchar(10) NOT NULL DEFAULT 'both' COMMENT '规则作用在哪一端: both, source, target',
+    `rule` varchar(20) NOT NULL COMMENT '规则: round, trim, cast, convert_tz, charset, epsilon',
+    `arg` varchar(100) NOT NULL DEFAULT '' COMMENT '规则参数. round: 小数位数, cast: 类型, convert_tz: 源时区,目标时区, charset: 字符集, epsilon: 浮点数相对误差',
+    `updated_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
+    `created_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+    PRIMARY KEY (`id`),
+    KEY `idx_uuid_tbl_col` (`task_uuid`,`schema`,`table`,`column`),
+    KEY `created_at` (`created_at`)
+) COMMENT='checksum 字段规范化规则, 按id顺序生效, 源和目标字段类型等不一样时使用';
+
+CREATE TABLE `checksum_table_stat` (
+    `id` bigint NOT NULL AUTO_INCREMENT COMMENT '自增ID',
+    `task_uuid` varchar(22) NOT NULL COMMENT '迁移任务UUID',
+    `schema` varchar(100) NOT NULL COMMENT '源 schema 名称',
+    `table` varchar(100) NOT NULL COMMENT '源 table 名称',
+    `chunk_count` bigint NOT NULL DEFAULT 0 COMMENT '第一次校验的范围数, 再次校验不算',
+    `diff_chunk_count` bigint NOT NULL DEFAULT 0 COMMENT '第一次校验(包含滚动校验)不一致的范围数',
+    `fixed_chunk_count` bigint NOT NULL DEFAULT 0 COMMENT '修复或再次校验后一致的范围数',
+    `checksum_elapsed_ms` bigint NOT NULL DEFAULT 0 COMMENT '多行校验的耗时(毫秒), 包含再次校验',
+    `fix_elapsed_ms` bigint NOT NULL DEFAULT 0 COMMENT '修复数据的耗时(毫秒)',
+    `updated_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
+    `created_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+    PRIMARY KEY (`id`),
+    UNIQUE KEY `udx_uuid_tbl` (`task_uuid`,`schema`,`table`),
+    KEY `created_at` (`created_at`)
+) COMMENT='每个表 checksum 的统计, 用于生成报告';
+
+CREATE TABLE `checksum_diff_row` (
+    `id` bigint NOT NULL AUTO_INCREMENT COMMENT '自增ID',
+    `task_uuid` varchar(22) NOT NULL COMMENT '迁移任务UUID',
+    `schema` varchar(100) NOT NULL COMMENT '源 schema 名称',
+    `table` varchar(100) NOT NULL COMMENT '源 table 名称',
+    `diff_type` varchar(10) NOT NULL COMMENT '不一致类型. missing: 目标缺少, extra: 目标多出, diff: 数据不一致',
+    `pk_value` varchar(500) NOT NULL COMMENT '主键值, json',
+    `source_row` text COMMENT '修复前源的数据, json',
+    `target_row` text COMMENT '修复前目标的数据, json',
+    `updated_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
+    `created_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+    PRIMARY KEY (`id`),
+    KEY `idx_uuid_tbl` (`task_uuid`,`schema`,`table`),
+    KEY `created_at` (`created_at`)
+) COMMENT='checksum 修复数据时发现的不一致行的样例, 用于生成报告';
+
+-- 开启 --enable-target-checkpoint 后在目标实例中自动创建, 库名和表名可以通过 --target-checkpoint-schema, --target-checkpoint-table 指定
+CREATE TABLE `d_bus_checkpoint` (
+    `task_uuid` varchar(22) NOT NULL COMMENT '迁移任务UUID',
+    `slot` int NOT NULL COMMENT '应用binlog的并发槽',
+    `trx_log_file` varchar(255) NOT NULL COMMENT '事务开始binlog文件, 重启从这里开始解析',
+    `trx_log_pos` bigint NOT NULL COMMENT '事务开始binlog位点',
+    `log_file` varchar(255) NOT NULL COMMENT '已经应用的行所在event的binlog文件',
+    `log_pos` bigint NOT NULL COMMENT '已经应用的行所在event的binlog位点',
+    `row_index` int NOT NULL COMMENT '已经应用的行在event中的下标',
+    `updated_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
+    PRIMARY KEY (`task_uuid`,`slot`)
+) COMMENT='go-d-bus 应用binlog checkpoint';
\ No newline at end of file
@@ -0,0 +1,177 @@
+package matemap
+
+import (
+	"fmt"
+	"github.com/daiguadaidai/go-d-bus/common"
+	"strings"
+)
+
+const (
+	CHECKSUM_ALGORITHM_CRC32  = "crc32"  // 每行 32 位, 速度最快, 行数多时容易碰撞
+	CHECKSUM_ALGORITHM_MD5    = "md5"    // 每行 128 位
+	CHECKSUM_ALGORITHM_SHA1   = "sha1"   // 每行 160 位
+	CHECKSUM_ALGORITHM_SHA256 = "sha256" // 每行 256 位
+
+	CHECKSUM_ALGORITHM_DEFAULT = CHECKSUM_ALGORITHM_MD5
+
+	checksumHexSliceLen = 16 // 16 进制的 hash 值每 16 位转化成一个 64 位无符号整数进行 BIT_XOR
+)
+
+// 每种算法 hash 值的16进制长度, crc32 直接是整数
+var checksumAlgorithmHexLenMap = map[string]int{
+	CHECKSUM_ALGORITHM_CRC32:  0,
+	CHECKSUM_ALGORITHM_MD5:    32,
+	CHECKSUM_ALGORITHM_SHA1:   40,
+	CHECKSUM_ALGORITHM_SHA256: 64,
+}
+
+// 当前任务使用的 checksum 算法, 需要在初始化迁移的表之前设置
+var checksumAlgorithm = CHECKSUM_ALGORITHM_DEFAULT
+
+// 是否是支持的 checksum 算法
+func IsChecksumAlgorithm(_algorithm string) bool {
+	_, ok := checksumAlgorithmHexLenMap[_algorithm]
+
+	return ok
+}
+
+/* 设置 checksum 算法, 需要在初始化迁移的表(InitMigrationTableMap)之前设置
+Params:
+    _algorithm: 算法名称
+*/
+func SetChecksumAlgorithm(_algorithm string) error {
+	if !IsChecksumAlgorithm(_algorithm) {
+		return fmt.Errorf("不支持的 checksum 算法: %v. 可选: %v, %v, %v, %v", _algorithm,
+			CHECKSUM_ALGORITHM_CRC32, CHECKSUM_ALGORITHM_MD5, CHECKSUM_ALGORITHM_SHA1, CHECKSUM_ALGORITHM_SHA256)
+	}
+	checksumAlgorithm = _algorithm
+
+	return nil
+}
+
+// 获取当前使用的 checksum 算法
+func GetChecksumAlgorithm() string {
+	return checksumAlgorithm
+}
+
+/* 生成一行数据拼接后的字符串表达式
+使用 CONCAT_WS 拼接, NULL 值会被跳过, 所以最后再拼接每个字段是否为 NULL 的标记, 如下:
+CONCAT_WS('#', `id`, `name`, `age`, CONCAT(ISNULL(`id`), ISNULL(`name`), ISNULL(`age`)))
+name 为 NULL 和 name 为 '' 拼接出的字符串不一样
+Params:
+    _columnNames: 需要拼接的字段
+*/
+func GetChecksumRowConcatExpr(_columnNames []string) string {
+	return GetChecksumRowConcatExprByExprs(getBackquoteColumnNames(_columnNames))
+}
+
+/* 生成一行数据拼接后的字符串表达式, 每个字段使用的是规范化后的表达式, 如: ROUND(`price`, 2)
+Params:
+    _columnExprs: 需要拼接的字段表达式
+*/
+func GetChecksumRowConcatExprByExprs(_columnExprs []string) string {
+	isNullStrs := make([]string, len(_columnExprs))
+	for i, columnExpr := range _columnExprs {
+		isNullStrs[i] = fmt.Sprintf("ISNULL(%v)", columnExpr)
+	}
+
+	return fmt.Sprintf("CONCAT_WS('#', %v, CONCAT(%v))", strings.Join(_columnExprs, ", "), strings.Join(isNullStrs, ", "))
+}
+
+/* 生成单行数据的 checksum 表达式
+Params:
+    _columnNames: 需要校验的字段
+*/
+func GetChecksumRowExpr(_columnNames []string) string {
+	return GetChecksumRowExprByExprs(getBackquoteColumnNames(_columnNames))
+}
+
+/* 生成单行数据的 checksum 表达式
+Params:
+    _columnExprs: 需要校验的字段表达式
+*/
+func GetChecksumRowExprByExprs(_columnExprs []string) string {
+	rowStr := GetChecksumRowConcatExprByExprs(_columnExprs)
+
+	switch checksumAlgorithm {
+	case CHECKSUM_ALGORITHM_CRC32:
+		return fmt.Sprintf("CRC32(%v)", rowStr)
+	case CHECKSUM_ALGORITHM_SHA1:
+		return fmt.Sprintf("SHA1(%v)", rowStr)
+	case CHECKSUM_ALGORITHM_SHA256:
+		return fmt.Sprintf("SHA2(%v, 256)", rowStr)
+	}
+
+	return fmt.Sprintf("MD5(%v)", rowStr)
+}
+
+/* 生成多行数据的 checksum 表达式, 结果为: 行数:hash值
+每行的 hash 值按 16 位切分转化成 64 位整数后进行 BIT_XOR, 再拼接成16进制字符串.
+BIT_XOR 不会像 SUM 一样让不同行的差异相互抵消, 再加上行数, 行数不同一定不一致
+Params:
+    _columnNames: 需要校验的字段
+*/
+func GetChecksumRowsExpr(_columnNames []string) string {
+	return GetChecksumRowsExprByExprs(getBackquoteColumnNames(_columnNames))
+}
+
+/* 生成多行数据的 checksum 表达式, 和 GetChecksumRowsExpr 一样
+Params:
+    _columnExprs: 需要校验的字段表达式
+*/
+func GetChecksumRowsExprByExprs(_columnExprs []string) string {
+	sliceStrs := getChecksumSliceExprs(_columnExprs)
+	for i, sliceStr := range sliceStrs {
+		sliceStrs[i] = fmt.Sprintf("LPAD(CONV(BIT_XOR(%v), 10, 16), %v, '0')", sliceStr, checksumHexSliceLen)
+	}
+
+	return fmt.Sprintf("CONCAT(COUNT(*), ':', LOWER(CONCAT(%v)))", strings.Join(sliceStrs, ", "))
+}
+
+/* 生成没有主键的表多行数据的 checksum 表达式, 结果为: 行数:hash值
+没有主键的表可能有完全相同的行, BIT_XOR 会让两个相同的行相互抵消, 所以每一段使用 SUM
+Params:
+    _columnExprs: 需要校验的字段表达式
+*/
+func GetChecksumNoKeyRowsExprByExprs(_columnExprs []string) string {
+	sliceStrs := getChecksumSliceExprs(_columnExprs)
+	for i, sliceStr := range sliceStrs {
+		sliceStrs[i] = fmt.Sprintf("COALESCE(SUM(%v), 0)", sliceStr)
+	}
+
+	return fmt.Sprintf("CONCAT(COUNT(*), ':', CONCAT_WS('-', %v))", strings.Join(sliceStrs, ", "))
+}
+
+/* 生成每行 hash 值按 16 位切分后转化成 64 位无符号整数的表达式, crc32 本身就是整数不需要切分
+Params:
+    _columnExprs: 需要校验的字段表达式
+*/
+func getChecksumSliceExprs(_columnExprs []string) []string {
+	rowExpr := GetChecksumRowExprByExprs(_columnExprs)
+
+	hexLen := checksumAlgorithmHexLenMap[checksumAlgorithm]
+	if hexLen == 0 {
+		return []string{rowExpr}
+	}
+
+	sliceStrs := make([]string, 0, hexLen/checksumHexSliceLen+1)
+	for pos := 1; pos <= hexLen; pos += checksumHexSliceLen {
+		sliceLen := checksumHexSliceLen
+		if pos+sliceLen-1 > hexLen {
+			sliceLen = hexLen - pos + 1
+		}
+		sliceStrs = append(sliceStrs, fmt.Sprintf("CAST(CONV(SUBSTRING(%v, %v, %v), 16, 10) AS UNSIGNED)", rowExpr, pos, sliceLen))
+	}
+
+	return sliceStrs
+}
+
+// 字段名加上反引号, 作为字段表达式
+func getBackquoteColumnNames(_columnNames []string) []string {
+	columnExprs := make([]string, len(_columnNames))
+	for i, columnName := range _columnNames {
+		columnExprs[i] = common.GetBackquote(columnName)
+	}
+
+	return columnExprs
+}
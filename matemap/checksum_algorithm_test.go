@@ -0,0 +1,39 @@
+package matemap
+
+import (
+	"testing"
+)
+
+func TestGetChecksumRowsExpr(t *testing.T) {
+	defer SetChecksumAlgorithm(CHECKSUM_ALGORITHM_DEFAULT)
+
+	columnNames := []string{"id", "name"}
+
+	rowStr := GetChecksumRowConcatExpr(columnNames)
+	expect := "CONCAT_WS('#', `id`, `name`, CONCAT(ISNULL(`id`), ISNULL(`name`)))"
+	if rowStr != expect {
+		t.Fatalf("期望 %v, 实际 %v", expect, rowStr)
+	}
+
+	if err := SetChecksumAlgorithm(CHECKSUM_ALGORITHM_CRC32); err != nil {
+		t.Fatal(err)
+	}
+	expect = "CONCAT(COUNT(*), ':', LOWER(CONCAT(LPAD(CONV(BIT_XOR(CRC32(" + rowStr + ")), 10, 16), 16, '0'))))"
+	if rowsStr := GetChecksumRowsExpr(columnNames); rowsStr != expect {
+		t.Fatalf("期望 %v, 实际 %v", expect, rowsStr)
+	}
+
+	// md5 32 位 16 进制切分成 2 段, sha1 40 位切分成 3 段
+	for algorithm, sliceCount := range map[string]int{CHECKSUM_ALGORITHM_MD5: 2, CHECKSUM_ALGORITHM_SHA1: 3, CHECKSUM_ALGORITHM_SHA256: 4} {
+		if err := SetChecksumAlgorithm(algorithm); err != nil {
+			t.Fatal(err)
+		}
+		if slices := getChecksumSliceExprs(columnNames); len(slices) != sliceCount {
+			t.Fatalf("%v 期望切分成 %v 段, 实际 %v 段", algorithm, sliceCount, len(slices))
+		}
+	}
+
+	if err := SetChecksumAlgorithm("crc64"); err == nil {
+		t.Fatalf("不支持的算法应该返回错误")
+	}
+}
@@ -0,0 +1,407 @@
+package matemap
+
+import (
+	"fmt"
+	"github.com/daiguadaidai/go-d-bus/common"
+	"github.com/daiguadaidai/go-d-bus/config"
+	"math"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	CHECKSUM_RULE_ROUND      = "round"      // 四舍五入保留指定的小数位数, 如: 浮点精度不一样
+	CHECKSUM_RULE_TRIM       = "trim"       // 去掉两边的空格, 如: CHAR 转 VARCHAR
+	CHECKSUM_RULE_CAST       = "cast"       // 转化成指定的类型, 如: DATETIME 转 DATETIME(3)
+	CHECKSUM_RULE_CONVERT_TZ = "convert_tz" // 时区转换, 如: 源和目标的 TIMESTAMP 时区不一样
+	CHECKSUM_RULE_CHARSET    = "charset"    // 转化成指定的字符集, 如: 源和目标字符集不一样
+	CHECKSUM_RULE_EPSILON    = "epsilon"    // 在Go中比较浮点数时允许的相对误差, 如: FLOAT 转 DOUBLE. 不会改变 checksum sql
+
+	CHECKSUM_RULE_SIDE_BOTH   = "both"   // 规则作用在源和目标
+	CHECKSUM_RULE_SIDE_SOURCE = "source" // 规则只作用在源
+	CHECKSUM_RULE_SIDE_TARGET = "target" // 规则只作用在目标
+
+	checksumTimeFormat = "2006-01-02 15:04:05.999999"
+)
+
+var (
+	checksumRuleCastArgRegexp     = regexp.MustCompile(`^[A-Za-z]+( *\( *[0-9]+( *, *[0-9]+)? *\))?( +[A-Za-z]+)?$`)
+	checksumRuleTimeZoneRegexp    = regexp.MustCompile(`^[A-Za-z0-9_/+:\-]+$`)
+	checksumRuleCharsetRegexp     = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+	checksumRuleCastDecimalRegexp = regexp.MustCompile(`^DECIMAL *\( *[0-9]+ *, *([0-9]+) *\)$`)
+	checksumRuleCastTimeRegexp    = regexp.MustCompile(`^(DATETIME|TIME) *(\( *([0-9]) *\))?$`)
+
+	checksumTimeLayouts = []string{"2006-01-02 15:04:05.999999999", "2006-01-02", "15:04:05.999999999"}
+)
+
+// checksum 字段规范化规则, 生成 checksum 表达式时对字段进行处理, 让源和目标故意不一样的数据可以比较
+type ChecksumColumnRule struct {
+	Side string // 规则作用在哪一端
+	Rule string // 规则
+	Arg  string // 规则参数
+}
+
+/* 创建并检测一个规则, 参数会拼接到sql中, 只允许简单的格式
+Params:
+    _side: 规则作用在哪一端, 为空则作用在源和目标
+    _rule: 规则
+    _arg: 规则参数
+*/
+func NewChecksumColumnRule(side string, rule string, arg string) (*ChecksumColumnRule, error) {
+	checksumColumnRule := &ChecksumColumnRule{
+		Side: strings.ToLower(strings.TrimSpace(side)),
+		Rule: strings.ToLower(strings.TrimSpace(rule)),
+		Arg:  strings.TrimSpace(arg),
+	}
+
+	switch checksumColumnRule.Side {
+	case "":
+		checksumColumnRule.Side = CHECKSUM_RULE_SIDE_BOTH
+	case CHECKSUM_RULE_SIDE_BOTH, CHECKSUM_RULE_SIDE_SOURCE, CHECKSUM_RULE_SIDE_TARGET:
+	default:
+		return nil, fmt.Errorf("不支持的规则作用端: %v. 可选: %v, %v, %v", side, CHECKSUM_RULE_SIDE_BOTH, CHECKSUM_RULE_SIDE_SOURCE, CHECKSUM_RULE_SIDE_TARGET)
+	}
+
+	switch checksumColumnRule.Rule {
+	case CHECKSUM_RULE_ROUND:
+		if n, err := strconv.Atoi(checksumColumnRule.Arg); err != nil || n < 0 {
+			return nil, fmt.Errorf("round 规则的参数必须是 >= 0 的小数位数: %v", arg)
+		}
+	case CHECKSUM_RULE_TRIM:
+	case CHECKSUM_RULE_CAST:
+		if !checksumRuleCastArgRegexp.MatchString(checksumColumnRule.Arg) {
+			return nil, fmt.Errorf("cast 规则的参数必须是类型, 如: DECIMAL(20, 6), DATETIME(3), CHAR: %v", arg)
+		}
+		checksumColumnRule.Arg = strings.ToUpper(checksumColumnRule.Arg)
+	case CHECKSUM_RULE_CONVERT_TZ:
+		timeZones := strings.Split(checksumColumnRule.Arg, ",")
+		if len(timeZones) != 2 {
+			return nil, fmt.Errorf("convert_tz 规则的参数必须是: 源时区,目标时区. 如: +00:00,+08:00: %v", arg)
+		}
+		for _, timeZone := range timeZones {
+			if _, err := getChecksumLocation(strings.TrimSpace(timeZone)); err != nil || !checksumRuleTimeZoneRegexp.MatchString(strings.TrimSpace(timeZone)) {
+				return nil, fmt.Errorf("convert_tz 规则的时区不正确: %v. %v", timeZone, err)
+			}
+		}
+	case CHECKSUM_RULE_CHARSET:
+		if !checksumRuleCharsetRegexp.MatchString(checksumColumnRule.Arg) {
+			return nil, fmt.Errorf("charset 规则的参数必须是字符集, 如: utf8mb4: %v", arg)
+		}
+	case CHECKSUM_RULE_EPSILON:
+		if epsilon, err := strconv.ParseFloat(checksumColumnRule.Arg, 64); err != nil || epsilon < 0 || epsilon >= 1 {
+			return nil, fmt.Errorf("epsilon 规则的参数必须是 >= 0 并且 < 1 的相对误差, 如: 1e-6: %v", arg)
+		}
+	default:
+		return nil, fmt.Errorf("不支持的规则: %v. 可选: %v, %v, %v, %v, %v, %v", rule,
+			CHECKSUM_RULE_ROUND, CHECKSUM_RULE_TRIM, CHECKSUM_RULE_CAST, CHECKSUM_RULE_CONVERT_TZ, CHECKSUM_RULE_CHARSET, CHECKSUM_RULE_EPSILON)
+	}
+
+	return checksumColumnRule, nil
+}
+
+/* 规则是否作用在指定的一端
+Params:
+    _isSource: 是否是源
+*/
+func (this *ChecksumColumnRule) IsSide(isSource bool) bool {
+	if this.Side == CHECKSUM_RULE_SIDE_BOTH {
+		return true
+	}
+
+	return (this.Side == CHECKSUM_RULE_SIDE_SOURCE) == isSource
+}
+
+/* 生成规范化后的sql表达式, 如: ROUND(`price`, 2)
+Params:
+    _expr: 字段表达式
+*/
+func (this *ChecksumColumnRule) GetSqlExpr(expr string) string {
+	switch this.Rule {
+	case CHECKSUM_RULE_ROUND:
+		return fmt.Sprintf("ROUND(%v, %v)", expr, this.Arg)
+	case CHECKSUM_RULE_TRIM:
+		return fmt.Sprintf("TRIM(%v)", expr)
+	case CHECKSUM_RULE_CAST:
+		return fmt.Sprintf("CAST(%v AS %v)", expr, this.Arg)
+	case CHECKSUM_RULE_CONVERT_TZ:
+		timeZones := strings.Split(this.Arg, ",")
+		return fmt.Sprintf("CONVERT_TZ(%v, '%v', '%v')", expr, strings.TrimSpace(timeZones[0]), strings.TrimSpace(timeZones[1]))
+	case CHECKSUM_RULE_CHARSET:
+		return fmt.Sprintf("CONVERT(%v USING %v)", expr, this.Arg)
+	}
+
+	return expr
+}
+
+/* 在Go中对字段值进行规范化, 和 GetSqlExpr 的处理一样, 用于在Go中比较数据
+Params:
+    _value: 字段的值
+*/
+func (this *ChecksumColumnRule) ApplyGo(value interface{}) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+	valueStr := GetChecksumValueString(value)
+
+	switch this.Rule {
+	case CHECKSUM_RULE_ROUND:
+		n, _ := strconv.Atoi(this.Arg)
+		return roundChecksumNumber(valueStr, n)
+	case CHECKSUM_RULE_TRIM:
+		return strings.Trim(valueStr, " "), nil
+	case CHECKSUM_RULE_CAST:
+		if matches := checksumRuleCastDecimalRegexp.FindStringSubmatch(this.Arg); matches != nil {
+			n, _ := strconv.Atoi(matches[1])
+			return roundChecksumNumber(valueStr, n)
+		}
+		if strings.HasPrefix(this.Arg, "SIGNED") || strings.HasPrefix(this.Arg, "UNSIGNED") {
+			return roundChecksumNumber(valueStr, 0)
+		}
+		if this.Arg == "DATE" {
+			t, err := parseChecksumTime(valueStr)
+			if err != nil {
+				return nil, err
+			}
+			return t.Format("2006-01-02"), nil
+		}
+		if matches := checksumRuleCastTimeRegexp.FindStringSubmatch(this.Arg); matches != nil {
+			t, err := parseChecksumTime(valueStr)
+			if err != nil {
+				return nil, err
+			}
+			n, _ := strconv.Atoi(matches[3])
+			return t.Round(time.Duration(math.Pow10(9 - n))).Format(checksumTimeFormat), nil
+		}
+		return valueStr, nil
+	case CHECKSUM_RULE_CONVERT_TZ:
+		timeZones := strings.Split(this.Arg, ",")
+		fromLocation, _ := getChecksumLocation(strings.TrimSpace(timeZones[0]))
+		toLocation, _ := getChecksumLocation(strings.TrimSpace(timeZones[1]))
+		t, err := time.ParseInLocation(checksumTimeLayouts[0], valueStr, fromLocation)
+		if err != nil {
+			return nil, fmt.Errorf("convert_tz 规则解析时间失败. %v. %v", valueStr, err)
+		}
+		return t.In(toLocation).Format(checksumTimeFormat), nil
+	}
+
+	// 查询结果都是连接的字符集, 不需要转换. epsilon 在比较的时候使用
+	return value, nil
+}
+
+// epsilon 规则允许的相对误差, 其他规则为 0
+func (this *ChecksumColumnRule) GetFloatEpsilon() float64 {
+	if this.Rule != CHECKSUM_RULE_EPSILON {
+		return 0
+	}
+
+	epsilon, _ := strconv.ParseFloat(this.Arg, 64)
+	return epsilon
+}
+
+/* 获取需要迁移的表字段的 checksum 规范化规则, key 为源字段名
+Params:
+    _configMap: 配置信息
+    _schemaName: 源数据库名称
+    _tableName: 源表名称
+    _sourceColumns: 源表的所有列
+*/
+func GetChecksumColumnRules(configMap *config.ConfigMap, schemaName string, tableName string, sourceColumns []Column) (map[string][]*ChecksumColumnRule, error) {
+	columnRules := make(map[string][]*ChecksumColumnRule)
+
+	for _, sourceColumn := range sourceColumns {
+		columnKey := config.GetColumnKey(schemaName, tableName, sourceColumn.Name)
+		for _, rule := range configMap.ChecksumColumnRuleMap[columnKey] {
+			checksumColumnRule, err := NewChecksumColumnRule(rule.Side.String, rule.Rule.String, rule.Arg.String)
+			if err != nil {
+				return nil, fmt.Errorf("checksum 字段规范化规则不正确. %v.%v.%v, %v", schemaName, tableName, sourceColumn.Name, err)
+			}
+			columnRules[sourceColumn.Name] = append(columnRules[sourceColumn.Name], checksumColumnRule)
+		}
+	}
+
+	return columnRules, nil
+}
+
+/* 获取需要迁移的字段规范化后的 checksum 表达式, 没有规则的字段就是加了反引号的字段名
+Params:
+    _isSource: 是否是源
+*/
+func (this *Table) FindChecksumColumnExprs(isSource bool) []string {
+	sourceColumnNames := this.FindUsefulColumnNames()
+	columnNames := sourceColumnNames
+	if !isSource {
+		columnNames = this.FindTargetUsefulColumnNames()
+	}
+
+	columnExprs := make([]string, len(columnNames))
+	for i, columnName := range columnNames {
+		columnExprs[i] = common.GetBackquote(columnName)
+		for _, rule := range this.ChecksumColumnRules[sourceColumnNames[i]] {
+			if rule.IsSide(isSource) {
+				columnExprs[i] = rule.GetSqlExpr(columnExprs[i])
+			}
+		}
+	}
+
+	return columnExprs
+}
+
+/* 在Go中比较源和目标的一行数据(需要迁移的字段), 先对字段值进行规范化, 再按源字段的类型宽容的比较
+Params:
+    _sourceRow: 源的一行数据
+    _targetRow: 目标的一行数据
+Return:
+    1. 是否一致
+    2. 第一个不一致的源字段名
+    3. 错误
+*/
+func (this *Table) CompareChecksumRow(sourceRow []interface{}, targetRow []interface{}) (bool, string, error) {
+	if len(sourceRow) != len(this.SourceUsefulColumns) || len(targetRow) != len(this.SourceUsefulColumns) {
+		return false, "", fmt.Errorf("比较的数据字段数不一样. 需要迁移的字段数: %v, 源: %v, 目标: %v",
+			len(this.SourceUsefulColumns), len(sourceRow), len(targetRow))
+	}
+
+	for i, sourceUsefulColumnIndex := range this.SourceUsefulColumns {
+		column := this.SourceColumns[sourceUsefulColumnIndex]
+
+		sourceValue, targetValue := sourceRow[i], targetRow[i]
+		var epsilon float64
+		var err error
+		for _, rule := range this.ChecksumColumnRules[column.Name] {
+			if rule.Rule == CHECKSUM_RULE_EPSILON {
+				epsilon = rule.GetFloatEpsilon()
+				continue
+			}
+
+			if rule.IsSide(true) {
+				if sourceValue, err = rule.ApplyGo(sourceValue); err != nil {
+					return false, column.Name, fmt.Errorf("源字段 %v. %v", column.Name, err)
+				}
+			}
+			if rule.IsSide(false) {
+				if targetValue, err = rule.ApplyGo(targetValue); err != nil {
+					return false, column.Name, fmt.Errorf("目标字段 %v. %v", column.Name, err)
+				}
+			}
+		}
+
+		if !CompareChecksumValue(sourceValue, targetValue, column, epsilon) {
+			return false, column.Name, nil
+		}
+	}
+
+	return true, "", nil
+}
+
+/* 按源字段的类型宽容的比较两个值:
+数字类型比较数值(1 和 1.00 一致, 浮点数允许指定的相对误差), 时间类型比较时间(2020-01-01 和 2020-01-01 00:00:00.000 一致),
+其他类型比较字符串
+Params:
+    _sourceValue: 源的值
+    _targetValue: 目标的值
+    _column: 源字段
+    _epsilon: 浮点数允许的相对误差, 0 则数值必须相等
+*/
+func CompareChecksumValue(sourceValue interface{}, targetValue interface{}, column Column, epsilon float64) bool {
+	if sourceValue == nil || targetValue == nil {
+		return sourceValue == nil && targetValue == nil
+	}
+	sourceStr, targetStr := GetChecksumValueString(sourceValue), GetChecksumValueString(targetValue)
+	if sourceStr == targetStr {
+		return true
+	}
+
+	switch column.Type {
+	case common.MYSQL_TYPE_TINYINT, common.MYSQL_TYPE_SMALLINT, common.MYSQL_TYPE_MEDIUMINT, common.MYSQL_TYPE_INT,
+		common.MYSQL_TYPE_BIGINT, common.MYSQL_TYPE_DECIMAL, common.MYSQL_TYPE_YEAR:
+		_, isSourceFloat := sourceValue.(float64)
+		_, isTargetFloat := targetValue.(float64)
+		if isSourceFloat || isTargetFloat {
+			return compareChecksumFloat(sourceStr, targetStr, epsilon)
+		}
+		sourceRat, ok1 := new(big.Rat).SetString(sourceStr)
+		targetRat, ok2 := new(big.Rat).SetString(targetStr)
+		return ok1 && ok2 && sourceRat.Cmp(targetRat) == 0
+	case common.MYSQL_TYPE_FLOAT, common.MYSQL_TYPE_DOUBLE:
+		return compareChecksumFloat(sourceStr, targetStr, epsilon)
+	case common.MYSQL_TYPE_DATE, common.MYSQL_TYPE_TIME, common.MYSQL_TYPE_DATETIME, common.MYSQL_TYPE_TIMESTAMP:
+		sourceTime, err1 := parseChecksumTime(sourceStr)
+		targetTime, err2 := parseChecksumTime(targetStr)
+		return err1 == nil && err2 == nil && sourceTime.Equal(targetTime)
+	}
+
+	return false
+}
+
+/* 获取值的字符串, 用于比较
+Params:
+    _value: 字段的值
+*/
+func GetChecksumValueString(value interface{}) string {
+	switch v := value.(type) {
+	case []byte:
+		return string(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32)
+	}
+
+	return fmt.Sprintf("%v", value)
+}
+
+// 比较两个浮点数, 允许 epsilon 的相对误差
+func compareChecksumFloat(sourceStr string, targetStr string, epsilon float64) bool {
+	sourceFloat, err1 := strconv.ParseFloat(sourceStr, 64)
+	targetFloat, err2 := strconv.ParseFloat(targetStr, 64)
+	if err1 != nil || err2 != nil {
+		return false
+	}
+
+	diff := math.Abs(sourceFloat - targetFloat)
+	return diff <= epsilon*math.Max(1, math.Max(math.Abs(sourceFloat), math.Abs(targetFloat)))
+}
+
+// 数字四舍五入保留 n 位小数, 返回字符串和 MySQL ROUND 的结果格式一样
+func roundChecksumNumber(valueStr string, n int) (string, error) {
+	rat, ok := new(big.Rat).SetString(valueStr)
+	if !ok {
+		return "", fmt.Errorf("不是数字, 不能四舍五入. %v", valueStr)
+	}
+
+	// big.Rat.FloatString 是四舍五入(远离0)的
+	return rat.FloatString(n), nil
+}
+
+// 解析时间字符串, 支持日期, 时间和日期时间
+func parseChecksumTime(valueStr string) (time.Time, error) {
+	var err error
+	for _, layout := range checksumTimeLayouts {
+		var t time.Time
+		if t, err = time.Parse(layout, valueStr); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("不是时间格式. %v. %v", valueStr, err)
+}
+
+// 获取时区, 支持 +08:00 格式和时区名称
+func getChecksumLocation(timeZone string) (*time.Location, error) {
+	if strings.HasPrefix(timeZone, "+") || strings.HasPrefix(timeZone, "-") {
+		t, err := time.Parse("-07:00", timeZone)
+		if err != nil {
+			return nil, err
+		}
+		_, offset := t.Zone()
+		return time.FixedZone(timeZone, offset), nil
+	}
+	if strings.ToUpper(timeZone) == "SYSTEM" {
+		return time.Local, nil
+	}
+
+	return time.LoadLocation(timeZone)
+}
@@ -0,0 +1,162 @@
+package matemap
+
+import (
+	"github.com/daiguadaidai/go-d-bus/common"
+	"testing"
+)
+
+func newChecksumRuleTestTable(t *testing.T) *Table {
+	roundRule, err := NewChecksumColumnRule("", "round", "2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tzRule, err := NewChecksumColumnRule("source", "convert_tz", "+00:00,+08:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	trimRule, err := NewChecksumColumnRule("target", "trim", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &Table{
+		SourceSchema: "test",
+		SourceName:   "order",
+		TargetSchema: "test",
+		TargetName:   "order_new",
+		SourceColumns: []Column{
+			{Name: "id", Type: common.MYSQL_TYPE_INT},
+			{Name: "price", Type: common.MYSQL_TYPE_DOUBLE},
+			{Name: "created", Type: common.MYSQL_TYPE_TIMESTAMP},
+			{Name: "name", Type: common.MYSQL_TYPE_VARCHAR},
+		},
+		SourceUsefulColumns:         []int{0, 1, 2, 3},
+		SourceToTargetColumnNameMap: map[string]string{"id": "id", "price": "amount", "created": "created", "name": "name"},
+		ChecksumColumnRules: map[string][]*ChecksumColumnRule{
+			"price":   {roundRule},
+			"created": {tzRule},
+			"name":    {trimRule},
+		},
+	}
+}
+
+func TestNewChecksumColumnRule(t *testing.T) {
+	for _, args := range [][]string{
+		{"both", "round", "-1"},
+		{"both", "cast", "CHAR); DROP TABLE t; --"},
+		{"both", "convert_tz", "+08:00"},
+		{"both", "convert_tz", "+00:00,'+08:00'"},
+		{"both", "charset", "utf8mb4 COLLATE x"},
+		{"both", "lower", ""},
+		{"all", "trim", ""},
+		{"both", "epsilon", "abc"},
+		{"both", "epsilon", "-1e-6"},
+		{"both", "epsilon", "1"},
+	} {
+		if _, err := NewChecksumColumnRule(args[0], args[1], args[2]); err == nil {
+			t.Fatalf("不正确的规则应该返回错误: %v", args)
+		}
+	}
+
+	rule, err := NewChecksumColumnRule("", "cast", "decimal(20, 6)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rule.Side != CHECKSUM_RULE_SIDE_BOTH || rule.Arg != "DECIMAL(20, 6)" {
+		t.Fatalf("规则解析不正确: %#v", rule)
+	}
+}
+
+func TestTable_FindChecksumColumnExprs(t *testing.T) {
+	table := newChecksumRuleTestTable(t)
+
+	sourceExprs := table.FindChecksumColumnExprs(true)
+	expect := []string{"`id`", "ROUND(`price`, 2)", "CONVERT_TZ(`created`, '+00:00', '+08:00')", "`name`"}
+	if common.ToJsonStr(sourceExprs) != common.ToJsonStr(expect) {
+		t.Fatalf("期望 %v, 实际 %v", expect, sourceExprs)
+	}
+
+	targetExprs := table.FindChecksumColumnExprs(false)
+	expect = []string{"`id`", "ROUND(`amount`, 2)", "`created`", "TRIM(`name`)"}
+	if common.ToJsonStr(targetExprs) != common.ToJsonStr(expect) {
+		t.Fatalf("期望 %v, 实际 %v", expect, targetExprs)
+	}
+}
+
+func TestTable_CompareChecksumRow(t *testing.T) {
+	table := newChecksumRuleTestTable(t)
+
+	sourceRow := []interface{}{int64(1), float64(1.005), "2020-01-01 00:00:00", "a"}
+	targetRow := []interface{}{uint64(1), "1.01", "2020-01-01 08:00:00.000", "a  "}
+	isConsistent, columnName, err := table.CompareChecksumRow(sourceRow, targetRow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isConsistent {
+		t.Fatalf("规范化后应该一致, 不一致的字段: %v", columnName)
+	}
+
+	targetRow[2] = "2020-01-01 00:00:00"
+	if isConsistent, columnName, _ = table.CompareChecksumRow(sourceRow, targetRow); isConsistent || columnName != "created" {
+		t.Fatalf("created 没有转换时区应该不一致, 实际: %v %v", isConsistent, columnName)
+	}
+}
+
+func TestTable_CompareChecksumRow_Epsilon(t *testing.T) {
+	table := &Table{
+		SourceColumns:               []Column{{Name: "id", Type: common.MYSQL_TYPE_INT}, {Name: "rate", Type: common.MYSQL_TYPE_FLOAT}},
+		SourceUsefulColumns:         []int{0, 1},
+		SourceToTargetColumnNameMap: map[string]string{"id": "id", "rate": "rate"},
+		ChecksumColumnRules:         map[string][]*ChecksumColumnRule{},
+	}
+	sourceRow := []interface{}{int64(1), float64(0.1)}
+	targetRow := []interface{}{int64(1), float64(0.10000000149011612)}
+
+	// 没有 epsilon 规则, 浮点数必须相等
+	if isConsistent, columnName, _ := table.CompareChecksumRow(sourceRow, targetRow); isConsistent || columnName != "rate" {
+		t.Fatalf("没有 epsilon 规则应该不一致, 实际: %v %v", isConsistent, columnName)
+	}
+
+	epsilonRule, err := NewChecksumColumnRule("", "epsilon", "1e-6")
+	if err != nil {
+		t.Fatal(err)
+	}
+	table.ChecksumColumnRules["rate"] = []*ChecksumColumnRule{epsilonRule}
+	if isConsistent, columnName, _ := table.CompareChecksumRow(sourceRow, targetRow); !isConsistent {
+		t.Fatalf("有 epsilon 规则应该一致, 不一致的字段: %v", columnName)
+	}
+
+	// epsilon 规则不改变 checksum sql
+	if exprs := table.FindChecksumColumnExprs(true); exprs[1] != "`rate`" {
+		t.Fatalf("epsilon 规则不应该改变 checksum 表达式, 实际 %v", exprs)
+	}
+}
+
+func TestCompareChecksumValue(t *testing.T) {
+	cases := []struct {
+		source  interface{}
+		target  interface{}
+		column  Column
+		epsilon float64
+		expect  bool
+	}{
+		{int64(1), uint64(1), Column{Type: common.MYSQL_TYPE_INT}, 0, true},
+		{"1.50", "1.500", Column{Type: common.MYSQL_TYPE_DECIMAL}, 0, true},
+		{"1.50", "1.51", Column{Type: common.MYSQL_TYPE_DECIMAL}, 0, false},
+		{float64(0.1), float64(0.10000000149011612), Column{Type: common.MYSQL_TYPE_FLOAT}, 0, false},
+		{float64(0.1), float64(0.10000000149011612), Column{Type: common.MYSQL_TYPE_FLOAT}, 1e-6, true},
+		{float64(0.1), "0.1", Column{Type: common.MYSQL_TYPE_DOUBLE}, 0, true},
+		{float64(1.5), float64(1.6), Column{Type: common.MYSQL_TYPE_DOUBLE}, 1e-6, false},
+		{"2020-01-01 00:00:00", "2020-01-01 00:00:00.000", Column{Type: common.MYSQL_TYPE_DATETIME}, 0, true},
+		{"2020-01-01", "2020-01-01 00:00:00", Column{Type: common.MYSQL_TYPE_DATE}, 0, true},
+		{"007", "7", Column{Type: common.MYSQL_TYPE_VARCHAR}, 0, false},
+		{nil, "", Column{Type: common.MYSQL_TYPE_VARCHAR}, 0, false},
+		{nil, nil, Column{Type: common.MYSQL_TYPE_VARCHAR}, 0, true},
+	}
+
+	for _, c := range cases {
+		if CompareChecksumValue(c.source, c.target, c.column, c.epsilon) != c.expect {
+			t.Fatalf("比较 %#v 和 %#v 期望 %v", c.source, c.target, c.expect)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package matemap
+
+import (
+	"fmt"
+)
+
+const (
+	CHECKSUM_LEVEL_COUNT   = "count" // 每个范围只比较行数
+	CHECKSUM_LEVEL_CRC     = "crc"   // 每个范围比较行数和每行 hash 值的 BIT_XOR
+	CHECKSUM_LEVEL_FULL    = "full"  // 和 crc 一样. 所有级别都会比较每个表源和目标的最小和最大主键值, 保留用于兼容
+	CHECKSUM_LEVEL_DEFAULT = CHECKSUM_LEVEL_CRC
+)
+
+var checksumLevel = CHECKSUM_LEVEL_DEFAULT
+
+// 是否是支持的 checksum 级别
+func IsChecksumLevel(_level string) bool {
+	switch _level {
+	case CHECKSUM_LEVEL_COUNT, CHECKSUM_LEVEL_CRC, CHECKSUM_LEVEL_FULL:
+		return true
+	}
+
+	return false
+}
+
+/* 设置 checksum 级别, 需要在初始化迁移的表(InitMigrationTableMap)之前设置
+Params:
+    _level: 级别名称
+*/
+func SetChecksumLevel(_level string) error {
+	if !IsChecksumLevel(_level) {
+		return fmt.Errorf("不支持的 checksum 级别: %v. 可选: %v, %v, %v", _level,
+			CHECKSUM_LEVEL_COUNT, CHECKSUM_LEVEL_CRC, CHECKSUM_LEVEL_FULL)
+	}
+	checksumLevel = _level
+
+	return nil
+}
+
+// 获取当前使用的 checksum 级别
+func GetChecksumLevel() string {
+	return checksumLevel
+}
+
+/* 按 checksum 级别生成多行 checksum 的表达式, count 级别只有行数, 其他的结果为: 行数:hash值
+二分修复数据时需要 hash 值找到不一致的行, 不使用该表达式
+Params:
+    _columnExprs: 需要校验的字段表达式
+*/
+func GetChecksumRowsExprByLevel(_columnExprs []string) string {
+	if checksumLevel == CHECKSUM_LEVEL_COUNT {
+		return "COUNT(*)"
+	}
+
+	return GetChecksumRowsExprByExprs(_columnExprs)
+}
+
+// 按 checksum 级别生成没有主键的表整表 checksum 的表达式, count 级别只有行数
+func GetChecksumNoKeyRowsExprByLevel(_columnExprs []string) string {
+	if checksumLevel == CHECKSUM_LEVEL_COUNT {
+		return "COUNT(*)"
+	}
+
+	return GetChecksumNoKeyRowsExprByExprs(_columnExprs)
+}
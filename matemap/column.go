@@ -19,6 +19,8 @@ type Column struct {
 
 	EnumValues []string // 枚举的值
 	SetValues  []string // 集合的值
+
+	Collation string // 字符串字段的排序规则, 其他类型为空
 }
 
 /* 创建一个行的列
@@ -146,3 +148,19 @@ func CreateColumn(_columnName string, _columnType string, _extra string, _ordina
 
 	return column
 }
+
+/* 字段的值是否可以按字节比较是否相等.
+非字符串字段, binary 和 _bin 排序规则可以, 大小写或重音不敏感的排序规则(如: utf8mb4_general_ci)不同的字节可能相等
+*/
+func (this *Column) IsBinaryCollation() bool {
+	collation := strings.ToLower(this.Collation)
+
+	return collation == "" || collation == "binary" || strings.HasSuffix(collation, "_bin")
+}
+
+// 比较字段的值时是否忽略结尾的空格(PAD SPACE), MySQL 8.0 的 _0900_ 排序规则和 binary 不忽略
+func (this *Column) IsPadSpace() bool {
+	collation := strings.ToLower(this.Collation)
+
+	return collation != "" && collation != "binary" && !strings.Contains(collation, "_0900_")
+}
@@ -14,3 +14,55 @@ func TestNewColumn(t *testing.T) {
 	fmt.Println(column)
 
 }
+
+func TestColumn_Collation(t *testing.T) {
+	cases := []struct {
+		collation string
+		binary    bool
+		padSpace  bool
+	}{
+		{"", true, false},
+		{"binary", true, false},
+		{"utf8mb4_bin", true, true},
+		{"utf8mb4_0900_bin", true, false},
+		{"utf8mb4_general_ci", false, true},
+		{"utf8mb4_0900_ai_ci", false, false},
+		{"utf8mb4_0900_as_cs", false, false},
+	}
+
+	for _, c := range cases {
+		column := Column{Collation: c.collation}
+		if column.IsBinaryCollation() != c.binary || column.IsPadSpace() != c.padSpace {
+			t.Fatalf("%v: 期望按字节比较 %v, 忽略结尾空格 %v", c.collation, c.binary, c.padSpace)
+		}
+	}
+}
+
+func TestTable_IsApplyBinlogBySingleSlot(t *testing.T) {
+	table := &Table{
+		SourceColumns:        []Column{{Name: "id"}, {Name: "code", Collation: "utf8mb4_bin"}, {Name: "name", Collation: "utf8mb4_general_ci"}},
+		SourcePKColumns:      []int{0},
+		SourceUKIndexColumns: [][]int{{0}, {1}},
+	}
+	if table.IsApplyBinlogBySingleSlot() {
+		t.Fatal("主键和唯一键都可以按字节比较, 不需要放到同一个并发槽中")
+	}
+	if columnNames := table.FindNonBinaryKeyColumnNames(); len(columnNames) != 0 {
+		t.Fatalf("主键和唯一键都可以按字节比较, 实际 %v", columnNames)
+	}
+
+	// 大小写不敏感的唯一键, 键值规范化后判断是否冲突, 不需要放到同一个并发槽中
+	table.SourceUKIndexColumns = append(table.SourceUKIndexColumns, []int{2})
+	if table.IsApplyBinlogBySingleSlot() {
+		t.Fatal("唯一键大小写不敏感, 不需要放到同一个并发槽中")
+	}
+	if columnNames := table.FindNonBinaryKeyColumnNames(); len(columnNames) != 1 || columnNames[0] != "name(utf8mb4_general_ci)" {
+		t.Fatalf("期望 [name(utf8mb4_general_ci)], 实际 %v", columnNames)
+	}
+
+	table.SourceUKIndexColumns = nil
+	table.NoUniqueKey = true
+	if !table.IsApplyBinlogBySingleSlot() {
+		t.Fatal("没有主键和唯一键, 需要放到同一个并发槽中")
+	}
+}
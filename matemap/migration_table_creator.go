@@ -133,6 +133,11 @@ func NewTable(configMap *config.ConfigMap, schemaName string, tableName string)
 	}
 	logger.M.Infof("成功. 生成Binlog Delete Where条件额外的字段. %v.%v", table.SourceSchema, table.SourceName)
 
+	// 添加 checksum 字段规范化规则
+	if table.ChecksumColumnRules, err = GetChecksumColumnRules(configMap, table.SourceSchema, table.SourceName, sourceColumns); err != nil {
+		return nil, err
+	}
+
 	// 生成 最终需要使用到的 列, 一个表有多个列, 但是同步时可能, 只需要同步其中几个列就好了.
 	table.InitSourceUsefulColumns()
 	logger.M.Infof("成功. 生成需要迁移的字段. %v.%v", table.SourceSchema, table.SourceName)
@@ -143,6 +148,13 @@ func NewTable(configMap *config.ConfigMap, schemaName string, tableName string)
 	}
 	logger.M.Infof("成功. 获得可用的主键. %v.%v %v", table.SourceSchema, table.SourceName, sourcePkColumnNames)
 
+	// 没有主键和唯一键的表, 初始化 row copy 分块字段
+	if len(sourcePkColumnNames) == 0 {
+		if err = InitNoKeyTableChunkColumn(configMap, table, tableKey); err != nil {
+			return nil, err
+		}
+	}
+
 	// 通过可用的 (主键/唯一键), 初始化该表迁移时需要的主键
 	table.InitSourcePKColumns(sourcePkColumnNames)
 	logger.M.Infof("成功. 初始化源表的主键. %v.%v", table.SourceSchema, table.SourceName)
@@ -166,6 +178,13 @@ func NewTable(configMap *config.ConfigMap, schemaName string, tableName string)
 		return nil, err
 	}
 
+	// 获取表每个主键/唯一键的字段, 应用binlog时检测冲突
+	uKIndexColumnNames, err := FindSourceUKIndexColumnNames(configMap.Source.Host.String, int(configMap.Source.Port.Int64), schemaName, tableName)
+	if err != nil {
+		return nil, err
+	}
+	table.InitSourceUKIndexColumnsByNames(uKIndexColumnNames)
+
 	// 设置目标表的建表 sql
 	targetCreateTableSql, err := GetTargetCreateTableSql(configMap, table)
 	if err != nil {
@@ -208,7 +227,8 @@ func GetSourceTableColumns(schemaName string, tableName string, host string, por
             COLUMN_NAME,
             ORDINAL_POSITION,
             COLUMN_TYPE,
-            EXTRA
+            EXTRA,
+            COLLATION_NAME
         FROM information_schema.COLUMNS
         WHERE TABLE_SCHEMA = ?
             AND TABLE_NAME = ?
@@ -237,12 +257,14 @@ func GetSourceTableColumns(schemaName string, tableName string, host string, por
 		var ordinalPosition sql.NullInt64
 		var columnType sql.NullString
 		var extra sql.NullString
+		var collationName sql.NullString
 
-		if err := rows.Scan(&tableSchema, &tableNameScan, &columnName, &ordinalPosition, &columnType, &extra); err != nil {
+		if err := rows.Scan(&tableSchema, &tableNameScan, &columnName, &ordinalPosition, &columnType, &extra, &collationName); err != nil {
 			return nil, fmt.Errorf("scan表字段出错. %v.%v. %v", schemaName, tableName, err)
 		}
 
 		column := CreateColumn(columnName.String, columnType.String, extra.String, int(ordinalPosition.Int64))
+		column.Collation = collationName.String
 
 		columns = append(columns, column)
 		logger.M.Infof("成功. 添加表字段 %v.%v.%v", schemaName, tableName, columnName.String)
@@ -329,7 +351,7 @@ func FindSourcePKColumnNames(configMap *config.ConfigMap, table *Table) ([]strin
 
 	// 判断主键列是有在不迁移打字段中, 如果主键列是否在需要迁移打列中
 	// 否则继续查找 唯一键
-	if len(pkColumnNames) >= 0 {
+	if len(pkColumnNames) > 0 {
 		logger.M.Infof("成功. 获取到所有的主键列 %v.%v %v", table.SourceSchema, table.SourceName, pkColumnNames)
 		pkInUsefulColumn := true
 		// 判断所有的主键列是否都在需要迁移打列中
@@ -361,9 +383,10 @@ func FindSourcePKColumnNames(configMap *config.ConfigMap, table *Table) ([]strin
 		return nil, err
 	}
 
-	// 该表没有唯一键则返回错误, 因为迁移必须要有唯一, 或主键
+	// 该表没有唯一键, 返回空, 使用没有主键的方式迁移
 	if len(uniqueNames) == 0 {
-		return nil, fmt.Errorf("失败. 该表没有主键和可以用的唯一键. %v.%v %v:%v", table.SourceSchema, table.SourceName, configMap.Source.Host.String, configMap.Source.Port.Int64)
+		logger.M.Warnf("警告. 该表没有主键和唯一键, 将使用没有主键的方式迁移. %v.%v %v:%v", table.SourceSchema, table.SourceName, configMap.Source.Host.String, configMap.Source.Port.Int64)
+		return []string{}, nil
 	}
 
 	// 获取能用的唯一键列名称, 并且可用的唯一键就是主键
@@ -397,7 +420,82 @@ func FindSourcePKColumnNames(configMap *config.ConfigMap, table *Table) ([]strin
 		}
 	}
 
-	return nil, fmt.Errorf("失败. 该表没有主键和可以用的唯一键. %v.%v %v:%v", table.SourceSchema, table.SourceName, configMap.Source.Host.String, configMap.Source.Port.Int64)
+	logger.M.Warnf("警告. 该表没有可以用的主键和唯一键, 将使用没有主键的方式迁移. %v.%v %v:%v", table.SourceSchema, table.SourceName, configMap.Source.Host.String, configMap.Source.Port.Int64)
+	return []string{}, nil
+}
+
+/* 初始化没有主键和唯一键的表的 row copy 分块字段
+Params:
+    _configMap: 映射元数据信息
+    _table: 需要迁移的表
+    _tableKey: 表在 table_map 中的 key
+*/
+func InitNoKeyTableChunkColumn(configMap *config.ConfigMap, table *Table, tableKey string) error {
+	table.NoUniqueKey = true
+
+	chunkColumn := configMap.TableMapMap[tableKey].ChunkColumn
+	if !chunkColumn.Valid || strings.TrimSpace(chunkColumn.String) == "" {
+		logger.M.Warnf("警告. 该表没有主键和唯一键, 也没有指定分块字段, row copy 将在快照中使用 LIMIT OFFSET 全表扫描. %v.%v",
+			table.SourceSchema, table.SourceName)
+		return nil
+	}
+
+	// 分块字段必须是需要迁移的字段
+	columnName := strings.TrimSpace(chunkColumn.String)
+	columnIndex, ok := table.SourceColumnIndexMap[columnName]
+	if !ok {
+		return fmt.Errorf("失败. 指定的分块字段在表中不存在. %v.%v.%v", table.SourceSchema, table.SourceName, columnName)
+	}
+	if !common.HasElem(table.SourceUsefulColumns, columnIndex) {
+		return fmt.Errorf("失败. 指定的分块字段不是需要迁移的字段. %v.%v.%v", table.SourceSchema, table.SourceName, columnName)
+	}
+
+	// 分块字段没有索引每次分块都会全表扫描
+	isIndexed, err := IsIndexFirstColumn(configMap.Source.Host.String, int(configMap.Source.Port.Int64), table.SourceSchema, table.SourceName, columnName)
+	if err != nil {
+		return err
+	}
+	if !isIndexed {
+		logger.M.Warnf("警告. 指定的分块字段不是索引的第一个字段, row copy 每次分块都会全表扫描. %v.%v.%v",
+			table.SourceSchema, table.SourceName, columnName)
+	}
+
+	table.ChunkColumn = columnName
+	logger.M.Infof("成功. 该表没有主键和唯一键, row copy 将使用分块字段. %v.%v.%v", table.SourceSchema, table.SourceName, columnName)
+
+	return nil
+}
+
+/* 判断字段是否是某个索引的第一个字段
+Params:
+    _host: 实例host
+    _port: 实例port
+    _schemaName: 数据库名称
+    _tableName: 表名称
+    _columnName: 字段名称
+*/
+func IsIndexFirstColumn(host string, port int, schemaName string, tableName string, columnName string) (bool, error) {
+	instance, ok := gdbc.GetDynamicDBByHostPort(host, int64(port))
+	if !ok {
+		return false, fmt.Errorf("缓存中不存在该实例(%v:%v). 获取字段是否有索引. %v.%v", host, port, schemaName, tableName)
+	}
+
+	selectSql := `
+        SELECT
+            COUNT(*)
+        FROM INFORMATION_SCHEMA.STATISTICS
+        WHERE TABLE_SCHEMA = ?
+            AND TABLE_NAME = ?
+            AND COLUMN_NAME = ?
+            AND SEQ_IN_INDEX = 1
+    `
+
+	var count sql.NullInt64
+	if err := instance.QueryRow(selectSql, schemaName, tableName, columnName).Scan(&count); err != nil {
+		return false, fmt.Errorf("失败. 获取字段是否有索引. %v.%v.%v %v:%v. %v", schemaName, tableName, columnName, host, port, err)
+	}
+
+	return count.Int64 > 0, nil
 }
 
 /* 获取指定表的主键名称
@@ -588,6 +686,41 @@ func FindSourceDistinctUKColumnNames(host string, port int, schemaName string, t
 	return distinctUK, nil
 }
 
+/* 获取表每个主键/唯一键包含的列
+Params:
+    _host: 实例host
+    _port: 实例port
+    _schemaName: 数据库名称
+    _tableName: 表名称
+*/
+func FindSourceUKIndexColumnNames(host string, port int, schemaName string, tableName string) ([][]string, error) {
+	uKIndexColumnNames := make([][]string, 0, 1)
+
+	pkColumnNames, err := FindPKColumnNames(host, port, schemaName, tableName)
+	if err != nil {
+		return nil, err
+	}
+	if len(pkColumnNames) > 0 {
+		uKIndexColumnNames = append(uKIndexColumnNames, pkColumnNames)
+	}
+
+	uniqueNames, err := FindUniqueNames(host, port, schemaName, tableName)
+	if err != nil {
+		return nil, err
+	}
+	for _, uniqueName := range uniqueNames {
+		uniqueColumnNames, err := FindUniqueColumnNames(host, port, schemaName, tableName, uniqueName)
+		if err != nil {
+			return nil, err
+		}
+		if len(uniqueColumnNames) > 0 {
+			uKIndexColumnNames = append(uKIndexColumnNames, uniqueColumnNames)
+		}
+	}
+
+	return uKIndexColumnNames, nil
+}
+
 /* 获得创建目标表语句
 如果该表有不需要迁移的列:
     1. 现在源实例库中创建一个匿名表 _dbus_xxx_c 的表
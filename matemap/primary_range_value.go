@@ -17,6 +17,8 @@ type PrimaryRangeValue struct {
 	MinValue      map[string]interface{} // 一个范围最小的主键ID值
 	MaxValue      map[string]interface{} // 一个范围最大的主键ID值
 	NextValue     map[string]interface{} // 下一个访问开始当主键ID值
+	RangeKey      string                 // 表拆分成多个范围 row copy 时所属的范围: schema.table#1, 没有拆分为空
+	IsRecheck     bool                   // 是否是修复后需要再次校验的范围, 不算在第一次校验的范围数中
 }
 
 /*获取新的PrimaryRangeValue
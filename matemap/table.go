@@ -15,6 +15,7 @@ type Table struct {
 	SourceAllUKColumns                     []int          // 原 所有的唯一键字段, 最终不重复
 	SourceColumnIndexMap                   map[string]int // 列名和 sourceColumns index 的映射, key:列名, value: 列所在的位置
 	SourceBinlogDeleteWhereExternalColumns []int          // 消费Binlog Delete Where 条件额外需要的字段 所在位置
+	SourceUKIndexColumns                   [][]int        // 源 每个主键/唯一键的字段, 应用binlog时检测同一个键值的行是否冲突
 
 	BinlogDeleteWhereExternalColumns []Column // 消费Binlog Delete Where 条件额外需要的字段, 字段名称是目标表的字段名
 
@@ -32,6 +33,11 @@ type Table struct {
 	SourceIgnoreColumns []int // 不进行同步的列
 	SourceUsefulColumns []int // 最终进行语句平凑操作的列, 最终使用的列
 
+	NoUniqueKey bool   // 表没有主键和可用的唯一键
+	ChunkColumn string // 没有主键的表 row copy 分块字段, 为空则使用 LIMIT OFFSET 全表扫描
+
+	ChecksumColumnRules map[string][]*ChecksumColumnRule // checksum 字段规范化规则, key 为源字段名
+
 	targetCreateTableSql      string // 创建目标表sql语句的 sql
 	targetDropTableSql        string // 删除目标表语句 sql
 	selFirstPKSqlTpl          string // 查询第一条记录  主键/唯一键 值 sql 模板
@@ -39,6 +45,7 @@ type Table struct {
 	selPerBatchMaxPKSqlTpl    string // 每批查询表最大 主键/唯一键 值 sql 模板
 	selCurrAndNextPkSqlTpl    string // 获取当前和下一批主键值sql模板
 	selPerBatchSqlTpl         string // 每批查询获取数据的sql, row copy 所用 sql 模板
+	selPerBatchTargetSqlTpl   string // 目标每批查询获取数据的sql, checksum 在Go中比较数据时使用
 	insIgrBatchSqlTpl         string // insert ignore into 批量 sql 模板
 	repPerBatchSqlTpl         string // replace into 批量 insert 数据 sql 模板
 	insOnDupUpdateBatchSqlTpl string // insert into values() on duplicate update
@@ -49,7 +56,10 @@ type Table struct {
 	selSourceRowsCheckSqlTpl  string // 源实例 多行 checksum sql 模板
 	selTargetRowsCheckSqlTpl  string // 目标 多行 checksum sql 模板
 	selPerBatchSourcePKSqlTpl string // 源实例每批查询主键值的sql, 用于checksum修复每行数据的时候使用
+	selPerBatchTargetPKSqlTpl string // 目标每批查询主键值的sql, 用于checksum修复时发现目标多出的行
 	selSourceRowSqlTpl        string // 通过主键获取源表一行数据 sql 模板
+	selTargetRowSqlTpl        string // 通过主键获取目标表一行数据 sql 模板, 用于生成修复sql时记录修复前的数据
+	selNoKeyOffsetSqlTpl      string // 没有主键的表 LIMIT OFFSET 获取数据 sql 模板
 }
 
 // 初始化 源 列映射关系, 通过源列
@@ -130,6 +140,61 @@ func (this *Table) InitSourceAllUKColumnsByNames(_uKColumnNames []string) error
 	return nil
 }
 
+/* 初始化表每个主键/唯一键的字段, 表中不存在的字段的键忽略
+Params:
+    _uKIndexColumnNames: 每个主键/唯一键的字段名
+*/
+func (this *Table) InitSourceUKIndexColumnsByNames(_uKIndexColumnNames [][]string) {
+	this.SourceUKIndexColumns = make([][]int, 0, len(_uKIndexColumnNames))
+
+	for _, columnNames := range _uKIndexColumnNames {
+		columnIndexes := make([]int, 0, len(columnNames))
+		for _, columnName := range columnNames {
+			columnIndex, ok := this.SourceColumnIndexMap[columnName]
+			if !ok {
+				break
+			}
+			columnIndexes = append(columnIndexes, columnIndex)
+		}
+		if len(columnIndexes) == 0 || len(columnIndexes) != len(columnNames) {
+			continue
+		}
+
+		this.SourceUKIndexColumns = append(this.SourceUKIndexColumns, columnIndexes)
+	}
+}
+
+/* 应用binlog时该表的行是否都放到同一个并发槽中.
+没有主键和唯一键, 不能通过键值判断不同的行是否冲突
+*/
+func (this *Table) IsApplyBinlogBySingleSlot() bool {
+	return this.NoUniqueKey
+}
+
+/* 获取主键/唯一键中不能按字节比较的字段(如: 大小写不敏感), 这些字段的键值需要按排序规则规范化才能判断不同的行是否冲突.
+规范化不了的键值(非 ASCII 字符)的行应用binlog时需要等待其他并发槽中该表的行都应用完
+*/
+func (this *Table) FindNonBinaryKeyColumnNames() []string {
+	columnIndexes := make([]int, 0, len(this.SourcePKColumns))
+	columnIndexes = append(columnIndexes, this.SourcePKColumns...)
+	for _, ukColumnIndexes := range this.SourceUKIndexColumns {
+		columnIndexes = append(columnIndexes, ukColumnIndexes...)
+	}
+
+	columnNames := make([]string, 0)
+	columnNameMap := make(map[string]bool)
+	for _, columnIndex := range columnIndexes {
+		column := this.SourceColumns[columnIndex]
+		if column.IsBinaryCollation() || columnNameMap[column.Name] {
+			continue
+		}
+		columnNameMap[column.Name] = true
+		columnNames = append(columnNames, fmt.Sprintf("%v(%v)", column.Name, column.Collation))
+	}
+
+	return columnNames
+}
+
 func (this *Table) InitTargetAllUKColumnsBySourceUKNames(_sourceUKColumnNames []string) error {
 	if len(_sourceUKColumnNames) < 1 {
 		return fmt.Errorf("初始化目标表所有的唯一键字段失败, 没有指定唯一键. 这种情况, 可能是你的源表没有唯一键.这不符合工具使用的要求. 请检查 %v:%v", this.SourceSchema, this.SourceName)
@@ -320,9 +385,15 @@ func (this *Table) InitALLSqlTpl() {
 	// 每批查询获取数据的sql, row copy 所用 sql 模板
 	this.InitSelPerBatchSqlTpl()
 
+	// 目标每批查询获取数据的sql, checksum 在Go中比较数据时使用
+	this.InitSelPerBatchTargetSqlTpl()
+
 	// 初始化 源表每批主键sql模板
 	this.InitSelPerBatchSourcePKSqlTpl()
 
+	// 初始化 目标表每批主键sql模板
+	this.InitSelPerBatchTargetPKSqlTpl()
+
 	// 初始化 insert ignore into 批量 sql 模板
 	this.InitInsIgrBatchSqlTpl()
 
@@ -352,6 +423,14 @@ func (this *Table) InitALLSqlTpl() {
 
 	// 初始化目标 多行 checksum sql 模板
 	this.InitSelSourceRowSqlTpl()
+
+	// 初始化 通过主键获取目标表一行数据 sql 模板
+	this.InitSelTargetRowSqlTpl()
+
+	// 没有主键的表, 初始化需要的 sql 模板, 并且 checksum 改为整表校验
+	if this.NoUniqueKey {
+		this.InitNoKeySqlTpl()
+	}
 }
 
 /* 初始化目标键表语句
@@ -499,6 +578,33 @@ func (this *Table) InitSelPerBatchSqlTpl() {
 		wherePlaceholderStr, pkFieldsStr, wherePlaceholderStr)
 }
 
+// 目标每批查询获取数据的sql, 和 row copy 所用 sql 一样, checksum 在Go中比较数据时使用
+func (this *Table) InitSelPerBatchTargetSqlTpl() {
+	selectSql := `
+        /* go-d-bus */ SELECT /*!40001 SQL_NO_CACHE */
+            %v
+        FROM %v
+        WHERE (%v) >= (%v)
+            AND (%v) <= (%v)
+    `
+
+	// 获取需要迁移的字段名称
+	usefulColumnNames := this.FindTargetUsefulColumnNames()
+	// 获取主键名称
+	pkColumnNames := this.FindTargetPKColumnNames()
+	// 获取所有需要迁移的字段 字符串
+	fieldsStr := common.FormatColumnNameStr(usefulColumnNames, "`, `")
+	// 获取 目标表名
+	tableName := common.FormatTableName(this.TargetSchema, this.TargetName, "`")
+	// 获取 主键字段 字符串
+	pkFieldsStr := common.FormatColumnNameStr(pkColumnNames, "`, `")
+	// 获取 Where 中需要的值的占位符
+	wherePlaceholderStr := common.CreatePlaceholderByCount(len(pkColumnNames))
+
+	this.selPerBatchTargetSqlTpl = fmt.Sprintf(selectSql, fieldsStr, tableName, pkFieldsStr,
+		wherePlaceholderStr, pkFieldsStr, wherePlaceholderStr)
+}
+
 // 每批查询获取主键值的sql 模板
 func (this *Table) InitSelPerBatchSourcePKSqlTpl() {
 	selectSql := `
@@ -623,32 +729,53 @@ func (this *Table) InitDelSqlTpl() {
 	this.delSqlTpl = fmt.Sprintf(deleteSql, tableName, pkFieldsStr, wherePlaceholderStr, externalWhere)
 }
 
+// 目标每批查询获取主键值的sql 模板, 占位符的值和源表一样
+func (this *Table) InitSelPerBatchTargetPKSqlTpl() {
+	selectSql := `
+        /* go-d-bus */ SELECT /*!40001 SQL_NO_CACHE */
+            %v
+        FROM %v
+        WHERE (%v) >= (%v)
+            AND (%v) <= (%v)
+    `
+
+	// 获取目标主键名称
+	pkColumnNames := this.FindTargetPKColumnNames()
+	// 获取所有需要迁移的字段 字符串
+	fieldsStr := common.FormatColumnNameStr(pkColumnNames, "`, `")
+	// 获取 目标表名
+	tableName := common.FormatTableName(this.TargetSchema, this.TargetName, "`")
+	// 获取 主键字段 字符串
+	pkFieldsStr := common.FormatColumnNameStr(pkColumnNames, "`, `")
+	// 获取 Where 中需要的值的占位符
+	wherePlaceholderStr := common.CreatePlaceholderByCount(len(pkColumnNames))
+
+	this.selPerBatchTargetPKSqlTpl = fmt.Sprintf(selectSql, fieldsStr, tableName, pkFieldsStr,
+		wherePlaceholderStr, pkFieldsStr, wherePlaceholderStr)
+}
+
 /* 初始化源 单行数据 checksum sql 模板
-把多个字段拼凑称一个字段并且使用 '#' 井号隔开, 如下显示:
+把多个字段使用 CONCAT_WS 拼凑称一个字段, 再拼接每个字段是否为 NULL 的标记, 使用任务指定的算法计算 hash 值, 如下显示:
 id, name, age
-SELECT RCR32(CONCAT(
-    `id`, '#', `name`, '#', `age`
+SELECT MD5(CONCAT_WS('#',
+    `id`, `name`, `age`, CONCAT(ISNULL(`id`), ISNULL(`name`), ISNULL(`age`))
 ))
 FROM xxx
 WHERE id = xxx
-使用 CONCAT 后的值: id#name#age
 */
 func (this *Table) InitSelSourceRowChecksumSqlTpl() {
 	selectSql := `
         /* go-d-bus checksum row source */ SELECT /*!40001 SQL_NO_CACHE */
-        CRC32(CONCAT(
-            %v
-        ))
+        %v
         FROM %v
         WHERE (%v) = (%v)
     `
 
 	// 获取需要迁移的字段名称
-	usefulColumnNames := this.FindUsefulColumnNames()
 	// 获取主键名称
 	pkColumnNames := this.FindSourcePKColumnNames()
-	// 获取所有需要迁移的字段 字符串
-	fieldsStr := common.FormatColumnNameStr(usefulColumnNames, "`, '#', `")
+	// 获取所有需要迁移的字段规范化后的 checksum 表达式
+	fieldsStr := GetChecksumRowExprByExprs(this.FindChecksumColumnExprs(true))
 	// 获取 源表名
 	tableName := common.FormatTableName(this.SourceSchema, this.SourceName, "`")
 	// 获取 主键字段 字符串
@@ -665,19 +792,16 @@ func (this *Table) InitSelSourceRowChecksumSqlTpl() {
 func (this *Table) InitSelTargetRowChecksumSqlTpl() {
 	selectSql := `
         /* go-d-bus checksum row target */ SELECT /*!40001 SQL_NO_CACHE */
-        CRC32(CONCAT(
-            %v
-        ))
+        %v
         FROM %v
         WHERE (%v) = (%v)
     `
 
 	// 获取需要迁移的字段名称
-	usefulColumnNames := this.FindTargetUsefulColumnNames()
 	// 获取主键名称
 	pkColumnNames := this.FindTargetPKColumnNames()
-	// 获取所有需要迁移的字段 字符串
-	fieldsStr := common.FormatColumnNameStr(usefulColumnNames, "`, '#', `")
+	// 获取所有需要迁移的字段规范化后的 checksum 表达式
+	fieldsStr := GetChecksumRowExprByExprs(this.FindChecksumColumnExprs(false))
 	// 获取 源表名
 	tableName := common.FormatTableName(this.TargetSchema, this.TargetName, "`")
 	// 获取 主键字段 字符串
@@ -690,32 +814,29 @@ func (this *Table) InitSelTargetRowChecksumSqlTpl() {
 }
 
 /* 初始化源 多行行数据 checksum sql 模板
-把多个字段拼凑称一个字段并且使用 '#' 井号隔开, 如下显示:
+每行的 hash 值和单行 checksum 一样, 切分成 64 位整数后 BIT_XOR, 再加上行数, 如下显示:
 id, name, age
-SELECT SUM(RCR32(CONCAT(
-    id, "#", name, "#", age
+SELECT CONCAT(COUNT(*), ':', LOWER(CONCAT(
+    LPAD(CONV(BIT_XOR(CAST(CONV(SUBSTRING(MD5(...), 1, 16), 16, 10) AS UNSIGNED)), 10, 16), 16, '0'),
+    LPAD(CONV(BIT_XOR(CAST(CONV(SUBSTRING(MD5(...), 17, 16), 16, 10) AS UNSIGNED)), 10, 16), 16, '0')
 )))
 FROM xxx
-WHERE id = xxx
-使用 CONCAT 后的值: id#name#age
+WHERE id >= xxx AND id <= xxx
 */
 func (this *Table) InitSelSourceRowsChecksumSqlTpl() {
 	selectSql := `
         /* go-d-bus checksum rows source */ SELECT /*!40001 SQL_NO_CACHE */
-        SUM(CRC32(CONCAT(
-            %v
-        )))
+        %v
         FROM %v
         WHERE (%v) >= (%v)
             AND (%v) <= (%v)
     `
 
 	// 获取需要迁移的字段名称
-	usefulColumnNames := this.FindUsefulColumnNames()
 	// 获取主键名称
 	pkColumnNames := this.FindSourcePKColumnNames()
-	// 获取所有需要迁移的字段 字符串
-	fieldsStr := common.FormatColumnNameStr(usefulColumnNames, "`, '#', `")
+	// 获取所有需要迁移的字段规范化后的 checksum 表达式, count 级别只比较行数
+	fieldsStr := GetChecksumRowsExprByLevel(this.FindChecksumColumnExprs(true))
 	// 获取 源表名
 	tableName := common.FormatTableName(this.SourceSchema, this.SourceName, "`")
 	// 获取 主键字段 字符串
@@ -733,20 +854,17 @@ func (this *Table) InitSelSourceRowsChecksumSqlTpl() {
 func (this *Table) InitSelTargetRowsChecksumSqlTpl() {
 	selectSql := `
         /* go-d-bus checksum row target */ SELECT /*!40001 SQL_NO_CACHE */
-        SUM(CRC32(CONCAT(
-            %v
-        )))
+        %v
         FROM %v
         WHERE (%v) >= (%v)
             AND (%v) <= (%v)
     `
 
 	// 获取需要迁移的字段名称
-	usefulColumnNames := this.FindTargetUsefulColumnNames()
 	// 获取主键名称
 	pkColumnNames := this.FindTargetPKColumnNames()
-	// 获取所有需要迁移的字段 字符串
-	fieldsStr := common.FormatColumnNameStr(usefulColumnNames, "`, '#', `")
+	// 获取所有需要迁移的字段规范化后的 checksum 表达式, count 级别只比较行数
+	fieldsStr := GetChecksumRowsExprByLevel(this.FindChecksumColumnExprs(false))
 	// 获取 源表名
 	tableName := common.FormatTableName(this.TargetSchema, this.TargetName, "`")
 	// 获取 主键字段 字符串
@@ -782,6 +900,31 @@ func (this *Table) InitSelSourceRowSqlTpl() {
 	this.selSourceRowSqlTpl = fmt.Sprintf(selectSql, fieldsStr, tableName, pkFieldsStr, wherePlaceholderStr)
 }
 
+// 初始化 通过主键值获取目标表数据 sql 模板, 占位符的值和源表一样
+func (this *Table) InitSelTargetRowSqlTpl() {
+	selectSql := `
+        /* go-d-bus */ SELECT /*!40001 SQL_NO_CACHE */
+            %v
+        FROM %v
+        WHERE (%v) = (%v)
+    `
+
+	// 获取目标需要迁移的字段名称
+	usefulColumnNames := this.FindTargetUsefulColumnNames()
+	// 获取目标主键名称
+	pkColumnNames := this.FindTargetPKColumnNames()
+	// 获取所有需要迁移的字段 字符串
+	fieldsStr := common.FormatColumnNameStr(usefulColumnNames, "`, `")
+	// 获取 目标表名
+	tableName := common.FormatTableName(this.TargetSchema, this.TargetName, "`")
+	// 获取 主键字段 字符串
+	pkFieldsStr := common.FormatColumnNameStr(pkColumnNames, "`, `")
+	// 获取 Where 中需要的值的占位符
+	wherePlaceholderStr := common.CreatePlaceholderByCount(len(pkColumnNames))
+
+	this.selTargetRowSqlTpl = fmt.Sprintf(selectSql, fieldsStr, tableName, pkFieldsStr, wherePlaceholderStr)
+}
+
 func (this *Table) InitSourceBinlogDeleteWhereExternalColumns() error {
 	if len(this.BinlogDeleteWhereExternalColumns) == 0 {
 		return nil
@@ -871,6 +1014,11 @@ func (this *Table) GetSelPerBatchSqlTpl() string {
 	return this.selPerBatchSqlTpl
 }
 
+// 获取 目标每一批 select的数据 sql
+func (this *Table) GetSelPerBatchTargetSqlTpl() string {
+	return this.selPerBatchTargetSqlTpl
+}
+
 /*获取 insert ignore sql模板
 Params:
     _rowCount: 行数
@@ -969,11 +1117,21 @@ func (this *Table) GetSelPerBatchSourcePKSqlTpl() string {
 	return this.selPerBatchSourcePKSqlTpl
 }
 
+// 获取目标表 主键 范围所有值的sql
+func (this *Table) GetSelPerBatchTargetPKSqlTpl() string {
+	return this.selPerBatchTargetPKSqlTpl
+}
+
 // 获取源实例表 主键 范围所有值的sql
 func (this *Table) GetSelSourceRowSqlTpl() string {
 	return this.selSourceRowSqlTpl
 }
 
+// 获取通过主键获取目标表一行数据的sql
+func (this *Table) GetSelTargetRowSqlTpl() string {
+	return this.selTargetRowSqlTpl
+}
+
 // 获取源表主键数据类型
 func (this *Table) FindSourcePKColumnTypes() []int {
 	pkColumnsTypes := make([]int, len(this.SourcePKColumns))
@@ -0,0 +1,89 @@
+package matemap
+
+import (
+	"fmt"
+	"github.com/daiguadaidai/go-d-bus/common"
+	"strconv"
+	"strings"
+)
+
+/* 获取二分范围的表名和主键名
+Params:
+    _isSource: 是否是源表
+*/
+func (this *Table) getBisectTableInfo(_isSource bool) (string, []string) {
+	if _isSource {
+		return common.FormatTableName(this.SourceSchema, this.SourceName, "`"), this.FindSourcePKColumnNames()
+	}
+
+	return common.FormatTableName(this.TargetSchema, this.TargetName, "`"), this.FindTargetPKColumnNames()
+}
+
+/* 获取二分查找不一致数据时范围的 where 条件
+每次二分的范围是 [min, max] 或者 [min, max), 拆分点左边的范围不包含拆分点.
+源表和目标表使用同一个范围, 只在目标存在的行也会落在某个范围中.
+占位符的值都是 最小值..., 最大值..., 和多行 checksum 一样
+Params:
+    _pkColumnNames: 主键名
+    _isMaxExclusive: 是否不包含最大值
+*/
+func getBisectWhereStr(_pkColumnNames []string, _isMaxExclusive bool) string {
+	pkFieldsStr := common.FormatColumnNameStr(_pkColumnNames, "`, `")
+	wherePlaceholderStr := common.CreatePlaceholderByCount(len(_pkColumnNames))
+
+	maxOp := "<="
+	if _isMaxExclusive {
+		maxOp = "<"
+	}
+
+	return fmt.Sprintf("(%v) >= (%v) AND (%v) %v (%v)", pkFieldsStr, wherePlaceholderStr, pkFieldsStr, maxOp, wherePlaceholderStr)
+}
+
+/* 获取二分范围多行数据 checksum 的 sql, 结果和多行 checksum 一样: 行数:hash值
+Params:
+    _isSource: 是否是源表
+    _isMaxExclusive: 是否不包含最大值
+*/
+func (this *Table) GetBisectRowsChecksumSql(_isSource bool, _isMaxExclusive bool) string {
+	tableName, pkColumnNames := this.getBisectTableInfo(_isSource)
+
+	return fmt.Sprintf("/* go-d-bus checksum bisect */ SELECT /*!40001 SQL_NO_CACHE */ %v FROM %v WHERE %v",
+		GetChecksumRowsExprByExprs(this.FindChecksumColumnExprs(_isSource)), tableName, getBisectWhereStr(pkColumnNames, _isMaxExclusive))
+}
+
+/* 获取二分范围中所有主键值的 sql
+Params:
+    _isSource: 是否是源表
+    _isMaxExclusive: 是否不包含最大值
+*/
+func (this *Table) GetBisectPKSql(_isSource bool, _isMaxExclusive bool) string {
+	tableName, pkColumnNames := this.getBisectTableInfo(_isSource)
+
+	return fmt.Sprintf("/* go-d-bus checksum bisect */ SELECT /*!40001 SQL_NO_CACHE */ %v FROM %v WHERE %v ORDER BY %v",
+		common.FormatColumnNameStr(pkColumnNames, "`, `"), tableName, getBisectWhereStr(pkColumnNames, _isMaxExclusive),
+		common.FormatOrderByStr(pkColumnNames, "ASC"))
+}
+
+/* 获取二分范围中第 offset 行主键值的 sql, 作为拆分点
+Params:
+    _isSource: 是否是源表
+    _isMaxExclusive: 是否不包含最大值
+    _offset: 第几行, 从 0 开始
+*/
+func (this *Table) GetBisectSplitPKSql(_isSource bool, _isMaxExclusive bool, _offset int) string {
+	return fmt.Sprintf("%v LIMIT %v, 1", this.GetBisectPKSql(_isSource, _isMaxExclusive), _offset)
+}
+
+/* 获取多行 checksum 值中的行数
+Params:
+    _checksumCode: 多行 checksum 值. 行数:hash值
+*/
+func GetChecksumCodeRowCount(_checksumCode string) int {
+	items := strings.SplitN(_checksumCode, ":", 2)
+	count, err := strconv.Atoi(items[0])
+	if err != nil {
+		return 0
+	}
+
+	return count
+}
@@ -0,0 +1,38 @@
+package matemap
+
+import (
+	"testing"
+)
+
+func TestTable_GetBisectSql(t *testing.T) {
+	defer SetChecksumAlgorithm(CHECKSUM_ALGORITHM_DEFAULT)
+	if err := SetChecksumAlgorithm(CHECKSUM_ALGORITHM_CRC32); err != nil {
+		t.Fatal(err)
+	}
+
+	table := &Table{
+		SourceSchema:                "test",
+		SourceName:                  "t",
+		TargetSchema:                "test",
+		TargetName:                  "t_new",
+		SourceColumns:               []Column{{Name: "id"}, {Name: "name"}},
+		SourcePKColumns:             []int{0},
+		SourceUsefulColumns:         []int{0, 1},
+		SourceToTargetColumnNameMap: map[string]string{"id": "new_id", "name": "name"},
+	}
+
+	expect := "/* go-d-bus checksum bisect */ SELECT /*!40001 SQL_NO_CACHE */ `new_id` FROM `test`.`t_new` WHERE (`new_id`) >= (?) AND (`new_id`) < (?) ORDER BY `new_id` ASC LIMIT 10, 1"
+	if splitSql := table.GetBisectSplitPKSql(false, true, 10); splitSql != expect {
+		t.Fatalf("期望 %v, 实际 %v", expect, splitSql)
+	}
+
+	expect = "/* go-d-bus checksum bisect */ SELECT /*!40001 SQL_NO_CACHE */ " + GetChecksumRowsExpr([]string{"id", "name"}) +
+		" FROM `test`.`t` WHERE (`id`) >= (?) AND (`id`) <= (?)"
+	if checksumSql := table.GetBisectRowsChecksumSql(true, false); checksumSql != expect {
+		t.Fatalf("期望 %v, 实际 %v", expect, checksumSql)
+	}
+
+	if count := GetChecksumCodeRowCount("120:00000000abcdef12"); count != 120 {
+		t.Fatalf("期望行数 120, 实际 %v", count)
+	}
+}
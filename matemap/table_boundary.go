@@ -0,0 +1,43 @@
+package matemap
+
+import (
+	"fmt"
+	"github.com/daiguadaidai/go-d-bus/common"
+)
+
+/* 获取表第一条或者最后一条记录主键值的 sql, 用于比较源和目标的最小和最大主键值
+Params:
+    _isSource: 是否是源表
+    _isLast: 是否获取最后一条
+*/
+func (this *Table) GetBoundaryPKSql(_isSource bool, _isLast bool) string {
+	tableName, pkColumnNames := this.getBisectTableInfo(_isSource)
+
+	ascDesc := "ASC"
+	if _isLast {
+		ascDesc = "DESC"
+	}
+
+	return fmt.Sprintf("/* go-d-bus checksum boundary */ SELECT /*!40001 SQL_NO_CACHE */ %v FROM %v ORDER BY %v LIMIT 1",
+		common.FormatColumnNameStr(pkColumnNames, "`, `"), tableName, common.FormatOrderByStr(pkColumnNames, ascDesc))
+}
+
+/* 获取目标表中超出源表主键范围的最远一行主键值的 sql, 即: 小于源表最小主键值的第一行, 或者大于源表最大主键值的最后一行.
+主键范围都是从源表生成的, 超出源表主键范围的目标行不会被任何范围校验到
+占位符的值是源表最小(或最大)的主键值
+Params:
+    _isLast: 是否是大于源表最大主键值
+*/
+func (this *Table) GetTargetOutOfBoundaryPKSql(_isLast bool) string {
+	tableName, pkColumnNames := this.getBisectTableInfo(false)
+	pkFieldsStr := common.FormatColumnNameStr(pkColumnNames, "`, `")
+	wherePlaceholderStr := common.CreatePlaceholderByCount(len(pkColumnNames))
+
+	op, ascDesc := "<", "ASC"
+	if _isLast {
+		op, ascDesc = ">", "DESC"
+	}
+
+	return fmt.Sprintf("/* go-d-bus checksum boundary */ SELECT /*!40001 SQL_NO_CACHE */ %v FROM %v WHERE (%v) %v (%v) ORDER BY %v LIMIT 1",
+		pkFieldsStr, tableName, pkFieldsStr, op, wherePlaceholderStr, common.FormatOrderByStr(pkColumnNames, ascDesc))
+}
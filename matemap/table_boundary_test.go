@@ -0,0 +1,51 @@
+package matemap
+
+import (
+	"testing"
+)
+
+func TestTable_GetBoundarySql(t *testing.T) {
+	table := &Table{
+		SourceSchema:                "test",
+		SourceName:                  "t",
+		TargetSchema:                "test",
+		TargetName:                  "t_new",
+		SourceColumns:               []Column{{Name: "id"}, {Name: "name"}},
+		SourcePKColumns:             []int{0},
+		SourceUsefulColumns:         []int{0, 1},
+		SourceToTargetColumnNameMap: map[string]string{"id": "new_id", "name": "name"},
+	}
+
+	expect := "/* go-d-bus checksum boundary */ SELECT /*!40001 SQL_NO_CACHE */ `id` FROM `test`.`t` ORDER BY `id` DESC LIMIT 1"
+	if boundarySql := table.GetBoundaryPKSql(true, true); boundarySql != expect {
+		t.Fatalf("期望 %v, 实际 %v", expect, boundarySql)
+	}
+
+	expect = "/* go-d-bus checksum boundary */ SELECT /*!40001 SQL_NO_CACHE */ `new_id` FROM `test`.`t_new` WHERE (`new_id`) < (?) ORDER BY `new_id` ASC LIMIT 1"
+	if boundarySql := table.GetTargetOutOfBoundaryPKSql(false); boundarySql != expect {
+		t.Fatalf("期望 %v, 实际 %v", expect, boundarySql)
+	}
+}
+
+func TestGetChecksumRowsExprByLevel(t *testing.T) {
+	defer SetChecksumLevel(CHECKSUM_LEVEL_DEFAULT)
+
+	if err := SetChecksumLevel("md5"); err == nil {
+		t.Fatal("不支持的级别应该返回错误")
+	}
+
+	exprs := []string{"`id`", "`name`"}
+	if err := SetChecksumLevel(CHECKSUM_LEVEL_COUNT); err != nil {
+		t.Fatal(err)
+	}
+	if expr := GetChecksumRowsExprByLevel(exprs); expr != "COUNT(*)" {
+		t.Fatalf("count 级别期望 COUNT(*), 实际 %v", expr)
+	}
+
+	if err := SetChecksumLevel(CHECKSUM_LEVEL_CRC); err != nil {
+		t.Fatal(err)
+	}
+	if expr := GetChecksumRowsExprByLevel(exprs); expr != GetChecksumRowsExprByExprs(exprs) {
+		t.Fatalf("crc 级别期望 %v, 实际 %v", GetChecksumRowsExprByExprs(exprs), expr)
+	}
+}
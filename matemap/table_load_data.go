@@ -0,0 +1,77 @@
+package matemap
+
+import (
+	"fmt"
+	"github.com/daiguadaidai/go-d-bus/common"
+	"strings"
+)
+
+/* 获取 LOAD DATA LOCAL INFILE 语句, 和 INSERT IGNORE 一样忽略重复的数据
+bit 类型的字段先保存到变量中, 再转化成数字设置到字段中.
+二进制类型的字段以十六进制保存到变量中, 再通过 UNHEX 还原, 不会被当做字符集中的字符解析
+Params:
+    _readerName: 在 mysql driver 中注册的 reader 名称
+    _charset: 数据的字符集, 需要和读取源数据的链接字符集一样
+*/
+func (this *Table) GetLoadDataSql(readerName string, charset string) string {
+	loadDataSql := "/* go-d-bus */ LOAD DATA LOCAL INFILE 'Reader::%v' IGNORE INTO TABLE %v CHARACTER SET %v " +
+		"FIELDS TERMINATED BY '\\t' ESCAPED BY '\\\\' LINES TERMINATED BY '\\n' (%v)%v"
+
+	tableName := common.FormatTableName(this.TargetSchema, this.TargetName, "`")
+	targetUsefulColumnNames := this.FindTargetUsefulColumnNames()
+	bitColumns := this.FindSourceUsefulBitColumns()
+	binaryColumns := this.FindSourceUsefulBinaryColumns()
+
+	fields := make([]string, 0, len(targetUsefulColumnNames))
+	sets := make([]string, 0)
+	for i, columnName := range targetUsefulColumnNames {
+		if bitColumns[i] {
+			variable := fmt.Sprintf("@go_d_bus_bit_%v", i)
+			fields = append(fields, variable)
+			sets = append(sets, fmt.Sprintf("`%v` = CAST(%v AS UNSIGNED)", columnName, variable))
+			continue
+		}
+		if binaryColumns[i] {
+			variable := fmt.Sprintf("@go_d_bus_binary_%v", i)
+			fields = append(fields, variable)
+			sets = append(sets, fmt.Sprintf("`%v` = UNHEX(%v)", columnName, variable))
+			continue
+		}
+
+		fields = append(fields, fmt.Sprintf("`%v`", columnName))
+	}
+
+	setStr := ""
+	if len(sets) > 0 {
+		setStr = fmt.Sprintf(" SET %v", strings.Join(sets, ", "))
+	}
+
+	return fmt.Sprintf(loadDataSql, readerName, tableName, charset, strings.Join(fields, ", "), setStr)
+}
+
+// 获取需要迁移的字段哪些是 bit 类型, 顺序和 SourceUsefulColumns 一致
+func (this *Table) FindSourceUsefulBitColumns() []bool {
+	bitColumns := make([]bool, len(this.SourceUsefulColumns))
+	for i, sourceUsefulColumnIndex := range this.SourceUsefulColumns {
+		bitColumns[i] = this.SourceColumns[sourceUsefulColumnIndex].Type == common.MYSQL_TYPE_BIT
+	}
+
+	return bitColumns
+}
+
+// 获取需要迁移的字段哪些是二进制类型(binary, varbinary, blob, 空间类型), 顺序和 SourceUsefulColumns 一致
+func (this *Table) FindSourceUsefulBinaryColumns() []bool {
+	binaryColumns := make([]bool, len(this.SourceUsefulColumns))
+	for i, sourceUsefulColumnIndex := range this.SourceUsefulColumns {
+		switch this.SourceColumns[sourceUsefulColumnIndex].Type {
+		case common.MYSQL_TYPE_BINARY, common.MYSQL_TYPE_VARBINARY,
+			common.MYSQL_TYPE_TINYBLOB, common.MYSQL_TYPE_BLOB, common.MYSQL_TYPE_MEDIUMBLOB, common.MYSQL_TYPE_LONGBLOB,
+			common.MYSQL_TYPE_GEOMETRY, common.MYSQL_TYPE_POINT, common.MYSQL_TYPE_LINESTRING, common.MYSQL_TYPE_POLYGON,
+			common.MYSQL_TYPE_GEOMETRYCOLLECTION, common.MYSQL_TYPE_MULTIPOINT, common.MYSQL_TYPE_MULTILINESTRING,
+			common.MYSQL_TYPE_MULTIPOLYGON:
+			binaryColumns[i] = true
+		}
+	}
+
+	return binaryColumns
+}
@@ -0,0 +1,29 @@
+package matemap
+
+import (
+	"testing"
+)
+
+func TestTable_GetLoadDataSql(t *testing.T) {
+	table := &Table{
+		SourceSchema: "test",
+		SourceName:   "t",
+		TargetSchema: "test",
+		TargetName:   "t_new",
+		SourceColumns: []Column{
+			CreateColumn("id", "int", "", 1),
+			CreateColumn("flag", "bit(8)", "", 2),
+			CreateColumn("data", "blob", "", 3),
+			CreateColumn("name", "varchar(10)", "", 4),
+		},
+		SourceUsefulColumns:         []int{0, 1, 2, 3},
+		SourceToTargetColumnNameMap: map[string]string{"id": "id", "flag": "flag", "data": "data", "name": "name"},
+	}
+
+	expect := "/* go-d-bus */ LOAD DATA LOCAL INFILE 'Reader::r' IGNORE INTO TABLE `test`.`t_new` CHARACTER SET utf8mb4 " +
+		"FIELDS TERMINATED BY '\\t' ESCAPED BY '\\\\' LINES TERMINATED BY '\\n' (`id`, @go_d_bus_bit_1, @go_d_bus_binary_2, `name`)" +
+		" SET `flag` = CAST(@go_d_bus_bit_1 AS UNSIGNED), `data` = UNHEX(@go_d_bus_binary_2)"
+	if loadDataSql := table.GetLoadDataSql("r", "utf8mb4"); loadDataSql != expect {
+		t.Fatalf("期望 %v, 实际 %v", expect, loadDataSql)
+	}
+}
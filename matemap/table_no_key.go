@@ -0,0 +1,222 @@
+package matemap
+
+import (
+	"fmt"
+	"github.com/daiguadaidai/go-d-bus/common"
+	"strings"
+)
+
+// 初始化没有主键的表需要的 sql 模板
+func (this *Table) InitNoKeySqlTpl() {
+	// 初始化 LIMIT OFFSET 获取数据 sql 模板
+	this.InitSelNoKeyOffsetSqlTpl()
+
+	// 没有主键无法按范围校验, 整表进行 checksum
+	this.InitSelNoKeyRowsChecksumSqlTpl()
+}
+
+// 初始化 没有主键的表 LIMIT OFFSET 获取数据 sql 模板, 需要在快照中执行才能保证每次的顺序一样
+func (this *Table) InitSelNoKeyOffsetSqlTpl() {
+	selectSql := `
+        /* go-d-bus */ SELECT /*!40001 SQL_NO_CACHE */
+            %v
+        FROM %v
+        LIMIT ?, ?
+    `
+
+	// 获取需要迁移的字段名称
+	usefulColumnNames := this.FindUsefulColumnNames()
+	// 获取所有需要迁移的字段 字符串
+	fieldsStr := common.FormatColumnNameStr(usefulColumnNames, "`, `")
+	// 获取 源表名
+	tableName := common.FormatTableName(this.SourceSchema, this.SourceName, "`")
+
+	this.selNoKeyOffsetSqlTpl = fmt.Sprintf(selectSql, fieldsStr, tableName)
+}
+
+// 初始化 没有主键的表 源和目标 整表 checksum sql 模板, 可能有相同的行, 使用 SUM 计算
+func (this *Table) InitSelNoKeyRowsChecksumSqlTpl() {
+	selectSql := `
+        /* go-d-bus checksum table %v */ SELECT /*!40001 SQL_NO_CACHE */
+        %v
+        FROM %v
+    `
+
+	// 源表
+	sourceFieldsStr := GetChecksumNoKeyRowsExprByLevel(this.FindChecksumColumnExprs(true))
+	sourceTableName := common.FormatTableName(this.SourceSchema, this.SourceName, "`")
+	this.selSourceRowsCheckSqlTpl = fmt.Sprintf(selectSql, "source", sourceFieldsStr, sourceTableName)
+
+	// 目标表
+	targetFieldsStr := GetChecksumNoKeyRowsExprByLevel(this.FindChecksumColumnExprs(false))
+	targetTableName := common.FormatTableName(this.TargetSchema, this.TargetName, "`")
+	this.selTargetRowsCheckSqlTpl = fmt.Sprintf(selectSql, "target", targetFieldsStr, targetTableName)
+}
+
+// 获取 没有主键的表 LIMIT OFFSET 获取数据 sql
+func (this *Table) GetSelNoKeyOffsetSqlTpl() string {
+	return this.selNoKeyOffsetSqlTpl
+}
+
+/* 获取 没有主键的表 下一个分块的上边界值 sql
+分块字段值相同的行一定在同一个分块中, 所以边界都使用 > 和 <=
+Params:
+    _hasLower: 是否有下边界, 第一个分块没有下边界
+    _maxRows: 每个分块的行数
+*/
+func (this *Table) GetSelNoKeyChunkBoundSql(hasLower bool, maxRows int) string {
+	selectSql := `
+        /* go-d-bus */ SELECT /*!40001 SQL_NO_CACHE */
+            %v
+        FROM %v
+        WHERE %v
+        ORDER BY %v
+        LIMIT %v, 1
+    `
+
+	chunkColumnStr := common.GetBackquote(this.ChunkColumn)
+	tableName := common.FormatTableName(this.SourceSchema, this.SourceName, "`")
+	whereStr := fmt.Sprintf("%v IS NOT NULL", chunkColumnStr)
+	if hasLower {
+		whereStr = fmt.Sprintf("%v > ?", chunkColumnStr)
+	}
+
+	return fmt.Sprintf(selectSql, chunkColumnStr, tableName, whereStr, chunkColumnStr, maxRows-1)
+}
+
+/* 获取 没有主键的表 一个分块的数据 sql
+Params:
+    _hasLower: 是否有下边界 (chunk > ?)
+    _hasUpper: 是否有上边界 (chunk <= ?), 没有则获取到最后
+*/
+func (this *Table) GetSelNoKeyChunkSql(hasLower bool, hasUpper bool) string {
+	selectSql := `
+        /* go-d-bus */ SELECT /*!40001 SQL_NO_CACHE */
+            %v
+        FROM %v
+        WHERE %v
+    `
+
+	fieldsStr := common.FormatColumnNameStr(this.FindUsefulColumnNames(), "`, `")
+	tableName := common.FormatTableName(this.SourceSchema, this.SourceName, "`")
+	chunkColumnStr := common.GetBackquote(this.ChunkColumn)
+
+	whereStrs := []string{fmt.Sprintf("%v IS NOT NULL", chunkColumnStr)}
+	if hasLower {
+		whereStrs = append(whereStrs, fmt.Sprintf("%v > ?", chunkColumnStr))
+	}
+	if hasUpper {
+		whereStrs = append(whereStrs, fmt.Sprintf("%v <= ?", chunkColumnStr))
+	}
+
+	return fmt.Sprintf(selectSql, fieldsStr, tableName, strings.Join(whereStrs, " AND "))
+}
+
+// 获取 没有主键的表 分块字段为 NULL 的数据 sql
+func (this *Table) GetSelNoKeyNullChunkSql() string {
+	selectSql := `
+        /* go-d-bus */ SELECT /*!40001 SQL_NO_CACHE */
+            %v
+        FROM %v
+        WHERE %v IS NULL
+    `
+
+	fieldsStr := common.FormatColumnNameStr(this.FindUsefulColumnNames(), "`, `")
+	tableName := common.FormatTableName(this.SourceSchema, this.SourceName, "`")
+
+	return fmt.Sprintf(selectSql, fieldsStr, tableName, common.GetBackquote(this.ChunkColumn))
+}
+
+/* 获取 没有主键的表 匹配所有字段的 where 字句, NULL 值也能匹配
+`c1` <=> 1 AND `c2` <=> 'name'
+Params:
+    _row: 前镜像, 和目标需要迁移的字段一一对应
+*/
+func (this *Table) getNoKeyWhereStr(row []interface{}) (string, error) {
+	columnNames := this.FindTargetUsefulColumnNames()
+	if len(columnNames) != len(row) {
+		return "", fmt.Errorf("失败. 字段个数和值个数不一致. %v.%v. %v != %v", this.TargetSchema, this.TargetName, len(columnNames), len(row))
+	}
+
+	whereStrs := make([]string, 0, len(columnNames))
+	for i, columnName := range columnNames {
+		valueStr, err := getNoKeySqlValueStr(row[i])
+		if err != nil {
+			return "", err
+		}
+		whereStrs = append(whereStrs, fmt.Sprintf("`%v` <=> %v", columnName, valueStr))
+	}
+
+	return strings.Join(whereStrs, " AND "), nil
+}
+
+/* 获取 没有主键的表 update sql, 通过匹配前镜像所有字段只更新一行
+Params:
+    _beforeRow: 前镜像
+    _afterRow: 后镜像
+*/
+func (this *Table) GetNoKeyUpdSql(beforeRow []interface{}, afterRow []interface{}) (string, error) {
+	updateSql := "/* go-d-bus */ UPDATE LOW_PRIORITY %v SET %v WHERE %v LIMIT 1"
+
+	columnNames := this.FindTargetUsefulColumnNames()
+	if len(columnNames) != len(afterRow) {
+		return "", fmt.Errorf("失败. 字段个数和值个数不一致. %v.%v. %v != %v", this.TargetSchema, this.TargetName, len(columnNames), len(afterRow))
+	}
+
+	setStrs := make([]string, 0, len(columnNames))
+	for i, columnName := range columnNames {
+		valueStr, err := getNoKeySqlValueStr(afterRow[i])
+		if err != nil {
+			return "", err
+		}
+		setStrs = append(setStrs, fmt.Sprintf("`%v` = %v", columnName, valueStr))
+	}
+
+	whereStr, err := this.getNoKeyWhereStr(beforeRow)
+	if err != nil {
+		return "", err
+	}
+
+	tableName := common.FormatTableName(this.TargetSchema, this.TargetName, "`")
+
+	return fmt.Sprintf(updateSql, tableName, strings.Join(setStrs, ", "), whereStr), nil
+}
+
+/* 获取 没有主键的表 delete sql, 通过匹配前镜像所有字段只删除一行
+Params:
+    _beforeRow: 前镜像
+*/
+func (this *Table) GetNoKeyDelSql(beforeRow []interface{}) (string, error) {
+	deleteSql := "/* go-d-bus */ DELETE LOW_PRIORITY FROM %v WHERE %v LIMIT 1"
+
+	whereStr, err := this.getNoKeyWhereStr(beforeRow)
+	if err != nil {
+		return "", err
+	}
+
+	tableName := common.FormatTableName(this.TargetSchema, this.TargetName, "`")
+
+	return fmt.Sprintf(deleteSql, tableName, whereStr), nil
+}
+
+// 获取清空目标表数据的 sql, 没有主键的表 row copy 中断后需要重新拷贝
+func (this *Table) GetDelNoKeyTargetAllSql() string {
+	return fmt.Sprintf("/* go-d-bus */ DELETE FROM %v", common.FormatTableName(this.TargetSchema, this.TargetName, "`"))
+}
+
+/* 将值转化为 sql 中的字符串, nil 转化为 NULL
+Params:
+    _value: 字段值
+*/
+func getNoKeySqlValueStr(value interface{}) (string, error) {
+	if value == nil {
+		return "NULL", nil
+	}
+
+	sqlValue, err := common.GetSqlValue(value, "'")
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%v", sqlValue), nil
+}
@@ -0,0 +1,45 @@
+package matemap
+
+import (
+	"testing"
+)
+
+func newNoKeyTestTable() *Table {
+	return &Table{
+		SourceSchema:                "test",
+		SourceName:                  "log",
+		TargetSchema:                "test",
+		TargetName:                  "log_new",
+		SourceColumns:               []Column{{Name: "created"}, {Name: "msg"}},
+		SourceUsefulColumns:         []int{0, 1},
+		SourceToTargetColumnNameMap: map[string]string{"created": "created", "msg": "message"},
+		NoUniqueKey:                 true,
+		ChunkColumn:                 "created",
+	}
+}
+
+func TestTable_GetNoKeyUpdSql(t *testing.T) {
+	table := newNoKeyTestTable()
+
+	updateSql, err := table.GetNoKeyUpdSql([]interface{}{int64(1), nil}, []interface{}{int64(2), "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "/* go-d-bus */ UPDATE LOW_PRIORITY `test`.`log_new` SET `created` = 2, `message` = 'a' WHERE `created` <=> 1 AND `message` <=> NULL LIMIT 1"
+	if updateSql != expect {
+		t.Fatalf("期望 %v, 实际 %v", expect, updateSql)
+	}
+
+	deleteSql, err := table.GetNoKeyDelSql([]interface{}{int64(1), "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect = "/* go-d-bus */ DELETE LOW_PRIORITY FROM `test`.`log_new` WHERE `created` <=> 1 AND `message` <=> 'a' LIMIT 1"
+	if deleteSql != expect {
+		t.Fatalf("期望 %v, 实际 %v", expect, deleteSql)
+	}
+
+	if _, err := table.GetNoKeyDelSql([]interface{}{int64(1)}); err == nil {
+		t.Fatal("字段个数和值个数不一致, 期望出错")
+	}
+}
@@ -0,0 +1,28 @@
+package matemap
+
+import (
+	"fmt"
+	"github.com/daiguadaidai/go-d-bus/common"
+)
+
+/* 获取 小于指定主键值的最大主键值 sql, 用于计算表拆分后每个范围的截止值
+SELECT `id` FROM `schema`.`table` WHERE (`id`) < (?) ORDER BY `id` DESC LIMIT 1
+*/
+func (this *Table) GetSelPrevPKSql() string {
+	selectSql := `
+        /* go-d-bus */ SELECT /*!40001 SQL_NO_CACHE */
+            %v
+        FROM %v
+        WHERE (%v) < (%v)
+        ORDER BY %v
+        LIMIT 1
+    `
+
+	pkColumnNames := this.FindSourcePKColumnNames()
+	pkFieldsStr := common.FormatColumnNameStr(pkColumnNames, "`, `")
+	tableName := common.FormatTableName(this.SourceSchema, this.SourceName, "`")
+	wherePlaceholderStr := common.CreatePlaceholderByCount(len(pkColumnNames))
+	orderByDescStr := common.FormatOrderByStr(pkColumnNames, "DESC")
+
+	return fmt.Sprintf(selectSql, pkFieldsStr, tableName, pkFieldsStr, wherePlaceholderStr, orderByDescStr)
+}
@@ -0,0 +1,24 @@
+package model
+
+import (
+	"database/sql"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+type ChecksumColumnRule struct {
+	Id        sql.NullInt64  `gorm:"primary_key;not null;AUTO_INCREMENT"`                                              // 主键ID
+	TaskUUID  sql.NullString `gorm:"column:task_uuid;type:varchar(22);not null"`                                       // 任务UUID
+	Schema    sql.NullString `gorm:"column:schema;type:varchar(100);not null"`                                         // 源 schema 名称
+	Table     sql.NullString `gorm:"column:table;type:varchar(100);not null"`                                          // 源 table 名称
+	Column    sql.NullString `gorm:"column:column;type:varchar(100);not null"`                                         // 源 字段 名称
+	Side      sql.NullString `gorm:"column:side;type:varchar(10);not null;default:'both'"`                             // 规则作用在哪一端: both, source, target
+	Rule      sql.NullString `gorm:"column:rule;type:varchar(20);not null"`                                            // 规则: round, trim, cast, convert_tz, charset, epsilon
+	Arg       sql.NullString `gorm:"column:arg;type:varchar(100);not null;default:''"`                                 // 规则参数
+	UpdatedAt mysql.NullTime `gorm:"column:updated_at;not null;default:CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP"` // 更新时间
+	CreatedAt mysql.NullTime `gorm:"column:created_at;not null;default:CURRENT_TIMESTAMP"`                             // 创建时间
+}
+
+func (ChecksumColumnRule) TableName() string {
+	return "checksum_column_rule"
+}
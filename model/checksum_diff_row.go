@@ -0,0 +1,30 @@
+package model
+
+import (
+	"database/sql"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+const (
+	CHECKSUM_DIFF_ROW_TYPE_MISSING = "missing" // 源有目标没有
+	CHECKSUM_DIFF_ROW_TYPE_EXTRA   = "extra"   // 目标有源没有
+	CHECKSUM_DIFF_ROW_TYPE_DIFF    = "diff"    // 源和目标都有但是数据不一致
+)
+
+type ChecksumDiffRow struct {
+	Id        sql.NullInt64  `gorm:"primary_key;not null;AUTO_INCREMENT"`                                              // 主键ID
+	TaskUUID  sql.NullString `gorm:"column:task_uuid;type:varchar(22);not null"`                                       // 任务UUID
+	Schema    sql.NullString `gorm:"column:schema;type:varchar(100);not null"`                                         // 源 schema 名称
+	Table     sql.NullString `gorm:"column:table;type:varchar(100);not null"`                                          // 源 table 名称
+	DiffType  sql.NullString `gorm:"column:diff_type;type:varchar(10);not null"`                                       // 不一致类型: missing, extra, diff
+	PKValue   sql.NullString `gorm:"column:pk_value;type:varchar(500);not null"`                                       // 主键值, json
+	SourceRow sql.NullString `gorm:"column:source_row;type:text"`                                                      // 修复前源的数据, json
+	TargetRow sql.NullString `gorm:"column:target_row;type:text"`                                                      // 修复前目标的数据, json
+	UpdatedAt mysql.NullTime `gorm:"column:updated_at;not null;default:CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP"` // 更新时间
+	CreatedAt mysql.NullTime `gorm:"column:created_at;not null;default:CURRENT_TIMESTAMP"`                             // 创建时间
+}
+
+func (ChecksumDiffRow) TableName() string {
+	return "checksum_diff_row"
+}
@@ -0,0 +1,25 @@
+package model
+
+import (
+	"database/sql"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+type ChecksumTableStat struct {
+	Id                sql.NullInt64  `gorm:"primary_key;not null;AUTO_INCREMENT"`                                              // 主键ID
+	TaskUUID          sql.NullString `gorm:"column:task_uuid;type:varchar(22);not null"`                                       // 任务UUID
+	Schema            sql.NullString `gorm:"column:schema;type:varchar(100);not null"`                                         // 源 schema 名称
+	Table             sql.NullString `gorm:"column:table;type:varchar(100);not null"`                                          // 源 table 名称
+	ChunkCount        sql.NullInt64  `gorm:"column:chunk_count;not null;default:0"`                                            // 第一次校验的范围数
+	DiffChunkCount    sql.NullInt64  `gorm:"column:diff_chunk_count;not null;default:0"`                                       // 第一次校验(包含滚动校验)不一致的范围数
+	FixedChunkCount   sql.NullInt64  `gorm:"column:fixed_chunk_count;not null;default:0"`                                      // 修复或再次校验后一致的范围数
+	ChecksumElapsedMs sql.NullInt64  `gorm:"column:checksum_elapsed_ms;not null;default:0"`                                    // 多行校验的耗时(毫秒)
+	FixElapsedMs      sql.NullInt64  `gorm:"column:fix_elapsed_ms;not null;default:0"`                                         // 修复数据的耗时(毫秒)
+	UpdatedAt         mysql.NullTime `gorm:"column:updated_at;not null;default:CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP"` // 更新时间
+	CreatedAt         mysql.NullTime `gorm:"column:created_at;not null;default:CURRENT_TIMESTAMP"`                             // 创建时间
+}
+
+func (ChecksumTableStat) TableName() string {
+	return "checksum_table_stat"
+}
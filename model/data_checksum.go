@@ -16,6 +16,11 @@ type DataChecksum struct {
 	IsFix           sql.NullInt64  `gorm:"column:is_fix;not null;default:0"`                                      // 表 row copy 是否完成
 	MinIDValue      sql.NullString `gorm:"column:min_id_value;type:varchar(200)"`                                            // 表需要row copy 到哪一行
 	MaxIDValue      sql.NullString `gorm:"column:max_id_value;type:varchar(200)"`                                           // 表当前row copy到哪一行
+
+	MissingRows sql.NullInt64 `gorm:"column:missing_rows"` // 修复时发现源有目标没有的行数
+	ExtraRows   sql.NullInt64 `gorm:"column:extra_rows"`   // 修复时发现目标有源没有的行数
+	DiffRows    sql.NullInt64 `gorm:"column:diff_rows"`    // 修复时发现源和目标都有但是数据不一致的行数
+
 	UpdatedAt       mysql.NullTime `gorm:"column:updated_at;not null;default:CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP"` // 更新时间
 	CreatedAt       mysql.NullTime `gorm:"column:created_at;not null;default:CURRENT_TIMESTAMP"`                             // 创建时间
 }
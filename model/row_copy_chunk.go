@@ -0,0 +1,32 @@
+package model
+
+import (
+	"database/sql"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+const (
+	ROW_COPY_CHUNK_STATUS_WAITING  = 0 // 等待 row copy
+	ROW_COPY_CHUNK_STATUS_COMPLETE = 1 // row copy 完成
+)
+
+type RowCopyChunk struct {
+	Id         sql.NullInt64  `gorm:"primary_key;not null;AUTO_INCREMENT"`                                              // 主键ID
+	TaskUUID   sql.NullString `gorm:"column:task_uuid;type:varchar(22);not null"`                                       // 任务UUID
+	Schema     sql.NullString `gorm:"column:schema;type:varchar(100);not null"`                                         // 源 schema 名称
+	Source     sql.NullString `gorm:"column:source;type:varchar(100);not null"`                                         // 源 table 名称
+	RangeNo    sql.NullInt64  `gorm:"column:range_no;not null;default:0"`                                               // 表拆分后的第几个范围, 没有拆分为0
+	ChunkHash  sql.NullString `gorm:"column:chunk_hash;type:varchar(30);not null"`                                      // 生成该 chunk 的时间戳
+	MinIDValue sql.NullString `gorm:"column:min_id_value;type:varchar(200)"`                                            // chunk 最小主键值
+	MaxIDValue sql.NullString `gorm:"column:max_id_value;type:varchar(200)"`                                            // chunk 最大主键值
+	Status     sql.NullInt64  `gorm:"column:status;not null;default:0"`                                                 // 0: 等待 row copy, 1: row copy 完成
+	RowCount   sql.NullInt64  `gorm:"column:row_count;not null;default:0"`                                              // row copy 的行数
+	ElapsedMs  sql.NullInt64  `gorm:"column:elapsed_ms;not null;default:0"`                                             // row copy 查询和插入的耗时(毫秒)
+	UpdatedAt  mysql.NullTime `gorm:"column:updated_at;not null;default:CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP"` // 更新时间
+	CreatedAt  mysql.NullTime `gorm:"column:created_at;not null;default:CURRENT_TIMESTAMP"`                             // 创建时间
+}
+
+func (RowCopyChunk) TableName() string {
+	return "row_copy_chunk"
+}
@@ -5,6 +5,7 @@ import (
 
 	"fmt"
 	"github.com/go-sql-driver/mysql"
+	"strings"
 )
 
 type Source struct {
@@ -24,6 +25,11 @@ type Source struct {
 	ParseLogPos  sql.NullInt64  // 解析到binlog应用位点
 	StopLogFile  sql.NullString `gorm:"type:varchar(20)"` // 停止binlog应用位点文件
 	StopLogPos   sql.NullInt64  // 停止binlog应用位点
+
+	ApplyPosition sql.NullString `gorm:"column:apply_position;type:text"` // 当前binlog应用位点(序列化的, 包含 GTID 和 server uuid)
+
+	ReadHost sql.NullString `gorm:"column:read_host;type:varchar(15)"` // row copy 和 checksum 读取数据的从库 host, 为空则读取源实例
+	ReadPort sql.NullInt64  `gorm:"column:read_port"`                  // row copy 和 checksum 读取数据的从库 port
 }
 
 func (Source) TableName() string {
@@ -33,3 +39,8 @@ func (Source) TableName() string {
 func (this *Source) GetHostPortStr() string {
 	return fmt.Sprintf("%v:%v", this.Host.String, this.Port.Int64)
 }
+
+// 是否指定了读取数据的从库
+func (this *Source) HasReadReplica() bool {
+	return this.ReadHost.Valid && strings.TrimSpace(this.ReadHost.String) != "" && this.ReadPort.Int64 > 0
+}
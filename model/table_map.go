@@ -7,16 +7,21 @@ import (
 )
 
 type TableMap struct {
-	Id              sql.NullInt64  `gorm:"primary_key;not null;AUTO_INCREMENT"`                                              // 主键ID
-	TaskUUID        sql.NullString `gorm:"column:task_uuid;type:varchar(22);not null"`                                       // 任务UUID
-	Schema          sql.NullString `gorm:"column:schema;type:varchar(100);not null"`                                         // 源 schema 名称
-	Source          sql.NullString `gorm:"column:source;type:varchar(100);not null"`                                         // 源 字段 名称
-	Target          sql.NullString `gorm:"column:target;type:varchar(100);not null"`                                         // 目标 字段 名称
-	RowCopyComplete sql.NullInt64  `gorm:"column:row_copy_complete;not null;default:0"`                                      // 表 row copy 是否完成
-	MaxIDValue      sql.NullString `gorm:"column:max_id_value;type:varchar(200)"`                                            // 表需要row copy 到哪一行
-	CurrIDValue     sql.NullString `gorm:"column:curr_id_value;type:varchar(200)"`                                           // 表当前row copy到哪一行
-	UpdatedAt       mysql.NullTime `gorm:"column:updated_at;not null;default:CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP"` // 更新时间
-	CreatedAt       mysql.NullTime `gorm:"column:created_at;not null;default:CURRENT_TIMESTAMP"`                             // 创建时间
+	Id               sql.NullInt64  `gorm:"primary_key;not null;AUTO_INCREMENT"`                                              // 主键ID
+	TaskUUID         sql.NullString `gorm:"column:task_uuid;type:varchar(22);not null"`                                       // 任务UUID
+	Schema           sql.NullString `gorm:"column:schema;type:varchar(100);not null"`                                         // 源 schema 名称
+	Source           sql.NullString `gorm:"column:source;type:varchar(100);not null"`                                         // 源 字段 名称
+	Target           sql.NullString `gorm:"column:target;type:varchar(100);not null"`                                         // 目标 字段 名称
+	RowCopyComplete  sql.NullInt64  `gorm:"column:row_copy_complete;not null;default:0"`                                      // 表 row copy 是否完成
+	MaxIDValue       sql.NullString `gorm:"column:max_id_value;type:varchar(200)"`                                            // 表需要row copy 到哪一行
+	CurrIDValue      sql.NullString `gorm:"column:curr_id_value;type:varchar(200)"`                                           // 表当前row copy到哪一行
+	ChunkColumn      sql.NullString `gorm:"column:chunk_column;type:varchar(100)"`                                            // 没有主键的表 row copy 分块字段
+	RowCopyPriority  sql.NullInt64  `gorm:"column:row_copy_priority;not null;default:0"`                                      // row copy 优先级, 越大越先拷贝
+	RowCopyParaller  sql.NullInt64  `gorm:"column:row_copy_paraller;not null;default:0"`                                      // 该表最多同时进行 row copy 的范围个数, 0 不限制
+	RowCopySplit     sql.NullInt64  `gorm:"column:row_copy_split_count;not null;default:0"`                                   // 该表拆分成多少个范围并发 row copy, 0 使用任务的设置
+	SnapshotPosition sql.NullString `gorm:"column:snapshot_position;type:text"`                                               // 没有主键的表 row copy 使用的快照位点(序列化的)
+	UpdatedAt        mysql.NullTime `gorm:"column:updated_at;not null;default:CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP"` // 更新时间
+	CreatedAt        mysql.NullTime `gorm:"column:created_at;not null;default:CURRENT_TIMESTAMP"`                             // 创建时间
 }
 
 func (TableMap) TableName() string {
@@ -0,0 +1,24 @@
+package model
+
+import (
+	"database/sql"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+type TableMapRange struct {
+	Id              sql.NullInt64  `gorm:"primary_key;not null;AUTO_INCREMENT"`                                              // 主键ID
+	TaskUUID        sql.NullString `gorm:"column:task_uuid;type:varchar(22);not null"`                                       // 任务UUID
+	Schema          sql.NullString `gorm:"column:schema;type:varchar(100);not null"`                                         // 源 schema 名称
+	Source          sql.NullString `gorm:"column:source;type:varchar(100);not null"`                                         // 源 table 名称
+	RangeNo         sql.NullInt64  `gorm:"column:range_no;not null"`                                                         // 表拆分后的第几个范围
+	RowCopyComplete sql.NullInt64  `gorm:"column:row_copy_complete;not null;default:0"`                                      // 该范围 row copy 是否完成
+	MaxIDValue      sql.NullString `gorm:"column:max_id_value;type:varchar(200)"`                                            // 该范围需要row copy 到哪一行
+	CurrIDValue     sql.NullString `gorm:"column:curr_id_value;type:varchar(200)"`                                           // 该范围当前row copy到哪一行
+	UpdatedAt       mysql.NullTime `gorm:"column:updated_at;not null;default:CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP"` // 更新时间
+	CreatedAt       mysql.NullTime `gorm:"column:created_at;not null;default:CURRENT_TIMESTAMP"`                             // 创建时间
+}
+
+func (TableMapRange) TableName() string {
+	return "table_map_range"
+}
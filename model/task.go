@@ -28,6 +28,18 @@ type Task struct {
 	BinlogParaller       sql.NullInt64  `gorm:"column:binlog_paraller;not null;default:15"`                                       //应用binlog 并发数
 	ChecksumParaller     sql.NullInt64  `gorm:"column:checksum_paraller;not null;default:1"`                                       //应用binlog 并发数
 	ChecksumFixParaller  sql.NullInt64  `gorm:"column:checksum_fix_paraller;not null;default:1"`                                       //应用binlog 并发数
+	RowCopySchedule      sql.NullString `gorm:"column:row_copy_schedule;type:varchar(20)"`                                        // row copy 表调度策略
+	RowCopyWriter        sql.NullString `gorm:"column:row_copy_writer;type:varchar(20)"`                                          // row copy 写入目标的方式
+
+	// 限速, 为 NULL 使用命令行的值, 运行时修改生效
+	RowCopyMaxRowsPerSec  sql.NullInt64 `gorm:"column:row_copy_max_rows_per_sec"`  // row copy 每秒最多读取的行数
+	RowCopyMaxBytesPerSec sql.NullInt64 `gorm:"column:row_copy_max_bytes_per_sec"` // row copy 每秒最多读取的字节数
+	BinlogMaxRowsPerSec   sql.NullInt64 `gorm:"column:binlog_max_rows_per_sec"`    // 应用binlog 每秒最多写入的行数
+
+	QueueHighWaterMB sql.NullInt64 `gorm:"column:queue_high_water_mb"` // 应用binlog 队列中缓存超过多少MB暂停解析binlog
+	QueueLowWaterMB  sql.NullInt64 `gorm:"column:queue_low_water_mb"`  // 应用binlog 队列中缓存少于多少MB继续解析binlog
+
+	ChecksumAlgorithm sql.NullString `gorm:"column:checksum_algorithm;type:varchar(20)"` // checksum 每行数据使用的 hash 算法
 }
 
 func (Task) TableName() string {
@@ -0,0 +1,27 @@
+package model
+
+import (
+	"database/sql"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+type TaskThrottle struct {
+	Id                      sql.NullInt64  `gorm:"primary_key;not null;AUTO_INCREMENT"`                                              // 主键ID
+	TaskUUID                sql.NullString `gorm:"column:task_uuid;type:varchar(22);not null"`                                       // 任务UUID
+	MaxSourceThreadsRunning sql.NullInt64  `gorm:"column:max_source_threads_running"`                                                // 源实例 Threads_running 限流阈值
+	MaxTargetThreadsRunning sql.NullInt64  `gorm:"column:max_target_threads_running"`                                                // 目标实例 Threads_running 限流阈值
+	MaxReplicaLag           sql.NullInt64  `gorm:"column:max_replica_lag"`                                                           // 目标从库延时(秒)限流阈值
+	ThrottleReplicas        sql.NullString `gorm:"column:throttle_replicas;type:varchar(500)"`                                       // 需要检测延时的目标从库 host1:port1,host2:port2
+	ThrottleQuery           sql.NullString `gorm:"column:throttle_query;type:varchar(1000)"`                                         // 自定义检测sql, 返回值大于0进行限流
+	ThrottleBinlogApply     sql.NullInt64  `gorm:"column:throttle_binlog_apply"`                                                     // 限流时是否暂停应用binlog
+	ForceThrottle           sql.NullInt64  `gorm:"column:force_throttle;not null;default:0"`                                         // 手动限流
+	IsThrottled             sql.NullInt64  `gorm:"column:is_throttled;not null;default:0"`                                           // 当前是否正在限流
+	ThrottleReason          sql.NullString `gorm:"column:throttle_reason;type:varchar(500)"`                                         // 当前限流的原因
+	UpdatedAt               mysql.NullTime `gorm:"column:updated_at;not null;default:CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP"` // 更新时间
+	CreatedAt               mysql.NullTime `gorm:"column:created_at;not null;default:CURRENT_TIMESTAMP"`                             // 创建时间
+}
+
+func (TaskThrottle) TableName() string {
+	return "task_throttle"
+}
@@ -0,0 +1,132 @@
+package parser
+
+import (
+	"fmt"
+	"github.com/daiguadaidai/go-d-bus/common"
+	"github.com/daiguadaidai/go-d-bus/logger"
+	"github.com/daiguadaidai/go-d-bus/matemap"
+	"os"
+	"strings"
+)
+
+// 单独运行 checksum 时用于接收和保存命令行输入的参数值, checksum 相关的参数和启动任务时一样
+type ChecksumParser struct {
+	RunParser
+
+	Tables string // 需要校验的表, 多个用逗号隔开: schema1.table1,schema2.table2. 为空则校验任务所有需要迁移的表
+	Fix    bool   // 是否修复不一致的数据
+}
+
+// 对输入的命令进行检测
+func (this *ChecksumParser) Parse() error {
+	// 检测任务信息
+	if err := DetectTask(this.TaskUUID); err != nil {
+		return err
+	}
+
+	// 解析 checksum 级别
+	if err := this.ParseChecksumLevel(); err != nil {
+		return err
+	}
+
+	// 解析相关并发数, count 级别只比较行数, 没有指定并发数时使用较大的并发数
+	if this.ChecksumLevel == matemap.CHECKSUM_LEVEL_COUNT && this.ChecksumParaller <= 0 {
+		this.ChecksumParaller = CHECKSUM_COUNT_PARALLER
+		logger.M.Infof("count 级别的 checksum 没有指定并发数, 使用默认值: %v", CHECKSUM_COUNT_PARALLER)
+	}
+	this.ParseChecksumParaller()
+	this.ParseChecksumFixParaller()
+
+	// 解析每个校验范围的行数, 和 row copy 每次的行数一样
+	this.ParseRowCopyLimit()
+
+	// 解析 checksum 算法
+	if err := this.ParseChecksumAlgorithm(); err != nil {
+		return err
+	}
+
+	// 解析 checksum 修复数据的方式
+	if err := this.ParseChecksumFixMode(); err != nil {
+		return err
+	}
+
+	// 指定了修复sql文件, 修复数据时只生成修复sql
+	if this.ChecksumFixSqlFile != "" {
+		this.Fix = true
+	}
+
+	// 解析 需要校验的表
+	if err := this.ParseTables(); err != nil {
+		return err
+	}
+
+	// 解析 出错重试次数
+	this.ParseErrRetryCount()
+
+	return nil
+}
+
+// 解析需要校验的表, 表名必须是 schema.table
+func (this *ChecksumParser) ParseTables() error {
+	for _, tableName := range this.GetTableNames() {
+		if len(strings.Split(tableName, ".")) != 2 {
+			return fmt.Errorf("失败. 需要校验的表名格式不正确, 必须是 schema.table: %v", tableName)
+		}
+	}
+
+	if len(this.GetTableNames()) == 0 {
+		logger.M.Infof("没有指定需要校验的表, 将校验任务所有需要迁移的表")
+	} else {
+		logger.M.Infof("需要校验的表: %v", common.ToJsonStr(this.GetTableNames()))
+	}
+
+	return nil
+}
+
+// 获取需要校验的表名, 没有指定返回空
+func (this *ChecksumParser) GetTableNames() []string {
+	tableNames := make([]string, 0, 1)
+	for _, tableName := range strings.Split(this.Tables, ",") {
+		tableName = strings.TrimSpace(tableName)
+		if tableName == "" {
+			continue
+		}
+		tableNames = append(tableNames, tableName)
+	}
+
+	return tableNames
+}
+
+// 执行人工审核过的修复sql文件时用于接收和保存命令行输入的参数值
+type ChecksumApplyFixParser struct {
+	RunParser
+
+	File string // 修复sql文件, checksum --checksum-fix-sql-file 生成
+}
+
+// 对输入的命令进行检测
+func (this *ChecksumApplyFixParser) Parse() error {
+	// 检测任务信息
+	if err := DetectTask(this.TaskUUID); err != nil {
+		return err
+	}
+
+	// 检测修复sql文件
+	this.File = strings.TrimSpace(this.File)
+	if this.File == "" {
+		return fmt.Errorf("失败. 没有指定修复sql文件 --file")
+	}
+	if _, err := os.Stat(this.File); err != nil {
+		return fmt.Errorf("失败. 修复sql文件不存在. %v. %v", this.File, err)
+	}
+
+	// 解析 checksum 算法, 需要和生成修复sql时一样
+	if err := this.ParseChecksumAlgorithm(); err != nil {
+		return err
+	}
+
+	// 解析 出错重试次数
+	this.ParseErrRetryCount()
+
+	return nil
+}
@@ -0,0 +1,52 @@
+package parser
+
+import (
+	"fmt"
+	"github.com/daiguadaidai/go-d-bus/logger"
+	"strings"
+)
+
+const (
+	REPORT_FORMAT_JSON = "json" // 报告输出为 json
+	REPORT_FORMAT_CSV  = "csv"  // 报告输出为 csv, 每一部分之间空一行
+	REPORT_FORMAT_HTML = "html" // 报告输出为 html 页面
+)
+
+// 生成 checksum 报告时用于接收和保存命令行输入的参数值
+type ReportParser struct {
+	TaskUUID  string // 任务UUID
+	Format    string // 报告格式: json, csv, html
+	Output    string // 报告输出的文件, 为空输出到标准输出
+	CountRows bool   // 是否 SELECT COUNT(*) 获取源和目标表的行数
+}
+
+// 对输入的命令进行检测
+func (this *ReportParser) Parse() error {
+	// 检测任务信息
+	if err := DetectTask(this.TaskUUID); err != nil {
+		return err
+	}
+
+	// 解析报告格式
+	this.Format = strings.ToLower(strings.TrimSpace(this.Format))
+	switch this.Format {
+	case "":
+		this.Format = REPORT_FORMAT_JSON
+	case REPORT_FORMAT_JSON, REPORT_FORMAT_CSV, REPORT_FORMAT_HTML:
+	default:
+		return fmt.Errorf("失败. 不支持的报告格式: %v. 可选: %v, %v, %v", this.Format, REPORT_FORMAT_JSON, REPORT_FORMAT_CSV, REPORT_FORMAT_HTML)
+	}
+
+	this.Output = strings.TrimSpace(this.Output)
+	if this.Output == "" {
+		logger.M.Infof("报告格式: %v, 输出到标准输出", this.Format)
+	} else {
+		logger.M.Infof("报告格式: %v, 输出到文件: %v", this.Format, this.Output)
+	}
+
+	if !this.CountRows {
+		logger.M.Warnf("不统计源和目标表的行数, 报告中行数为 -1")
+	}
+
+	return nil
+}
@@ -3,9 +3,12 @@ package parser
 import (
 	"database/sql"
 	"fmt"
+	"github.com/daiguadaidai/go-d-bus/common"
 	"github.com/daiguadaidai/go-d-bus/dao"
 	"github.com/daiguadaidai/go-d-bus/gdbc"
 	"github.com/daiguadaidai/go-d-bus/logger"
+	"github.com/daiguadaidai/go-d-bus/matemap"
+	"github.com/daiguadaidai/go-d-bus/model"
 	"strings"
 )
 
@@ -20,6 +23,42 @@ const (
 	HEARTBEAT_SCHEMA             = ""    // 默认 心跳库
 	HEARTBEAT_TABLE              = ""    // 默认 心跳表
 	ERR_RETRY_COUNT              = 60    // 默认出错重试次数
+
+	TARGET_CHECKPOINT_SCHEMA = "d_bus"            // 默认 目标 checkpoint 库
+	TARGET_CHECKPOINT_TABLE  = "d_bus_checkpoint" // 默认 目标 checkpoint 表
+
+	ROW_COPY_MIN_LIMIT       = 100              // 默认 自适应 row copy 每次最少行数
+	ROW_COPY_MAX_LIMIT       = 100000           // 默认 自适应 row copy 每次最多行数
+	ROW_COPY_CHUNK_MAX_BYTES = 64 * 1024 * 1024 // 默认 自适应 row copy 每次最多字节数
+
+	ROW_COPY_SCHEDULE_RANDOM         = "random"         // 随机选择表进行 row copy
+	ROW_COPY_SCHEDULE_SMALLEST_FIRST = "smallest-first" // 先拷贝数据量小的表
+	ROW_COPY_SCHEDULE_LARGEST_FIRST  = "largest-first"  // 先拷贝数据量大的表
+	ROW_COPY_SCHEDULE_PRIORITY       = "priority"       // 按 table_map.row_copy_priority 从大到小拷贝
+	ROW_COPY_SCHEDULE_ROUND_ROBIN    = "round-robin"    // 所有表轮流拷贝
+
+	ROW_COPY_SPLIT_MIN_ROWS = 1000000 // 默认 表的行数超过多少才拆分成多个范围并发 row copy
+
+	ROW_COPY_WRITER_INSERT    = "insert"    // row copy 通过 INSERT IGNORE 语句写入目标
+	ROW_COPY_WRITER_LOAD_DATA = "load-data" // row copy 通过 LOAD DATA LOCAL INFILE 流式写入目标
+
+	QUEUE_HIGH_WATER_MB   = 512   // 默认 应用binlog 队列中缓存超过多少MB暂停解析binlog
+	QUEUE_LOW_WATER_MB    = 256   // 默认 应用binlog 队列中缓存少于多少MB继续解析binlog
+	QUEUE_HIGH_WATER_ROWS = 10000 // 默认 应用binlog 队列中缓存超过多少行暂停解析binlog
+	QUEUE_LOW_WATER_ROWS  = 2000  // 默认 应用binlog 队列中缓存少于多少行继续解析binlog
+
+	CHECKSUM_WAIT_APPLY_TIMEOUT = 60 // 默认 checksum 等待应用binlog追上源数据位点的超时时间(秒)
+
+	CHECKSUM_FIX_MODE_ROW    = "row"    // 修复数据时逐行比较源表范围中的每一行
+	CHECKSUM_FIX_MODE_BISECT = "bisect" // 修复数据时二分查找不一致的行, 可以发现只在目标存在的行
+	CHECKSUM_BISECT_ROWS     = 64       // 默认 二分到范围行数少于多少时逐行比较
+
+	CHECKSUM_DIFF_SAMPLE_ROWS = 10 // 默认 每个表最多保存多少行不一致数据的样例, 用于生成报告
+
+	CHECKSUM_COUNT_PARALLER = 16 // 默认 单独运行 count 级别 checksum 的并发数, 只比较行数开销很小
+
+	ROLLING_CHECKSUM_CHUNK_INTERVAL = 1    // 默认 滚动校验每个范围之间间隔多少秒
+	ROLLING_CHECKSUM_ROUND_INTERVAL = 3600 // 默认 滚动校验每一轮之间间隔多少秒
 )
 
 // 在启动一个任务时用于接收和保存 命令行输入的参数值
@@ -29,6 +68,8 @@ type RunParser struct {
 	StartLogFile string // 任务开始binlog文件
 	StartLogPos  int    // 任务开始binlog 位点
 
+	IsStartLogPosSpecified bool // 开始位点是否是命令行指定的, 不是之前运行保存的
+
 	StopLogFile string // 应用到那个 binlog 停止
 	StopLogPos  int    // 应用到 binlog 哪个位点停止
 
@@ -44,12 +85,70 @@ type RunParser struct {
 	ApplyBinlogHighWaterMark int // 进行 应用 binlog 队列中最多缓存多少个值
 	RowCopyHighWaterMark     int // 进行row copy队列中最多缓存多少个值
 
+	QueueHighWaterMB   int // 应用binlog 队列中缓存超过多少MB暂停解析binlog, 0 不检测
+	QueueLowWaterMB    int // 应用binlog 队列中缓存少于多少MB继续解析binlog
+	QueueHighWaterRows int // 应用binlog 队列中缓存超过多少行暂停解析binlog, 0 不检测
+	QueueLowWaterRows  int // 应用binlog 队列中缓存少于多少行继续解析binlog
+
 	RowCopyLimit int // 进行每次 row copy 的行数
 
+	RowCopyChunkTime     float64 // 自适应 row copy 每次期望的耗时(秒), <= 0 不开启, 使用固定的 RowCopyLimit
+	RowCopyMinLimit      int     // 自适应 row copy 每次最少行数
+	RowCopyMaxLimit      int     // 自适应 row copy 每次最多行数
+	RowCopyChunkMaxBytes int     // 自适应 row copy 每次最多字节数, 防止大字段的表一次拷贝太多数据
+
+	RowCopySchedule      string // row copy 表调度策略
+	RowCopyTableParaller int    // 每个表最多同时进行 row copy 的范围个数, 0 不限制
+
+	RowCopySplitCount   int // 大表拆分成多少个范围, 每个范围单独生成主键值并发 row copy, <= 1 不拆分
+	RowCopySplitMinRows int // 表的行数(估算)超过多少才进行拆分
+
+	RowCopyWriter string // row copy 写入目标的方式
+
+	ChecksumAlgorithm string // checksum 每行数据使用的 hash 算法: crc32, md5, sha1, sha256
+
+	ChecksumLevel string // checksum 级别: count, crc, full
+
+	ChecksumWaitApplyTimeout int // checksum 等待应用binlog追上源数据位点的超时时间(秒), 0 不等待
+
+	ChecksumFixMode    string // checksum 修复数据的方式: row, bisect
+	ChecksumBisectRows int    // 二分到范围行数少于多少时逐行比较
+
+	ChecksumDeleteExtraDryRun bool // checksum 修复数据时目标多出的行只打印不删除
+
+	ChecksumFixSqlFile string // checksum 修复数据时不直接修改目标, 把修复sql写入该文件
+
+	ChecksumGoCompare bool // checksum 不一致时, 在Go中逐行宽容的比较数据, 源和目标字段类型不一样时使用
+
+	ChecksumDiffSampleRows int // checksum 修复数据时每个表最多保存多少行不一致数据的样例, 0 不保存
+
+	EnableRollingChecksum        bool    // row copy 完成后是否循环对所有的表进行滚动校验
+	RollingChecksumChunkInterval float64 // 滚动校验每个范围之间间隔多少秒
+	RollingChecksumRoundInterval int     // 滚动校验每一轮之间间隔多少秒
+
 	HeartbeatSchema string // 心跳数据库
 	HeartbeatTable  string // 心跳表 该表的数据不会被应用, 主要是为了解析的位点能不段变, 应用的位点有可能不变
 
 	ErrRetryCount int // 当出现错误的时候默认重试次数
+
+	EnableTargetCheckpoint bool   // 是否将应用binlog的位点和数据在同一个事务中保存到目标实例
+	TargetCheckpointSchema string // 目标实例保存 checkpoint 的库
+	TargetCheckpointTable  string // 目标实例保存 checkpoint 的表
+
+	EnableSnapshot bool // 是否使用一致性快照进行 row copy
+
+	// 限流的初始值, task_throttle 中不为 NULL 的值会覆盖这些值, 并且可以在运行时修改
+	MaxSourceThreadsRunning int    // 源实例 Threads_running 超过该值进行限流, 0 不检测
+	MaxTargetThreadsRunning int    // 目标实例 Threads_running 超过该值进行限流, 0 不检测
+	MaxReplicaLag           int    // 目标从库延时(秒)超过该值进行限流, 0 不检测
+	ThrottleReplicas        string // 需要检测延时的目标从库 host1:port1,host2:port2
+	ThrottleQuery           string // 在目标实例执行的自定义检测sql, 返回值大于0进行限流
+	ThrottleBinlogApply     bool   // 限流时是否暂停应用binlog
+
+	// 限速的初始值, task 中不为 NULL 的值会覆盖这些值, 并且可以在运行时修改
+	RowCopyMaxRowsPerSec     int64 // row copy 每秒最多从源读取的行数, 0 不限制
+	RowCopyMaxBytesPerSec    int64 // row copy 每秒最多从源读取的字节数, 0 不限制
+	ApplyBinlogMaxRowsPerSec int64 // 应用binlog 每秒最多写入目标的行数, 0 不限制
 }
 
 // 对输入的命令进行检测
@@ -73,6 +172,7 @@ func (this *RunParser) Parse() error {
 	// 解析并发队列缓存大小
 	this.ParseApplyBinlogHighWaterMark()
 	this.ParseRowCopyHighWaterMark()
+	this.ParseQueueWaterMark()
 
 	// 解析相关并发数
 	this.ParseApplyBinlogParaller()
@@ -82,6 +182,35 @@ func (this *RunParser) Parse() error {
 
 	// 解析每次row copy行数
 	this.ParseRowCopyLimit()
+	this.ParseRowCopyChunkTime()
+
+	// 解析 row copy 表调度策略
+	if err := this.ParseRowCopySchedule(); err != nil {
+		return err
+	}
+
+	// 解析 row copy 写入目标的方式
+	if err := this.ParseRowCopyWriter(); err != nil {
+		return err
+	}
+
+	// 解析 checksum 算法
+	if err := this.ParseChecksumAlgorithm(); err != nil {
+		return err
+	}
+
+	// 解析 checksum 级别
+	if err := this.ParseChecksumLevel(); err != nil {
+		return err
+	}
+
+	// 解析 checksum 修复数据的方式
+	if err := this.ParseChecksumFixMode(); err != nil {
+		return err
+	}
+
+	// 解析 滚动校验 信息
+	this.ParseRollingChecksum()
 
 	// 解析 heartbeat schema 和 heartbeat table
 	if err := this.ParseHeartbeat(); err != nil {
@@ -91,6 +220,17 @@ func (this *RunParser) Parse() error {
 	// 解析 出错重试次数
 	this.ParseErrRetryCount()
 
+	// 解析 目标 checkpoint 信息
+	this.ParseTargetCheckpoint()
+
+	// 解析 限流 信息
+	if err := this.ParseThrottle(); err != nil {
+		return err
+	}
+
+	// 解析 限速 信息
+	this.ParseRateLimit()
+
 	return nil
 }
 
@@ -98,6 +238,7 @@ func (this *RunParser) Parse() error {
 func (this *RunParser) ParseStartBinlogInfo() error {
 	// 如果有手动指定开始位点则不需要去数据库中取
 	if strings.TrimSpace(this.StartLogFile) != "" { // 命令行有指定开始的 binlog 文件
+		this.IsStartLogPosSpecified = true
 		if this.StartLogPos >= 0 { // 命令行有指定开始的 binlog 位点
 			return nil
 		} else { // 命令行没有指定开始的binlog 位点, 进行赋值为 0
@@ -341,6 +482,57 @@ func (this *RunParser) ParseRowCopyHighWaterMark() {
 	return
 }
 
+/* 解析 应用binlog 队列缓存的高低水位, 命令行 > 数据库 > 默认值
+字节数使用 task.queue_high_water_mb, task.queue_low_water_mb
+行数使用 task.row_high_water_mark, task.row_low_water_mark
+*/
+func (this *RunParser) ParseQueueWaterMark() {
+	taskDao := new(dao.TaskDao)
+	columnStr := "queue_high_water_mb, queue_low_water_mb, row_high_water_mark, row_low_water_mark"
+	task, err := taskDao.GetByTaskUUID(this.TaskUUID, columnStr)
+	if err != nil {
+		logger.M.Errorf("失败. 解析应用binlog队列水位(从数据库获取数据时). 没有指定的使用默认值. %v", err)
+	}
+	if task == nil {
+		task = new(model.Task)
+	}
+
+	this.QueueHighWaterMB = getWaterMark(this.QueueHighWaterMB, task.QueueHighWaterMB, QUEUE_HIGH_WATER_MB)
+	this.QueueLowWaterMB = getWaterMark(this.QueueLowWaterMB, task.QueueLowWaterMB, QUEUE_LOW_WATER_MB)
+	this.QueueHighWaterRows = getWaterMark(this.QueueHighWaterRows, task.RHWM, QUEUE_HIGH_WATER_ROWS)
+	this.QueueLowWaterRows = getWaterMark(this.QueueLowWaterRows, task.RLWM, QUEUE_LOW_WATER_ROWS)
+
+	// 低水位必须小于高水位, 否则暂停后马上又继续
+	if this.QueueHighWaterMB > 0 && this.QueueLowWaterMB >= this.QueueHighWaterMB {
+		logger.M.Warnf("警告. 队列字节数低水位 %vMB >= 高水位 %vMB. 低水位设置为高水位的一半", this.QueueLowWaterMB, this.QueueHighWaterMB)
+		this.QueueLowWaterMB = this.QueueHighWaterMB / 2
+	}
+	if this.QueueHighWaterRows > 0 && this.QueueLowWaterRows >= this.QueueHighWaterRows {
+		logger.M.Warnf("警告. 队列行数低水位 %v >= 高水位 %v. 低水位设置为高水位的一半", this.QueueLowWaterRows, this.QueueHighWaterRows)
+		this.QueueLowWaterRows = this.QueueHighWaterRows / 2
+	}
+
+	logger.M.Infof("应用binlog队列水位. 字节数: 高 %vMB, 低 %vMB. 行数: 高 %v, 低 %v. (高水位为0不检测)",
+		this.QueueHighWaterMB, this.QueueLowWaterMB, this.QueueHighWaterRows, this.QueueLowWaterRows)
+}
+
+/* 获取水位值, 命令行指定(>= 0)优先, 其次是数据库中的值, 都没有使用默认值
+Params:
+    _cliValue: 命令行的值, < 0 为没有指定
+    _dbValue: 数据库中的值
+    _defaultValue: 默认值
+*/
+func getWaterMark(cliValue int, dbValue sql.NullInt64, defaultValue int) int {
+	if cliValue >= 0 {
+		return cliValue
+	}
+	if dbValue.Valid && dbValue.Int64 >= 0 {
+		return int(dbValue.Int64)
+	}
+
+	return defaultValue
+}
+
 // 解析每次 row copy 的行数
 func (this *RunParser) ParseRowCopyLimit() {
 	// 如果在命令行参数中有指定 每次row copy 的行数.
@@ -371,6 +563,187 @@ func (this *RunParser) ParseRowCopyLimit() {
 	return
 }
 
+// 解析 自适应 row copy 行数的上下限, 开启时初始行数需要在上下限之间
+func (this *RunParser) ParseRowCopyChunkTime() {
+	if this.RowCopyChunkTime <= 0 {
+		return
+	}
+
+	if this.RowCopyMinLimit <= 0 {
+		this.RowCopyMinLimit = ROW_COPY_MIN_LIMIT
+	}
+	if this.RowCopyMaxLimit <= 0 {
+		this.RowCopyMaxLimit = ROW_COPY_MAX_LIMIT
+	}
+	if this.RowCopyMaxLimit < this.RowCopyMinLimit {
+		logger.M.Warnf("自适应 row copy 最多行数 %v 小于最少行数 %v. 最多行数设置为 %v",
+			this.RowCopyMaxLimit, this.RowCopyMinLimit, this.RowCopyMinLimit)
+		this.RowCopyMaxLimit = this.RowCopyMinLimit
+	}
+	if this.RowCopyChunkMaxBytes <= 0 {
+		this.RowCopyChunkMaxBytes = ROW_COPY_CHUNK_MAX_BYTES
+	}
+
+	if this.RowCopyLimit < this.RowCopyMinLimit {
+		this.RowCopyLimit = this.RowCopyMinLimit
+	} else if this.RowCopyLimit > this.RowCopyMaxLimit {
+		this.RowCopyLimit = this.RowCopyMaxLimit
+	}
+
+	logger.M.Warnf("开启了自适应 row copy 行数. 期望耗时: %vs, 行数范围: [%v, %v], 最多字节数: %v, 初始行数: %v",
+		this.RowCopyChunkTime, this.RowCopyMinLimit, this.RowCopyMaxLimit, this.RowCopyChunkMaxBytes, this.RowCopyLimit)
+}
+
+// 解析 row copy 表调度策略, 命令行没有指定则从数据库中获取, 都没有则使用 random
+func (this *RunParser) ParseRowCopySchedule() error {
+	if strings.TrimSpace(this.RowCopySchedule) == "" {
+		taskDao := new(dao.TaskDao)
+		task, err := taskDao.GetByTaskUUID(this.TaskUUID, "row_copy_schedule")
+		if err != nil {
+			logger.M.Errorf("失败. 解析 row copy 表调度策略失败(从数据库获取数据时). 将设置称默认值: %v. %v", ROW_COPY_SCHEDULE_RANDOM, err)
+		} else if task != nil && task.RowCopySchedule.Valid {
+			this.RowCopySchedule = task.RowCopySchedule.String
+		}
+	}
+
+	this.RowCopySchedule = strings.ToLower(strings.TrimSpace(this.RowCopySchedule))
+	switch this.RowCopySchedule {
+	case "":
+		this.RowCopySchedule = ROW_COPY_SCHEDULE_RANDOM
+	case ROW_COPY_SCHEDULE_RANDOM, ROW_COPY_SCHEDULE_SMALLEST_FIRST, ROW_COPY_SCHEDULE_LARGEST_FIRST,
+		ROW_COPY_SCHEDULE_PRIORITY, ROW_COPY_SCHEDULE_ROUND_ROBIN:
+	default:
+		return fmt.Errorf("失败. 不支持的 row copy 表调度策略: %v. 可选: %v, %v, %v, %v, %v", this.RowCopySchedule,
+			ROW_COPY_SCHEDULE_RANDOM, ROW_COPY_SCHEDULE_SMALLEST_FIRST, ROW_COPY_SCHEDULE_LARGEST_FIRST,
+			ROW_COPY_SCHEDULE_PRIORITY, ROW_COPY_SCHEDULE_ROUND_ROBIN)
+	}
+
+	if this.RowCopyTableParaller < 0 {
+		this.RowCopyTableParaller = 0
+	}
+
+	logger.M.Infof("row copy 表调度策略: %v, 每个表最多同时进行 row copy 的范围个数: %v", this.RowCopySchedule, this.RowCopyTableParaller)
+
+	return nil
+}
+
+// 解析 row copy 写入目标的方式, 命令行没有指定则使用任务中的设置
+func (this *RunParser) ParseRowCopyWriter() error {
+	if strings.TrimSpace(this.RowCopyWriter) == "" {
+		taskDao := new(dao.TaskDao)
+		task, err := taskDao.GetByTaskUUID(this.TaskUUID, "row_copy_writer")
+		if err != nil {
+			logger.M.Errorf("失败. 解析 row copy 写入目标的方式失败(从数据库获取数据时). 将设置称默认值: %v. %v", ROW_COPY_WRITER_INSERT, err)
+		} else if task != nil && task.RowCopyWriter.Valid {
+			this.RowCopyWriter = task.RowCopyWriter.String
+		}
+	}
+
+	this.RowCopyWriter = strings.ToLower(strings.TrimSpace(this.RowCopyWriter))
+	switch this.RowCopyWriter {
+	case "":
+		this.RowCopyWriter = ROW_COPY_WRITER_INSERT
+	case ROW_COPY_WRITER_INSERT, ROW_COPY_WRITER_LOAD_DATA:
+	default:
+		return fmt.Errorf("失败. 不支持的 row copy 写入目标的方式: %v. 可选: %v, %v", this.RowCopyWriter,
+			ROW_COPY_WRITER_INSERT, ROW_COPY_WRITER_LOAD_DATA)
+	}
+
+	logger.M.Infof("row copy 写入目标的方式: %v", this.RowCopyWriter)
+
+	return nil
+}
+
+// 解析 checksum 算法, 命令行没有指定则使用任务中的设置
+func (this *RunParser) ParseChecksumAlgorithm() error {
+	if strings.TrimSpace(this.ChecksumAlgorithm) == "" {
+		taskDao := new(dao.TaskDao)
+		task, err := taskDao.GetByTaskUUID(this.TaskUUID, "checksum_algorithm")
+		if err != nil {
+			logger.M.Errorf("失败. 解析 checksum 算法失败(从数据库获取数据时). 将设置称默认值: %v. %v", matemap.CHECKSUM_ALGORITHM_DEFAULT, err)
+		} else if task != nil && task.ChecksumAlgorithm.Valid {
+			this.ChecksumAlgorithm = task.ChecksumAlgorithm.String
+		}
+	}
+
+	this.ChecksumAlgorithm = strings.ToLower(strings.TrimSpace(this.ChecksumAlgorithm))
+	if this.ChecksumAlgorithm == "" {
+		this.ChecksumAlgorithm = matemap.CHECKSUM_ALGORITHM_DEFAULT
+	}
+	if !matemap.IsChecksumAlgorithm(this.ChecksumAlgorithm) {
+		return fmt.Errorf("失败. 不支持的 checksum 算法: %v. 可选: %v, %v, %v, %v", this.ChecksumAlgorithm,
+			matemap.CHECKSUM_ALGORITHM_CRC32, matemap.CHECKSUM_ALGORITHM_MD5, matemap.CHECKSUM_ALGORITHM_SHA1, matemap.CHECKSUM_ALGORITHM_SHA256)
+	}
+
+	logger.M.Infof("checksum 算法: %v", this.ChecksumAlgorithm)
+
+	return nil
+}
+
+// 解析 checksum 级别
+func (this *RunParser) ParseChecksumLevel() error {
+	this.ChecksumLevel = strings.ToLower(strings.TrimSpace(this.ChecksumLevel))
+	if this.ChecksumLevel == "" {
+		this.ChecksumLevel = matemap.CHECKSUM_LEVEL_DEFAULT
+	}
+	if !matemap.IsChecksumLevel(this.ChecksumLevel) {
+		return fmt.Errorf("失败. 不支持的 checksum 级别: %v. 可选: %v, %v, %v", this.ChecksumLevel,
+			matemap.CHECKSUM_LEVEL_COUNT, matemap.CHECKSUM_LEVEL_CRC, matemap.CHECKSUM_LEVEL_FULL)
+	}
+
+	logger.M.Infof("checksum 级别: %v", this.ChecksumLevel)
+
+	return nil
+}
+
+// 解析 checksum 修复数据的方式
+func (this *RunParser) ParseChecksumFixMode() error {
+	this.ChecksumFixMode = strings.ToLower(strings.TrimSpace(this.ChecksumFixMode))
+	switch this.ChecksumFixMode {
+	case "":
+		this.ChecksumFixMode = CHECKSUM_FIX_MODE_BISECT
+	case CHECKSUM_FIX_MODE_ROW, CHECKSUM_FIX_MODE_BISECT:
+	default:
+		return fmt.Errorf("失败. 不支持的 checksum 修复数据方式: %v. 可选: %v, %v", this.ChecksumFixMode, CHECKSUM_FIX_MODE_ROW, CHECKSUM_FIX_MODE_BISECT)
+	}
+
+	if this.ChecksumBisectRows < 1 {
+		logger.M.Warnf("警告. 二分到范围行数少于多少时逐行比较(%v) 必须 >= 1. 将设置称默认值: %v", this.ChecksumBisectRows, CHECKSUM_BISECT_ROWS)
+		this.ChecksumBisectRows = CHECKSUM_BISECT_ROWS
+	}
+
+	logger.M.Infof("checksum 修复数据方式: %v, 二分到范围行数 <= %v 时逐行比较", this.ChecksumFixMode, this.ChecksumBisectRows)
+
+	this.ChecksumFixSqlFile = strings.TrimSpace(this.ChecksumFixSqlFile)
+	if this.ChecksumFixSqlFile != "" {
+		logger.M.Warnf("checksum 修复数据时不直接修改目标, 修复sql写入文件: %v. 审核后使用 checksum apply-fix 执行", this.ChecksumFixSqlFile)
+	}
+
+	if this.ChecksumDiffSampleRows < 0 {
+		logger.M.Warnf("警告. 每个表最多保存不一致数据样例行数(%v) 必须 >= 0. 将设置称默认值: %v", this.ChecksumDiffSampleRows, CHECKSUM_DIFF_SAMPLE_ROWS)
+		this.ChecksumDiffSampleRows = CHECKSUM_DIFF_SAMPLE_ROWS
+	}
+
+	return nil
+}
+
+// 解析 滚动校验的间隔, 小于0使用默认值
+func (this *RunParser) ParseRollingChecksum() {
+	if !this.EnableRollingChecksum {
+		return
+	}
+
+	if this.RollingChecksumChunkInterval < 0 {
+		this.RollingChecksumChunkInterval = ROLLING_CHECKSUM_CHUNK_INTERVAL
+	}
+	if this.RollingChecksumRoundInterval < 0 {
+		this.RollingChecksumRoundInterval = ROLLING_CHECKSUM_ROUND_INTERVAL
+	}
+
+	logger.M.Warnf("开启了滚动校验, row copy 完成后将循环对所有的表进行校验. 每个范围间隔: %vs, 每一轮间隔: %vs",
+		this.RollingChecksumChunkInterval, this.RollingChecksumRoundInterval)
+}
+
 // 解析 心跳检测所需信息
 func (this *RunParser) ParseHeartbeat() error {
 	// 如果在命令行参数中有指定 heartbeat 库和表, 则使用命令行指定的
@@ -434,6 +807,67 @@ func (this *RunParser) ParseErrRetryCount() {
 	}
 }
 
+// 解析 目标 checkpoint 库和表, 没有指定则使用默认值
+func (this *RunParser) ParseTargetCheckpoint() {
+	if !this.EnableTargetCheckpoint {
+		return
+	}
+
+	if strings.TrimSpace(this.TargetCheckpointSchema) == "" {
+		this.TargetCheckpointSchema = TARGET_CHECKPOINT_SCHEMA
+	}
+	if strings.TrimSpace(this.TargetCheckpointTable) == "" {
+		this.TargetCheckpointTable = TARGET_CHECKPOINT_TABLE
+	}
+
+	logger.M.Warnf("开启了目标 checkpoint, 应用binlog位点将和数据在同一个事务中保存到目标实例 %v.%v",
+		this.TargetCheckpointSchema, this.TargetCheckpointTable)
+}
+
+// 解析 限流 的初始值, 检测需要检测延时的从库格式是否正确
+func (this *RunParser) ParseThrottle() error {
+	if this.MaxSourceThreadsRunning < 0 {
+		this.MaxSourceThreadsRunning = 0
+	}
+	if this.MaxTargetThreadsRunning < 0 {
+		this.MaxTargetThreadsRunning = 0
+	}
+	if this.MaxReplicaLag < 0 {
+		this.MaxReplicaLag = 0
+	}
+	this.ThrottleReplicas = strings.TrimSpace(this.ThrottleReplicas)
+	this.ThrottleQuery = strings.TrimSpace(this.ThrottleQuery)
+
+	if _, err := common.ParseHostPorts(this.ThrottleReplicas); err != nil {
+		return fmt.Errorf("失败. 需要检测延时的从库格式不正确. %v", err)
+	}
+	if this.MaxReplicaLag > 0 && this.ThrottleReplicas == "" {
+		logger.M.Warnf("警告. 指定了从库延时限流 %v 秒, 但是没有指定需要检测延时的从库, 可以在 task_throttle 中指定", this.MaxReplicaLag)
+	}
+
+	logger.M.Infof("限流初始值. 源 Threads_running: %v, 目标 Threads_running: %v, 从库延时: %v 秒, 从库: %v, 自定义sql: %v, 暂停应用binlog: %v",
+		this.MaxSourceThreadsRunning, this.MaxTargetThreadsRunning, this.MaxReplicaLag, this.ThrottleReplicas,
+		this.ThrottleQuery, this.ThrottleBinlogApply)
+
+	return nil
+}
+
+// 解析 限速 的初始值, 小于0则不限速
+func (this *RunParser) ParseRateLimit() {
+	if this.RowCopyMaxRowsPerSec < 0 {
+		this.RowCopyMaxRowsPerSec = 0
+	}
+	if this.RowCopyMaxBytesPerSec < 0 {
+		this.RowCopyMaxBytesPerSec = 0
+	}
+	if this.ApplyBinlogMaxRowsPerSec < 0 {
+		this.ApplyBinlogMaxRowsPerSec = 0
+	}
+
+	logger.M.Infof("限速初始值. row copy 每秒行数: %v, 每秒字节数: %v. 应用binlog 每秒行数: %v",
+		this.RowCopyMaxRowsPerSec, this.RowCopyMaxBytesPerSec, this.ApplyBinlogMaxRowsPerSec)
+}
+
 /* 设置binlog位点信息, 通过给的实例 host, port
 Params:
     _host: 实例host
@@ -0,0 +1,110 @@
+package service
+
+import (
+	"github.com/daiguadaidai/go-d-bus/config"
+	"github.com/daiguadaidai/go-d-bus/logger"
+	"github.com/daiguadaidai/go-d-bus/matemap"
+	"github.com/daiguadaidai/go-d-bus/parser"
+	mysqlcs "github.com/daiguadaidai/go-d-bus/service/mysqlchecksum"
+)
+
+/* 不启动迁移, 单独对任务的源和目标数据进行校验
+Params:
+    _checksumParser: 启动参数
+Return: 校验的汇总结果
+*/
+func StartChecksumVerify(checksumParser *parser.ChecksumParser) *mysqlcs.VerifySummary {
+	// 获取配置映射信息
+	configMap, err := config.NewConfigMap(checksumParser.TaskUUID)
+	if err != nil {
+		logger.M.Fatal(err)
+	}
+
+	// 获取随机其中一个schemaMap
+	randSchemaMap := configMap.GetRandSchemaMap()
+	if randSchemaMap == nil {
+		logger.M.Fatal("随机获取一个数据库映射信息失败, 没有数据库映射信息")
+	}
+
+	// 链接原数据数据库
+	if err := InitSourceDB(configMap.Source, randSchemaMap.Source.String); err != nil {
+		logger.M.Fatalf("初始化(源)数据库链接出错, %v", err)
+	}
+
+	// 指定了读取数据的从库, 多行 checksum 从从库读取源数据
+	if configMap.Source.HasReadReplica() {
+		if err := InitSourceReadDB(configMap.Source, randSchemaMap.Source.String); err != nil {
+			logger.M.Fatalf("初始化(源从库)数据库链接出错, %v", err)
+		}
+	}
+
+	// 初始化目标连接数
+	if err := InitTargetDB(configMap.Target, randSchemaMap.Target.String); err != nil {
+		logger.M.Fatalf("初始化(目标)数据库链接出错, %v", err)
+	}
+
+	// 初始化需要迁移的表, checksum sql 模板使用任务指定的算法
+	if err := matemap.SetChecksumAlgorithm(checksumParser.ChecksumAlgorithm); err != nil {
+		logger.M.Fatal(err)
+	}
+	if err := matemap.SetChecksumLevel(checksumParser.ChecksumLevel); err != nil {
+		logger.M.Fatal(err)
+	}
+	if err := matemap.InitMigrationTableMap(configMap); err != nil {
+		logger.M.Fatal(err)
+	}
+
+	checksumVerify, err := mysqlcs.NewChecksumVerify(&checksumParser.RunParser, configMap, checksumParser.GetTableNames(), checksumParser.Fix)
+	if err != nil {
+		logger.M.Fatal(err)
+	}
+
+	return checksumVerify.Start()
+}
+
+/* 执行人工审核过的修复sql文件, 执行前再次比较每一行的数据
+Params:
+    _applyFixParser: 启动参数
+Return: 执行的汇总结果
+*/
+func StartChecksumApplyFix(applyFixParser *parser.ChecksumApplyFixParser) *mysqlcs.ApplyFixSummary {
+	// 获取配置映射信息
+	configMap, err := config.NewConfigMap(applyFixParser.TaskUUID)
+	if err != nil {
+		logger.M.Fatal(err)
+	}
+
+	// 获取随机其中一个schemaMap
+	randSchemaMap := configMap.GetRandSchemaMap()
+	if randSchemaMap == nil {
+		logger.M.Fatal("随机获取一个数据库映射信息失败, 没有数据库映射信息")
+	}
+
+	// 链接原数据数据库
+	if err := InitSourceDB(configMap.Source, randSchemaMap.Source.String); err != nil {
+		logger.M.Fatalf("初始化(源)数据库链接出错, %v", err)
+	}
+
+	// 初始化目标连接数
+	if err := InitTargetDB(configMap.Target, randSchemaMap.Target.String); err != nil {
+		logger.M.Fatalf("初始化(目标)数据库链接出错, %v", err)
+	}
+
+	// 初始化需要迁移的表, checksum sql 模板使用生成修复sql时的算法
+	if err := matemap.SetChecksumAlgorithm(applyFixParser.ChecksumAlgorithm); err != nil {
+		logger.M.Fatal(err)
+	}
+	if err := matemap.InitMigrationTableMap(configMap); err != nil {
+		logger.M.Fatal(err)
+	}
+
+	summary, err := mysqlcs.ApplyFixSqlFile(configMap, applyFixParser.File, applyFixParser.ErrRetryCount)
+	if err != nil {
+		if summary != nil {
+			logger.M.Error(summary.String())
+		}
+		logger.M.Fatal(err)
+	}
+
+	return summary
+}
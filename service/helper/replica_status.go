@@ -0,0 +1,67 @@
+package helper
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/daiguadaidai/go-d-bus/gdbc"
+	"strings"
+)
+
+/* 获取从库的复制状态, 返回 map: {"字段名": 值}
+Params:
+    _host: 从库 host
+    _port: 从库 port
+*/
+func GetReplicaStatus(host string, port int) (map[string]sql.NullString, error) {
+	instance, ok := gdbc.GetDynamicDBByHostPort(host, int64(port))
+	if !ok {
+		return nil, fmt.Errorf("缓存中不存在该实例(%v:%v). 获取从库复制状态", host, port)
+	}
+
+	rows, err := instance.Query("/* go-d-bus */ SHOW SLAVE STATUS")
+	if err != nil {
+		// MySQL 8.4 之后只能使用 SHOW REPLICA STATUS
+		if rows, err = instance.Query("/* go-d-bus */ SHOW REPLICA STATUS"); err != nil {
+			return nil, fmt.Errorf("失败. 获取从库复制状态. %v:%v. %v", host, port, err)
+		}
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, fmt.Errorf("失败. 获取从库状态的字段. %v:%v. %v", host, port, err)
+	}
+	if !rows.Next() {
+		return nil, fmt.Errorf("失败. %v:%v 不是从库, 没有获取到复制状态", host, port)
+	}
+
+	values := make([]sql.NullString, len(columns))
+	scanArgs := make([]interface{}, len(columns))
+	for i := range values {
+		scanArgs[i] = &values[i]
+	}
+	if err := rows.Scan(scanArgs...); err != nil {
+		return nil, fmt.Errorf("失败. 获取从库状态. %v:%v. %v", host, port, err)
+	}
+
+	statusMap := make(map[string]sql.NullString)
+	for i, column := range columns {
+		statusMap[column] = values[i]
+	}
+
+	return statusMap, nil
+}
+
+/* 从复制状态中获取字段值, 兼容 MySQL 8.0.22 之后 Master 改名为 Source 的字段
+Params:
+    _statusMap: 复制状态
+    _masterColumn: 老版本的字段名, 如: Seconds_Behind_Master
+*/
+func GetReplicaStatusValue(statusMap map[string]sql.NullString, masterColumn string) sql.NullString {
+	if value, ok := statusMap[masterColumn]; ok {
+		return value
+	}
+
+	sourceColumn := strings.Replace(masterColumn, "Master", "Source", 1)
+	return statusMap[sourceColumn]
+}
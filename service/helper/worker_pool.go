@@ -0,0 +1,194 @@
+package helper
+
+import (
+	"github.com/daiguadaidai/go-d-bus/logger"
+	"sync"
+	"time"
+)
+
+const (
+	PARALLER_WATCH_INTERVAL = 5 * time.Second // 多久从数据库中获取一次并发数, 运行时修改并发数
+)
+
+/* 可以在运行时调整并发数的协程池
+每个协程有一个编号, 调小并发数后, 编号 >= 并发数的协程处理完当前的数据后退出.
+调大并发数后, 启动缺少编号的协程. 数据处理完(通道关闭)后不再启动新的协程
+协程在获取下一个数据前调用 IsRetired, 通道关闭后调用 Close, 退出时调用 Exit
+*/
+type WorkerPool struct {
+	Name        string        // 协程池名称, 用于记录日志
+	MaxParaller int           // 最大并发数, 0 不限制
+	spawn       func(tag int) // 启动一个指定编号的协程, 需要自己调用 go
+	mu          sync.Mutex
+	paraller    int          // 当前并发数
+	running     map[int]bool // 正在运行的协程编号
+	retiring    map[int]bool // 因为调小并发数正在退出的协程编号
+	closed      bool         // 数据已经处理完, 不再启动新的协程
+}
+
+/* 创建协程池
+Params:
+    _name: 协程池名称
+    _paraller: 初始并发数
+    _maxParaller: 最大并发数, 0 不限制
+    _spawn: 启动一个指定编号的协程, 需要自己调用 go
+*/
+func NewWorkerPool(_name string, _paraller int, _maxParaller int, _spawn func(tag int)) *WorkerPool {
+	return &WorkerPool{
+		Name:        _name,
+		MaxParaller: _maxParaller,
+		spawn:       _spawn,
+		paraller:    _paraller,
+		running:     make(map[int]bool),
+		retiring:    make(map[int]bool),
+	}
+}
+
+// 启动初始并发数个协程
+func (this *WorkerPool) Start() {
+	this.Resize(this.Paraller())
+}
+
+/* 调整并发数
+Params:
+    _paraller: 新的并发数, 最小为1
+*/
+func (this *WorkerPool) Resize(_paraller int) {
+	if _paraller < 1 {
+		_paraller = 1
+	}
+	if this.MaxParaller > 0 && _paraller > this.MaxParaller {
+		logger.M.Warnf("警告. %v 并发数 %v 超过了上限 %v. 使用上限", this.Name, _paraller, this.MaxParaller)
+		_paraller = this.MaxParaller
+	}
+
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if this.closed {
+		return
+	}
+
+	if _paraller != this.paraller {
+		logger.M.Infof("调整 %v 并发数: %v -> %v", this.Name, this.paraller, _paraller)
+	}
+	this.paraller = _paraller
+
+	for tag := 0; tag < this.paraller; tag++ {
+		if this.running[tag] { // 正在退出的协程, 退出时会重新启动
+			continue
+		}
+		this.running[tag] = true
+		this.spawn(tag)
+	}
+}
+
+/* 协程在获取下一个数据之前调用, 编号 >= 并发数则需要退出
+Params:
+    _tag: 协程编号
+*/
+func (this *WorkerPool) IsRetired(_tag int) bool {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if _tag < this.paraller {
+		return false
+	}
+
+	this.retiring[_tag] = true
+	logger.M.Infof("%v 并发数调整为 %v, 协程 %v 退出", this.Name, this.paraller, _tag)
+
+	return true
+}
+
+// 数据已经处理完(通道关闭), 不再启动新的协程
+func (this *WorkerPool) Close() {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	this.closed = true
+}
+
+/* 协程退出时调用
+Params:
+    _tag: 协程编号
+Return: 是否是最后一个退出的协程, 最后一个协程退出后不再启动新的协程
+*/
+func (this *WorkerPool) Exit(_tag int) bool {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	// 退出的过程中又调大了并发数, 重新启动该编号的协程
+	if this.retiring[_tag] {
+		delete(this.retiring, _tag)
+		if !this.closed && _tag < this.paraller {
+			this.spawn(_tag)
+			return false
+		}
+	}
+
+	delete(this.running, _tag)
+	if len(this.running) == 0 {
+		this.closed = true
+		return true
+	}
+
+	return false
+}
+
+// 是否已经处理完所有数据
+func (this *WorkerPool) IsClosed() bool {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	return this.closed
+}
+
+// 当前并发数
+func (this *WorkerPool) Paraller() int {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	return this.paraller
+}
+
+/* 循环获取协程池的并发数, 和上一次获取的值不一样则调整并发数, 数据处理完后退出
+Params:
+    _getParaller: 获取并发数
+*/
+func (this *WorkerPool) LoopWatchParaller(_getParaller func() (int, error)) {
+	LoopWatchParaller(this.Name, _getParaller, this.Resize, this.IsClosed)
+}
+
+/* 循环获取并发数, 和上一次获取的值不一样则调用 _setParaller 调整并发数
+启动时获取的值作为基准, 只有数据库中的值被修改后才调整, 保证命令行指定的并发数生效
+Params:
+    _name: 名称, 用于记录日志
+    _getParaller: 获取并发数
+    _setParaller: 调整并发数
+    _isStop: 是否停止获取
+*/
+func LoopWatchParaller(_name string, _getParaller func() (int, error), _setParaller func(int), _isStop func() bool) {
+	lastParaller, err := _getParaller()
+	hasLast := err == nil
+	for !_isStop() {
+		time.Sleep(PARALLER_WATCH_INTERVAL)
+
+		paraller, err := _getParaller()
+		if err != nil {
+			logger.M.Warnf("警告. 获取 %v 并发数失败. 继续使用当前并发数. %v", _name, err)
+			continue
+		}
+		if !hasLast {
+			lastParaller, hasLast = paraller, true
+			continue
+		}
+		if paraller == lastParaller || paraller <= 0 {
+			continue
+		}
+
+		logger.M.Infof("%v 并发数被修改: %v -> %v", _name, lastParaller, paraller)
+		lastParaller = paraller
+		_setParaller(paraller)
+	}
+}
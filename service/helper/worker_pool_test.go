@@ -0,0 +1,79 @@
+package helper
+
+import (
+	"github.com/daiguadaidai/go-d-bus/logger"
+	"go.uber.org/zap"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWorkerPool_Resize(t *testing.T) {
+	logger.M = zap.NewNop().Sugar()
+
+	dataChan := make(chan int)
+	wg := new(sync.WaitGroup)
+	var mu sync.Mutex
+	handled := make(map[int]int) // 每个协程处理的数据个数
+
+	var pool *WorkerPool
+	pool = NewWorkerPool("test", 4, 0, func(tag int) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer pool.Exit(tag)
+			for {
+				if pool.IsRetired(tag) {
+					return
+				}
+				_, ok := <-dataChan
+				if !ok {
+					pool.Close()
+					return
+				}
+				mu.Lock()
+				handled[tag]++
+				mu.Unlock()
+			}
+		}()
+	})
+	pool.Start()
+
+	// 调小并发数, 编号 >= 1 的协程处理完一个数据后退出
+	pool.Resize(1)
+	for i := 0; i < 100; i++ {
+		dataChan <- i
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	mu.Lock()
+	handled = make(map[int]int)
+	mu.Unlock()
+	for i := 0; i < 100; i++ {
+		dataChan <- i
+	}
+	time.Sleep(50 * time.Millisecond)
+	mu.Lock()
+	if len(handled) != 1 || handled[0] != 100 {
+		t.Fatalf("并发数调整为 1 后, 应该只有协程 0 处理数据. %v", handled)
+	}
+	mu.Unlock()
+
+	// 调大并发数
+	pool.Resize(3)
+	if pool.Paraller() != 3 {
+		t.Fatalf("并发数应该是 3, 实际是 %v", pool.Paraller())
+	}
+
+	close(dataChan)
+	wg.Wait()
+	if !pool.IsClosed() {
+		t.Fatalf("通道关闭后协程池应该是关闭状态")
+	}
+
+	// 关闭后不再启动新的协程
+	pool.Resize(5)
+	if pool.Paraller() != 3 {
+		t.Fatalf("关闭后不应该再调整并发数, 实际是 %v", pool.Paraller())
+	}
+}
@@ -1,6 +1,7 @@
 package service
 
 import (
+	"fmt"
 	"github.com/daiguadaidai/go-d-bus/config"
 	"github.com/daiguadaidai/go-d-bus/dao"
 	"github.com/daiguadaidai/go-d-bus/gdbc"
@@ -11,6 +12,7 @@ import (
 	mysqlab "github.com/daiguadaidai/go-d-bus/service/mysqlapplybinlog"
 	mysqlcs "github.com/daiguadaidai/go-d-bus/service/mysqlchecksum"
 	mysqlrc "github.com/daiguadaidai/go-d-bus/service/mysqlrowcopy"
+	"github.com/daiguadaidai/go-d-bus/service/throttler"
 	"github.com/daiguadaidai/go-d-bus/setting"
 	"sync"
 )
@@ -33,11 +35,38 @@ func StartMigration(runParser *parser.RunParser) {
 		logger.M.Fatalf("初始化(源)数据库链接出错, %v", err)
 	}
 
+	// 指定了读取数据的从库, row copy 和 checksum 从从库读取数据
+	if configMap.Source.HasReadReplica() {
+		if err := InitSourceReadDB(configMap.Source, randSchemaMap.Source.String); err != nil {
+			logger.M.Fatalf("初始化(源从库)数据库链接出错, %v", err)
+		}
+		if runParser.EnableSnapshot {
+			logger.M.Warnf("警告. 开启了一致性快照, row copy 从源实例的快照中读取数据, 不使用从库 %v:%v",
+				configMap.Source.ReadHost.String, configMap.Source.ReadPort.Int64)
+		}
+	}
+
 	// 初始化目标连接数
 	if err := InitTargetDB(configMap.Target, randSchemaMap.Target.String); err != nil {
 		logger.M.Fatalf("初始化(目标)数据库链接出错, %v", err)
 	}
 
+	// 开启了目标 checkpoint, 开始位点以目标实例的 checkpoint 为准
+	if runParser.EnableApplyBinlog && runParser.EnableTargetCheckpoint {
+		if err := mysqlab.ResumeFromTargetCheckpoint(runParser, configMap.Target.Host.String, configMap.Target.Port.Int64); err != nil {
+			logger.M.Fatalf("从目标实例 checkpoint 获取位点信息出错. %v, 退出迁移", err)
+		}
+	}
+
+	// 开启了一致性快照, 在 row copy 开始前建立快照, 没有开始位点则从快照位点开始应用binlog
+	var snapshot *mysqlrc.Snapshot
+	if runParser.EnableRowCopy && runParser.EnableSnapshot {
+		snapshot, err = StartSnapshot(runParser, configMap)
+		if err != nil {
+			logger.M.Fatalf("创建一致性快照出错. %v, 退出迁移", err)
+		}
+	}
+
 	// 如果没有设置binglog开始位点则show master status 找
 	if runParser.StartLogFile == "" || runParser.StartLogPos < 0 {
 		if err := runParser.SetStartBinlogInfoByHostAndPort(configMap.Source.Host.String, int(configMap.Source.Port.Int64)); err != nil {
@@ -50,7 +79,13 @@ func StartMigration(runParser *parser.RunParser) {
 		logger.M.Fatalf("迁移启动保存位点信息出错 %v", err)
 	}
 
-	// 初始化需要迁移的表
+	// 初始化需要迁移的表, checksum sql 模板使用任务指定的算法
+	if err := matemap.SetChecksumAlgorithm(runParser.ChecksumAlgorithm); err != nil {
+		logger.M.Fatal(err)
+	}
+	if err := matemap.SetChecksumLevel(runParser.ChecksumLevel); err != nil {
+		logger.M.Fatal(err)
+	}
 	err = matemap.InitMigrationTableMap(configMap)
 	if err != nil {
 		logger.M.Fatal(err)
@@ -66,18 +101,37 @@ func StartMigration(runParser *parser.RunParser) {
 	// 会在最后所有的rowcopy完成后再次对第一次不一致的进行checksum操作
 	notifySecondChecksum := make(chan bool, 1000)
 
+	// 初始化限流器, row copy, 应用binlog 和滚动校验 限流时暂停
+	var taskThrottler *throttler.Throttler
+	if runParser.EnableRowCopy || runParser.EnableApplyBinlog || (runParser.EnableChecksum && runParser.EnableRollingChecksum) {
+		taskThrottler, err = throttler.NewThrottler(runParser, configMap)
+		if err != nil {
+			logger.M.Fatalf("初始化限流器出错. %v, 退出迁移", err)
+		}
+		taskThrottler.Start()
+	}
+
+	// 应用binlog 需要在 checksum 之前创建, checksum 等待应用binlog追上读取源数据时的位点
+	var applyBinlog *mysqlab.ApplyBinlog
+	if runParser.EnableApplyBinlog {
+		applyBinlog, err = mysqlab.NewApplyBinlog(runParser, configMap)
+		if err != nil {
+			logger.M.Fatal(err)
+		}
+	}
+
 	wg := new(sync.WaitGroup)
 	// 开启了 checksum功能, 需要进行checksum
 	if runParser.EnableChecksum {
 		wg.Add(1)
-		go StartChecksum(runParser, configMap, wg, rowCopy2CheksumChan, notifySecondChecksum)
+		go StartChecksum(runParser, configMap, wg, applyBinlog, taskThrottler, rowCopy2CheksumChan, notifySecondChecksum)
 	} else {
 		logger.M.Warn("没有指定checksum, 本次迁移将不会进行数据校验")
 	}
 
 	// 开始进行 row copy
 	if runParser.EnableRowCopy {
-		err = StartRowCopy(runParser, configMap, rowCopy2CheksumChan, notifySecondChecksum)
+		err = StartRowCopy(runParser, configMap, snapshot, taskThrottler, rowCopy2CheksumChan, notifySecondChecksum)
 		if err != nil {
 			logger.M.Fatal(err)
 		}
@@ -87,10 +141,7 @@ func StartMigration(runParser *parser.RunParser) {
 
 	// 开始应用binlog
 	if runParser.EnableApplyBinlog {
-		err = StartApplyBinlog(runParser, configMap)
-		if err != nil {
-			logger.M.Fatal(err)
-		}
+		StartApplyBinlog(applyBinlog, taskThrottler)
 	} else {
 		logger.M.Warn("没有指定应用binlog, 本次迁移将不会进行binlog的应用")
 	}
@@ -100,50 +151,105 @@ func StartMigration(runParser *parser.RunParser) {
 
 /* 开始对 binlog 进行应用
 Params:
-    _parser: 启动参数
-    _configMap: 需要迁移的表的配置映射信息
-    _wg: 并发参数
+    _applyBinlog: 应用binlog
+    _throttler: 限流器
 */
-func StartApplyBinlog(_parser *parser.RunParser, _configMap *config.ConfigMap) error {
-	applyBinlog, err := mysqlab.NewApplyBinlog(_parser, _configMap)
-	if err != nil {
-		return err
-	}
+func StartApplyBinlog(_applyBinlog *mysqlab.ApplyBinlog, _throttler *throttler.Throttler) {
+	_applyBinlog.Throttler = _throttler
 
-	applyBinlog.Start()
-
-	return nil
+	_applyBinlog.Start()
 }
 
 /* 开始行拷贝
 Params:
     _parser: 启动参数
     _configMap: 需要迁移的表的配置映射信息
-    _wg: 并发参数
+    _snapshot: 一致性快照, 没有开启为 nil
+    _throttler: 限流器
 	_rowCopy2ChecksumChan: 行拷贝到checksum
 	_notifySecondChecksum: 通知可以进行二次checksum了
 */
 func StartRowCopy(
 	parser *parser.RunParser,
 	configMap *config.ConfigMap,
+	snapshot *mysqlrc.Snapshot,
+	taskThrottler *throttler.Throttler,
 	rowCopy2ChecksumChan chan *matemap.PrimaryRangeValue,
 	notifySecondChecksum chan bool,
 ) error {
 	rowCopy, err := mysqlrc.NewRowCopy(parser, configMap, rowCopy2ChecksumChan, notifySecondChecksum)
 	if err != nil {
+		if snapshot != nil {
+			snapshot.Close()
+		}
 		return err
 	}
+	rowCopy.Snapshot = snapshot
+	rowCopy.Throttler = taskThrottler
 
 	rowCopy.Start()
 
 	return nil
 }
 
+/* 建立一致性快照, row copy 已经完成的任务不需要快照
+Params:
+    _parser: 启动参数
+    _configMap: 需要迁移的表的配置映射信息
+*/
+func StartSnapshot(parser *parser.RunParser, configMap *config.ConfigMap) (*mysqlrc.Snapshot, error) {
+	isComplete, err := mysqlrc.TaskRowCopyIsComplete(configMap.TaskUUID)
+	if err != nil {
+		return nil, err
+	}
+	if isComplete {
+		logger.M.Warnf("警告. row copy 任务已经完成. 不需要创建一致性快照. %v", configMap.TaskUUID)
+		return nil, nil
+	}
+
+	// 命令行指定了开始位点, 快照比该位点新, 从旧的位点开始应用binlog,
+	// 快照之前已经应用过的事件会再次应用到快照的数据上, 数据不一致
+	if parser.IsStartLogPosSpecified {
+		return nil, fmt.Errorf("失败. 命令行指定了开始位点 %v:%v, 不能使用一致性快照进行 row copy. 请关闭 --enable-snapshot 或者不指定开始位点",
+			parser.StartLogFile, parser.StartLogPos)
+	}
+
+	// 每个 row copy 并发一个快照连接, 多出的一个给没有主键的表使用
+	snapshot, err := mysqlrc.NewSnapshot(configMap.Source.Host.String, int(configMap.Source.Port.Int64), parser.RowCopyParaller+1)
+	if err != nil {
+		return nil, err
+	}
+
+	// 之前运行时保存的位点(之前的快照位点), row copy 还没有完成. 没有完成的表从新的快照中拷贝,
+	// 已经拷贝完成的表是之前的快照中的数据, 应用binlog需要从更早的位点开始. 有主键的表重复应用binlog不会造成不一致,
+	// 没有主键的表会保存拷贝使用的快照位点, 应用binlog跳过该表在快照位点之前的事务
+	if parser.StartLogFile != "" && parser.StartLogPos >= 0 {
+		savedLogFilePos := mysqlab.NewLogFilePos(parser.StartLogFile, parser.StartLogPos)
+		snapshotLogFilePos := mysqlab.NewLogFilePos(snapshot.LogFile, snapshot.LogPos)
+		if savedLogFilePos.IsRatherThan(snapshotLogFilePos) {
+			parser.StartLogFile = snapshot.LogFile
+			parser.StartLogPos = snapshot.LogPos
+		}
+		logger.M.Warnf("警告. 任务之前保存了开始位点 %v:%v, row copy 没有完成, 重新创建一致性快照 %v:%v 拷贝没有完成的表. 应用binlog将从更早的位点开始: %v:%v",
+			savedLogFilePos.LogFile, savedLogFilePos.LogPos, snapshot.LogFile, snapshot.LogPos, parser.StartLogFile, parser.StartLogPos)
+
+		return snapshot, nil
+	}
+
+	parser.StartLogFile = snapshot.LogFile
+	parser.StartLogPos = snapshot.LogPos
+	logger.M.Infof("应用binlog将从一致性快照位点开始: %v:%v", snapshot.LogFile, snapshot.LogPos)
+
+	return snapshot, nil
+}
+
 /* 开始进行数据校验
 Params:
     _parser: 启动参数
     _configMap: 需要迁移的表的配置映射信息
     _wg: 并发参数
+    _applyBinlog: 应用binlog, 没有开启为 nil
+    _throttler: 限流器, 滚动校验使用, 没有开启为 nil
 	_rowCopy2ChecksumChan: 行拷贝到checksum
 	_notifySecondChecksum: 通知可以进行二次checksum了
 */
@@ -151,6 +257,8 @@ func StartChecksum(
 	parser *parser.RunParser,
 	configMap *config.ConfigMap,
 	wg *sync.WaitGroup,
+	applyBinlog *mysqlab.ApplyBinlog,
+	taskThrottler *throttler.Throttler,
 	rowCopy2ChecksumChan chan *matemap.PrimaryRangeValue,
 	notifySecondChecksum chan bool,
 ) error {
@@ -160,6 +268,8 @@ func StartChecksum(
 	if err != nil {
 		return err
 	}
+	checksum.ApplyBinlog = applyBinlog
+	checksum.Throttler = taskThrottler
 
 	checksum.Start()
 
@@ -187,6 +297,28 @@ func InitSourceDB(source *model.Source, dbName string) error {
 	return nil
 }
 
+// 初始化读取数据的从库连接, 使用源实例的用户名和密码
+func InitSourceReadDB(source *model.Source, dbName string) error {
+	cfg := setting.NewMysqlConfig(
+		source.ReadHost.String,
+		source.ReadPort.Int64,
+		source.UserName.String,
+		source.Password.String,
+		dbName,
+		100,
+		99,
+	)
+
+	db, err := gdbc.GetMySQLDB(cfg)
+	if err != nil {
+		return err
+	}
+
+	gdbc.AddInstanceToCache(source.ReadHost.String, source.ReadPort.Int64, db)
+
+	return nil
+}
+
 func InitTargetDB(target *model.Target, dbName string) error {
 	cfg := setting.NewMysqlConfig(
 		target.Host.String,
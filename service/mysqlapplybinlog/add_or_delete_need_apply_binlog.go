@@ -12,15 +12,23 @@ type AddOrDeleteNeedApplyBinlog struct {
 	Key string
 	Type int
 	Num int
+	LogFilePos *LogFilePos // 该事件的位点, 只有添加的时候需要
 }
 
 /* 新建一个 添加还是减少需要应用binlog的行数
 
  */
-func NewAddOrDeleteNeedApplyBinlog(_key string, _type int, _num int) *AddOrDeleteNeedApplyBinlog {
+func NewAddOrDeleteNeedApplyBinlog(_key string, _type int, _num int, _logFilePos *LogFilePos) *AddOrDeleteNeedApplyBinlog {
 	return &AddOrDeleteNeedApplyBinlog{
 		Key: _key,
 		Type: _type,
 		Num: _num,
+		LogFilePos: _logFilePos,
 	}
 }
+
+// 还需要应用的binlog事件, 保存在 NeedApplyBinlogMap 中
+type NeedApplyEvent struct {
+	LogFilePos *LogFilePos // 事件的位点
+	RowCount   int         // 还需要应用的行数
+}
@@ -0,0 +1,72 @@
+package mysqlapplybinlog
+
+import (
+	"time"
+)
+
+const (
+	WAIT_APPLIED_CHECK_INTERVAL = 100 * time.Millisecond // 等待应用binlog追上某个位点时, 检测的间隔
+)
+
+/* 更新还没应用完成的第一个事件位点和应用完成的最大位点, 给其他协程判断应用binlog是否追上某个位点.
+只在 LoopSaveApplyBinlogProgress 中调用, 每次添加或应用完成一个事件后调用
+*/
+func (this *ApplyBinlog) updateAppliedPosition() {
+	var firstPendingLogFilePos *LogFilePos
+	eventRowCountIter := this.NeedApplyBinlogMap.IterFunc()
+	if eventRowCountItem, ok := eventRowCountIter(); ok {
+		firstPendingLogFilePos = eventRowCountItem.Value.(*NeedApplyEvent).LogFilePos
+	}
+
+	this.appliedLock.Lock()
+	this.firstPendingLogFilePos = firstPendingLogFilePos
+	this.maxAppliedLogFilePos = this.AppliedMinMaxLogPos[APPLIED_MAX_VALUE_INDEX]
+	this.appliedLock.Unlock()
+}
+
+// 应用binlog是否已经开始
+func (this *ApplyBinlog) IsStarted() bool {
+	return this.Started.Load()
+}
+
+/* 应用binlog是否已经追上(应用完成)指定的位点, 该位点之前提交的事务都已经应用到目标
+Params:
+    _logFilePos: 源实例的位点, 一般是事务的边界(show master status)
+*/
+func (this *ApplyBinlog) IsAppliedPassed(_logFilePos *LogFilePos) bool {
+	// 1. 没有还需要分配和应用的事件, 解析完的事务都已经应用完成. 先获取解析到的位点再判断事件数
+	parsedTrxLogFilePos := this.GetParsedTrxLogFilePos()
+	if this.NeedDistributeEventCount.Load() == 0 && this.NeedApplyEventCount.Load() == 0 &&
+		parsedTrxLogFilePos.Compare(_logFilePos) >= 0 {
+		return true
+	}
+
+	this.appliedLock.Lock()
+	defer this.appliedLock.Unlock()
+
+	// 2. 还没应用完成的第一个事件在该位点之后, 该位点之前提交的事务的事件都在它之前, 已经应用完成
+	if this.firstPendingLogFilePos != nil {
+		return this.firstPendingLogFilePos.Compare(_logFilePos) > 0
+	}
+
+	// 3. 没有还没应用完成的事件, 应用完成的最大位点之前的事件都已经分配并应用完成
+	return this.maxAppliedLogFilePos != nil && this.maxAppliedLogFilePos.Compare(_logFilePos) >= 0
+}
+
+/* 等待应用binlog追上指定的位点
+Params:
+    _logFilePos: 源实例的位点
+    _timeout: 最多等待多久
+Return: 是否追上了
+*/
+func (this *ApplyBinlog) WaitAppliedPassed(_logFilePos *LogFilePos, _timeout time.Duration) bool {
+	deadline := time.Now().Add(_timeout)
+	for !this.IsAppliedPassed(_logFilePos) {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(WAIT_APPLIED_CHECK_INTERVAL)
+	}
+
+	return true
+}
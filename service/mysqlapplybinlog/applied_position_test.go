@@ -0,0 +1,62 @@
+package mysqlapplybinlog
+
+import (
+	"github.com/cevaris/ordered_map"
+	"go.uber.org/atomic"
+	"testing"
+	"time"
+)
+
+func newAppliedPositionTestApplyBinlog() *ApplyBinlog {
+	startLogFilePos := NewLogFilePos("mysql-bin.000001", 100)
+
+	return &ApplyBinlog{
+		NeedApplyBinlogMap:       ordered_map.NewOrderedMap(),
+		NeedApplyEventCount:      atomic.NewInt64(0),
+		NeedDistributeEventCount: atomic.NewInt64(0),
+		AppliedMinMaxLogPos:      map[int]*LogFilePos{APPLIED_MIN_VALUE_INDEX: startLogFilePos, APPLIED_MAX_VALUE_INDEX: startLogFilePos},
+		parsedTrxLogFilePos:      startLogFilePos,
+		maxAppliedLogFilePos:     startLogFilePos,
+	}
+}
+
+func TestApplyBinlog_IsAppliedPassed(t *testing.T) {
+	applyBinlog := newAppliedPositionTestApplyBinlog()
+	snapshotLogFilePos := NewLogFilePos("mysql-bin.000001", 500)
+
+	// 解析到的事务位点还没到快照位点
+	if applyBinlog.IsAppliedPassed(snapshotLogFilePos) {
+		t.Fatalf("还没解析到快照位点, 不应该追上")
+	}
+
+	// 位点 300 的事件还没应用完成
+	applyBinlog.NeedApplyEventCount.Inc()
+	applyBinlog.NeedApplyBinlogMap.Set("300", &NeedApplyEvent{LogFilePos: NewLogFilePos("mysql-bin.000001", 300), RowCount: 1})
+	applyBinlog.updateAppliedPosition()
+	applyBinlog.SetParsedTrxLogFilePos("mysql-bin.000001", 600)
+	if applyBinlog.IsAppliedPassed(snapshotLogFilePos) {
+		t.Fatalf("快照位点之前还有没应用完成的事件, 不应该追上")
+	}
+
+	// 位点 300 应用完成, 位点 550 的事件还没应用完成, 快照位点之前的事件都应用完成了
+	applyBinlog.NeedApplyBinlogMap.Set("550", &NeedApplyEvent{LogFilePos: NewLogFilePos("mysql-bin.000001", 550), RowCount: 1})
+	applyBinlog.NeedApplyBinlogMap.Delete("300")
+	applyBinlog.AppliedMinMaxLogPos[APPLIED_MAX_VALUE_INDEX] = NewLogFilePos("mysql-bin.000001", 300)
+	applyBinlog.updateAppliedPosition()
+	if !applyBinlog.IsAppliedPassed(snapshotLogFilePos) {
+		t.Fatalf("快照位点之前的事件都应用完成, 应该追上")
+	}
+
+	// 没有需要应用的事件, 解析到的事务位点已经超过快照位点(其他表的事务)
+	applyBinlog = newAppliedPositionTestApplyBinlog()
+	applyBinlog.SetParsedTrxLogFilePos("mysql-bin.000002", 4)
+	if !applyBinlog.WaitAppliedPassed(snapshotLogFilePos, time.Second) {
+		t.Fatalf("解析到的事务都应用完成, 应该追上")
+	}
+
+	// 还有解析了没分配的事件
+	applyBinlog.NeedDistributeEventCount.Inc()
+	if applyBinlog.WaitAppliedPassed(snapshotLogFilePos, 3*WAIT_APPLIED_CHECK_INTERVAL) {
+		t.Fatalf("还有没有分配的事件, 不应该追上")
+	}
+}
@@ -6,10 +6,10 @@ import (
 	"github.com/cevaris/ordered_map"
 	"github.com/daiguadaidai/go-d-bus/common"
 	"github.com/daiguadaidai/go-d-bus/config"
-	"github.com/daiguadaidai/go-d-bus/gdbc"
 	"github.com/daiguadaidai/go-d-bus/logger"
 	"github.com/daiguadaidai/go-d-bus/matemap"
 	"github.com/daiguadaidai/go-d-bus/parser"
+	"github.com/daiguadaidai/go-d-bus/service/throttler"
 	"github.com/go-mysql-org/go-mysql/mysql"
 	"github.com/go-mysql-org/go-mysql/replication"
 	"go.uber.org/atomic"
@@ -51,8 +51,8 @@ type ApplyBinlog struct {
 
 	/* 已经解析完成了的binlog位点, 还需要消费的binlog
 	map {
-	     // key: event的 行数
-		"1111111111111111111:mysql-bin.000000001:000001111111111": 1
+	     // key: event的位点和还需要应用的行数
+		"1111111111111111111:mysql-bin.000000001:000001111111111": *NeedApplyEvent
 	}
 	*/
 	NeedApplyBinlogMap             *ordered_map.OrderedMap
@@ -77,6 +77,40 @@ type ApplyBinlog struct {
 	ParsedLogPos  int    // 解析到的位点
 	StopLogFile   string // 停止的的日志文件
 	StopLogPos    int    // 停止的的位点
+
+	SourceServerUUID string // 源实例的 server uuid, 保存在位点中
+	StartGTIDSet     string // 开始位点已经执行的 GTID 集合, 从保存的应用位点继续时才有
+	IsSyncByGTID     bool   // 源实例发生了切换, 文件位点没有意义, 使用 StartGTIDSet 开始解析binlog
+
+	// 开启目标 checkpoint 时使用
+	NeedDistributeEventCount  *atomic.Int64             // 已经解析还没有分配的事件数
+	TargetCheckpointMap       map[int]*TargetCheckpoint // 启动时目标实例中每个槽的 checkpoint
+	TargetCheckpointUpdateSql string                    // 更新槽 checkpoint 的sql
+	parsedTrxLogFilePos       *LogFilePos               // 解析到的事务位点(已经解析完整的事务)
+	parsedTrxLock             sync.Mutex
+
+	// 限流器, 设置了限流时暂停应用binlog 才会等待, 没有开启为 nil
+	Throttler *throttler.Throttler
+
+	// 队列中缓存的字节数和行数, 超过高水位暂停解析binlog
+	QueueWaterMark *QueueWaterMark
+
+	// 同一个主键/唯一键值的行之间的依赖, 保证冲突的行按顺序应用
+	KeyDependency *KeyDependency
+
+	// 没有主键的表 row copy 使用的快照位点 {"schema.table": 快照位点}, 跳过该表在快照位点之前的事务
+	TableSnapshotPositions map[string]*LogFilePos
+
+	// 运行时调整并发数
+	PendingParaller *atomic.Int64   // 需要调整成的并发数, 0 不需要调整
+	applyParaller   *atomic.Int64   // 当前的并发数(通道数), 启动时为命令行指定的并发数, 调整并发数后修改
+	consumeWG       *sync.WaitGroup // 当前这一批消费协程
+
+	// 已经应用到的位点, checksum 等待应用binlog追上读取源数据时的位点
+	Started                *atomic.Bool // 是否已经开始应用binlog
+	firstPendingLogFilePos *LogFilePos  // 还没应用完成的第一个事件位点, 没有为 nil
+	maxAppliedLogFilePos   *LogFilePos  // 应用完成的最大事件位点
+	appliedLock            sync.Mutex
 }
 
 /* 创建一个应用binlog
@@ -99,6 +133,13 @@ func NewApplyBinlog(_parser *parser.RunParser, _configMap *config.ConfigMap) (*A
 	applyBinlog.NeedApplyTableMap = make(map[string]bool)
 	for key, _ := range applyBinlog.MigrationTableNameMap {
 		applyBinlog.NeedApplyTableMap[key] = true
+
+		// 主键/唯一键中有大小写不敏感等字段, 键值有非 ASCII 字符的行需要等待其他并发槽中该表的行应用完
+		if table, err := matemap.GetMigrationTable(key); err == nil && !table.IsApplyBinlogBySingleSlot() {
+			if columnNames := table.FindNonBinaryKeyColumnNames(); len(columnNames) > 0 {
+				logger.M.Warnf("警告. 表 %v 主键/唯一键字段 %v 不是按字节比较的排序规则, 应用binlog时这些字段的值有非 ASCII 字符的行需要等待其他并发槽中该表的行应用完", key, columnNames)
+			}
+		}
 	}
 	// 将heartbeat table 也添加入需要应用binlog的表中
 	if heartbeatTable := common.FormatTableName(applyBinlog.Parser.HeartbeatSchema, applyBinlog.Parser.HeartbeatTable, ""); heartbeatTable == "" {
@@ -112,13 +153,16 @@ func NewApplyBinlog(_parser *parser.RunParser, _configMap *config.ConfigMap) (*A
 	applyBinlog.Parse2DistributeChan = make(chan *BinlogEventPos, _parser.ApplyBinlogHighWaterMark)
 
 	// 初始化分配binlog到应用binlog的通道
-	applyBinlog.Distribute2ApplyChans = make([]chan *BinlogRowInfo, _parser.ApplyBinlogParaller)
-	for i := 0; i < _parser.ApplyBinlogParaller; i++ {
-		applyBinlog.Distribute2ApplyChans[i] = make(chan *BinlogRowInfo, _parser.ApplyBinlogHighWaterMark)
-	}
+	applyBinlog.Distribute2ApplyChans = NewDistribute2ApplyChans(_parser.ApplyBinlogParaller, _parser.ApplyBinlogHighWaterMark)
+	applyBinlog.PendingParaller = atomic.NewInt64(0)
+	applyBinlog.applyParaller = atomic.NewInt64(int64(_parser.ApplyBinlogParaller))
+	applyBinlog.KeyDependency = NewKeyDependency()
 	// 初始化还需要应用到事件个数
 	applyBinlog.NeedApplyEventCount = atomic.NewInt64(0)
 
+	// 初始化队列水位
+	applyBinlog.QueueWaterMark = NewQueueWaterMark(_parser)
+
 	// 用于保存需要消费的binlog行数数量
 	applyBinlog.NeedApplyBinlogMap = ordered_map.NewOrderedMap()
 
@@ -131,12 +175,18 @@ func NewApplyBinlog(_parser *parser.RunParser, _configMap *config.ConfigMap) (*A
 	// 初始化延时信息
 	applyBinlog.ParseTimestamp = 0
 
+	// 初始化源实例的 server uuid, 检测保存的位点是否来自同一个实例, 从保存的应用位点继续时使用保存的 GTID 集合
+	applyBinlog.InitSourceServerUUID()
+
 	// 初始化已经应用到的binlog最大最小位点信息
 	// AppliedMinMaxLogPos map[int]*LogFilePos
-	minAppliedLogPos := NewLogFilePos(_parser.StartLogFile, _parser.StartLogPos)
+	minAppliedLogPos := applyBinlog.NewSourceLogFilePos(_parser.StartLogFile, _parser.StartLogPos)
+	minAppliedLogPos.SetGTIDSet(applyBinlog.StartGTIDSet)
 	applyBinlog.AppliedMinMaxLogPos = make(map[int]*LogFilePos)
 	applyBinlog.AppliedMinMaxLogPos[APPLIED_MIN_VALUE_INDEX] = minAppliedLogPos
 	applyBinlog.AppliedMinMaxLogPos[APPLIED_MAX_VALUE_INDEX] = minAppliedLogPos
+	applyBinlog.maxAppliedLogFilePos = minAppliedLogPos
+	applyBinlog.Started = atomic.NewBool(false)
 
 	// 初始化解析到的位点信息
 	applyBinlog.ParsedLogFile = _parser.StartLogFile
@@ -144,6 +194,16 @@ func NewApplyBinlog(_parser *parser.RunParser, _configMap *config.ConfigMap) (*A
 	applyBinlog.StopLogFile = _parser.StopLogFile
 	applyBinlog.StopLogPos = _parser.StopLogPos
 
+	// 初始化目标 checkpoint
+	applyBinlog.NeedDistributeEventCount = atomic.NewInt64(0)
+	applyBinlog.parsedTrxLogFilePos = applyBinlog.NewSourceLogFilePos(_parser.StartLogFile, _parser.StartLogPos)
+	if _parser.EnableTargetCheckpoint {
+		if err := applyBinlog.InitTargetCheckpoints(); err != nil {
+			return nil, err
+		}
+		logger.M.Infof("成功. 初始化目标 checkpoint. %v", GetTargetCheckpointTableName(_parser))
+	}
+
 	// 初始化 Syncer
 	applyBinlog.InitSyncer()
 
@@ -163,6 +223,13 @@ func (this *ApplyBinlog) InitSyncer() {
 }
 
 func (this *ApplyBinlog) Start() {
+	// row copy 已经完成, 获取没有主键的表拷贝时使用的快照位点
+	if err := this.InitTableSnapshotPositions(); err != nil {
+		logger.M.Fatalf("%v. 退出迁移", err)
+	}
+
+	this.Started.Store(true)
+
 	wg := new(sync.WaitGroup)
 	// 产生binlog event
 	wg.Add(1)
@@ -173,10 +240,10 @@ func (this *ApplyBinlog) Start() {
 	go this.DistributeEventRows(wg)
 
 	// 并发应用每一行数据
-	for i, _ := range this.Distribute2ApplyChans {
-		wg.Add(1)
-		go this.ConsumeEevetRows(wg, i)
-	}
+	this.StartConsumeEventRows(wg)
+
+	// 循环获取应用binlog并发数, 运行时调整并发数
+	go this.LoopWatchApplyBinlogParaller()
 
 	// 循环记录应用进度
 	wg.Add(1)
@@ -210,8 +277,20 @@ func (this *ApplyBinlog) ProduceEvent(wg *sync.WaitGroup) {
 		Pos:  uint32(this.Parser.StartLogPos),
 	}
 
+	// 已经执行的 GTID 集合, 保存在位点中
+	executedGTIDSet, err := NewExecutedGTIDSet(this.StartGTIDSet)
+	if err != nil {
+		logger.M.Fatalf("错误. 初始化已经执行的 GTID 集合. %v. 退出迁移.", err)
+	}
+
 	// 生成解析binglog 工具
-	streamer, err := this.Syncer.StartSync(position)
+	var streamer *replication.BinlogStreamer
+	if this.IsSyncByGTID {
+		logger.M.Warnf("使用 GTID 集合开始解析binlog: %v", this.StartGTIDSet)
+		streamer, err = this.Syncer.StartSyncGTID(executedGTIDSet.gtidSet.Clone())
+	} else {
+		streamer, err = this.Syncer.StartSync(position)
+	}
 	if err != nil {
 		logger.M.Fatalf("错误. 开始binlog发生错误. %v. 退出迁移.", err)
 		// syscall.Exit(1)
@@ -220,6 +299,9 @@ func (this *ApplyBinlog) ProduceEvent(wg *sync.WaitGroup) {
 	// 初始化binlog文件
 	logFile := this.Parser.StartLogFile
 	produceErrCNT := 0
+	// 当前事务开始的位点
+	trxLogFilePos := this.NewSourceLogFilePos(this.Parser.StartLogFile, this.Parser.StartLogPos)
+	trxLogFilePos.SetExecutedGTIDSet(executedGTIDSet)
 
 	for {
 		ev, err := streamer.GetEvent(context.Background())
@@ -260,6 +342,27 @@ func (this *ApplyBinlog) ProduceEvent(wg *sync.WaitGroup) {
 		case *replication.RotateEvent: // 更新在解析的binlog文件
 			logFile = string(e.NextLogName)
 			this.ParsedLogFile = logFile
+			trxLogFilePos = this.NewSourceLogFilePos(logFile, int(e.Position))
+			trxLogFilePos.SetExecutedGTIDSet(executedGTIDSet)
+
+		case *replication.PreviousGTIDsEvent: // binlog文件开头, 之前已经执行的 GTID 集合
+			if err := executedGTIDSet.SetPrevious(e.GTIDSets); err != nil {
+				logger.M.Warnf("警告. %v", err)
+			}
+			trxLogFilePos.SetExecutedGTIDSet(executedGTIDSet)
+
+		case *replication.GTIDEvent: // 事务开始, 记录该事务的 GTID
+			executedGTIDSet.SetTrxGTID(e.SID, e.GNO)
+
+		case *replication.XIDEvent: // 事务结束, 下一个事务从这里开始
+			trxLogFilePos = this.NewTrxEndLogFilePos(logFile, int(ev.Header.LogPos), executedGTIDSet)
+			this.SetParsedTrxLogFilePos(logFile, int(ev.Header.LogPos))
+
+		case *replication.QueryEvent: // 除了 BEGIN, 其他的 QueryEvent(COMMIT, DDL) 都是一个事务的结束
+			if string(e.Query) != "BEGIN" {
+				trxLogFilePos = this.NewTrxEndLogFilePos(logFile, int(ev.Header.LogPos), executedGTIDSet)
+				this.SetParsedTrxLogFilePos(logFile, int(ev.Header.LogPos))
+			}
 
 		case *replication.TableMapEvent:
 			schemaName := string(e.Schema)
@@ -285,9 +388,14 @@ func (this *ApplyBinlog) ProduceEvent(wg *sync.WaitGroup) {
 			schema := string(e.Table.Schema)
 			table := string(e.Table.Table)
 
-			// 只需要处理需要应用的表
-			if this.IsApplyTable(schema, table) {
-				binlogEventPos := NewBinlogEventPos(ev, logFile, int(ev.Header.LogPos), -1)
+			// 只需要处理需要应用的表, 已经包含在表 row copy 快照中的事务不需要应用
+			if this.IsApplyTable(schema, table) && !this.IsInTableSnapshot(schema, table, trxLogFilePos) {
+				// 队列中缓存的数据超过高水位, 等待降到低水位以下再继续解析
+				this.QueueWaterMark.WaitBelowHighWaterMark()
+				this.QueueWaterMark.Add(int64(ev.Header.EventSize), int64(GetRowsEventRowCount(e, ev.Header.EventType)))
+
+				binlogEventPos := NewBinlogEventPos(ev, logFile, int(ev.Header.LogPos), -1, trxLogFilePos)
+				this.NeedDistributeEventCount.Inc()
 				this.Parse2DistributeChan <- binlogEventPos
 			}
 		}
@@ -301,6 +409,12 @@ func (this *ApplyBinlog) DistributeEventRows(wg *sync.WaitGroup) {
 
 	// 循环获取binglog事件
 	for binlogEventPos := range this.Parse2DistributeChan {
+		// 限流并且设置了暂停应用binlog时, 暂停分配事件
+		this.Throttler.WaitApplyBinlog()
+
+		// 修改了并发数, 等待已经分配的行应用完成后调整并发数
+		this.ReshardIfNeeded(wg)
+
 		errCNT := 0
 
 		for {
@@ -346,6 +460,9 @@ func (this *ApplyBinlog) DistributeEventRows(wg *sync.WaitGroup) {
 
 			break
 		}
+
+		// 需要应用的事件数已经增加了, 才能减少还需要分配的事件数
+		this.NeedDistributeEventCount.Dec()
 	}
 }
 
@@ -367,15 +484,22 @@ func (this *ApplyBinlog) DistributeInsertEventRows(binlogEventPos *BinlogEventPo
 	this.NeedApplyEventCount.Inc()
 
 	// 添加该事件的行数
-	addOrDeleteNeedApplyBinlog := NewAddOrDeleteNeedApplyBinlog(binlogEventPos.GetLogFilePosTimeStamp(), AODNAB_TYPE_ADD, rowCount)
+	addOrDeleteNeedApplyBinlog := NewAddOrDeleteNeedApplyBinlog(binlogEventPos.GetLogFilePosTimeStamp(), AODNAB_TYPE_ADD, rowCount,
+		this.NewEventLogFilePos(binlogEventPos))
 	this.AddOrDeleteNeedApplyBinlogChan <- addOrDeleteNeedApplyBinlog
 
-	for _, row := range rowEvent.Rows {
+	for i, row := range rowEvent.Rows {
 		// 新建每一行数据
 		binlogRowInfo := NewBinlogRowInfo(schemaName, TableName, row, row, binlogEventPos.BinlogEvent.Header.EventType, binlogEventPos.GetLogFilePosTimeStamp())
 
 		// 获取该行应该应该放入那个chan
-		slot := binlogRowInfo.GetChanSlotByAfter(table.SourcePKColumns, this.Parser.ApplyBinlogParaller)
+		slot := binlogRowInfo.GetChanSlotByAfter(table.SourcePKColumns, this.GetApplyParaller())
+		if table.IsApplyBinlogBySingleSlot() {
+			slot = binlogRowInfo.GetChanSlotByTable(this.GetApplyParaller())
+		}
+		this.SetRowTargetCheckpoint(binlogRowInfo, binlogEventPos, slot, i)
+		this.SetRowQueueBytes(binlogRowInfo, binlogEventPos, rowCount, i)
+		this.AcquireRowDependency(binlogRowInfo, table, slot)
 		this.Distribute2ApplyChans[slot] <- binlogRowInfo
 	}
 
@@ -400,7 +524,8 @@ func (this *ApplyBinlog) DistributeUpdateEventRows(_binlogEventPos *BinlogEventP
 	this.NeedApplyEventCount.Inc()
 
 	// 添加该事件的行数
-	addOrDeleteNeedApplyBinlog := NewAddOrDeleteNeedApplyBinlog(_binlogEventPos.GetLogFilePosTimeStamp(), AODNAB_TYPE_ADD, rowCount)
+	addOrDeleteNeedApplyBinlog := NewAddOrDeleteNeedApplyBinlog(_binlogEventPos.GetLogFilePosTimeStamp(), AODNAB_TYPE_ADD, rowCount,
+		this.NewEventLogFilePos(_binlogEventPos))
 	this.AddOrDeleteNeedApplyBinlogChan <- addOrDeleteNeedApplyBinlog
 
 	for i := 0; i < rowCount; i++ {
@@ -417,8 +542,14 @@ func (this *ApplyBinlog) DistributeUpdateEventRows(_binlogEventPos *BinlogEventP
 			_binlogEventPos.GetLogFilePosTimeStamp(),
 		)
 
-		// 获取该行应该应该放入那个chan
-		slot := binlogRowInfo.GetChanSlotByBefore(table.SourcePKColumns, this.Parser.ApplyBinlogParaller)
+		// 获取该行应该应该放入那个chan, 修改了主键的行按旧的主键分配, 和新主键的行冲突时会等待
+		slot := binlogRowInfo.GetChanSlotByBefore(table.SourcePKColumns, this.GetApplyParaller())
+		if table.IsApplyBinlogBySingleSlot() {
+			slot = binlogRowInfo.GetChanSlotByTable(this.GetApplyParaller())
+		}
+		this.SetRowTargetCheckpoint(binlogRowInfo, _binlogEventPos, slot, i)
+		this.SetRowQueueBytes(binlogRowInfo, _binlogEventPos, rowCount, i)
+		this.AcquireRowDependency(binlogRowInfo, table, slot)
 		this.Distribute2ApplyChans[slot] <- binlogRowInfo
 	}
 
@@ -443,10 +574,11 @@ func (this *ApplyBinlog) DistributeDeleteEventRows(_binlogEventPos *BinlogEventP
 	this.NeedApplyEventCount.Inc()
 
 	// 添加该事件的行数
-	addOrDeleteNeedApplyBinlog := NewAddOrDeleteNeedApplyBinlog(_binlogEventPos.GetLogFilePosTimeStamp(), AODNAB_TYPE_ADD, rowCount)
+	addOrDeleteNeedApplyBinlog := NewAddOrDeleteNeedApplyBinlog(_binlogEventPos.GetLogFilePosTimeStamp(), AODNAB_TYPE_ADD, rowCount,
+		this.NewEventLogFilePos(_binlogEventPos))
 	this.AddOrDeleteNeedApplyBinlogChan <- addOrDeleteNeedApplyBinlog
 
-	for _, row := range rowEvent.Rows {
+	for i, row := range rowEvent.Rows {
 		// 新建每一行数据
 		binlogRowInfo := NewBinlogRowInfo(
 			schemaName,
@@ -458,7 +590,13 @@ func (this *ApplyBinlog) DistributeDeleteEventRows(_binlogEventPos *BinlogEventP
 		)
 
 		// 获取该行应该应该放入那个chan
-		slot := binlogRowInfo.GetChanSlotByAfter(table.SourcePKColumns, this.Parser.ApplyBinlogParaller)
+		slot := binlogRowInfo.GetChanSlotByAfter(table.SourcePKColumns, this.GetApplyParaller())
+		if table.IsApplyBinlogBySingleSlot() {
+			slot = binlogRowInfo.GetChanSlotByTable(this.GetApplyParaller())
+		}
+		this.SetRowTargetCheckpoint(binlogRowInfo, _binlogEventPos, slot, i)
+		this.SetRowQueueBytes(binlogRowInfo, _binlogEventPos, rowCount, i)
+		this.AcquireRowDependency(binlogRowInfo, table, slot)
 		this.Distribute2ApplyChans[slot] <- binlogRowInfo
 	}
 
@@ -474,6 +612,17 @@ func (this *ApplyBinlog) ConsumeEevetRows(wg *sync.WaitGroup, slot int) {
 	logger.M.Infof("协程 %v. 开始应用每一行.", slot)
 
 	for binlogRowInfo := range this.Distribute2ApplyChans[slot] {
+		// 目标 checkpoint 中已经应用过的行, 不需要再应用
+		if this.IsAppliedByTargetCheckpoint(binlogRowInfo) {
+			this.QueueWaterMark.Release(binlogRowInfo.QueueBytes, 1)
+			this.KeyDependency.Release(binlogRowInfo.DependencyKeys, slot)
+			this.AddOrDeleteNeedApplyBinlogChan <- NewAddOrDeleteNeedApplyBinlog(binlogRowInfo.ApplyRowKey, AODNAB_TYPE_DELETE, 1, nil)
+			continue
+		}
+
+		// 限速, 所有协程写入目标的行数一起计算
+		this.Throttler.WaitApplyBinlogRate(1)
+
 		errCNT := 0
 		for {
 			switch binlogRowInfo.EventType {
@@ -515,8 +664,12 @@ func (this *ApplyBinlog) ConsumeEevetRows(wg *sync.WaitGroup, slot int) {
 				}
 			}
 
+			// 该行已经应用, 减少队列中缓存的数据
+			this.QueueWaterMark.Release(binlogRowInfo.QueueBytes, 1)
+			this.KeyDependency.Release(binlogRowInfo.DependencyKeys, slot)
+
 			// 减少该事件的行数
-			addOrDeleteNeedApplyBinlog := NewAddOrDeleteNeedApplyBinlog(binlogRowInfo.ApplyRowKey, AODNAB_TYPE_DELETE, 1)
+			addOrDeleteNeedApplyBinlog := NewAddOrDeleteNeedApplyBinlog(binlogRowInfo.ApplyRowKey, AODNAB_TYPE_DELETE, 1, nil)
 			this.AddOrDeleteNeedApplyBinlogChan <- addOrDeleteNeedApplyBinlog
 
 			break
@@ -529,34 +682,12 @@ Params:
 	_binlogRowInfo: 相关行数据信息
 */
 func (this *ApplyBinlog) ConsumeInsertRows(binlogRowInfo *BinlogRowInfo) error {
-	// 获取需要迁移的表的元信息
-	table, err := matemap.GetMigrationTableBySchemaTable(binlogRowInfo.Schema, binlogRowInfo.Table)
-	if err != nil {
-		return fmt.Errorf("获取迁移的表失败(应用行insert). %v", err)
-	}
-
-	// 需要用于repalce into 的数据
-	afterRow := binlogRowInfo.GetAfterRow(table.SourceUsefulColumns)
-
-	// 获取数据库并且执行 REPLACE INTO SQL
-	instance, ok := gdbc.GetDynamicDBByHostPort(this.ConfigMap.Target.Host.String, this.ConfigMap.Target.Port.Int64)
-	if !ok {
-		return fmt.Errorf("缓存中不存在该实例(%v:%v). 获取目标数据库实例出错", this.ConfigMap.Target.Host.String, this.ConfigMap.Target.Port.Int64)
-	}
-
-	rows := [][]interface{}{afterRow}
-	// 开启事物执行sql
-	replaceIntoSql, err := table.GetInsOnDupUpdateBatchSqlTpl_V3(rows)
-	if err != nil {
-		return fmt.Errorf("应用binlog, 获取Replace Into sql失败. %v", err.Error())
-	}
-
-	_, err = instance.Exec(replaceIntoSql)
+	replaceIntoSql, err := this.GetInsertRowSql(binlogRowInfo)
 	if err != nil {
-		return fmt.Errorf("%v. %v", err.Error(), replaceIntoSql)
+		return err
 	}
 
-	return nil
+	return this.ExecApplySqls(binlogRowInfo, replaceIntoSql)
 }
 
 /* 消费update行
@@ -570,22 +701,36 @@ func (this *ApplyBinlog) ConsumeUpdateRows(binlogRowInfo *BinlogRowInfo) error {
 		return fmt.Errorf("获取迁移的表失败(应用行insert). %v", err)
 	}
 
+	// 没有主键的表, 通过匹配所有字段更新一行
+	if table.NoUniqueKey {
+		updateSql, err := this.GetNoKeyUpdateRowSql(binlogRowInfo, table)
+		if err != nil {
+			return err
+		}
+
+		return this.ExecApplySqls(binlogRowInfo, updateSql)
+	}
+
+	// 插入数据
+	replaceIntoSql, err := this.GetInsertRowSql(binlogRowInfo)
+	if err != nil {
+		return fmt.Errorf("消费update行, update 转化为 replace into. %v", err)
+	}
+
 	// 如果唯一键有修改则变成 delete 和 insert 操作
 	if binlogRowInfo.IsDiffBeforeAndAfter(table.SourceAllUKColumns) {
 		// 删除数据
-		err := this.ConsumeDeleteRows(binlogRowInfo)
+		deleteSql, err := this.GetDeleteRowSql(binlogRowInfo)
 		if err != nil {
 			return fmt.Errorf("消费update行, update 转化为 delete/replace into(delete). %v", err)
 		}
 
-		// 插入数据
-		err = this.ConsumeInsertRows(binlogRowInfo)
+		err = this.ExecApplySqls(binlogRowInfo, deleteSql, replaceIntoSql)
 		if err != nil {
-			return fmt.Errorf("消费update行, update 转化为 delete/replace into(replace into). %v", err)
+			return fmt.Errorf("消费update行, update 转化为 delete/replace into. %v", err)
 		}
 	} else { // 如果唯一键列值没有修改. 则变成insert
-		// 插入数据
-		err = this.ConsumeInsertRows(binlogRowInfo)
+		err = this.ExecApplySqls(binlogRowInfo, replaceIntoSql)
 		if err != nil {
 			return fmt.Errorf("消费update行, update 转化为 replace into. %v", err)
 		}
@@ -599,30 +744,78 @@ Params:
 	_binlogRowInfo: 相关行数据信息
 */
 func (this *ApplyBinlog) ConsumeDeleteRows(binlogRowInfo *BinlogRowInfo) error {
+	deleteSql, err := this.GetDeleteRowSql(binlogRowInfo)
+	if err != nil {
+		return err
+	}
+
+	return this.ExecApplySqls(binlogRowInfo, deleteSql)
+}
+
+/* 获取应用行需要执行的 insert sql
+Params:
+	_binlogRowInfo: 相关行数据信息
+*/
+func (this *ApplyBinlog) GetInsertRowSql(binlogRowInfo *BinlogRowInfo) (string, error) {
+	// 获取需要迁移的表的元信息
+	table, err := matemap.GetMigrationTableBySchemaTable(binlogRowInfo.Schema, binlogRowInfo.Table)
+	if err != nil {
+		return "", fmt.Errorf("获取迁移的表失败(应用行insert). %v", err)
+	}
+
+	// 需要用于repalce into 的数据
+	afterRow := binlogRowInfo.GetAfterRow(table.SourceUsefulColumns)
+
+	rows := [][]interface{}{afterRow}
+	replaceIntoSql, err := table.GetInsOnDupUpdateBatchSqlTpl_V3(rows)
+	if err != nil {
+		return "", fmt.Errorf("应用binlog, 获取Replace Into sql失败. %v", err.Error())
+	}
+
+	return replaceIntoSql, nil
+}
+
+/* 获取应用行需要执行的 delete sql
+Params:
+	_binlogRowInfo: 相关行数据信息
+*/
+func (this *ApplyBinlog) GetDeleteRowSql(binlogRowInfo *BinlogRowInfo) (string, error) {
 	// 获取需要迁移的表的元信息
 	table, err := matemap.GetMigrationTableBySchemaTable(binlogRowInfo.Schema, binlogRowInfo.Table)
 	if err != nil {
-		return fmt.Errorf("获取迁移的表失败(应用行delete). %v", err)
+		return "", fmt.Errorf("获取迁移的表失败(应用行delete). %v", err)
+	}
+
+	// 没有主键的表, 通过匹配所有字段删除一行
+	if table.NoUniqueKey {
+		deleteSql, err := table.GetNoKeyDelSql(binlogRowInfo.GetBeforeRow(table.SourceUsefulColumns))
+		if err != nil {
+			return "", fmt.Errorf("应用binlog, 获取没有主键的表 delete sql失败. %v", err)
+		}
+
+		return deleteSql, nil
 	}
 
 	// 需要用于 delete 的数据
 	beforeRow := binlogRowInfo.GetDeleteBeforeRow(table.TargetPKColumns, table.TargetBinlogDeleteWhereExternalColumns)
 
-	// 获取数据库并且执行 REPLACE INTO SQL
-	instance, ok := gdbc.GetDynamicDBByHostPort(this.ConfigMap.Target.Host.String, this.ConfigMap.Target.Port.Int64)
-	if !ok {
-		return fmt.Errorf("缓存中不存在该实例(%v:%v). 获取目标数据库实例出错", this.ConfigMap.Target.Host.String, this.ConfigMap.Target.Port.Int64)
-	}
+	return table.GetDelSqlTpl(beforeRow), nil
+}
 
-	deleteSql := table.GetDelSqlTpl(beforeRow)
+/* 获取没有主键的表应用 update 行需要执行的 sql
+Params:
+	_binlogRowInfo: 相关行数据信息
+	_table: 需要迁移的表的元信息
+*/
+func (this *ApplyBinlog) GetNoKeyUpdateRowSql(binlogRowInfo *BinlogRowInfo, table *matemap.Table) (string, error) {
+	beforeRow, afterRow := binlogRowInfo.GetBeforeAndAfterRow(table.SourceUsefulColumns)
 
-	// 开启事物执行sql
-	_, err = instance.Exec(deleteSql)
+	updateSql, err := table.GetNoKeyUpdSql(beforeRow, afterRow)
 	if err != nil {
-		return fmt.Errorf("%v. %v", err.Error(), deleteSql)
+		return "", fmt.Errorf("应用binlog, 获取没有主键的表 update sql失败. %v", err)
 	}
 
-	return nil
+	return updateSql, nil
 }
 
 func (this *ApplyBinlog) LoopSaveApplyBinlogProgress(wg *sync.WaitGroup) {
@@ -630,10 +823,9 @@ func (this *ApplyBinlog) LoopSaveApplyBinlogProgress(wg *sync.WaitGroup) {
 
 	saveDelayTicker := time.NewTicker(time.Second * 5)
 	saveBinlogProgressTicker := time.NewTicker(time.Second * 5)
-	tmpMinLogFilePos := LogFilePos{
-		LogFile: "",
-		LogPos:  -1,
-	}
+	tmpMinLogFilePos := NewLogFilePos("", -1)
+	// 上一次推进的目标 checkpoint 位点
+	advancedTrxLogFilePos := this.NewSourceLogFilePos(this.Parser.StartLogFile, this.Parser.StartLogPos)
 
 	for {
 		select {
@@ -655,6 +847,7 @@ func (this *ApplyBinlog) LoopSaveApplyBinlogProgress(wg *sync.WaitGroup) {
 				"",
 				-1,
 			)
+			UpdateSourceApplyPosition(this.ConfigMap.TaskUUID, this.AppliedMinMaxLogPos[APPLIED_MIN_VALUE_INDEX])
 
 			logger.M.Infof("binlog 位点信息. 开始位点: %v:%v, 解析到位点: %v:%v, 应用到位点: %v:%v. %v",
 				this.Parser.StartLogFile, this.Parser.StartLogPos, this.ParsedLogFile, this.ParsedLogPos,
@@ -662,12 +855,22 @@ func (this *ApplyBinlog) LoopSaveApplyBinlogProgress(wg *sync.WaitGroup) {
 
 			// 比较当前应用最小位点信息是否和临时位点信息相等. 如果不相等将通知. 收集目标实例 show master status 信息.
 			// 并更新临时位点 为当前最小位点
-			if tmpMinLogFilePos.LogFile != this.AppliedMinMaxLogPos[APPLIED_MIN_VALUE_INDEX].LogFile ||
-				tmpMinLogFilePos.LogPos != this.AppliedMinMaxLogPos[APPLIED_MIN_VALUE_INDEX].LogPos {
-
+			if tmpMinLogFilePos.Compare(this.AppliedMinMaxLogPos[APPLIED_MIN_VALUE_INDEX]) != 0 {
 				this.NotifySaveTargetLogFilePos <- true
-				tmpMinLogFilePos.LogFile = this.AppliedMinMaxLogPos[APPLIED_MIN_VALUE_INDEX].LogFile
-				tmpMinLogFilePos.LogPos = this.AppliedMinMaxLogPos[APPLIED_MIN_VALUE_INDEX].LogPos
+				tmpMinLogFilePos = this.AppliedMinMaxLogPos[APPLIED_MIN_VALUE_INDEX].Clone()
+			}
+
+			// 推进目标 checkpoint. 先获取解析完的事务位点, 再判断事件是否都应用完成
+			if this.Parser.EnableTargetCheckpoint {
+				parsedTrxLogFilePos := this.GetParsedTrxLogFilePos()
+				if parsedTrxLogFilePos.IsRatherThan(advancedTrxLogFilePos) &&
+					this.NeedDistributeEventCount.Load() == 0 && this.NeedApplyEventCount.Load() == 0 {
+					if err := this.AdvanceTargetCheckpoints(parsedTrxLogFilePos); err != nil {
+						logger.M.Errorf("错误. %v", err)
+					} else {
+						advancedTrxLogFilePos = parsedTrxLogFilePos
+					}
+				}
 			}
 
 		case <-saveDelayTicker.C:
@@ -678,29 +881,34 @@ func (this *ApplyBinlog) LoopSaveApplyBinlogProgress(wg *sync.WaitGroup) {
 		case addOrDeleteNeedApplyBinlog := <-this.AddOrDeleteNeedApplyBinlogChan:
 			switch addOrDeleteNeedApplyBinlog.Type {
 			case AODNAB_TYPE_ADD: // 添加需要应用的binlog event标记
-				this.NeedApplyBinlogMap.Set(addOrDeleteNeedApplyBinlog.Key, addOrDeleteNeedApplyBinlog.Num)
+				needApplyEvent := &NeedApplyEvent{
+					LogFilePos: addOrDeleteNeedApplyBinlog.LogFilePos,
+					RowCount:   addOrDeleteNeedApplyBinlog.Num,
+				}
+				this.NeedApplyBinlogMap.Set(addOrDeleteNeedApplyBinlog.Key, needApplyEvent)
+				this.updateAppliedPosition()
 
 			case AODNAB_TYPE_DELETE: // 减少需要应用binlog event row 标记
-				eventRowCountInterface, ok := this.NeedApplyBinlogMap.Get(addOrDeleteNeedApplyBinlog.Key)
+				needApplyEventInterface, ok := this.NeedApplyBinlogMap.Get(addOrDeleteNeedApplyBinlog.Key)
 				if !ok {
 					logger.M.Errorf("错误. 没有发现需要应用的binlog. %v", addOrDeleteNeedApplyBinlog.Key)
 					continue
 				}
-				eventRowCount := eventRowCountInterface.(int)
-				eventRowCount -= addOrDeleteNeedApplyBinlog.Num
+				needApplyEvent := needApplyEventInterface.(*NeedApplyEvent)
+				needApplyEvent.RowCount -= addOrDeleteNeedApplyBinlog.Num
 
 				// 如果binlog event中的每一个行都被应用了则从还需要应用的binlog中移除
-				if eventRowCount == 0 {
+				if needApplyEvent.RowCount == 0 {
 					// 设置当前应用最小的 位点信息
 					eventRowCountIter := this.NeedApplyBinlogMap.IterFunc()
 					eventRowCountItem, ok := eventRowCountIter()
 					if ok {
-						minLogFilePos := NewLogFilePosByKey(eventRowCountItem.Key.(string))
+						minLogFilePos := eventRowCountItem.Value.(*NeedApplyEvent).LogFilePos
 						this.AppliedMinMaxLogPos[APPLIED_MIN_VALUE_INDEX] = minLogFilePos
 					}
 
 					// 如果该应用完成的位点比保存的最大位点大则, 将该位点设置为最大位点
-					currLogFilePos := NewLogFilePosByKey(addOrDeleteNeedApplyBinlog.Key)
+					currLogFilePos := needApplyEvent.LogFilePos
 					maxLogFilePos, ok := this.AppliedMinMaxLogPos[APPLIED_MAX_VALUE_INDEX]
 					if !ok { // 如果之前没有设置最大应用binlog位点, 将本次位点设置为最大的位点
 						this.AppliedMinMaxLogPos[APPLIED_MAX_VALUE_INDEX] = currLogFilePos
@@ -715,8 +923,7 @@ func (this *ApplyBinlog) LoopSaveApplyBinlogProgress(wg *sync.WaitGroup) {
 
 					// 该binlog 位点已经应用完毕, 可以清除
 					this.NeedApplyBinlogMap.Delete(addOrDeleteNeedApplyBinlog.Key)
-				} else { // 该binlog event中还有行没有被应用
-					this.NeedApplyBinlogMap.Set(addOrDeleteNeedApplyBinlog.Key, eventRowCount)
+					this.updateAppliedPosition()
 				}
 
 			}
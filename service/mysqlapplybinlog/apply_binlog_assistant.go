@@ -7,6 +7,7 @@ import (
 	"github.com/daiguadaidai/go-d-bus/gdbc"
 	"github.com/daiguadaidai/go-d-bus/logger"
 	"github.com/daiguadaidai/go-d-bus/matemap"
+	"strings"
 	"time"
 )
 
@@ -59,15 +60,98 @@ func (this *ApplyBinlog) IsStopParseBinlogByStopLogFilePos() bool {
 	if this.StopLogFile == "" {
 		return false
 	}
-	if this.StopLogFile != "" {
-		if this.ParsedLogFile > this.StopLogFile {
-			return true
-		} else if this.ParsedLogFile == this.StopLogFile && int(this.ParsedLogPos) >= this.StopLogPos {
-			return true
+	parsedLogFilePos := NewLogFilePos(this.ParsedLogFile, this.ParsedLogPos)
+	stopLogFilePos := NewLogFilePos(this.StopLogFile, this.StopLogPos)
+
+	return parsedLogFilePos.Compare(stopLogFilePos) >= 0
+}
+
+/* 新建一个源实例的位点, 带上源实例的 server uuid
+Params:
+	_logFile: binlog文件
+	_logPos: binlog位点
+*/
+func (this *ApplyBinlog) NewSourceLogFilePos(_logFile string, _logPos int) *LogFilePos {
+	logFilePos := NewLogFilePos(_logFile, _logPos)
+	logFilePos.ServerUUID = this.SourceServerUUID
+
+	return logFilePos
+}
+
+/* 新建一个事件的位点, 带上源实例的 server uuid 和该事件所在事务开始时已经执行的 GTID 集合.
+使用该 GTID 集合继续解析会从该事务开始, 应用binlog是幂等的
+Params:
+	_binlogEventPos: binlog事件和位点信息
+*/
+func (this *ApplyBinlog) NewEventLogFilePos(_binlogEventPos *BinlogEventPos) *LogFilePos {
+	logFilePos := this.NewSourceLogFilePos(_binlogEventPos.LogFile, _binlogEventPos.LogPos)
+	logFilePos.setParsedGTIDSet(_binlogEventPos.TrxGTIDSet, _binlogEventPos.trxGTIDSet)
+
+	return logFilePos
+}
+
+/* 事务结束, 将该事务的 GTID 添加到已经执行的 GTID 集合中, 新建下一个事务开始的位点
+Params:
+	_logFile: binlog文件
+	_logPos: binlog位点
+	_executedGTIDSet: 已经执行的 GTID 集合
+*/
+func (this *ApplyBinlog) NewTrxEndLogFilePos(_logFile string, _logPos int, _executedGTIDSet *ExecutedGTIDSet) *LogFilePos {
+	if err := _executedGTIDSet.CommitTrx(); err != nil {
+		logger.M.Warnf("警告. %v", err)
+	}
+
+	logFilePos := this.NewSourceLogFilePos(_logFile, _logPos)
+	logFilePos.SetExecutedGTIDSet(_executedGTIDSet)
+
+	return logFilePos
+}
+
+/* 初始化源实例的 server uuid, 如果和之前保存的位点不是同一个实例, 文件位点是没有意义的.
+从保存的应用位点继续时使用保存的 GTID 集合, 不是同一个实例则使用 GTID 集合开始解析binlog
+*/
+func (this *ApplyBinlog) InitSourceServerUUID() {
+	serverUUID, err := GetServerUUID(this.ConfigMap.Source.Host.String, int(this.ConfigMap.Source.Port.Int64))
+	if err != nil {
+		logger.M.Warnf("警告. 获取源实例 server uuid 失败, 位点中将不保存 server uuid. %v", err)
+	} else {
+		this.SourceServerUUID = serverUUID
+	}
+
+	appliedLogFilePos, err := GetSourceApplyPosition(this.ConfigMap.TaskUUID)
+	if err != nil {
+		logger.M.Warnf("警告. %v", err)
+		return
+	}
+	if appliedLogFilePos == nil {
+		return
+	}
+	this.InitStartGTIDSet(appliedLogFilePos)
+}
+
+/* 通过保存的应用位点初始化开始位点的 GTID 集合
+Params:
+	_appliedLogFilePos: 之前保存的应用位点
+*/
+func (this *ApplyBinlog) InitStartGTIDSet(_appliedLogFilePos *LogFilePos) {
+	isSameServer := _appliedLogFilePos.IsSameServer(this.NewSourceLogFilePos("", -1))
+
+	// 开始位点就是保存的应用位点(从应用位点继续), 保存的 GTID 集合才是开始位点的
+	isResume := _appliedLogFilePos.LogFile == this.Parser.StartLogFile && _appliedLogFilePos.LogPos == this.Parser.StartLogPos
+	if isResume && strings.TrimSpace(_appliedLogFilePos.GTIDSet) != "" {
+		this.StartGTIDSet = _appliedLogFilePos.GTIDSet
+		if !isSameServer {
+			this.IsSyncByGTID = true
+			logger.M.Warnf("警告. 源实例 server uuid 和之前应用到的位点不一样(可能发生了切换), 使用保存的 GTID 集合开始解析binlog. %v -> %v. %v",
+				_appliedLogFilePos.ServerUUID, this.SourceServerUUID, this.StartGTIDSet)
 		}
+		return
 	}
 
-	return false
+	if !isSameServer {
+		logger.M.Warnf("警告. 源实例 server uuid 和之前应用到的位点不一样(可能发生了切换), binlog文件位点可能不正确, 请确认开始位点. %v -> %v",
+			_appliedLogFilePos.ServerUUID, this.SourceServerUUID)
+	}
 }
 
 /* 更新源已经应用过了的位点信息
@@ -99,6 +183,54 @@ func UpdateSourceLogPosInfo(
 	return affected
 }
 
+/* 保存已经应用到的位点(序列化后的), 包含 GTID 和 server uuid
+Params:
+	_taskUUID: 任务ID
+	_logFilePos: 已经应用到的位点
+*/
+func UpdateSourceApplyPosition(_taskUUID string, _logFilePos *LogFilePos) int {
+	sourceDao := new(dao.SourceDao)
+	affected := sourceDao.UpdateApplyPosition(_taskUUID, _logFilePos.String())
+
+	return affected
+}
+
+/* 获取之前保存的已经应用到的位点, 没有保存过返回 nil
+Params:
+	_taskUUID: 任务ID
+*/
+func GetSourceApplyPosition(_taskUUID string) (*LogFilePos, error) {
+	sourceDao := new(dao.SourceDao)
+	source, err := sourceDao.GetByTaskUUID(_taskUUID, "apply_position")
+	if err != nil {
+		return nil, fmt.Errorf("失败. 获取已经应用到的位点. %v", err)
+	}
+	if source == nil || !source.ApplyPosition.Valid || strings.TrimSpace(source.ApplyPosition.String) == "" {
+		return nil, nil
+	}
+
+	return NewLogFilePosByString(source.ApplyPosition.String)
+}
+
+/* 获取实例的 server uuid
+Params:
+	_host: 实例IP
+	_port: 实例端口
+*/
+func GetServerUUID(host string, port int) (string, error) {
+	instance, ok := gdbc.GetDynamicDBByHostPort(host, int64(port))
+	if !ok {
+		return "", fmt.Errorf("缓存中不存在该实例(%v:%v). 获取 server uuid", host, port)
+	}
+
+	var serverUUID string
+	if err := instance.QueryRow("/* go-d-bus */ SELECT @@server_uuid").Scan(&serverUUID); err != nil {
+		return "", fmt.Errorf("失败. 获取 server uuid. %v:%v. %v", host, port, err)
+	}
+
+	return serverUUID, nil
+}
+
 /* 获取指定任务的停止位点信息
 Params:
 	_taskUUID: 任务UUID
@@ -125,6 +257,20 @@ func GetStopLogFilePos(_taskUUID string) (string, int) {
 	return stopLogFile, stopLogPos
 }
 
+/* 获取任务应用binlog并发数, 运行时修改 task.binlog_paraller 可以调整并发数
+Params:
+	_taskUUID: 任务UUID
+*/
+func GetTaskApplyBinlogParaller(_taskUUID string) (int, error) {
+	taskDao := new(dao.TaskDao)
+	task, err := taskDao.GetByTaskUUID(_taskUUID, "binlog_paraller")
+	if err != nil {
+		return 0, fmt.Errorf("失败. 获取任务应用binlog并发数. %v. %v", _taskUUID, err)
+	}
+
+	return int(task.BinlogParaller.Int64), nil
+}
+
 /* 执行 show master status 获取数据库位点信息
 Params:
 	_host: 实例IP
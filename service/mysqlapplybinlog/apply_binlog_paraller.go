@@ -0,0 +1,95 @@
+package mysqlapplybinlog
+
+import (
+	"github.com/daiguadaidai/go-d-bus/logger"
+	"github.com/daiguadaidai/go-d-bus/service/helper"
+	"sync"
+	"time"
+)
+
+/* 创建分配binlog到应用binlog的通道, 每个并发一个通道
+Params:
+    _paraller: 并发数
+    _size: 每个通道的容量
+*/
+func NewDistribute2ApplyChans(_paraller int, _size int) []chan *BinlogRowInfo {
+	chans := make([]chan *BinlogRowInfo, _paraller)
+	for i := 0; i < _paraller; i++ {
+		chans[i] = make(chan *BinlogRowInfo, _size)
+	}
+
+	return chans
+}
+
+/* 每个通道启动一个消费协程, 同一批消费协程使用一个 WaitGroup, 调整并发数时等待这一批协程应用完所有的行
+Params:
+    _wg: 并发控制参数
+*/
+func (this *ApplyBinlog) StartConsumeEventRows(_wg *sync.WaitGroup) {
+	consumeWG := new(sync.WaitGroup)
+	for i := range this.Distribute2ApplyChans {
+		_wg.Add(1)
+		consumeWG.Add(1)
+		go func(slot int) {
+			defer consumeWG.Done()
+			this.ConsumeEevetRows(_wg, slot)
+		}(i)
+	}
+
+	this.consumeWG = consumeWG
+}
+
+/* 分配下一个事件之前检测是否需要调整并发数
+需要调整时先关闭所有的通道, 等待已经分配的行全部应用完成, 再按新的并发数创建通道和消费协程.
+调整前分配的行都应用完了才分配调整后的行, 同一个主键的行不会同时在新旧两个通道中, 保证了同一行的应用顺序
+Params:
+    _wg: 并发控制参数
+*/
+func (this *ApplyBinlog) ReshardIfNeeded(_wg *sync.WaitGroup) {
+	paraller := int(this.PendingParaller.Swap(0))
+	if paraller <= 0 || paraller == this.GetApplyParaller() {
+		return
+	}
+
+	logger.M.Infof("开始调整应用binlog并发数: %v -> %v. 等待已经分配的行应用完成", this.GetApplyParaller(), paraller)
+	startTime := time.Now()
+
+	for _, distribute2ApplyChan := range this.Distribute2ApplyChans {
+		close(distribute2ApplyChan)
+	}
+	this.consumeWG.Wait()
+
+	this.applyParaller.Store(int64(paraller))
+	this.Distribute2ApplyChans = NewDistribute2ApplyChans(paraller, this.Parser.ApplyBinlogHighWaterMark)
+	this.StartConsumeEventRows(_wg)
+
+	logger.M.Infof("完成. 调整应用binlog并发数为 %v. 等待了 %v", paraller, time.Since(startTime))
+}
+
+// 当前应用binlog的并发数, 运行时会被调整, 不要直接使用命令行的并发数
+func (this *ApplyBinlog) GetApplyParaller() int {
+	return int(this.applyParaller.Load())
+}
+
+/* 循环获取应用binlog并发数, 被修改后在分配下一个事件前调整并发数
+开启了目标 checkpoint 时每个通道保存了各自的 checkpoint, 不能调整并发数
+*/
+func (this *ApplyBinlog) LoopWatchApplyBinlogParaller() {
+	if this.Parser.EnableTargetCheckpoint {
+		logger.M.Warnf("警告. 开启了目标 checkpoint, 每个通道保存了各自的 checkpoint, 运行时修改应用binlog并发数不会生效")
+		return
+	}
+
+	helper.LoopWatchParaller(
+		"应用binlog",
+		func() (int, error) {
+			return GetTaskApplyBinlogParaller(this.Parser.TaskUUID)
+		},
+		func(paraller int) {
+			this.PendingParaller.Store(int64(paraller))
+		},
+		func() bool {
+			return false
+		},
+	)
+}
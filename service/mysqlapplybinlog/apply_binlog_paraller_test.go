@@ -0,0 +1,67 @@
+package mysqlapplybinlog
+
+import (
+	"github.com/daiguadaidai/go-d-bus/logger"
+	"github.com/daiguadaidai/go-d-bus/parser"
+	"go.uber.org/atomic"
+	"go.uber.org/zap"
+	"sync"
+	"testing"
+)
+
+func TestApplyBinlog_ReshardIfNeeded(t *testing.T) {
+	logger.M = zap.NewNop().Sugar()
+
+	runParser := &parser.RunParser{ApplyBinlogParaller: 2, ApplyBinlogHighWaterMark: 10}
+	applyBinlog := &ApplyBinlog{
+		Parser:                runParser,
+		Distribute2ApplyChans: NewDistribute2ApplyChans(runParser.ApplyBinlogParaller, runParser.ApplyBinlogHighWaterMark),
+		PendingParaller:       atomic.NewInt64(0),
+		applyParaller:         atomic.NewInt64(int64(runParser.ApplyBinlogParaller)),
+	}
+	wg := new(sync.WaitGroup)
+	applyBinlog.StartConsumeEventRows(wg)
+
+	// 调整并发数的同时其他协程读取当前的并发数
+	stop := make(chan bool)
+	readWG := new(sync.WaitGroup)
+	readWG.Add(1)
+	go func() {
+		defer readWG.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				if paraller := applyBinlog.GetApplyParaller(); paraller != 2 && paraller != 4 {
+					t.Errorf("并发数只能是 2 或者 4, 实际 %v", paraller)
+					return
+				}
+			}
+		}
+	}()
+
+	applyBinlog.PendingParaller.Store(4)
+	applyBinlog.ReshardIfNeeded(wg)
+	close(stop)
+	readWG.Wait()
+
+	if applyBinlog.GetApplyParaller() != 4 || len(applyBinlog.Distribute2ApplyChans) != 4 {
+		t.Fatalf("期望调整为 4 个并发, 实际 %v, 通道数 %v", applyBinlog.GetApplyParaller(), len(applyBinlog.Distribute2ApplyChans))
+	}
+	if runParser.ApplyBinlogParaller != 2 {
+		t.Fatalf("不应该修改命令行的并发数, 实际 %v", runParser.ApplyBinlogParaller)
+	}
+
+	// 并发数没有变化不需要调整
+	applyBinlog.PendingParaller.Store(4)
+	applyBinlog.ReshardIfNeeded(wg)
+	if len(applyBinlog.Distribute2ApplyChans) != 4 {
+		t.Fatalf("期望 4 个通道, 实际 %v", len(applyBinlog.Distribute2ApplyChans))
+	}
+
+	for _, distribute2ApplyChan := range applyBinlog.Distribute2ApplyChans {
+		close(distribute2ApplyChan)
+	}
+	wg.Wait()
+}
@@ -2,6 +2,7 @@ package mysqlapplybinlog
 
 import (
 	"fmt"
+	"github.com/go-mysql-org/go-mysql/mysql"
 	"github.com/go-mysql-org/go-mysql/replication"
 	"time"
 )
@@ -11,6 +12,11 @@ type BinlogEventPos struct {
 	LogFile           string
 	LogPos            int
 	GenerateTimestamp int64
+	TrxLogFile        string // 该事件所在事务开始的binlog文件
+	TrxLogPos         int    // 该事件所在事务开始的binlog位点
+	TrxGTIDSet        string // 该事件所在事务开始时已经执行的 GTID 集合, 不知道为空
+
+	trxGTIDSet mysql.GTIDSet // 解析好的 TrxGTIDSet, 生成事件位点的时候不需要重新解析
 }
 
 /* 获取位点和时间戳字符串
@@ -29,12 +35,14 @@ Params:
 	_losFile: 解析到的binlog位点文件
 	_logPos: 解析到的binlog 位点
 	_generateTimestamp: 生成的该实例的时间纳秒
+	_trxLogFilePos: 该事件所在事务开始的位点
 */
 func NewBinlogEventPos(
 	_binlogEvent *replication.BinlogEvent,
 	_logFile string,
 	_logPos int,
 	_generateTimestamp int64,
+	_trxLogFilePos *LogFilePos,
 ) *BinlogEventPos {
 
 	if _generateTimestamp < 0 {
@@ -46,6 +54,10 @@ func NewBinlogEventPos(
 		LogFile:           _logFile,
 		LogPos:            _logPos,
 		GenerateTimestamp: _generateTimestamp,
+		TrxLogFile:        _trxLogFilePos.LogFile,
+		TrxLogPos:         _trxLogFilePos.LogPos,
+		TrxGTIDSet:        _trxLogFilePos.GTIDSet,
+		trxGTIDSet:        _trxLogFilePos.gtidSet,
 	}
 
 }
@@ -3,7 +3,9 @@ package mysqlapplybinlog
 import (
 	"fmt"
 	"github.com/daiguadaidai/go-d-bus/common"
+	"github.com/daiguadaidai/go-d-bus/matemap"
 	"github.com/go-mysql-org/go-mysql/replication"
+	"strings"
 )
 
 type BinlogRowInfo struct {
@@ -13,6 +15,10 @@ type BinlogRowInfo struct {
 	After       []interface{}
 	EventType   replication.EventType
 	ApplyRowKey string
+	Checkpoint  *TargetCheckpoint // 开启目标 checkpoint 时, 该行应用后需要保存的 checkpoint
+	QueueBytes  int64             // 该行在队列中占用的字节数, 应用完成后从队列水位中减去
+
+	DependencyKeys []DependencyKey // 该行前后镜像中所有的主键/唯一键值, 应用完成后释放
 }
 
 /* 新建一个event中的每一行数据
@@ -45,7 +51,7 @@ func (this *BinlogRowInfo) GetChanSlotByBefore(_columnIndexes []int, _paraller i
 	needHashValue := ""
 
 	for _, columnIndex := range _columnIndexes {
-		needHashValue += fmt.Sprintf("%v", this.After[columnIndex])
+		needHashValue += fmt.Sprintf("%v", this.Before[columnIndex])
 	}
 
 	hashValue := common.GenerateHashByString(needHashValue)
@@ -71,6 +77,134 @@ func (this *BinlogRowInfo) GetChanSlotByAfter(_columnIndexes []int, _paraller in
 	return hashValue % _paraller
 }
 
+/* 通过表名计算出需要的并发槽是哪个, 没有主键的表同一个表的行都在一个并发槽中顺序应用
+Params:
+	_paraller: 应用binlog的并发数
+*/
+func (this *BinlogRowInfo) GetChanSlotByTable(_paraller int) int {
+	hashValue := common.GenerateHashByString(common.FormatTableName(this.Schema, this.Table, ""))
+
+	return hashValue % _paraller
+}
+
+/* 获取该行前后镜像中所有的主键/唯一键值, 用于检测不同并发槽中的行是否冲突
+键值中有 NULL 的唯一键不会冲突, 不需要记录.
+键中有不能按字节比较的字段(如: 大小写不敏感)时, 可见 ASCII 字符的值转化成小写就能判断是否相等, 对所有的排序规则都成立.
+其他的值(如: utf8mb4_general_ci 中 'é' = 'e')无法精确规范化, 该行独占表级别的键值, 等待其他并发槽中该表的行都应用完;
+该表其他的行共享表级别的键值, 之间不冲突
+Params:
+	_ukIndexColumns: 每个主键/唯一键的字段下角标
+	_columns: 表所有的字段, 用于按排序规则规范化键值
+*/
+func (this *BinlogRowInfo) GetDependencyKeys(_ukIndexColumns [][]int, _columns []matemap.Column) []DependencyKey {
+	keys := make([]DependencyKey, 0, len(_ukIndexColumns)*2+1)
+	keyMap := make(map[string]bool)
+
+	isExact := true // 键值是否都能精确规范化
+	for _, row := range [][]interface{}{this.Before, this.After} {
+		for ukIndex, columnIndexes := range _ukIndexColumns {
+			key, ok, exact := getDependencyKey(this.Schema, this.Table, ukIndex, row, columnIndexes, _columns)
+			if !ok {
+				continue
+			}
+			isExact = isExact && exact
+			if keyMap[key] {
+				continue
+			}
+			keyMap[key] = true
+			keys = append(keys, DependencyKey{Key: key})
+		}
+	}
+
+	// 该表所有的行都有表级别的键值, 和键值不能精确规范化的行冲突
+	if hasNonBinaryKeyColumn(_ukIndexColumns, _columns) {
+		keys = append(keys, DependencyKey{Key: fmt.Sprintf("%v.%v:*", this.Schema, this.Table), Shared: isExact})
+	}
+
+	return keys
+}
+
+/* 获取一行中一个主键/唯一键的键值, 排序规则忽略结尾空格的字段去掉结尾空格, 不能按字节比较的字段转化成小写
+Params:
+	_schema: 数据库
+	_table: 表
+	_ukIndex: 第几个主键/唯一键
+	_row: 行数据
+	_columnIndexes: 该键的字段下角标
+	_columns: 表所有的字段
+Return: 键值, 是否有键值(有 NULL 值没有键值), 键值是否能精确规范化
+*/
+func getDependencyKey(
+	_schema string,
+	_table string,
+	_ukIndex int,
+	_row []interface{},
+	_columnIndexes []int,
+	_columns []matemap.Column,
+) (string, bool, bool) {
+	key := fmt.Sprintf("%v.%v:%v", _schema, _table, _ukIndex)
+	isExact := true
+	for _, columnIndex := range _columnIndexes {
+		if columnIndex >= len(_row) || _row[columnIndex] == nil {
+			return "", false, true
+		}
+
+		var value interface{} = _row[columnIndex]
+		if columnIndex < len(_columns) {
+			switch v := value.(type) {
+			case []byte:
+				value = normalizeKeyValue(string(v), _columns[columnIndex], &isExact)
+			case string:
+				value = normalizeKeyValue(v, _columns[columnIndex], &isExact)
+			}
+		}
+		key += fmt.Sprintf(":%v", value)
+	}
+
+	return key, true, isExact
+}
+
+/* 主键/唯一键中是否有不能按字节比较的字段
+Params:
+	_ukIndexColumns: 每个主键/唯一键的字段下角标
+	_columns: 表所有的字段
+*/
+func hasNonBinaryKeyColumn(_ukIndexColumns [][]int, _columns []matemap.Column) bool {
+	for _, columnIndexes := range _ukIndexColumns {
+		for _, columnIndex := range columnIndexes {
+			if columnIndex < len(_columns) && !_columns[columnIndex].IsBinaryCollation() {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+/* 按字段的排序规则规范化字符串键值
+Params:
+	_value: 字段值
+	_column: 字段
+	_isExact: 不能精确规范化时设置为 false
+*/
+func normalizeKeyValue(_value string, _column matemap.Column, _isExact *bool) string {
+	if _column.IsPadSpace() {
+		_value = strings.TrimRight(_value, " ")
+	}
+	if _column.IsBinaryCollation() {
+		return _value
+	}
+
+	for i := 0; i < len(_value); i++ {
+		if _value[i] < 0x20 || _value[i] > 0x7e {
+			*_isExact = false
+			return _value
+		}
+	}
+
+	return strings.ToLower(_value)
+}
+
 /* 获取 前镜像
 Params:
 	columnIndexies: 相关索引信息
@@ -0,0 +1,101 @@
+package mysqlapplybinlog
+
+import (
+	"fmt"
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"strings"
+)
+
+/* 解析binlog时已经执行的 GTID 集合, 保存在位点中
+初始集合来自保存的位点, 或者binlog文件开头的 PREVIOUS_GTIDS 事件, 之后每个事务结束时添加该事务的 GTID.
+从binlog文件中间的位点开始解析, 并且没有保存的 GTID 集合时, 到下一个binlog文件之前不知道已经执行的 GTID 集合
+*/
+type ExecutedGTIDSet struct {
+	gtidSet mysql.GTIDSet // 已经执行的 GTID 集合, 不知道为 nil
+	trxGTID string        // 正在解析的事务的 GTID, 没有为空
+}
+
+/* 新建一个已经执行的 GTID 集合
+Params:
+	_gtidSet: 初始的 GTID 集合, 不知道为空
+*/
+func NewExecutedGTIDSet(_gtidSet string) (*ExecutedGTIDSet, error) {
+	executedGTIDSet := new(ExecutedGTIDSet)
+	if strings.TrimSpace(_gtidSet) == "" {
+		return executedGTIDSet, nil
+	}
+
+	gtidSet, err := mysql.ParseMysqlGTIDSet(_gtidSet)
+	if err != nil {
+		return nil, fmt.Errorf("失败. 解析 GTID 集合. %v. %v", _gtidSet, err)
+	}
+	executedGTIDSet.gtidSet = gtidSet
+
+	return executedGTIDSet, nil
+}
+
+/* 通过 PREVIOUS_GTIDS 事件设置初始集合, 已经知道 GTID 集合时忽略.
+使用 GTID 开始解析时, 服务端会跳过已经执行的事务, PREVIOUS_GTIDS 中没有这些事务
+Params:
+	_gtidSets: PREVIOUS_GTIDS 事件中的 GTID 集合
+*/
+func (this *ExecutedGTIDSet) SetPrevious(_gtidSets string) error {
+	if this.gtidSet != nil {
+		return nil
+	}
+
+	gtidSet, err := mysql.ParseMysqlGTIDSet(_gtidSets)
+	if err != nil {
+		return fmt.Errorf("失败. 解析 PREVIOUS_GTIDS 事件的 GTID 集合. %v. %v", _gtidSets, err)
+	}
+	this.gtidSet = gtidSet
+
+	return nil
+}
+
+/* 记录正在解析的事务的 GTID, 没有开启 GTID 的事件(ANONYMOUS_GTID)忽略
+Params:
+	_sid: 产生事务实例的 server uuid
+	_gno: 事务序号
+*/
+func (this *ExecutedGTIDSet) SetTrxGTID(_sid []byte, _gno int64) {
+	if len(_sid) != 16 || _gno <= 0 {
+		this.trxGTID = ""
+		return
+	}
+
+	this.trxGTID = fmt.Sprintf("%x-%x-%x-%x-%x:%d", _sid[0:4], _sid[4:6], _sid[6:8], _sid[8:10], _sid[10:16], _gno)
+}
+
+// 事务结束, 将该事务的 GTID 添加到已经执行的 GTID 集合中
+func (this *ExecutedGTIDSet) CommitTrx() error {
+	trxGTID := this.trxGTID
+	this.trxGTID = ""
+	if this.gtidSet == nil || trxGTID == "" {
+		return nil
+	}
+
+	if err := this.gtidSet.Update(trxGTID); err != nil {
+		return fmt.Errorf("失败. 添加事务 GTID 到已经执行的 GTID 集合. %v. %v", trxGTID, err)
+	}
+
+	return nil
+}
+
+// 已经执行的 GTID 集合, 不知道为空
+func (this *ExecutedGTIDSet) String() string {
+	if this.gtidSet == nil {
+		return ""
+	}
+
+	return this.gtidSet.String()
+}
+
+// 复制一份已经执行的 GTID 集合, 不知道为 nil
+func (this *ExecutedGTIDSet) Clone() mysql.GTIDSet {
+	if this.gtidSet == nil {
+		return nil
+	}
+
+	return this.gtidSet.Clone()
+}
@@ -0,0 +1,83 @@
+package mysqlapplybinlog
+
+import (
+	"github.com/daiguadaidai/go-d-bus/logger"
+	"github.com/daiguadaidai/go-d-bus/parser"
+	"go.uber.org/zap"
+	"testing"
+)
+
+// 3e11fa47-71ca-11e1-9e33-c80aa9429562
+var testGTIDSID = []byte{0x3e, 0x11, 0xfa, 0x47, 0x71, 0xca, 0x11, 0xe1, 0x9e, 0x33, 0xc8, 0x0a, 0xa9, 0x42, 0x95, 0x62}
+
+func TestExecutedGTIDSet(t *testing.T) {
+	executedGTIDSet, err := NewExecutedGTIDSet("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 从文件中间开始解析, 还不知道已经执行的 GTID 集合, 事务的 GTID 忽略
+	executedGTIDSet.SetTrxGTID(testGTIDSID, 9)
+	if err := executedGTIDSet.CommitTrx(); err != nil {
+		t.Fatal(err)
+	}
+	if executedGTIDSet.String() != "" {
+		t.Fatalf("期望不知道 GTID 集合, 实际 %v", executedGTIDSet.String())
+	}
+
+	// 下一个binlog文件开头的 PREVIOUS_GTIDS
+	if err := executedGTIDSet.SetPrevious("3e11fa47-71ca-11e1-9e33-c80aa9429562:1-10"); err != nil {
+		t.Fatal(err)
+	}
+	executedGTIDSet.SetTrxGTID(testGTIDSID, 11)
+	if err := executedGTIDSet.CommitTrx(); err != nil {
+		t.Fatal(err)
+	}
+	if gtidSet := executedGTIDSet.String(); gtidSet != "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-11" {
+		t.Fatalf("期望 3e11fa47-71ca-11e1-9e33-c80aa9429562:1-11, 实际 %v", gtidSet)
+	}
+
+	// 已经知道 GTID 集合, 忽略 PREVIOUS_GTIDS. 没有开启 GTID 的事务不添加
+	if err := executedGTIDSet.SetPrevious("3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5"); err != nil {
+		t.Fatal(err)
+	}
+	executedGTIDSet.SetTrxGTID(make([]byte, 16), 0)
+	if err := executedGTIDSet.CommitTrx(); err != nil {
+		t.Fatal(err)
+	}
+	if gtidSet := executedGTIDSet.String(); gtidSet != "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-11" {
+		t.Fatalf("期望 3e11fa47-71ca-11e1-9e33-c80aa9429562:1-11, 实际 %v", gtidSet)
+	}
+}
+
+func TestApplyBinlog_InitStartGTIDSet(t *testing.T) {
+	logger.M = zap.NewNop().Sugar()
+
+	appliedLogFilePos := NewLogFilePos("mysql-bin.000009", 400)
+	appliedLogFilePos.GTIDSet = "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-10"
+	appliedLogFilePos.ServerUUID = "3e11fa47-71ca-11e1-9e33-c80aa9429562"
+
+	cases := []struct {
+		serverUUID   string
+		startLogPos  int
+		startGTIDSet string
+		isSyncByGTID bool
+	}{
+		{"3e11fa47-71ca-11e1-9e33-c80aa9429562", 400, appliedLogFilePos.GTIDSet, false}, // 同一个实例继续, 使用文件位点
+		{"4e11fa47-71ca-11e1-9e33-c80aa9429562", 400, appliedLogFilePos.GTIDSet, true},  // 发生了切换, 使用 GTID 集合
+		{"4e11fa47-71ca-11e1-9e33-c80aa9429562", 4, "", false},                          // 指定了其他开始位点
+	}
+
+	for i, c := range cases {
+		applyBinlog := &ApplyBinlog{
+			Parser:           &parser.RunParser{StartLogFile: "mysql-bin.000009", StartLogPos: c.startLogPos},
+			SourceServerUUID: c.serverUUID,
+		}
+		applyBinlog.InitStartGTIDSet(appliedLogFilePos)
+
+		if applyBinlog.StartGTIDSet != c.startGTIDSet || applyBinlog.IsSyncByGTID != c.isSyncByGTID {
+			t.Fatalf("case %v: 期望 GTID 集合 %v, 使用 GTID 开始 %v. 实际 %v, %v",
+				i, c.startGTIDSet, c.isSyncByGTID, applyBinlog.StartGTIDSet, applyBinlog.IsSyncByGTID)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package mysqlapplybinlog
+
+import (
+	"github.com/daiguadaidai/go-d-bus/logger"
+	"github.com/daiguadaidai/go-d-bus/matemap"
+	"sync"
+)
+
+// 一行数据依赖的一个键值. 共享(Shared)的键值之间不冲突, 只和其他并发槽中独占该键值的行冲突
+type DependencyKey struct {
+	Key    string
+	Shared bool
+}
+
+// 一个主键/唯一键值还没有应用的行
+type keyPending struct {
+	Slot         int         // 独占该键值的行所在的并发槽
+	Count        int         // 独占该键值还没有应用的行数
+	SharedCounts map[int]int // 共享该键值的行在每个并发槽中还没有应用的行数, 没有为 nil
+}
+
+/* 应用binlog时同一个主键/唯一键值的行之间的依赖关系
+分配每一行前取出该行前后镜像中所有的主键/唯一键值, 记录每个键值还有多少行没有应用, 以及这些行在哪个并发槽中.
+如果该行的某个键值还有没应用的行在其他并发槽中, 等待其他并发槽把这些行应用完再分配.
+所以同一个键值的行永远不会同时在两个并发槽中, 修改了主键/唯一键的行也不会和其他槽中的行乱序.
+键值不能精确规范化的行(见 GetDependencyKeys)独占表级别的键值, 等待其他并发槽中该表的行都应用完
+*/
+type KeyDependency struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+	keys map[string]*keyPending
+}
+
+func NewKeyDependency() *KeyDependency {
+	keyDependency := &KeyDependency{
+		keys: make(map[string]*keyPending),
+	}
+	keyDependency.cond = sync.NewCond(&keyDependency.mu)
+
+	return keyDependency
+}
+
+/* 分配行之前调用, 该行的键值在其他并发槽中还有没应用的行则一直等待, 之后记录该行的键值
+Params:
+    _keys: 该行的主键/唯一键值
+    _slot: 该行分配的并发槽
+Return: 是否发生了等待
+*/
+func (this *KeyDependency) Acquire(_keys []DependencyKey, _slot int) bool {
+	if len(_keys) == 0 {
+		return false
+	}
+
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	waited := false
+	for this.isConflict(_keys, _slot) {
+		waited = true
+		this.cond.Wait()
+	}
+
+	for _, key := range _keys {
+		pending, ok := this.keys[key.Key]
+		if !ok {
+			pending = new(keyPending)
+			this.keys[key.Key] = pending
+		}
+
+		if key.Shared {
+			if pending.SharedCounts == nil {
+				pending.SharedCounts = make(map[int]int)
+			}
+			pending.SharedCounts[_slot]++
+			continue
+		}
+		if pending.Count == 0 {
+			pending.Slot = _slot
+		}
+		pending.Count++
+	}
+
+	return waited
+}
+
+/* 行应用完成后调用, 减少该行键值没有应用的行数
+Params:
+    _keys: 该行的主键/唯一键值
+    _slot: 该行所在的并发槽
+*/
+func (this *KeyDependency) Release(_keys []DependencyKey, _slot int) {
+	if len(_keys) == 0 {
+		return
+	}
+
+	this.mu.Lock()
+	for _, key := range _keys {
+		pending, ok := this.keys[key.Key]
+		if !ok {
+			continue
+		}
+
+		if key.Shared {
+			pending.SharedCounts[_slot]--
+			if pending.SharedCounts[_slot] <= 0 {
+				delete(pending.SharedCounts, _slot)
+			}
+		} else {
+			pending.Count--
+		}
+		if pending.Count <= 0 && len(pending.SharedCounts) == 0 {
+			delete(this.keys, key.Key)
+		}
+	}
+	this.mu.Unlock()
+
+	this.cond.Broadcast()
+}
+
+// 还有没有应用完的键值个数
+func (this *KeyDependency) Len() int {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	return len(this.keys)
+}
+
+// 该行的键值是否有没应用的行在其他并发槽中, 调用者需要持有锁
+func (this *KeyDependency) isConflict(_keys []DependencyKey, _slot int) bool {
+	for _, key := range _keys {
+		pending, ok := this.keys[key.Key]
+		if !ok {
+			continue
+		}
+		if pending.Count > 0 && pending.Slot != _slot {
+			return true
+		}
+		if key.Shared {
+			continue
+		}
+		for slot, count := range pending.SharedCounts {
+			if slot != _slot && count > 0 {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+/* 分配行之前记录该行的主键/唯一键值, 和其他并发槽中还没应用的行冲突时等待这些行应用完成
+没有主键和唯一键的表, 同一个表的行都在一个并发槽中, 不需要记录
+Params:
+    _binlogRowInfo: 相关行数据信息
+    _table: 该行所在的表
+    _slot: 该行分配的并发槽
+*/
+func (this *ApplyBinlog) AcquireRowDependency(_binlogRowInfo *BinlogRowInfo, _table *matemap.Table, _slot int) {
+	if _table.IsApplyBinlogBySingleSlot() {
+		return
+	}
+
+	ukIndexColumns := _table.SourceUKIndexColumns
+	if len(ukIndexColumns) == 0 {
+		ukIndexColumns = [][]int{_table.SourcePKColumns}
+	}
+	_binlogRowInfo.DependencyKeys = _binlogRowInfo.GetDependencyKeys(ukIndexColumns, _table.SourceColumns)
+
+	if this.KeyDependency.Acquire(_binlogRowInfo.DependencyKeys, _slot) {
+		logger.M.Debugf("%v.%v 行的主键/唯一键值和其他并发槽中的行冲突, 等待其他并发槽应用完成后再分配. 并发槽: %v",
+			_binlogRowInfo.Schema, _binlogRowInfo.Table, _slot)
+	}
+}
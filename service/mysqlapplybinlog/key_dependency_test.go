@@ -0,0 +1,147 @@
+package mysqlapplybinlog
+
+import (
+	"github.com/daiguadaidai/go-d-bus/matemap"
+	"testing"
+	"time"
+)
+
+var keyDependencyTestColumns = []matemap.Column{{Name: "id"}, {Name: "name", Collation: "utf8mb4_bin"}}
+
+func TestKeyDependency_Acquire(t *testing.T) {
+	keyDependency := NewKeyDependency()
+
+	// 主键 1 -> 2 的 update 分配到槽 0
+	updateRow := NewBinlogRowInfo("db", "t", []interface{}{1, "a"}, []interface{}{2, "a"}, 0, "")
+	updateKeys := updateRow.GetDependencyKeys([][]int{{0}, {1}}, keyDependencyTestColumns)
+	if len(updateKeys) != 3 {
+		t.Fatalf("前后镜像应该有 3 个不同的键值(主键 1, 主键 2, 唯一键 a). %v", updateKeys)
+	}
+	if keyDependency.Acquire(updateKeys, 0) {
+		t.Fatalf("没有冲突的行, 不应该等待")
+	}
+
+	// 同一个槽中的行不需要等待
+	if keyDependency.Acquire(updateKeys, 0) {
+		t.Fatalf("同一个槽中的行, 不应该等待")
+	}
+	keyDependency.Release(updateKeys, 0)
+
+	// 新主键 2 的 delete 分配到槽 1, 需要等待槽 0 中的 update 应用完成
+	deleteRow := NewBinlogRowInfo("db", "t", []interface{}{2, "b"}, []interface{}{2, "b"}, 0, "")
+	deleteKeys := deleteRow.GetDependencyKeys([][]int{{0}, {1}}, keyDependencyTestColumns)
+	acquired := make(chan bool)
+	go func() {
+		acquired <- keyDependency.Acquire(deleteKeys, 1)
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatalf("槽 0 中还有主键 2 的行没有应用, 不应该分配到槽 1")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	keyDependency.Release(updateKeys, 0)
+	select {
+	case waited := <-acquired:
+		if !waited {
+			t.Fatalf("发生了等待, 应该返回 true")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("槽 0 中的行应用完成后, 应该可以分配到槽 1")
+	}
+
+	keyDependency.Release(deleteKeys, 1)
+	if keyDependency.Len() != 0 {
+		t.Fatalf("所有的行都应用完成, 不应该还有键值. %v", keyDependency.Len())
+	}
+}
+
+func TestBinlogRowInfo_GetDependencyKeys_PadSpace(t *testing.T) {
+	// utf8mb4_bin 比较时忽略结尾的空格, 'a' 和 'a  ' 是同一个唯一键值
+	row1 := NewBinlogRowInfo("db", "t", []interface{}{1, "a"}, []interface{}{1, "a"}, 0, "")
+	row2 := NewBinlogRowInfo("db", "t", []interface{}{2, []byte("a  ")}, []interface{}{2, []byte("a  ")}, 0, "")
+	keys1 := row1.GetDependencyKeys([][]int{{1}}, keyDependencyTestColumns)
+	keys2 := row2.GetDependencyKeys([][]int{{1}}, keyDependencyTestColumns)
+	if len(keys1) != 1 || len(keys2) != 1 || keys1[0] != keys2[0] {
+		t.Fatalf("忽略结尾空格的排序规则, 键值应该一样. %v, %v", keys1, keys2)
+	}
+
+	// utf8mb4_0900_bin 不忽略结尾的空格
+	noPadColumns := []matemap.Column{{Name: "id"}, {Name: "name", Collation: "utf8mb4_0900_bin"}}
+	keys1 = row1.GetDependencyKeys([][]int{{1}}, noPadColumns)
+	keys2 = row2.GetDependencyKeys([][]int{{1}}, noPadColumns)
+	if keys1[0] == keys2[0] {
+		t.Fatalf("不忽略结尾空格的排序规则, 键值应该不一样. %v, %v", keys1, keys2)
+	}
+}
+
+func TestBinlogRowInfo_GetDependencyKeys_CaseInsensitive(t *testing.T) {
+	ciColumns := []matemap.Column{{Name: "id"}, {Name: "name", Collation: "utf8mb4_general_ci"}}
+
+	// 大小写不敏感的排序规则, 'ABC' 和 'abc' 是同一个唯一键值, 表级别的键是共享的
+	row1 := NewBinlogRowInfo("db", "t", []interface{}{1, "ABC"}, []interface{}{1, "ABC"}, 0, "")
+	row2 := NewBinlogRowInfo("db", "t", []interface{}{2, []byte("abc ")}, []interface{}{2, []byte("abc ")}, 0, "")
+	keys1 := row1.GetDependencyKeys([][]int{{1}}, ciColumns)
+	keys2 := row2.GetDependencyKeys([][]int{{1}}, ciColumns)
+	if len(keys1) != 2 || len(keys2) != 2 {
+		t.Fatalf("应该有唯一键值和表级别的键. %v, %v", keys1, keys2)
+	}
+	if keys1[0] != keys2[0] {
+		t.Fatalf("大小写不敏感的排序规则, 键值应该一样. %v, %v", keys1, keys2)
+	}
+	if !keys1[1].Shared || keys1[1] != keys2[1] {
+		t.Fatalf("键值都是 ASCII 字符, 表级别的键应该是共享的. %v, %v", keys1, keys2)
+	}
+
+	// 非 ASCII 字符没办法按排序规则规范化, 表级别的键是独占的
+	row3 := NewBinlogRowInfo("db", "t", []interface{}{3, "é"}, []interface{}{3, "é"}, 0, "")
+	keys3 := row3.GetDependencyKeys([][]int{{1}}, ciColumns)
+	if len(keys3) != 2 || keys3[1].Shared || keys3[1].Key != keys1[1].Key {
+		t.Fatalf("键值有非 ASCII 字符, 表级别的键应该是独占的. %v", keys3)
+	}
+}
+
+func TestKeyDependency_AcquireShared(t *testing.T) {
+	keyDependency := NewKeyDependency()
+	sharedKeys := []DependencyKey{{Key: "db.t:*", Shared: true}}
+	exclusiveKeys := []DependencyKey{{Key: "db.t:*"}}
+
+	// 共享的键在不同的槽中不需要等待
+	if keyDependency.Acquire(sharedKeys, 0) || keyDependency.Acquire(sharedKeys, 1) {
+		t.Fatalf("共享的键在不同的槽中, 不应该等待")
+	}
+	keyDependency.Release(sharedKeys, 1)
+
+	// 独占的键需要等待其他槽中共享的键释放
+	acquired := make(chan bool)
+	go func() {
+		acquired <- keyDependency.Acquire(exclusiveKeys, 1)
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatalf("槽 0 中还有共享的键没有释放, 不应该分配到槽 1")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	keyDependency.Release(sharedKeys, 0)
+	select {
+	case waited := <-acquired:
+		if !waited {
+			t.Fatalf("发生了等待, 应该返回 true")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("槽 0 中共享的键释放后, 应该可以分配到槽 1")
+	}
+
+	// 共享的键需要等待其他槽中独占的键释放
+	if keyDependency.Acquire(sharedKeys, 1) {
+		t.Fatalf("同一个槽中的行, 不应该等待")
+	}
+	keyDependency.Release(sharedKeys, 1)
+	keyDependency.Release(exclusiveKeys, 1)
+	if keyDependency.Len() != 0 {
+		t.Fatalf("所有的行都应用完成, 不应该还有键值. %v", keyDependency.Len())
+	}
+}
@@ -1,55 +1,250 @@
 package mysqlapplybinlog
 
 import (
-	"strings"
+	"encoding/json"
+	"fmt"
+	"github.com/go-mysql-org/go-mysql/mysql"
 	"strconv"
+	"strings"
 )
 
+/* binlog 位点
+文件名不直接用字符串比较, 而是比较文件名后缀的序号. 如: mysql-bin.999999 < mysql-bin.1000000
+有 GTID 的时候优先使用 GTID 比较. 文件位点只有在同一个实例(server uuid)中比较才有意义
+*/
 type LogFilePos struct {
-	LogFile string
-	LogPos int
+	LogFile    string `json:"log_file"`
+	LogPos     int    `json:"log_pos"`
+	GTIDSet    string `json:"gtid_set,omitempty"`    // 执行到该位点的 GTID 集合, 可以为空
+	ServerUUID string `json:"server_uuid,omitempty"` // 产生该位点实例的 server uuid, 可以为空
+
+	gtidSet       mysql.GTIDSet // 解析好的 GTID 集合, 比较位点的时候不需要每次都解析. 只读, 可以在多个位点中共用
+	parsedGTIDSet string        // gtidSet 是通过哪个 GTID 集合字符串解析的, 直接修改了 GTIDSet 后缓存失效
 }
 
 /* 新建一个信息实例
 Params:
 	_logFile: binlog文件
 	_logPos: binlog pos
- */
+*/
 func NewLogFilePos(_logFile string, _logPos int) *LogFilePos {
 	return &LogFilePos{
 		LogFile: _logFile,
-		LogPos: _logPos,
+		LogPos:  _logPos,
 	}
 }
 
-/* 通过一个timestamp, logfile, logpos, 组合的key生成 LogFilePos
+/* 通过序列化的字符串生成 LogFilePos
 Params:
-	_key: 1111111111111111111:mysql-bin.000000001:000001111111111
- */
-func NewLogFilePosByKey(_key string) *LogFilePos {
-	items := strings.Split(_key, ":")
-	logFile := items[1]
-	logPos, _ := strconv.Atoi(items[2])
+	_str: {"log_file":"mysql-bin.000001","log_pos":120,"gtid_set":"...","server_uuid":"..."}
+*/
+func NewLogFilePosByString(_str string) (*LogFilePos, error) {
+	logFilePos := new(LogFilePos)
+	if err := json.Unmarshal([]byte(_str), logFilePos); err != nil {
+		return nil, fmt.Errorf("失败. 解析binlog位点. %v. %v", _str, err)
+	}
 
+	return logFilePos, nil
+}
 
-	return &LogFilePos{
-		LogFile: logFile,
-		LogPos: logPos,
+// 序列化位点, 用于保存到元数据表中
+func (this *LogFilePos) String() string {
+	raw, _ := json.Marshal(this)
+
+	return string(raw)
+}
+
+// 复制一个位点
+func (this *LogFilePos) Clone() *LogFilePos {
+	logFilePos := *this
+
+	return &logFilePos
+}
+
+/* 设置执行到该位点的 GTID 集合, 并缓存解析好的 GTID 集合
+Params:
+	_gtidSet: GTID 集合字符串
+*/
+func (this *LogFilePos) SetGTIDSet(_gtidSet string) {
+	this.GTIDSet = _gtidSet
+	this.gtidSet = nil
+	this.parsedGTIDSet = ""
+	if strings.TrimSpace(_gtidSet) == "" {
+		return
 	}
+
+	gtidSet, err := mysql.ParseMysqlGTIDSet(_gtidSet)
+	if err != nil {
+		return
+	}
+	this.gtidSet = gtidSet
+	this.parsedGTIDSet = _gtidSet
 }
 
-/* 判断本 位点是否 >= 其他位点
+/* 使用已经执行的 GTID 集合设置该位点的 GTID 集合, 复制一份不需要重新解析
+Params:
+	_executedGTIDSet: 已经执行的 GTID 集合
+*/
+func (this *LogFilePos) SetExecutedGTIDSet(_executedGTIDSet *ExecutedGTIDSet) {
+	this.setParsedGTIDSet(_executedGTIDSet.String(), _executedGTIDSet.Clone())
+}
+
+/* 设置 GTID 集合字符串和解析好的 GTID 集合
+Params:
+	_gtidSetStr: GTID 集合字符串
+	_gtidSet: 解析好的 GTID 集合, 不知道为 nil
+*/
+func (this *LogFilePos) setParsedGTIDSet(_gtidSetStr string, _gtidSet mysql.GTIDSet) {
+	this.GTIDSet = _gtidSetStr
+	this.gtidSet = _gtidSet
+	this.parsedGTIDSet = _gtidSetStr
+}
+
+/* 获取解析好的 GTID 集合. 没有缓存(如: 从元数据表中读取的位点)时临时解析, 不修改位点, 可以并发调用
+Return:
+	GTID 集合, 是否有 GTID 集合
+*/
+func (this *LogFilePos) getGTIDSet() (mysql.GTIDSet, bool) {
+	if strings.TrimSpace(this.GTIDSet) == "" {
+		return nil, false
+	}
+	if this.gtidSet != nil && this.parsedGTIDSet == this.GTIDSet {
+		return this.gtidSet, true
+	}
+
+	gtidSet, err := mysql.ParseMysqlGTIDSet(this.GTIDSet)
+	if err != nil {
+		return nil, false
+	}
+
+	return gtidSet, true
+}
+
+/* 解析binlog文件名, 获得文件名前缀和序号
+Params:
+	_logFile: binlog文件. 如: mysql-bin.000001
+Return:
+	mysql-bin, 1, true
+*/
+func ParseLogFileSeq(_logFile string) (string, int64, bool) {
+	dotIndex := strings.LastIndex(_logFile, ".")
+	if dotIndex < 0 || dotIndex == len(_logFile)-1 {
+		return "", -1, false
+	}
+
+	seq, err := strconv.ParseInt(_logFile[dotIndex+1:], 10, 64)
+	if err != nil || seq < 0 {
+		return "", -1, false
+	}
+
+	return _logFile[:dotIndex], seq, true
+}
+
+/* 比较两个binlog文件
+Params:
+	_logFileA: 文件A
+	_logFileB: 文件B
+Return:
+	-1: A < B, 0: A == B, 1: A > B
+*/
+func CompareLogFile(_logFileA string, _logFileB string) int {
+	if _logFileA == _logFileB {
+		return 0
+	}
+
+	// 文件名前缀相同的时候比较序号, 否则只能比较字符串
+	baseA, seqA, okA := ParseLogFileSeq(_logFileA)
+	baseB, seqB, okB := ParseLogFileSeq(_logFileB)
+	if okA && okB && baseA == baseB {
+		if seqA < seqB {
+			return -1
+		} else if seqA > seqB {
+			return 1
+		}
+		return 0
+	}
+
+	if _logFileA < _logFileB {
+		return -1
+	}
+	return 1
+}
+
+/* 通过 GTID 比较位点, 只有一个 GTID 集合包含另外一个时才能比较出大小
+Params:
+	_other: 其他位点
+Return:
+	比较结果, 是否可以通过 GTID 比较
+*/
+func (this *LogFilePos) compareGTIDSet(_other *LogFilePos) (int, bool) {
+	gtidSetA, ok := this.getGTIDSet()
+	if !ok {
+		return 0, false
+	}
+	gtidSetB, ok := _other.getGTIDSet()
+	if !ok {
+		return 0, false
+	}
+
+	if gtidSetA.Equal(gtidSetB) {
+		// GTID 一样, 同一个实例还需要比较文件位点(同一个事务中的多个event)
+		if this.IsSameServer(_other) {
+			return 0, false
+		}
+		return 0, true
+	} else if gtidSetA.Contain(gtidSetB) {
+		return 1, true
+	} else if gtidSetB.Contain(gtidSetA) {
+		return -1, true
+	}
+
+	return 0, false
+}
+
+/* 比较两个位点
+Params:
+	_other: 其他位点
+Return:
+	-1: 本位点 < 其他位点, 0: 相等, 1: 本位点 > 其他位点
+*/
+func (this *LogFilePos) Compare(_other *LogFilePos) int {
+	// 都知道是同一个实例产生的位点, 文件位点就可以比较出大小, 不需要比较 GTID
+	isSameKnownServer := this.ServerUUID != "" && this.ServerUUID == _other.ServerUUID
+	if !isSameKnownServer {
+		if cmp, ok := this.compareGTIDSet(_other); ok {
+			return cmp
+		}
+	}
+
+	if cmp := CompareLogFile(this.LogFile, _other.LogFile); cmp != 0 {
+		return cmp
+	}
+
+	if this.LogPos < _other.LogPos {
+		return -1
+	} else if this.LogPos > _other.LogPos {
+		return 1
+	}
+
+	return 0
+}
+
+/* 判断本 位点是否 > 其他位点
 Params:
 	_other: 其他位点
- */
+*/
 func (this *LogFilePos) IsRatherThan(_other *LogFilePos) bool {
-	isRatherThan := false
+	return this.Compare(_other) > 0
+}
 
-	if this.LogFile > _other.LogFile {
-		isRatherThan = true
-	} else if(this.LogFile == _other.LogFile && this.LogPos > _other.LogPos) {
-		isRatherThan = true
+/* 判断两个位点是否是同一个实例产生的, 有一个没有 server uuid 认为是同一个实例
+Params:
+	_other: 其他位点
+*/
+func (this *LogFilePos) IsSameServer(_other *LogFilePos) bool {
+	if this.ServerUUID == "" || _other.ServerUUID == "" {
+		return true
 	}
 
-	return isRatherThan
+	return this.ServerUUID == _other.ServerUUID
 }
@@ -0,0 +1,108 @@
+package mysqlapplybinlog
+
+import (
+	"testing"
+)
+
+func TestLogFilePos_Compare(t *testing.T) {
+	cases := []struct {
+		a   *LogFilePos
+		b   *LogFilePos
+		cmp int
+	}{
+		{NewLogFilePos("mysql-bin.000001", 120), NewLogFilePos("mysql-bin.000001", 120), 0},
+		{NewLogFilePos("mysql-bin.000001", 120), NewLogFilePos("mysql-bin.000001", 4), 1},
+		{NewLogFilePos("mysql-bin.000001", 120), NewLogFilePos("mysql-bin.000002", 4), -1},
+		{NewLogFilePos("mysql-bin.999999", 120), NewLogFilePos("mysql-bin.1000000", 4), -1},
+		{NewLogFilePos("mysql-bin.1000000", 4), NewLogFilePos("mysql-bin.999999", 120), 1},
+		{NewLogFilePos("host:3306-bin.000010", 4), NewLogFilePos("host:3306-bin.000009", 900), 1},
+	}
+
+	for i, c := range cases {
+		if cmp := c.a.Compare(c.b); cmp != c.cmp {
+			t.Fatalf("case %v: %v 比较 %v 期望 %v, 实际 %v", i, c.a, c.b, c.cmp, cmp)
+		}
+	}
+}
+
+func TestLogFilePos_CompareGTIDSet(t *testing.T) {
+	a := NewLogFilePos("mysql-bin.000009", 4)
+	a.GTIDSet = "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-10"
+	a.ServerUUID = "3e11fa47-71ca-11e1-9e33-c80aa9429562"
+	b := NewLogFilePos("mysql-bin.000001", 900)
+	b.GTIDSet = "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-20"
+	b.ServerUUID = "4e11fa47-71ca-11e1-9e33-c80aa9429562"
+
+	// 不同实例, 文件位点没有意义, 使用 GTID 比较
+	if cmp := a.Compare(b); cmp != -1 {
+		t.Fatalf("期望 -1, 实际 %v", cmp)
+	}
+	if !b.IsRatherThan(a) {
+		t.Fatal("期望 b > a")
+	}
+	if a.IsSameServer(b) {
+		t.Fatal("期望不是同一个实例")
+	}
+}
+
+func TestLogFilePos_CompareSameServer(t *testing.T) {
+	a := NewLogFilePos("mysql-bin.000001", 900)
+	a.SetGTIDSet("3e11fa47-71ca-11e1-9e33-c80aa9429562:1-20")
+	a.ServerUUID = "3e11fa47-71ca-11e1-9e33-c80aa9429562"
+	b := NewLogFilePos("mysql-bin.000002", 4)
+	b.SetGTIDSet("3e11fa47-71ca-11e1-9e33-c80aa9429562:1-10")
+	b.ServerUUID = "3e11fa47-71ca-11e1-9e33-c80aa9429562"
+
+	// 同一个实例直接使用文件位点比较
+	if cmp := a.Compare(b); cmp != -1 {
+		t.Fatalf("期望 -1, 实际 %v", cmp)
+	}
+}
+
+func TestLogFilePos_GTIDSetCache(t *testing.T) {
+	executedGTIDSet, err := NewExecutedGTIDSet("3e11fa47-71ca-11e1-9e33-c80aa9429562:1-10")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := NewLogFilePos("mysql-bin.000009", 4)
+	a.SetExecutedGTIDSet(executedGTIDSet)
+	b := NewLogFilePos("mysql-bin.000001", 900)
+	b.SetGTIDSet("3e11fa47-71ca-11e1-9e33-c80aa9429562:1-20")
+	if a.gtidSet == nil || b.gtidSet == nil {
+		t.Fatal("设置 GTID 集合后应该缓存解析好的 GTID 集合")
+	}
+
+	// 已经执行的 GTID 集合继续增加, 不能影响已经生成的位点
+	executedGTIDSet.SetTrxGTID([]byte{0x3e, 0x11, 0xfa, 0x47, 0x71, 0xca, 0x11, 0xe1, 0x9e, 0x33, 0xc8, 0x0a, 0xa9, 0x42, 0x95, 0x62}, 30)
+	if err := executedGTIDSet.CommitTrx(); err != nil {
+		t.Fatal(err)
+	}
+	if cmp := a.Compare(b); cmp != -1 {
+		t.Fatalf("期望 -1, 实际 %v", cmp)
+	}
+
+	// 直接修改 GTID 集合字符串, 缓存失效
+	a.GTIDSet = "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-30"
+	if cmp := a.Compare(b); cmp != 1 {
+		t.Fatalf("期望 1, 实际 %v", cmp)
+	}
+}
+
+func TestNewLogFilePosByString(t *testing.T) {
+	logFilePos := NewLogFilePos("mysql-bin.1000000", 120)
+	logFilePos.GTIDSet = "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-10"
+	logFilePos.ServerUUID = "3e11fa47-71ca-11e1-9e33-c80aa9429562"
+
+	decoded, err := NewLogFilePosByString(logFilePos.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *decoded != *logFilePos {
+		t.Fatalf("期望 %v, 实际 %v", logFilePos, decoded)
+	}
+
+	if _, err := NewLogFilePosByString("1111:mysql-bin.000001:000000000000120"); err == nil {
+		t.Fatal("期望解析失败")
+	}
+}
@@ -0,0 +1,135 @@
+package mysqlapplybinlog
+
+import (
+	"github.com/daiguadaidai/go-d-bus/logger"
+	"github.com/daiguadaidai/go-d-bus/parser"
+	"github.com/go-mysql-org/go-mysql/replication"
+	"go.uber.org/atomic"
+	"time"
+)
+
+const (
+	QUEUE_WATER_MARK_WAIT_TIME = 100 * time.Millisecond // 队列超过高水位后, 多久检测一次是否降到了低水位
+)
+
+/* 解析 binlog 到应用完成之间队列中缓存的数据量
+解析出的 RowsEvent 放入队列前加上事件的字节数和行数, 每一行应用完成后减去该行的字节数和行数.
+超过高水位后暂停解析 binlog, 直到降到低水位以下再继续, 防止大 JSON/BLOB 行的突发写入耗尽内存
+*/
+type QueueWaterMark struct {
+	HighBytes int64 // 字节数高水位, 0 不检测
+	LowBytes  int64 // 字节数低水位
+	HighRows  int64 // 行数高水位, 0 不检测
+	LowRows   int64 // 行数低水位
+
+	Bytes *atomic.Int64 // 队列中缓存的字节数
+	Rows  *atomic.Int64 // 队列中缓存的行数
+}
+
+/* 创建队列水位
+Params:
+    _parser: 命令行解析的信息
+*/
+func NewQueueWaterMark(_parser *parser.RunParser) *QueueWaterMark {
+	return &QueueWaterMark{
+		HighBytes: int64(_parser.QueueHighWaterMB) * 1024 * 1024,
+		LowBytes:  int64(_parser.QueueLowWaterMB) * 1024 * 1024,
+		HighRows:  int64(_parser.QueueHighWaterRows),
+		LowRows:   int64(_parser.QueueLowWaterRows),
+		Bytes:     atomic.NewInt64(0),
+		Rows:      atomic.NewInt64(0),
+	}
+}
+
+/* 事件放入队列, 增加缓存的字节数和行数
+Params:
+    _bytes: 事件的字节数
+    _rows: 事件的行数
+*/
+func (this *QueueWaterMark) Add(bytes int64, rows int64) {
+	this.Bytes.Add(bytes)
+	this.Rows.Add(rows)
+}
+
+/* 行应用完成, 减少缓存的字节数和行数
+Params:
+    _bytes: 行的字节数
+    _rows: 行数
+*/
+func (this *QueueWaterMark) Release(bytes int64, rows int64) {
+	this.Bytes.Sub(bytes)
+	this.Rows.Sub(rows)
+}
+
+// 是否超过了高水位
+func (this *QueueWaterMark) IsOverHighWaterMark() bool {
+	if this.HighBytes > 0 && this.Bytes.Load() > this.HighBytes {
+		return true
+	}
+	if this.HighRows > 0 && this.Rows.Load() > this.HighRows {
+		return true
+	}
+
+	return false
+}
+
+// 是否降到了低水位以下
+func (this *QueueWaterMark) IsBelowLowWaterMark() bool {
+	if this.HighBytes > 0 && this.Bytes.Load() > this.LowBytes {
+		return false
+	}
+	if this.HighRows > 0 && this.Rows.Load() > this.LowRows {
+		return false
+	}
+
+	return true
+}
+
+// 超过了高水位则一直等待, 直到降到低水位以下
+func (this *QueueWaterMark) WaitBelowHighWaterMark() {
+	if !this.IsOverHighWaterMark() {
+		return
+	}
+
+	logger.M.Warnf("警告. 应用binlog队列超过高水位, 暂停解析binlog. 缓存: %v 字节, %v 行. 高水位: %v 字节, %v 行",
+		this.Bytes.Load(), this.Rows.Load(), this.HighBytes, this.HighRows)
+
+	waitStartTime := time.Now()
+	for !this.IsBelowLowWaterMark() {
+		time.Sleep(QUEUE_WATER_MARK_WAIT_TIME)
+	}
+
+	logger.M.Infof("应用binlog队列降到低水位以下, 继续解析binlog. 暂停了 %v. 缓存: %v 字节, %v 行. 低水位: %v 字节, %v 行",
+		time.Since(waitStartTime), this.Bytes.Load(), this.Rows.Load(), this.LowBytes, this.LowRows)
+}
+
+/* 获取 RowsEvent 中需要应用的行数, update 事件前后镜像算一行
+Params:
+    _rowsEvent: binlog 行事件
+    _eventType: 事件类型
+*/
+func GetRowsEventRowCount(rowsEvent *replication.RowsEvent, eventType replication.EventType) int {
+	switch eventType {
+	case replication.UPDATE_ROWS_EVENTv0, replication.UPDATE_ROWS_EVENTv1, replication.UPDATE_ROWS_EVENTv2:
+		return len(rowsEvent.Rows) / 2
+	}
+
+	return len(rowsEvent.Rows)
+}
+
+/* 设置行在队列中占用的字节数, 事件的字节数平均分给每一行, 余数算在最后一行
+Params:
+    _binlogRowInfo: 相关行数据信息
+    _binlogEventPos: 行所在的事件
+    _rowCount: 事件的行数
+    _rowIndex: 行在事件中的位置
+*/
+func (this *ApplyBinlog) SetRowQueueBytes(_binlogRowInfo *BinlogRowInfo, _binlogEventPos *BinlogEventPos, _rowCount int, _rowIndex int) {
+	eventSize := int64(_binlogEventPos.BinlogEvent.Header.EventSize)
+	rowBytes := eventSize / int64(_rowCount)
+	if _rowIndex == _rowCount-1 {
+		rowBytes = eventSize - rowBytes*int64(_rowCount-1)
+	}
+
+	_binlogRowInfo.QueueBytes = rowBytes
+}
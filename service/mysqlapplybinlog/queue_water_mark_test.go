@@ -0,0 +1,39 @@
+package mysqlapplybinlog
+
+import (
+	"github.com/daiguadaidai/go-d-bus/parser"
+	"testing"
+)
+
+func TestQueueWaterMark(t *testing.T) {
+	waterMark := NewQueueWaterMark(&parser.RunParser{
+		QueueHighWaterMB:   2,
+		QueueLowWaterMB:    1,
+		QueueHighWaterRows: 100,
+		QueueLowWaterRows:  10,
+	})
+
+	waterMark.Add(3*1024*1024, 1)
+	if !waterMark.IsOverHighWaterMark() {
+		t.Fatalf("字节数超过了高水位, 应该暂停")
+	}
+
+	// 降到字节数低水位以下, 行数没有超过低水位
+	waterMark.Release(2*1024*1024, 0)
+	if waterMark.IsOverHighWaterMark() || !waterMark.IsBelowLowWaterMark() {
+		t.Fatalf("已经降到低水位以下, 应该继续. 字节数: %v, 行数: %v", waterMark.Bytes.Load(), waterMark.Rows.Load())
+	}
+
+	// 行数在高低水位之间, 不暂停也不算降到低水位
+	waterMark.Add(0, 50)
+	if waterMark.IsOverHighWaterMark() || waterMark.IsBelowLowWaterMark() {
+		t.Fatalf("行数在高低水位之间. 行数: %v", waterMark.Rows.Load())
+	}
+
+	// 高水位为0不检测
+	noCheck := NewQueueWaterMark(&parser.RunParser{})
+	noCheck.Add(1024*1024*1024, 1000000)
+	if noCheck.IsOverHighWaterMark() || !noCheck.IsBelowLowWaterMark() {
+		t.Fatalf("高水位为0不应该检测")
+	}
+}
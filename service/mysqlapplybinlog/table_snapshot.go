@@ -0,0 +1,71 @@
+package mysqlapplybinlog
+
+import (
+	"fmt"
+	"github.com/daiguadaidai/go-d-bus/common"
+	"github.com/daiguadaidai/go-d-bus/dao"
+	"github.com/daiguadaidai/go-d-bus/logger"
+	"github.com/daiguadaidai/go-d-bus/model"
+	"strings"
+)
+
+/* 在 row copy 完成后, 开始应用binlog前, 获取没有主键的表 row copy 使用的快照位点.
+没有主键的表重复应用binlog会造成数据不一致. 重启时没有完成的表会从新的快照中重新拷贝, 应用binlog从更早的位点开始,
+该表在快照位点之前的事务已经包含在拷贝的数据中, 需要跳过
+*/
+func (this *ApplyBinlog) InitTableSnapshotPositions() error {
+	tableMapDao := new(dao.TableMapDao)
+	tableMaps, err := tableMapDao.FindByTaskUUID(this.ConfigMap.TaskUUID, "`schema`, source, snapshot_position")
+	if err != nil {
+		return fmt.Errorf("失败. 获取没有主键的表 row copy 使用的快照位点. %v", err)
+	}
+
+	tableSnapshotPositions, err := NewTableSnapshotPositions(tableMaps)
+	if err != nil {
+		return err
+	}
+	this.TableSnapshotPositions = tableSnapshotPositions
+
+	for tableName, logFilePos := range tableSnapshotPositions {
+		logger.M.Infof("没有主键的表 %v 的数据来源于快照 %v:%v, 应用binlog跳过该表在这个位点之前的事务", tableName, logFilePos.LogFile, logFilePos.LogPos)
+	}
+
+	return nil
+}
+
+/* 解析每个表保存的快照位点
+Params:
+	_tableMaps: 需要迁移的表, 包含 schema, source, snapshot_position
+Return: {"schema.table": 快照位点}, 错误
+*/
+func NewTableSnapshotPositions(_tableMaps []*model.TableMap) (map[string]*LogFilePos, error) {
+	tableSnapshotPositions := make(map[string]*LogFilePos)
+	for _, tableMap := range _tableMaps {
+		if !tableMap.SnapshotPosition.Valid || strings.TrimSpace(tableMap.SnapshotPosition.String) == "" {
+			continue
+		}
+
+		logFilePos, err := NewLogFilePosByString(tableMap.SnapshotPosition.String)
+		if err != nil {
+			return nil, fmt.Errorf("失败. 解析表 %v.%v 的快照位点. %v", tableMap.Schema.String, tableMap.Source.String, err)
+		}
+		tableSnapshotPositions[common.FormatTableName(tableMap.Schema.String, tableMap.Source.String, "")] = logFilePos
+	}
+
+	return tableSnapshotPositions, nil
+}
+
+/* 事务是否已经包含在表 row copy 使用的快照中, 事务开始位点在快照位点之前
+Params:
+	_schema: 数据库名
+	_table: 表名
+	_trxLogFilePos: 事务开始的位点
+*/
+func (this *ApplyBinlog) IsInTableSnapshot(_schema string, _table string, _trxLogFilePos *LogFilePos) bool {
+	snapshotLogFilePos, ok := this.TableSnapshotPositions[common.FormatTableName(_schema, _table, "")]
+	if !ok {
+		return false
+	}
+
+	return snapshotLogFilePos.IsRatherThan(_trxLogFilePos)
+}
@@ -0,0 +1,62 @@
+package mysqlapplybinlog
+
+import (
+	"database/sql"
+	"github.com/daiguadaidai/go-d-bus/model"
+	"testing"
+)
+
+func newTableSnapshotTestTableMap(schema string, table string, snapshotPosition string) *model.TableMap {
+	return &model.TableMap{
+		Schema:           sql.NullString{String: schema, Valid: true},
+		Source:           sql.NullString{String: table, Valid: true},
+		SnapshotPosition: sql.NullString{String: snapshotPosition, Valid: snapshotPosition != ""},
+	}
+}
+
+func TestApplyBinlog_IsInTableSnapshot_Restart(t *testing.T) {
+	// 第一次运行的快照位点是 1000, 保存为开始位点. 重启时没有主键的表 db.nokey 没有拷贝完成,
+	// 从新的快照(位点 5000)中重新拷贝, 应用binlog从更早的 1000 开始
+	snapshotLogFilePos := NewLogFilePos("mysql-bin.000001", 5000)
+	snapshotLogFilePos.SetGTIDSet("3e11fa47-71ca-11e1-9e33-c80aa9429562:1-20")
+	tableSnapshotPositions, err := NewTableSnapshotPositions([]*model.TableMap{
+		newTableSnapshotTestTableMap("db", "nokey", snapshotLogFilePos.String()),
+		newTableSnapshotTestTableMap("db", "haskey", ""),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tableSnapshotPositions) != 1 {
+		t.Fatalf("只有没有主键的表有快照位点. %v", tableSnapshotPositions)
+	}
+
+	applyBinlog := &ApplyBinlog{TableSnapshotPositions: tableSnapshotPositions, SourceServerUUID: "3e11fa47-71ca-11e1-9e33-c80aa9429562"}
+	cases := []struct {
+		logPos   int
+		gtidSet  string
+		table    string
+		isInSnap bool
+	}{
+		{1000, "", "nokey", true},   // 快照之前的事务已经在拷贝的数据中
+		{4900, "", "nokey", true},   // 快照之前的事务已经在拷贝的数据中
+		{5000, "", "nokey", false},  // 快照位点开始的事务需要应用
+		{6000, "", "nokey", false},  // 快照之后的事务需要应用
+		{1000, "", "haskey", false}, // 有主键的表重复应用不会不一致
+		{4900, "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-15", "nokey", true},
+		{5000, "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-20", "nokey", false},
+		{6000, "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-25", "nokey", false},
+	}
+	for i, c := range cases {
+		trxLogFilePos := applyBinlog.NewSourceLogFilePos("mysql-bin.000001", c.logPos)
+		trxLogFilePos.SetGTIDSet(c.gtidSet)
+		if isInSnap := applyBinlog.IsInTableSnapshot("db", c.table, trxLogFilePos); isInSnap != c.isInSnap {
+			t.Fatalf("case %v: 事务 %v:%v(%v) 是否在表 %v 的快照中, 期望 %v, 实际 %v",
+				i, trxLogFilePos.LogFile, trxLogFilePos.LogPos, c.gtidSet, c.table, c.isInSnap, isInSnap)
+		}
+	}
+
+	// 保存的快照位点有问题, 不能启动
+	if _, err := NewTableSnapshotPositions([]*model.TableMap{newTableSnapshotTestTableMap("db", "nokey", "{")}); err == nil {
+		t.Fatal("快照位点解析失败应该返回错误")
+	}
+}
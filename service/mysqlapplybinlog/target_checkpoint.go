@@ -0,0 +1,365 @@
+package mysqlapplybinlog
+
+import (
+	"fmt"
+	"github.com/daiguadaidai/go-d-bus/common"
+	"github.com/daiguadaidai/go-d-bus/gdbc"
+	"github.com/daiguadaidai/go-d-bus/logger"
+	"github.com/daiguadaidai/go-d-bus/parser"
+)
+
+/* 保存在目标实例中的 checkpoint, 每一个应用binlog的并发槽一行.
+该行和应用的数据在同一个事务中更新, 所以目标实例中的数据和 checkpoint 永远是一致的.
+重启的时候:
+    1. 从所有槽最小的事务开始位点开始解析binlog
+    2. 每个槽中 <= checkpoint 的行说明已经应用过了, 直接跳过
+*/
+type TargetCheckpoint struct {
+	Slot       int    // 应用binlog的并发槽
+	TrxLogFile string // 该行所在事务开始的binlog文件, 重启时从这里开始解析
+	TrxLogPos  int    // 该行所在事务开始的binlog位点
+	LogFile    string // 该行所在 event 的binlog文件
+	LogPos     int    // 该行所在 event 的binlog位点
+	RowIndex   int    // 该行在 event 中的下标
+}
+
+/* 新建一个目标 checkpoint
+Params:
+    _slot: 并发槽
+    _trxLogFile: 事务开始binlog文件
+    _trxLogPos: 事务开始binlog位点
+    _logFile: event binlog文件
+    _logPos: event binlog位点
+    _rowIndex: 行在 event 中的下标
+*/
+func NewTargetCheckpoint(_slot int, _trxLogFile string, _trxLogPos int, _logFile string, _logPos int, _rowIndex int) *TargetCheckpoint {
+	return &TargetCheckpoint{
+		Slot:       _slot,
+		TrxLogFile: _trxLogFile,
+		TrxLogPos:  _trxLogPos,
+		LogFile:    _logFile,
+		LogPos:     _logPos,
+		RowIndex:   _rowIndex,
+	}
+}
+
+/* 判断本行是否已经被 checkpoint 包含了(已经应用过了)
+Params:
+    _checkpoint: 该槽保存的 checkpoint
+*/
+func (this *TargetCheckpoint) IsAppliedBy(_checkpoint *TargetCheckpoint) bool {
+	if cmp := NewLogFilePos(this.LogFile, this.LogPos).Compare(NewLogFilePos(_checkpoint.LogFile, _checkpoint.LogPos)); cmp != 0 {
+		return cmp < 0
+	}
+
+	return this.RowIndex <= _checkpoint.RowIndex
+}
+
+// 获取目标 checkpoint 表名
+func GetTargetCheckpointTableName(_parser *parser.RunParser) string {
+	return common.FormatTableName(_parser.TargetCheckpointSchema, _parser.TargetCheckpointTable, "`")
+}
+
+/* 在目标实例创建 checkpoint 表
+Params:
+    _parser: 命令行解析的信息
+    _host: 目标实例host
+    _port: 目标实例port
+*/
+func CreateTargetCheckpointTable(_parser *parser.RunParser, _host string, _port int64) error {
+	instance, ok := gdbc.GetDynamicDBByHostPort(_host, _port)
+	if !ok {
+		return fmt.Errorf("缓存中不存在该实例(%v:%v). 创建目标 checkpoint 表失败", _host, _port)
+	}
+
+	createDBSql := fmt.Sprintf("/* go-d-bus */ CREATE DATABASE IF NOT EXISTS `%v`", _parser.TargetCheckpointSchema)
+	if _, err := instance.Exec(createDBSql); err != nil {
+		return fmt.Errorf("失败. 创建目标 checkpoint 库. %v. %v", createDBSql, err)
+	}
+
+	createTableSql := fmt.Sprintf(`/* go-d-bus */ CREATE TABLE IF NOT EXISTS %v (
+  task_uuid varchar(22) NOT NULL COMMENT '迁移任务UUID',
+  slot int(11) NOT NULL COMMENT '应用binlog的并发槽',
+  trx_log_file varchar(255) NOT NULL COMMENT '事务开始binlog文件, 重启从这里开始解析',
+  trx_log_pos bigint(20) NOT NULL COMMENT '事务开始binlog位点',
+  log_file varchar(255) NOT NULL COMMENT '已经应用的行所在event的binlog文件',
+  log_pos bigint(20) NOT NULL COMMENT '已经应用的行所在event的binlog位点',
+  row_index int(11) NOT NULL COMMENT '已经应用的行在event中的下标',
+  updated_at datetime NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
+  PRIMARY KEY (task_uuid, slot)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='go-d-bus 应用binlog checkpoint'`, GetTargetCheckpointTableName(_parser))
+	if _, err := instance.Exec(createTableSql); err != nil {
+		return fmt.Errorf("失败. 创建目标 checkpoint 表. %v", err)
+	}
+
+	return nil
+}
+
+/* 获取目标实例中该任务的所有 checkpoint
+Params:
+    _parser: 命令行解析的信息
+    _host: 目标实例host
+    _port: 目标实例port
+*/
+func FindTargetCheckpoints(_parser *parser.RunParser, _host string, _port int64) (map[int]*TargetCheckpoint, error) {
+	instance, ok := gdbc.GetDynamicDBByHostPort(_host, _port)
+	if !ok {
+		return nil, fmt.Errorf("缓存中不存在该实例(%v:%v). 获取目标 checkpoint 失败", _host, _port)
+	}
+
+	selectSql := fmt.Sprintf(`/* go-d-bus */ SELECT slot, trx_log_file, trx_log_pos, log_file, log_pos, row_index
+FROM %v WHERE task_uuid = ?`, GetTargetCheckpointTableName(_parser))
+	rows, err := instance.Query(selectSql, _parser.TaskUUID)
+	if err != nil {
+		return nil, fmt.Errorf("失败. 获取目标 checkpoint. %v", err)
+	}
+	defer rows.Close()
+
+	checkpoints := make(map[int]*TargetCheckpoint)
+	for rows.Next() {
+		checkpoint := new(TargetCheckpoint)
+		if err := rows.Scan(&checkpoint.Slot, &checkpoint.TrxLogFile, &checkpoint.TrxLogPos,
+			&checkpoint.LogFile, &checkpoint.LogPos, &checkpoint.RowIndex); err != nil {
+			return nil, fmt.Errorf("失败. scan 目标 checkpoint. %v", err)
+		}
+		checkpoints[checkpoint.Slot] = checkpoint
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("失败. 遍历目标 checkpoint. %v", err)
+	}
+
+	return checkpoints, nil
+}
+
+/* 获取重启时需要开始解析的位点, 也就是所有槽中最小的事务开始位点
+Params:
+    _checkpoints: 所有槽的 checkpoint
+*/
+func GetTargetCheckpointResumeLogFilePos(_checkpoints map[int]*TargetCheckpoint) (*LogFilePos, bool) {
+	var resumeLogFilePos *LogFilePos
+	for _, checkpoint := range _checkpoints {
+		trxLogFilePos := NewLogFilePos(checkpoint.TrxLogFile, checkpoint.TrxLogPos)
+		if resumeLogFilePos == nil || resumeLogFilePos.IsRatherThan(trxLogFilePos) {
+			resumeLogFilePos = trxLogFilePos
+		}
+	}
+
+	return resumeLogFilePos, resumeLogFilePos != nil
+}
+
+/* 使用目标实例的 checkpoint 覆盖开始位点和应用binlog并发数. 开启了目标 checkpoint 才需要调用
+Params:
+    _parser: 命令行解析的信息
+    _host: 目标实例host
+    _port: 目标实例port
+*/
+func ResumeFromTargetCheckpoint(_parser *parser.RunParser, _host string, _port int64) error {
+	if err := CreateTargetCheckpointTable(_parser, _host, _port); err != nil {
+		return err
+	}
+
+	checkpoints, err := FindTargetCheckpoints(_parser, _host, _port)
+	if err != nil {
+		return err
+	}
+
+	resumeLogFilePos, ok := GetTargetCheckpointResumeLogFilePos(checkpoints)
+	if !ok {
+		logger.M.Warnf("目标实例中没有该任务的 checkpoint, 使用正常的开始位点. %v", _parser.TaskUUID)
+		return nil
+	}
+
+	// 每个槽的 checkpoint 只对同样的分配方式有效, 所以并发数必须和之前一样
+	if len(checkpoints) != _parser.ApplyBinlogParaller {
+		return fmt.Errorf("失败. 目标 checkpoint 的并发槽数和应用binlog并发数不一样, 请使用 checkpoint 中的并发槽数 --apply-binlog-paraller=%v. "+
+			"应用binlog并发数: %v, checkpoint 并发槽数: %v. %v", len(checkpoints), _parser.ApplyBinlogParaller, len(checkpoints),
+			GetTargetCheckpointTableName(_parser))
+	}
+
+	logger.M.Warnf("位点信息来源于目标实例 checkpoint, %v:%v -> %v:%v",
+		_parser.StartLogFile, _parser.StartLogPos, resumeLogFilePos.LogFile, resumeLogFilePos.LogPos)
+	_parser.StartLogFile = resumeLogFilePos.LogFile
+	_parser.StartLogPos = resumeLogFilePos.LogPos
+
+	return nil
+}
+
+// 初始化所有槽的 checkpoint, 已经存在的槽不覆盖
+func (this *ApplyBinlog) InitTargetCheckpoints() error {
+	instance, ok := gdbc.GetDynamicDBByHostPort(this.ConfigMap.Target.Host.String, this.ConfigMap.Target.Port.Int64)
+	if !ok {
+		return fmt.Errorf("缓存中不存在该实例(%v:%v). 初始化目标 checkpoint 失败", this.ConfigMap.Target.Host.String, this.ConfigMap.Target.Port.Int64)
+	}
+
+	insertSql := fmt.Sprintf(`/* go-d-bus */ INSERT IGNORE INTO %v
+(task_uuid, slot, trx_log_file, trx_log_pos, log_file, log_pos, row_index) VALUES(?, ?, ?, ?, ?, ?, -1)`,
+		GetTargetCheckpointTableName(this.Parser))
+	for slot := 0; slot < this.GetApplyParaller(); slot++ {
+		_, err := instance.Exec(insertSql, this.Parser.TaskUUID, slot, this.Parser.StartLogFile, this.Parser.StartLogPos,
+			this.Parser.StartLogFile, this.Parser.StartLogPos)
+		if err != nil {
+			return fmt.Errorf("失败. 初始化目标 checkpoint. 槽: %v. %v", slot, err)
+		}
+	}
+
+	checkpoints, err := FindTargetCheckpoints(this.Parser, this.ConfigMap.Target.Host.String, this.ConfigMap.Target.Port.Int64)
+	if err != nil {
+		return err
+	}
+	this.TargetCheckpointMap = checkpoints
+
+	this.TargetCheckpointUpdateSql = fmt.Sprintf(`/* go-d-bus */ UPDATE %v
+SET trx_log_file = ?, trx_log_pos = ?, log_file = ?, log_pos = ?, row_index = ?
+WHERE task_uuid = ? AND slot = ?`, GetTargetCheckpointTableName(this.Parser))
+
+	return nil
+}
+
+/* 设置该行应用后需要保存的 checkpoint
+Params:
+    _binlogRowInfo: 相关行数据信息
+    _binlogEventPos: 该行所在的事件
+    _slot: 该行分配到的并发槽
+    _rowIndex: 该行在事件中的下标
+*/
+func (this *ApplyBinlog) SetRowTargetCheckpoint(_binlogRowInfo *BinlogRowInfo, _binlogEventPos *BinlogEventPos, _slot int, _rowIndex int) {
+	if !this.Parser.EnableTargetCheckpoint {
+		return
+	}
+
+	_binlogRowInfo.Checkpoint = NewTargetCheckpoint(_slot, _binlogEventPos.TrxLogFile, _binlogEventPos.TrxLogPos,
+		_binlogEventPos.LogFile, _binlogEventPos.LogPos, _rowIndex)
+}
+
+/* 判断该行是否已经在目标 checkpoint 中(之前已经应用过了)
+Params:
+    _binlogRowInfo: 相关行数据信息
+*/
+func (this *ApplyBinlog) IsAppliedByTargetCheckpoint(_binlogRowInfo *BinlogRowInfo) bool {
+	if !this.Parser.EnableTargetCheckpoint || _binlogRowInfo.Checkpoint == nil {
+		return false
+	}
+
+	checkpoint, ok := this.TargetCheckpointMap[_binlogRowInfo.Checkpoint.Slot]
+	if !ok {
+		return false
+	}
+
+	return _binlogRowInfo.Checkpoint.IsAppliedBy(checkpoint)
+}
+
+/* 在目标实例执行应用binlog的sql. 开启了目标 checkpoint 会在同一个事务中更新该槽的 checkpoint
+Params:
+    _binlogRowInfo: 相关行数据信息
+    _sqls: 需要执行的sql
+*/
+func (this *ApplyBinlog) ExecApplySqls(_binlogRowInfo *BinlogRowInfo, _sqls ...string) error {
+	instance, ok := gdbc.GetDynamicDBByHostPort(this.ConfigMap.Target.Host.String, this.ConfigMap.Target.Port.Int64)
+	if !ok {
+		return fmt.Errorf("缓存中不存在该实例(%v:%v). 获取目标数据库实例出错", this.ConfigMap.Target.Host.String, this.ConfigMap.Target.Port.Int64)
+	}
+
+	if !this.Parser.EnableTargetCheckpoint {
+		for _, applySql := range _sqls {
+			if _, err := instance.Exec(applySql); err != nil {
+				return fmt.Errorf("%v. %v", err.Error(), applySql)
+			}
+		}
+
+		return nil
+	}
+
+	checkpoint := _binlogRowInfo.Checkpoint
+	tx, err := instance.Begin()
+	if err != nil {
+		return fmt.Errorf("失败. 应用binlog开启事务. %v", err)
+	}
+
+	for _, applySql := range _sqls {
+		if _, err := tx.Exec(applySql); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("%v. %v", err.Error(), applySql)
+		}
+	}
+
+	_, err = tx.Exec(this.TargetCheckpointUpdateSql, checkpoint.TrxLogFile, checkpoint.TrxLogPos, checkpoint.LogFile,
+		checkpoint.LogPos, checkpoint.RowIndex, this.Parser.TaskUUID, checkpoint.Slot)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("失败. 更新目标 checkpoint. 槽: %v. %v", checkpoint.Slot, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("失败. 应用binlog提交事务. %v", err)
+	}
+
+	return nil
+}
+
+/* 当所有解析出来的事件都应用完成后, 将所有槽的 checkpoint 推进到已经解析完的事务位点.
+防止某些槽长时间没有数据, 导致重启的时候需要从很早的位点开始解析.
+只会推进比该位点小的 checkpoint, 锁住该槽的 checkpoint 后再比较, 所以不会和应用数据的事务冲突
+Params:
+    _logFilePos: 已经解析完成的事务位点
+*/
+func (this *ApplyBinlog) AdvanceTargetCheckpoints(_logFilePos *LogFilePos) error {
+	instance, ok := gdbc.GetDynamicDBByHostPort(this.ConfigMap.Target.Host.String, this.ConfigMap.Target.Port.Int64)
+	if !ok {
+		return fmt.Errorf("缓存中不存在该实例(%v:%v). 推进目标 checkpoint 失败", this.ConfigMap.Target.Host.String, this.ConfigMap.Target.Port.Int64)
+	}
+
+	selectSql := fmt.Sprintf(`/* go-d-bus */ SELECT log_file, log_pos FROM %v
+WHERE task_uuid = ? AND slot = ? FOR UPDATE`, GetTargetCheckpointTableName(this.Parser))
+	for slot := 0; slot < this.GetApplyParaller(); slot++ {
+		tx, err := instance.Begin()
+		if err != nil {
+			return fmt.Errorf("失败. 推进目标 checkpoint 开启事务. 槽: %v. %v", slot, err)
+		}
+
+		var logFile string
+		var logPos int
+		if err := tx.QueryRow(selectSql, this.Parser.TaskUUID, slot).Scan(&logFile, &logPos); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("失败. 获取目标 checkpoint. 槽: %v. %v", slot, err)
+		}
+
+		// 该槽已经应用到了更大的位点, 不需要推进
+		if NewLogFilePos(logFile, logPos).Compare(_logFilePos) >= 0 {
+			tx.Rollback()
+			continue
+		}
+
+		_, err = tx.Exec(this.TargetCheckpointUpdateSql, _logFilePos.LogFile, _logFilePos.LogPos, _logFilePos.LogFile,
+			_logFilePos.LogPos, -1, this.Parser.TaskUUID, slot)
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("失败. 推进目标 checkpoint. 槽: %v. %v:%v. %v", slot, _logFilePos.LogFile, _logFilePos.LogPos, err)
+		}
+
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("失败. 推进目标 checkpoint 提交事务. 槽: %v. %v", slot, err)
+		}
+	}
+
+	return nil
+}
+
+// 获取解析到的事务位点
+func (this *ApplyBinlog) GetParsedTrxLogFilePos() *LogFilePos {
+	this.parsedTrxLock.Lock()
+	defer this.parsedTrxLock.Unlock()
+
+	return NewLogFilePos(this.parsedTrxLogFilePos.LogFile, this.parsedTrxLogFilePos.LogPos)
+}
+
+/* 设置解析到的事务位点
+Params:
+    _logFile: binlog文件
+    _logPos: binlog位点
+*/
+func (this *ApplyBinlog) SetParsedTrxLogFilePos(_logFile string, _logPos int) {
+	this.parsedTrxLock.Lock()
+	defer this.parsedTrxLock.Unlock()
+
+	this.parsedTrxLogFilePos = NewLogFilePos(_logFile, _logPos)
+}
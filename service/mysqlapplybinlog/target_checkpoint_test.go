@@ -0,0 +1,47 @@
+package mysqlapplybinlog
+
+import (
+	"testing"
+)
+
+func TestTargetCheckpoint_IsAppliedBy(t *testing.T) {
+	checkpoint := NewTargetCheckpoint(0, "mysql-bin.000002", 100, "mysql-bin.000002", 500, 3)
+
+	cases := []struct {
+		row     *TargetCheckpoint
+		applied bool
+	}{
+		{NewTargetCheckpoint(0, "mysql-bin.000001", 4, "mysql-bin.000001", 900, 0), true},
+		{NewTargetCheckpoint(0, "mysql-bin.000002", 100, "mysql-bin.000002", 400, 9), true},
+		{NewTargetCheckpoint(0, "mysql-bin.000002", 100, "mysql-bin.000002", 500, 3), true},
+		{NewTargetCheckpoint(0, "mysql-bin.000002", 100, "mysql-bin.000002", 500, 4), false},
+		{NewTargetCheckpoint(0, "mysql-bin.000002", 500, "mysql-bin.000002", 600, 0), false},
+		{NewTargetCheckpoint(0, "mysql-bin.000003", 4, "mysql-bin.000003", 120, 0), false},
+	}
+
+	for i, c := range cases {
+		if applied := c.row.IsAppliedBy(checkpoint); applied != c.applied {
+			t.Fatalf("case %v: 期望 %v, 实际 %v", i, c.applied, applied)
+		}
+	}
+}
+
+func TestGetTargetCheckpointResumeLogFilePos(t *testing.T) {
+	if _, ok := GetTargetCheckpointResumeLogFilePos(map[int]*TargetCheckpoint{}); ok {
+		t.Fatal("没有 checkpoint 不应该有开始位点")
+	}
+
+	checkpoints := map[int]*TargetCheckpoint{
+		0: NewTargetCheckpoint(0, "mysql-bin.000003", 4, "mysql-bin.000003", 120, 0),
+		1: NewTargetCheckpoint(1, "mysql-bin.000002", 800, "mysql-bin.000002", 900, 1),
+		2: NewTargetCheckpoint(2, "mysql-bin.000002", 300, "mysql-bin.000002", 500, 0),
+	}
+
+	logFilePos, ok := GetTargetCheckpointResumeLogFilePos(checkpoints)
+	if !ok {
+		t.Fatal("没有获取到开始位点")
+	}
+	if logFilePos.LogFile != "mysql-bin.000002" || logFilePos.LogPos != 300 {
+		t.Fatalf("开始位点错误: %v:%v", logFilePos.LogFile, logFilePos.LogPos)
+	}
+}
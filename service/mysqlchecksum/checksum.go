@@ -7,12 +7,26 @@ import (
 	"github.com/daiguadaidai/go-d-bus/matemap"
 	"github.com/daiguadaidai/go-d-bus/model"
 	"github.com/daiguadaidai/go-d-bus/parser"
+	"github.com/daiguadaidai/go-d-bus/service/helper"
+	"github.com/daiguadaidai/go-d-bus/service/mysqlapplybinlog"
 	"github.com/daiguadaidai/go-d-bus/service/mysqlrowcopy"
+	"github.com/daiguadaidai/go-d-bus/service/throttler"
 	"go.uber.org/atomic"
 	"sync"
 	"time"
 )
 
+const (
+	CHECKSUM_BINLOG_AWARE_RECHECK_COUNT = 2 // 等待了应用binlog还是不一致, 最多再重新校验几次, 该范围的数据可能正在被修改
+)
+
+// 修复一个范围时发现的不一致行数
+type DiffRowCount struct {
+	MissingRows int // 源有目标没有的行数
+	ExtraRows   int // 目标有源没有的行数
+	DiffRows    int // 源和目标都有但是数据不一致的行数
+}
+
 // 对MySQL数据进行校验
 type Checksum struct {
 	Parser    *parser.RunParser
@@ -23,6 +37,32 @@ type Checksum struct {
 	FixDiffRecordChan    chan model.DataChecksum // 传输fix数据的chan
 
 	NeedFixRecordCounter *atomic.Int64
+
+	// 读取数据的从库, 多行 checksum 从从库读取源数据, 修复数据还是读取源实例
+	ReadReplica *mysqlrowcopy.ReadReplica
+
+	// 第一波checksum和修复数据的协程池, 运行时可以调整并发数
+	ChecksumPool    *helper.WorkerPool
+	ChecksumFixPool *helper.WorkerPool
+
+	// 应用binlog, 没有开启为 nil. 应用binlog开始后, 读取目标数据前等待应用binlog追上读取源数据时的位点
+	ApplyBinlog *mysqlapplybinlog.ApplyBinlog
+	// 应用binlog开始后, 在源实例的快照中读取源数据, 快照连接在多个范围之间复用
+	SnapshotPool *ChecksumSnapshotPool
+
+	// 限流器, 滚动校验每个范围之前限流时等待和限速. 没有开启为 nil
+	Throttler *throttler.Throttler
+
+	// 修复sql写入文件, 不直接修改目标数据. 没有指定修复sql文件为 nil
+	FixSqlWriter *FixSqlWriter
+
+	// 每个表已经保存的不一致数据样例行数
+	diffSampleCounts map[string]int
+	diffSampleLock   sync.Mutex
+
+	// 本次运行已经处理过, 但是保持没有修复的不一致记录, 不再次获取修复
+	unfixedDiffRecordIds  map[int64]bool
+	unfixedDiffRecordLock sync.Mutex
 }
 
 /* 创建一个 row Copy 对象
@@ -45,6 +85,10 @@ func NewChecksum(
 	checksum.Parser = parser
 	checksum.ConfigMap = configMap
 	checksum.NeedFixRecordCounter = atomic.NewInt64(0)
+	checksum.ReadReplica = mysqlrowcopy.NewReadReplica(parser, configMap)
+	checksum.SnapshotPool = NewChecksumSnapshotPool(configMap.Source.Host.String, int(configMap.Source.Port.Int64))
+	checksum.diffSampleCounts = make(map[string]int)
+	checksum.unfixedDiffRecordIds = make(map[int64]bool)
 
 	checksum.ChecksumRowsChan = checksumRowsChan
 	checksum.NotifySecondChecksum = nodifySecondChecksum // 初始化通知可以进行第二次checksum
@@ -52,6 +96,15 @@ func NewChecksum(
 	// 初始化传输fix数据的通道
 	checksum.FixDiffRecordChan = make(chan model.DataChecksum, 1000)
 
+	// 修复sql写入文件
+	if parser.ChecksumFixSqlFile != "" {
+		fixSqlWriter, err := NewFixSqlWriter(parser.ChecksumFixSqlFile)
+		if err != nil {
+			return nil, err
+		}
+		checksum.FixSqlWriter = fixSqlWriter
+	}
+
 	return checksum, nil
 }
 
@@ -59,23 +112,45 @@ func (this *Checksum) Start() {
 	wg := new(sync.WaitGroup)
 
 	// 并发进行第一波的checksum
-	for parallerTag := 0; parallerTag < this.Parser.ChecksumParaller; parallerTag++ {
+	this.ChecksumPool = helper.NewWorkerPool("checksum", this.Parser.ChecksumParaller, 0, func(parallerTag int) {
 		wg.Add(1)
 		go this.LoopFirstChecksum(wg, parallerTag)
-	}
+	})
+	this.ChecksumPool.Start()
 
 	// 获取二次校验需要的数据
 	wg.Add(1)
 	go this.EmitDiffRecords(wg)
 
 	// 并发修复校验数据
-	for parallerTag := 0; parallerTag < this.Parser.ChecksumFixParaller; parallerTag++ {
+	this.ChecksumFixPool = helper.NewWorkerPool("checksum fix", this.Parser.ChecksumFixParaller, 0, func(parallerTag int) {
 		wg.Add(1)
 		go this.LoopFixDiffRows(wg, parallerTag)
+	})
+	this.ChecksumFixPool.Start()
+
+	// 循环获取 checksum 并发数, 运行时调整并发数
+	go this.ChecksumPool.LoopWatchParaller(func() (int, error) {
+		checksumParaller, _, err := GetTaskChecksumParaller(this.ConfigMap.TaskUUID)
+		return checksumParaller, err
+	})
+	go this.ChecksumFixPool.LoopWatchParaller(func() (int, error) {
+		_, checksumFixParaller, err := GetTaskChecksumParaller(this.ConfigMap.TaskUUID)
+		return checksumFixParaller, err
+	})
+
+	// 开启了滚动校验, row copy 完成后循环校验所有的表. 不会结束, 不需要等待
+	if this.Parser.EnableRollingChecksum {
+		go this.LoopRollingChecksum()
 	}
 
 	wg.Wait()
 
+	this.SnapshotPool.Close()
+	if this.FixSqlWriter != nil {
+		this.FixSqlWriter.Close()
+	}
+
 	logger.M.Infof("!!!!!!!!!!!!! checksum任务总体完成 !!!!!!!!!!!!!")
 }
 
@@ -84,25 +159,37 @@ _parallerTag: 协程编号
 */
 func (this *Checksum) LoopFirstChecksum(wg *sync.WaitGroup, _parallerTag int) {
 	defer wg.Done()
+	defer this.ChecksumPool.Exit(_parallerTag)
 
 	logger.M.Infof("开始进行第一波数据校验, 启动协程%v", _parallerTag)
 
-	for primaryRangeValue := range this.ChecksumRowsChan {
+	for {
+		if this.ChecksumPool.IsRetired(_parallerTag) { // 调小了并发数
+			return
+		}
+		primaryRangeValue, ok := <-this.ChecksumRowsChan
+		if !ok {
+			this.ChecksumPool.Close()
+			return
+		}
+
 		isError := false
 		for i := 0; i < this.Parser.ErrRetryCount; i++ {
+			startTime := time.Now()
 			is_consistent, err := this.RowsChecksum(primaryRangeValue, _parallerTag)
 			if err != nil {
 				logger.M.Error(err)
 				time.Sleep(time.Second)
 				continue
 			}
+			this.IncrChunkStat(primaryRangeValue, is_consistent, time.Since(startTime))
 
 			// 有不一致的情况就记录数据库
 			if !is_consistent {
 				// 保存数据不一致, 会再次进行检测
 				saveDiffRecordError := false
 				for j := 0; j < this.Parser.ErrRetryCount; j++ {
-					err = CreateDiffRecord(this.ConfigMap.TaskUUID, primaryRangeValue)
+					_, err = CreateDiffRecord(this.ConfigMap.TaskUUID, primaryRangeValue)
 					if err != nil {
 						logger.M.Errorf("checksum 协程 %v. %v", _parallerTag, err)
 						saveDiffRecordError = true
@@ -149,29 +236,100 @@ func (this *Checksum) RowsChecksum(primaryRangeValue *matemap.PrimaryRangeValue,
 		return false, fmt.Errorf("执行多行数据checksum 协程 %v. 获取需要迁移的表失败. %v", parallerTag, err)
 	}
 
-	// 1. 在源实例上获取数据的 checksum 值
-	sourceChecksumCode, err := GetSourceRowsChecksumCode(this.ConfigMap.Source.Host.String, int(this.ConfigMap.Source.Port.Int64), primaryRangeValue, table)
-	if err != nil {
-		return false, fmt.Errorf("checksum 协程 %v. %v", parallerTag, err)
+	for i := 0; ; i++ {
+		// 重新校验时使用新的快照
+		isConsistent, isWaited, err := this.rowsChecksumOnce(primaryRangeValue, table, parallerTag, i > 0)
+		if err != nil {
+			return false, err
+		}
+
+		// 一致, 或者没有等待应用binlog的不一致都直接返回
+		if isConsistent || !isWaited || i >= CHECKSUM_BINLOG_AWARE_RECHECK_COUNT {
+			// 规范化后的 checksum 还是不一致, 在Go中逐行比较数据
+			if !isConsistent && this.Parser.ChecksumGoCompare && !table.NoUniqueKey {
+				if isConsistent, err = this.GoCompareRange(primaryRangeValue, table, parallerTag); err != nil {
+					return false, err
+				}
+			}
+
+			if !isConsistent {
+				logger.M.Warnf("checksum 协程%v. 多行数据校验, 发现不一致数据. %v:%v. min:%v, max:%v",
+					parallerTag, primaryRangeValue.Schema, primaryRangeValue.Table, primaryRangeValue.MinValue, primaryRangeValue.MaxValue)
+			} else {
+				logger.M.Infof("校验成功 checksum 协程%v. %v.%v. min:%v, max:%v",
+					parallerTag, primaryRangeValue.Schema, primaryRangeValue.Table, primaryRangeValue.MinValue, primaryRangeValue.MaxValue)
+			}
+			return isConsistent, nil
+		}
+
+		logger.M.Infof("checksum 协程%v. 等待应用binlog后数据还是不一致, 该范围的数据可能正在被修改, 第 %v 次重新校验. %v.%v. min:%v, max:%v",
+			parallerTag, i+1, primaryRangeValue.Schema, primaryRangeValue.Table, primaryRangeValue.MinValue, primaryRangeValue.MaxValue)
+	}
+}
+
+/* 进行一次多行checksum
+应用binlog已经开始时, 在快照中读取源数据并获取快照位点, 等待应用binlog追上该位点后再读取目标数据,
+正在应用的binlog不会造成不一致
+Params:
+	_primaryRangeValue: 数据范围
+	_table: 需要迁移的表
+	_parallerTag: 第几个协程
+	_freshSnapshot: 是否必须使用新开启的快照, 否则可以复用没有过期的快照
+Return:
+    1. 是否一致
+    2. 是否等待了应用binlog
+    3. 错误
+*/
+func (this *Checksum) rowsChecksumOnce(primaryRangeValue *matemap.PrimaryRangeValue, table *matemap.Table, parallerTag int, freshSnapshot bool) (bool, bool, error) {
+	var sourceChecksumCode string
+	var err error
+	isWaited := false
+
+	if this.IsBinlogAware() {
+		// 1. 在源实例的快照中获取数据的 checksum 值和快照位点, 应用binlog解析的是源实例, 不能从从库读取
+		snapshot, err := this.SnapshotPool.Get(freshSnapshot)
+		if err != nil {
+			return false, false, fmt.Errorf("checksum 协程 %v. %v", parallerTag, err)
+		}
+		sourceChecksumCode, err = GetSourceRowsChecksumCodeInSnapshot(snapshot, primaryRangeValue, table)
+		this.SnapshotPool.Put(snapshot, err)
+		if err != nil {
+			return false, false, fmt.Errorf("checksum 协程 %v. %v", parallerTag, err)
+		}
+		snapshotLogFilePos := snapshot.LogFilePos
+
+		// 等待应用binlog追上快照位点, 超时了还是进行比较
+		timeout := time.Duration(this.Parser.ChecksumWaitApplyTimeout) * time.Second
+		if isWaited = this.ApplyBinlog.WaitAppliedPassed(snapshotLogFilePos, timeout); !isWaited {
+			logger.M.Warnf("checksum 协程%v. 等待应用binlog追上位点 %v:%v 超时(%v), 直接进行比较. %v.%v. min:%v, max:%v",
+				parallerTag, snapshotLogFilePos.LogFile, snapshotLogFilePos.LogPos, timeout,
+				primaryRangeValue.Schema, primaryRangeValue.Table, primaryRangeValue.MinValue, primaryRangeValue.MaxValue)
+		}
+	} else {
+		// 1. 在源实例(指定了从库则在从库)上获取数据的 checksum 值
+		sourceHost, sourcePort, err := mysqlrowcopy.GetReadHostPort(this.ReadReplica, this.ConfigMap)
+		if err != nil {
+			return false, false, fmt.Errorf("checksum 协程 %v. %v", parallerTag, err)
+		}
+		sourceChecksumCode, err = GetSourceRowsChecksumCode(sourceHost, sourcePort, primaryRangeValue, table)
+		if err != nil {
+			return false, false, fmt.Errorf("checksum 协程 %v. %v", parallerTag, err)
+		}
 	}
 
 	// 2. 在目标实例上获取数据的 checksum 值
 	targetChecksumCode, err := GetTargetRowsChecksumCode(this.ConfigMap.Target.Host.String, int(this.ConfigMap.Target.Port.Int64), primaryRangeValue, table)
 	if err != nil {
-		return false, fmt.Errorf("checksum 协程 %v. %v", parallerTag, err)
+		return false, isWaited, fmt.Errorf("checksum 协程 %v. %v", parallerTag, err)
 	}
 
-	// 3. 比较 源和目标的值是否相等, 不相等则记录到数据
-	if sourceChecksumCode != targetChecksumCode {
-		logger.M.Warnf("checksum 协程%v. 多行数据校验, 发现不一致数据. %v:%v. min:%v, max:%v",
-			parallerTag, primaryRangeValue.Schema, primaryRangeValue.Table, primaryRangeValue.MinValue, primaryRangeValue.MaxValue)
-		return false, nil
-	} else {
-		logger.M.Infof("校验成功 checksum 协程%v. %v.%v. min:%v, max:%v",
-			parallerTag, primaryRangeValue.Schema, primaryRangeValue.Table, primaryRangeValue.MinValue, primaryRangeValue.MaxValue)
-	}
+	// 3. 比较 源和目标的值是否相等
+	return sourceChecksumCode == targetChecksumCode, isWaited, nil
+}
 
-	return true, nil
+// 是否需要等待应用binlog追上读取源数据时的位点. 应用binlog还没开始(row copy 期间)不需要等待
+func (this *Checksum) IsBinlogAware() bool {
+	return this.ApplyBinlog != nil && this.Parser.ChecksumWaitApplyTimeout > 0 && this.ApplyBinlog.IsStarted()
 }
 
 // 从数据库中获取需要再次校验的数据
@@ -211,6 +369,15 @@ CHECK_TASK_ROW_COPY_COMPLETE_LOOP:
 		}
 	}
 
+	// 比较每个表源和目标的最小和最大主键值, 目标超出源主键范围(包括源表没有数据)的数据保存为不一致记录
+	tableNames := make([]string, 0, 1)
+	for tableName, _ := range matemap.FindAllMigrationTableNameMap() {
+		tableNames = append(tableNames, tableName)
+	}
+	if err := this.CheckTablesBoundary(tableNames, func(*matemap.PrimaryRangeValue, *model.DataChecksum) {}); err != nil {
+		logger.M.Fatalf("错误. %v. 退出迁移", err)
+	}
+
 	// 能到这里, 说明就能开始进行第二波获取所有的不一致数据了
 checkSecondCheckSumLoop:
 	for {
@@ -234,7 +401,11 @@ checkSecondCheckSumLoop:
 					time.Sleep(time.Second)
 					continue
 				}
+				records = this.filterUnfixedDiffRecords(records)
 				if len(records) == 0 {
+					if unfixedCount := this.GetUnfixedDiffRecordCount(); unfixedCount > 0 {
+						logger.M.Warnf("警告. 还有 %v 个不一致记录没有修复(没有主键的表, dry run 或者修复sql写入了文件), 需要人工处理", unfixedCount)
+					}
 					close(this.FixDiffRecordChan)
 					break checkSecondCheckSumLoop
 				}
@@ -262,10 +433,20 @@ Params:
 */
 func (this *Checksum) LoopFixDiffRows(wg *sync.WaitGroup, parallerTag int) {
 	defer wg.Done()
+	defer this.ChecksumFixPool.Exit(parallerTag)
 
 	logger.M.Infof("开始修复数据, 启动协程 %v", parallerTag)
 
-	for diffRecord := range this.FixDiffRecordChan {
+	for {
+		if this.ChecksumFixPool.IsRetired(parallerTag) { // 调小了并发数
+			return
+		}
+		diffRecord, ok := <-this.FixDiffRecordChan
+		if !ok {
+			this.ChecksumFixPool.Close()
+			return
+		}
+
 		isError := false
 
 		// 进行再次数据校验已经修复
@@ -304,24 +485,54 @@ func (this *Checksum) FixDiffRows(_diffRecord model.DataChecksum, _parallerTag i
 	// 1. 通过不一致记录生成, 需要进行修复的主键范围值
 	primaryRangeValue, err := diffRecord2PrimaryRangeValue(_diffRecord, table)
 
-	// 2. 再次比较范围数据是否一致
-	is_consistent, err := this.RowsChecksum(primaryRangeValue, _parallerTag)
+	// 2. 再次比较范围数据是否一致, 不一致就开始修复
+	startTime := time.Now()
+	is_consistent, diffRowCount, err := this.FixDiffRange(primaryRangeValue, table, _parallerTag)
 	if err != nil {
-		return fmt.Errorf("修复数据时. %v", err)
+		return err
+	}
+	var fixedChunkCount int64
+	if is_consistent {
+		fixedChunkCount = 1
 	}
+	this.IncrTableStat(primaryRangeValue.Schema, primaryRangeValue.Table, 0, 0, fixedChunkCount, 0, time.Since(startTime))
 
-	// 3. 如果不一致就开始进行逐行的修复
-	if !is_consistent {
-		if err := this.FixDiffRowsStepFix(primaryRangeValue, table, _parallerTag); err != nil {
-			return err
-		}
+	// 没有主键的表无法逐行修复, 只记录错误, 不一致记录保持没有修复, 需要人工处理
+	if !is_consistent && table.NoUniqueKey {
+		logger.M.Errorf("错误. 没有主键的表整表校验数据不一致, 无法自动修复, 不一致记录保持没有修复, 请人工处理. %v.%v",
+			primaryRangeValue.Schema, primaryRangeValue.Table)
+		this.KeepDiffRecordUnfixed(_diffRecord.Id.Int64, diffRowCount)
+		this.NeedFixRecordCounter.Dec()
+
+		return nil
+	}
+
+	// 只是打印了目标多出的行没有删除, 再次检测还是会不一致. 不标记修复, 该范围不再次检测
+	if !is_consistent && this.Parser.ChecksumDeleteExtraDryRun && diffRowCount.ExtraRows > 0 {
+		logger.M.Warnf("警告. 只打印不删除目标多出的行(dry run), 不一致记录保持没有修复, 该范围不再次检测. %v.%v. min: %v max: %v. 目标多出行数: %v",
+			primaryRangeValue.Schema, primaryRangeValue.Table, primaryRangeValue.MinValue, primaryRangeValue.MaxValue, diffRowCount.ExtraRows)
+		this.KeepDiffRecordUnfixed(_diffRecord.Id.Int64, diffRowCount)
+		this.NeedFixRecordCounter.Dec()
+
+		return nil
+	}
+
+	// 修复sql只是写入了文件, 再次检测还是会不一致. 不标记修复, 该范围不再次检测, 执行修复sql(checksum apply-fix)后再次校验一致才标记修复
+	if !is_consistent && this.FixSqlWriter != nil {
+		logger.M.Warnf("警告. 修复sql已经写入文件 %v, 不一致记录保持没有修复, 该范围不再次检测. %v.%v. min: %v max: %v",
+			this.FixSqlWriter.FileName, primaryRangeValue.Schema, primaryRangeValue.Table, primaryRangeValue.MinValue, primaryRangeValue.MaxValue)
+		this.KeepDiffRecordUnfixed(_diffRecord.Id.Int64, diffRowCount)
+		this.NeedFixRecordCounter.Dec()
+
+		return nil
 	}
 
-	// 标记该记录修复完成
-	affected := TagDiffRecordFixed(_diffRecord.Id.Int64)
+	// 标记该记录修复完成, 并记录不一致的行数
+	affected := TagDiffRecordFixedWithCount(_diffRecord.Id.Int64, diffRowCount)
 	if affected >= 1 {
-		logger.M.Infof("已经标记不一致数据修复完成. %v.%v. min: %v max: %v",
-			primaryRangeValue.Schema, primaryRangeValue.Table, primaryRangeValue.MinValue, primaryRangeValue.MaxValue)
+		logger.M.Infof("已经标记不一致数据修复完成. %v.%v. min: %v max: %v. 目标缺少行数: %v, 目标多出行数: %v, 数据不一致行数: %v",
+			primaryRangeValue.Schema, primaryRangeValue.Table, primaryRangeValue.MinValue, primaryRangeValue.MaxValue,
+			diffRowCount.MissingRows, diffRowCount.ExtraRows, diffRowCount.DiffRows)
 	} else {
 		logger.M.Warnf("标记不一致数据修复(未成功). %v.%v. min: %v max: %v",
 			primaryRangeValue.Schema, primaryRangeValue.Table, primaryRangeValue.MinValue, primaryRangeValue.MaxValue)
@@ -329,73 +540,251 @@ func (this *Checksum) FixDiffRows(_diffRecord model.DataChecksum, _parallerTag i
 	this.NeedFixRecordCounter.Dec()
 
 	if !is_consistent {
-		// 再次进行检测通道
+		// 再次进行检测通道, 再次检测一致算修复成功
+		primaryRangeValue.IsRecheck = true
 		this.ChecksumRowsChan <- primaryRangeValue
 	}
 
 	return nil
 }
 
+/* 不标记修复, 不一致记录保持没有修复, 只记录修复时发现的不一致行数. 本次运行不再次获取该记录修复
+Params:
+	_diffRecordId: 不一致记录ID
+	_diffRowCount: 修复时发现的不一致行数
+*/
+func (this *Checksum) KeepDiffRecordUnfixed(diffRecordId int64, diffRowCount *DiffRowCount) {
+	if affected := TagDiffRecordCount(diffRecordId, diffRowCount); affected < 1 {
+		logger.M.Warnf("记录不一致记录的行数(未成功). id: %v", diffRecordId)
+	}
+
+	this.unfixedDiffRecordLock.Lock()
+	defer this.unfixedDiffRecordLock.Unlock()
+
+	this.unfixedDiffRecordIds[diffRecordId] = true
+}
+
+// 本次运行保持没有修复的不一致记录数
+func (this *Checksum) GetUnfixedDiffRecordCount() int {
+	this.unfixedDiffRecordLock.Lock()
+	defer this.unfixedDiffRecordLock.Unlock()
+
+	return len(this.unfixedDiffRecordIds)
+}
+
+// 去掉本次运行保持没有修复的不一致记录
+func (this *Checksum) filterUnfixedDiffRecords(records []model.DataChecksum) []model.DataChecksum {
+	this.unfixedDiffRecordLock.Lock()
+	defer this.unfixedDiffRecordLock.Unlock()
+
+	needFixRecords := make([]model.DataChecksum, 0, len(records))
+	for _, record := range records {
+		if this.unfixedDiffRecordIds[record.Id.Int64] {
+			continue
+		}
+		needFixRecords = append(needFixRecords, record)
+	}
+
+	return needFixRecords
+}
+
+/* 再次比较范围数据是否一致, 不一致就开始修复. 没有主键的表无法逐行修复, 只进行比较
+Params:
+	_primaryRangeValue: 数据范围
+	_table: 需要迁移的表
+	_parallerTag: 协程号
+Return:
+    1. 修复前是否一致
+    2. 修复时发现的不一致行数
+    3. 错误
+*/
+func (this *Checksum) FixDiffRange(primaryRangeValue *matemap.PrimaryRangeValue, table *matemap.Table, parallerTag int) (bool, *DiffRowCount, error) {
+	diffRowCount := new(DiffRowCount)
+
+	is_consistent, err := this.RowsChecksum(primaryRangeValue, parallerTag)
+	if err != nil {
+		return false, diffRowCount, fmt.Errorf("修复数据时. %v", err)
+	}
+	if is_consistent || table.NoUniqueKey {
+		return is_consistent, diffRowCount, nil
+	}
+
+	// 二分查找不一致的行, 或者逐行比较源表和目标的每一行
+	if this.Parser.ChecksumFixMode == parser.CHECKSUM_FIX_MODE_BISECT {
+		err = this.FixDiffRowsBisect(primaryRangeValue, table, parallerTag, diffRowCount)
+	} else {
+		err = this.FixDiffRowsStepFix(primaryRangeValue, table, parallerTag, diffRowCount)
+	}
+
+	return false, diffRowCount, err
+}
+
 /* 真正开始修复数据
 Params:
 	primaryRangeValue: 修复的数据范围值
 	parallerTag: 并发标记
+	diffRowCount: 记录不一致的行数
 */
-func (this *Checksum) FixDiffRowsStepFix(primaryRangeValue *matemap.PrimaryRangeValue, table *matemap.Table, parallerTag int) error {
+func (this *Checksum) FixDiffRowsStepFix(primaryRangeValue *matemap.PrimaryRangeValue, table *matemap.Table, parallerTag int, diffRowCount *DiffRowCount) error {
 	// 1. 获取源表id范围所有值
 	// 获取源数据所有主键值
-	rows, err := FindSourcePKRows(this.ConfigMap.Source.Host.String, int(this.ConfigMap.Source.Port.Int64), primaryRangeValue, table)
+	sourceRows, err := FindSourcePKRows(this.ConfigMap.Source.Host.String, int(this.ConfigMap.Source.Port.Int64), primaryRangeValue, table)
+	if err != nil {
+		return fmt.Errorf("协程: %v, 修复数据出错. %v", parallerTag, err)
+	}
+	// 获取目标数据所有主键值, 只在目标存在的行也需要比较
+	targetRows, err := FindTargetPKRows(this.ConfigMap.Target.Host.String, int(this.ConfigMap.Target.Port.Int64), primaryRangeValue, table)
 	if err != nil {
 		return fmt.Errorf("协程: %v, 修复数据出错. %v", parallerTag, err)
 	}
 
 	// 2. 比较每一行的checksum数据
-	for _, pkValues := range rows {
-		// 获取源数据 checksum 值
-		sourceCode, err := GetSourceRowChecksumCode(this.ConfigMap.Source.Host.String, int(this.ConfigMap.Source.Port.Int64), pkValues, table)
-		if err != nil {
-			return fmt.Errorf("协程: %v, 修复数据出错 %v", parallerTag, err)
+	for _, pkValues := range UnionPKRows(sourceRows, targetRows) {
+		if err := this.FixDiffRow(pkValues, table, parallerTag, diffRowCount); err != nil {
+			return err
 		}
-		// 获取目标数据 checksum 值
-		targetCode, err := GetTargetRowChecksumCode(this.ConfigMap.Target.Host.String, int(this.ConfigMap.Target.Port.Int64), pkValues, table)
+	}
+
+	return nil
+}
+
+/* 比较一行数据的 checksum 值, 不一致则修复
+Params:
+	_pkValues: 该行的主键值
+	_table: 需要迁移的表
+	_parallerTag: 并发标记
+	_diffRowCount: 记录不一致的行数
+*/
+func (this *Checksum) FixDiffRow(pkValues []interface{}, table *matemap.Table, parallerTag int, diffRowCount *DiffRowCount) error {
+	// 获取源数据 checksum 值
+	sourceCode, err := GetSourceRowChecksumCode(this.ConfigMap.Source.Host.String, int(this.ConfigMap.Source.Port.Int64), pkValues, table)
+	if err != nil {
+		return fmt.Errorf("协程: %v, 修复数据出错 %v", parallerTag, err)
+	}
+	// 获取目标数据 checksum 值
+	targetCode, err := GetTargetRowChecksumCode(this.ConfigMap.Target.Host.String, int(this.ConfigMap.Target.Port.Int64), pkValues, table)
+	if err != nil {
+		return fmt.Errorf("协程: %v, 修复数据出错 %v", parallerTag, err)
+	}
+
+	// 一致不需要修复
+	if sourceCode == targetCode {
+		return nil
+	}
+
+	// 源和目标都有该行, 规范化后的 checksum 不一致, 在Go中比较数据一致也不需要修复
+	if sourceCode != "" && targetCode != "" && this.Parser.ChecksumGoCompare {
+		isConsistent, err := this.GoCompareRow(pkValues, table, parallerTag)
 		if err != nil {
-			return fmt.Errorf("协程: %v, 修复数据出错 %v", parallerTag, err)
+			return err
+		}
+		if isConsistent {
+			return nil
 		}
+	}
 
-		// 不一致的情况需要进行修复
-		if sourceCode != targetCode {
-			// 源没有数据, 目标有数据. 在目标端把数据删了
-			if sourceCode == 0 && targetCode != 0 {
-				if err = DeleteTargetRow(this.ConfigMap.Target.Host.String, int(this.ConfigMap.Target.Port.Int64), pkValues, table); err != nil {
-					return fmt.Errorf("协程: %v, 修复数据, 删除目标行失败. %v.%v -> %v.%v. Primary: %v. %v",
-						parallerTag, table.SourceSchema, table.SourceName, table.TargetSchema, table.TargetName, pkValues, err)
-				}
+	// 源没有数据, 目标有数据. 在目标端把数据删了
+	if sourceCode == "" && targetCode != "" {
+		diffRowCount.ExtraRows++
+		this.SaveDiffRowSample(model.CHECKSUM_DIFF_ROW_TYPE_EXTRA, pkValues, table, nil, parallerTag)
+		if this.Parser.ChecksumDeleteExtraDryRun {
+			logger.M.Warnf("协程: %v, 数据不一致, 目标多余行(dry run 不删除) %v.%v -> %v.%v. Primary: %v",
+				parallerTag, table.SourceSchema, table.SourceName, table.TargetSchema, table.TargetName, pkValues)
+			return nil
+		}
 
-				logger.M.Warnf("协程: %v, 数据不一致, 删除目标多余行 %v.%v -> %v.%v. Primary: %v",
-					parallerTag, table.SourceSchema, table.SourceName, table.TargetSchema, table.TargetName, pkValues)
-			} else { // 其他情况变成replace into 语句直接在 目标段执行
-				// 通过主键值对源表进行select操作
-				sourceRow, err := GetSourceRowByPK(this.ConfigMap.Source.Host.String, int(this.ConfigMap.Source.Port.Int64), pkValues, table)
-				if err != nil {
-					return fmt.Errorf("协程: %v, 数据不一致. 正在修复数据. 通过主键值获取源表数据失败. %v.%v. %v. %v",
-						parallerTag, table.SourceSchema, table.SourceName, pkValues, err)
-				}
-				// 如没有数据, 可能是源表有delete操作. 就不用任何操作了, 本行就不修复了
-				if sourceRow == nil || len(sourceRow) == 0 {
-					logger.M.Warnf("协程: %v, 在修复数据准备替换目标数据是, 发现不能获取到源表数据. 有可能是刚好碰到源表数据被删除. 本行数据库可以不用修复.", parallerTag)
-					continue
-				}
+		if this.FixSqlWriter != nil {
+			return this.WriteFixSql(FIX_SQL_TYPE_DELETE, pkValues, table, sourceCode, targetCode, nil, parallerTag)
+		}
 
-				// 对目标表进行 replace into 操作
-				if err = ReplaceTargetRow(this.ConfigMap.Target.Host.String, int(this.ConfigMap.Target.Port.Int64), sourceRow, table); err != nil {
-					return fmt.Errorf("协程: %v, 数据不一致, 正在修复数据. 对目标表进行Replace into时失败. %v.%v -> %v.%v. %v. %v",
-						parallerTag, table.SourceSchema, table.SourceName, table.TargetSchema, table.TargetName, pkValues, err)
-				}
-				logger.M.Warnf("协程: %v, 数据不一致, 使用源数据替换目标数据行 %v.%v -> %v.%v. Primary: %v",
-					parallerTag, table.SourceSchema, table.SourceName, table.TargetSchema, table.TargetName, pkValues)
-			}
-		} // 完成单行不一致的修复
+		if err = DeleteTargetRow(this.ConfigMap.Target.Host.String, int(this.ConfigMap.Target.Port.Int64), pkValues, table); err != nil {
+			return fmt.Errorf("协程: %v, 修复数据, 删除目标行失败. %v.%v -> %v.%v. Primary: %v. %v",
+				parallerTag, table.SourceSchema, table.SourceName, table.TargetSchema, table.TargetName, pkValues, err)
+		}
+
+		logger.M.Warnf("协程: %v, 数据不一致, 删除目标多余行 %v.%v -> %v.%v. Primary: %v",
+			parallerTag, table.SourceSchema, table.SourceName, table.TargetSchema, table.TargetName, pkValues)
+
+		return nil
+	}
+
+	diffType := model.CHECKSUM_DIFF_ROW_TYPE_DIFF
+	if targetCode == "" {
+		diffRowCount.MissingRows++
+		diffType = model.CHECKSUM_DIFF_ROW_TYPE_MISSING
+	} else {
+		diffRowCount.DiffRows++
+	}
+
+	// 其他情况变成replace into 语句直接在 目标段执行
+	// 通过主键值对源表进行select操作
+	sourceRow, err := GetSourceRowByPK(this.ConfigMap.Source.Host.String, int(this.ConfigMap.Source.Port.Int64), pkValues, table)
+	if err != nil {
+		return fmt.Errorf("协程: %v, 数据不一致. 正在修复数据. 通过主键值获取源表数据失败. %v.%v. %v. %v",
+			parallerTag, table.SourceSchema, table.SourceName, pkValues, err)
+	}
+	// 如没有数据, 可能是源表有delete操作. 就不用任何操作了, 本行就不修复了
+	if sourceRow == nil || len(sourceRow) == 0 {
+		logger.M.Warnf("协程: %v, 在修复数据准备替换目标数据是, 发现不能获取到源表数据. 有可能是刚好碰到源表数据被删除. 本行数据库可以不用修复.", parallerTag)
+		return nil
+	}
+	this.SaveDiffRowSample(diffType, pkValues, table, sourceRow, parallerTag)
+
+	if this.FixSqlWriter != nil {
+		return this.WriteFixSql(FIX_SQL_TYPE_REPLACE, pkValues, table, sourceCode, targetCode, sourceRow, parallerTag)
+	}
+
+	// 对目标表进行 replace into 操作
+	if err = ReplaceTargetRow(this.ConfigMap.Target.Host.String, int(this.ConfigMap.Target.Port.Int64), sourceRow, table); err != nil {
+		return fmt.Errorf("协程: %v, 数据不一致, 正在修复数据. 对目标表进行Replace into时失败. %v.%v -> %v.%v. %v. %v",
+			parallerTag, table.SourceSchema, table.SourceName, table.TargetSchema, table.TargetName, pkValues, err)
+	}
+	logger.M.Warnf("协程: %v, 数据不一致, 使用源数据替换目标数据行 %v.%v -> %v.%v. Primary: %v",
+		parallerTag, table.SourceSchema, table.SourceName, table.TargetSchema, table.TargetName, pkValues)
+
+	return nil
+}
+
+/* 把修复一行的sql写入文件, 同时记录修复前后的数据, 用于人工审核
+Params:
+	_typ: 修复类型
+	_pkValues: 该行的主键值
+	_table: 需要迁移的表
+	_sourceCode: 源该行的 checksum 值
+	_targetCode: 目标该行的 checksum 值
+	_sourceRow: 源该行的数据, 删除时为 nil
+	_parallerTag: 并发标记
+*/
+func (this *Checksum) WriteFixSql(
+	typ string,
+	pkValues []interface{},
+	table *matemap.Table,
+	sourceCode string,
+	targetCode string,
+	sourceRow []interface{},
+	parallerTag int,
+) error {
+	fixSql, err := NewFixSql(typ, table, pkValues, sourceCode, targetCode)
+	if err != nil {
+		return fmt.Errorf("协程: %v, %v", parallerTag, err)
+	}
+
+	// 修复前目标的数据
+	if fixSql.Before, err = GetTargetRowByPK(this.ConfigMap.Target.Host.String, int(this.ConfigMap.Target.Port.Int64), pkValues, table); err != nil {
+		return fmt.Errorf("协程: %v, 生成修复sql. 通过主键值获取目标表数据失败. %v.%v. %v. %v",
+			parallerTag, table.TargetSchema, table.TargetName, pkValues, err)
+	}
+
+	fixSql.After = sourceRow
+	if fixSql.Sql, err = fixSql.GenerateSql(table, pkValues, sourceRow); err != nil {
+		return fmt.Errorf("协程: %v, %v", parallerTag, err)
+	}
+
+	if err = this.FixSqlWriter.Write(fixSql); err != nil {
+		return fmt.Errorf("协程: %v, %v", parallerTag, err)
 	}
+	logger.M.Warnf("协程: %v, 数据不一致, 修复sql(%v)写入文件 %v. %v.%v -> %v.%v. Primary: %v",
+		parallerTag, typ, this.FixSqlWriter.FileName, table.SourceSchema, table.SourceName, table.TargetSchema, table.TargetName, pkValues)
 
 	return nil
 }
@@ -1,6 +1,7 @@
 package mysqlchecksum
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"github.com/daiguadaidai/go-d-bus/common"
@@ -19,8 +20,8 @@ Params:
 	_primaryRangeValue: 需要进行checksum的值范围
 	_table: 需要迁移的表元数据信息
 */
-func GetSourceRowsChecksumCode(host string, port int, priamryRangeValue *matemap.PrimaryRangeValue, table *matemap.Table) (int, error) {
-	var checksumCode sql.NullInt64
+func GetSourceRowsChecksumCode(host string, port int, priamryRangeValue *matemap.PrimaryRangeValue, table *matemap.Table) (string, error) {
+	var checksumCode sql.NullString
 
 	// 获取需要迁移的表的最小最大的主键值, 用于多行checksum sql语句的占位符
 	primaryMinValue := priamryRangeValue.GetMinMaxValueSlice(table.FindSourcePKColumnNames())
@@ -28,15 +29,37 @@ func GetSourceRowsChecksumCode(host string, port int, priamryRangeValue *matemap
 	// 获取数据库实例
 	instance, ok := gdbc.GetDynamicDBByHostPort(host, int64(port))
 	if !ok {
-		return int(checksumCode.Int64), fmt.Errorf("缓存中不存在该实例(%v:%v). 获取源数据库实例(获取多行checksum code时)", host, port)
+		return checksumCode.String, fmt.Errorf("缓存中不存在该实例(%v:%v). 获取源数据库实例(获取多行checksum code时)", host, port)
 	}
 
 	if err := instance.QueryRow(table.GetSelSourceRowsChecksumSqlTpl(), primaryMinValue...).Scan(&checksumCode); err != nil {
-		return int(checksumCode.Int64), fmt.Errorf("失败. 获取源实例表多行checksum值. %v:%v. %v:%v. min:%v, max:%v. %v",
+		return checksumCode.String, fmt.Errorf("失败. 获取源实例表多行checksum值. %v:%v. %v:%v. min:%v, max:%v. %v",
 			priamryRangeValue.Schema, priamryRangeValue.Table, host, port, priamryRangeValue.MinValue, priamryRangeValue.MaxValue, err)
 	}
 
-	return int(checksumCode.Int64), nil
+	return checksumCode.String, nil
+}
+
+/* 在一致性快照中获取源实例的 checksum code
+快照对应的 binlog 位点在开启快照时获取, 应用binlog追上该位点后, 目标包含了快照中所有的数据
+Params:
+	_snapshot: 源实例的快照, 必须是应用binlog解析的实例
+	_primaryRangeValue: 需要进行checksum的值范围
+	_table: 需要迁移的表元数据信息
+*/
+func GetSourceRowsChecksumCodeInSnapshot(snapshot *ChecksumSnapshot, priamryRangeValue *matemap.PrimaryRangeValue, table *matemap.Table) (string, error) {
+	var checksumCode sql.NullString
+
+	// 获取需要迁移的表的最小最大的主键值, 用于多行checksum sql语句的占位符
+	primaryMinValue := priamryRangeValue.GetMinMaxValueSlice(table.FindSourcePKColumnNames())
+
+	if err := snapshot.Conn.QueryRowContext(context.Background(), table.GetSelSourceRowsChecksumSqlTpl(), primaryMinValue...).Scan(&checksumCode); err != nil {
+		return checksumCode.String, fmt.Errorf("失败. 在快照中获取源实例表多行checksum值. %v:%v. 快照位点: %v:%v. min:%v, max:%v. %v",
+			priamryRangeValue.Schema, priamryRangeValue.Table, snapshot.LogFilePos.LogFile, snapshot.LogFilePos.LogPos,
+			priamryRangeValue.MinValue, priamryRangeValue.MaxValue, err)
+	}
+
+	return checksumCode.String, nil
 }
 
 /* 获取目标实例的 checksum code
@@ -46,8 +69,8 @@ Params:
 	_primaryRangeValue: 需要进行checksum的值范围
 	_table: 需要迁移的表元数据信息
 */
-func GetTargetRowsChecksumCode(host string, port int, priamryRangeValue *matemap.PrimaryRangeValue, table *matemap.Table) (int, error) {
-	var checksumCode sql.NullInt64
+func GetTargetRowsChecksumCode(host string, port int, priamryRangeValue *matemap.PrimaryRangeValue, table *matemap.Table) (string, error) {
+	var checksumCode sql.NullString
 
 	// 获取需要迁移的表的最小最大的主键值, 用于多行checksum sql语句的占位符
 	primaryMinValue := priamryRangeValue.GetMinMaxValueSlice(table.FindSourcePKColumnNames())
@@ -55,48 +78,69 @@ func GetTargetRowsChecksumCode(host string, port int, priamryRangeValue *matemap
 	// 获取数据库实例
 	instance, ok := gdbc.GetDynamicDBByHostPort(host, int64(port))
 	if !ok {
-		return int(checksumCode.Int64), fmt.Errorf("缓存中不存在该实例(%v:%v). 获取目标数据库实例(获取多行checksum code时)", host, port)
+		return checksumCode.String, fmt.Errorf("缓存中不存在该实例(%v:%v). 获取目标数据库实例(获取多行checksum code时)", host, port)
 	}
 
 	if err := instance.QueryRow(table.GetSelTargetRowsChecksumSqlTpl(), primaryMinValue...).Scan(&checksumCode); err != nil {
-		return int(checksumCode.Int64), fmt.Errorf("失败. 获取目标实例表多行checksum值. %v:%v. %v:%v. min:%v, max:%v. %v",
+		return checksumCode.String, fmt.Errorf("失败. 获取目标实例表多行checksum值. %v:%v. %v:%v. min:%v, max:%v. %v",
 			priamryRangeValue.Schema, priamryRangeValue.Table, host, port, priamryRangeValue.MinValue, priamryRangeValue.MaxValue, err)
 	}
 
-	return int(checksumCode.Int64), nil
+	return checksumCode.String, nil
 }
 
 /* 生成一条不一致数据
 Params:
     _taskUUID: 任务UUID
     _primaryRangeValue: 表的主键范围值
+Return: 保存的不一致记录(包含ID), 错误
 */
-func CreateDiffRecord(taskUUID string, priamryRangeValue *matemap.PrimaryRangeValue) error {
+func CreateDiffRecord(taskUUID string, priamryRangeValue *matemap.PrimaryRangeValue) (*model.DataChecksum, error) {
 	// 获取需要迁移的表的元数据
 	table, err := matemap.GetMigrationTableBySchemaTable(priamryRangeValue.Schema, priamryRangeValue.Table)
 	if err != nil {
-		return fmt.Errorf("失败. 获取目标需要迁移的表(保存不一致数据). %v:%v. %v", priamryRangeValue.Schema, priamryRangeValue.Table, err)
+		return nil, fmt.Errorf("失败. 获取目标需要迁移的表(保存不一致数据). %v:%v. %v", priamryRangeValue.Schema, priamryRangeValue.Table, err)
 	}
 
 	minValue, err := common.Map2Json(priamryRangeValue.MinValue) // 获取范围最小值
 	maxValue, err := common.Map2Json(priamryRangeValue.MaxValue) // 获取范围最大值
 
 	diffRecord := &model.DataChecksum{
-		TaskUUID:     sql.NullString{taskUUID, true},
-		SourceSchema: sql.NullString{table.SourceSchema, true},
-		SourceTable:  sql.NullString{table.SourceName, true},
-		TargetSchema: sql.NullString{table.TargetSchema, true},
-		TargetTable:  sql.NullString{table.TargetName, true},
-		MinIDValue:   sql.NullString{minValue, true},
-		MaxIDValue:   sql.NullString{maxValue, true},
+		TaskUUID:     sql.NullString{String: taskUUID, Valid: true},
+		SourceSchema: sql.NullString{String: table.SourceSchema, Valid: true},
+		SourceTable:  sql.NullString{String: table.SourceName, Valid: true},
+		TargetSchema: sql.NullString{String: table.TargetSchema, Valid: true},
+		TargetTable:  sql.NullString{String: table.TargetName, Valid: true},
+		MinIDValue:   sql.NullString{String: minValue, Valid: true},
+		MaxIDValue:   sql.NullString{String: maxValue, Valid: true},
 	}
 
 	if err := new(dao.DataChecksumDao).Create(diffRecord); err != nil {
-		return fmt.Errorf("%v: 失败, 创建不一致记录. taskUUID: %v, %v.%v -> %v.%v min: %v, max: %v",
-			taskUUID, table.SourceSchema, table.SourceName, table.TargetSchema, table.TargetName, minValue, maxValue)
+		return nil, fmt.Errorf("失败. 创建不一致记录. taskUUID: %v, %v.%v -> %v.%v min: %v, max: %v. %v",
+			taskUUID, table.SourceSchema, table.SourceName, table.TargetSchema, table.TargetName, minValue, maxValue, err)
 	}
 
-	return nil
+	return diffRecord, nil
+}
+
+/* 一个范围是否已经有还没修复的不一致记录
+Params:
+    _taskUUID: 任务UUID
+    _primaryRangeValue: 表的主键范围值
+*/
+func HasNoFixDiffRecord(taskUUID string, priamryRangeValue *matemap.PrimaryRangeValue) (bool, error) {
+	minValue, err := common.Map2Json(priamryRangeValue.MinValue)
+	if err != nil {
+		return false, fmt.Errorf("失败. 范围最小值转化成json. %v.%v. %v. %v", priamryRangeValue.Schema, priamryRangeValue.Table, priamryRangeValue.MinValue, err)
+	}
+	maxValue, err := common.Map2Json(priamryRangeValue.MaxValue)
+	if err != nil {
+		return false, fmt.Errorf("失败. 范围最大值转化成json. %v.%v. %v. %v", priamryRangeValue.Schema, priamryRangeValue.Table, priamryRangeValue.MaxValue, err)
+	}
+
+	count := new(dao.DataChecksumDao).CountNoFixByRange(taskUUID, priamryRangeValue.Schema, priamryRangeValue.Table, minValue, maxValue)
+
+	return count > 0, nil
 }
 
 /* 获取还没修复的不一致记录
@@ -115,6 +159,20 @@ func FindNoFixDiffRecords(taskUUID string) ([]model.DataChecksum, error) {
 	return records, nil
 }
 
+/* 获取任务 checksum 和 checksum 修复数据的并发数, 运行时修改 task 表中的值可以调整并发数
+Params:
+	_taskUUID: 任务ID
+*/
+func GetTaskChecksumParaller(taskUUID string) (int, int, error) {
+	taskDao := new(dao.TaskDao)
+	task, err := taskDao.GetByTaskUUID(taskUUID, "checksum_paraller, checksum_fix_paraller")
+	if err != nil {
+		return 0, 0, fmt.Errorf("失败. 获取任务 checksum 并发数. %v. %v", taskUUID, err)
+	}
+
+	return int(task.ChecksumParaller.Int64), int(task.ChecksumFixParaller.Int64), nil
+}
+
 /* 获取源数据主键范围值的所有行
 Param:
 	_host: 实例host
@@ -145,52 +203,90 @@ func FindSourcePKRows(host string, port int, primaryRangeValue *matemap.PrimaryR
 	return rs, nil
 }
 
-/* 获取源实例单行数据的checksum值
+/* 获取目标数据主键范围值的所有行, 用于发现只在目标存在的行
+Param:
+	_host: 实例host
+	_port: 实例端口
+	_primaryRangeValue 主键范围值
+	_table 需要迁移的表元数据
+*/
+func FindTargetPKRows(host string, port int, primaryRangeValue *matemap.PrimaryRangeValue, table *matemap.Table) ([][]interface{}, error) {
+	// 获取目标实例
+	instance, ok := gdbc.GetDynamicDBByHostPort(host, int64(port))
+	if !ok {
+		return nil, fmt.Errorf("缓存中不存在该实例(%v:%v). 获取目标实例失败(修复数据, 获取所有主键值)", host, port)
+	}
+
+	// 获取范围值, 用于sql语句中的占位符
+	minMaxValue := primaryRangeValue.GetMinMaxValueSlice(table.FindSourcePKColumnNames())
+	rows, err := instance.Query(table.GetSelPerBatchTargetPKSqlTpl(), minMaxValue...)
+	if err != nil {
+		return nil, fmt.Errorf("查询需要fix数据的目标所有主键值(修复数据, 获取所有主键值). %v. %v", table.GetSelPerBatchTargetPKSqlTpl(), err)
+	}
+	defer rows.Close()
+
+	rs, err := helper.GetRows(rows)
+	if err != nil {
+		return nil, fmt.Errorf("checksum 获取目标数据主键范围值的所有行出错. %v.", err)
+	}
+
+	return rs, nil
+}
+
+/* 获取源实例单行数据的checksum值, 没有该行返回空字符串
 Params:
 	_host: 实例ip
 	_port: 实例端口
 	_primaryValues: 获取单行数据的sql的 where 占位符的值
 	_table: 需要迁移的表的元数据信息
 */
-func GetSourceRowChecksumCode(host string, port int, primaryValues []interface{}, table *matemap.Table) (int, error) {
-	var checksumCode sql.NullInt64
+func GetSourceRowChecksumCode(host string, port int, primaryValues []interface{}, table *matemap.Table) (string, error) {
+	var checksumCode sql.NullString
 
 	// 获取数据库实例
 	instance, ok := gdbc.GetDynamicDBByHostPort(host, int64(port))
 	if !ok {
-		return int(checksumCode.Int64), fmt.Errorf("缓存中不存在该实例(%v:%v). 获取源数据库实例(获取单行checksum code时)", host, port)
+		return checksumCode.String, fmt.Errorf("缓存中不存在该实例(%v:%v). 获取源数据库实例(获取单行checksum code时)", host, port)
 	}
 
-	if err := instance.QueryRow(table.GetSelSourceRowChecksumSqlTpl(), primaryValues...).Scan(&checksumCode); err != nil {
-		return int(checksumCode.Int64), fmt.Errorf("失败. 获取源实例表单行checksum值. %v:%v. %v:%v. primary: %v. %v",
+	err := instance.QueryRow(table.GetSelSourceRowChecksumSqlTpl(), primaryValues...).Scan(&checksumCode)
+	if err == sql.ErrNoRows { // 没有该行, checksum 值为空
+		return "", nil
+	}
+	if err != nil {
+		return checksumCode.String, fmt.Errorf("失败. 获取源实例表单行checksum值. %v:%v. %v:%v. primary: %v. %v",
 			table.SourceSchema, table.SourceName, host, port, primaryValues, err)
 	}
 
-	return int(checksumCode.Int64), nil
+	return checksumCode.String, nil
 }
 
-/* 获取目标实例单行数据的checksum值
+/* 获取目标实例单行数据的checksum值, 没有该行返回空字符串
 Params:
 	_host: 实例ip
 	_port: 实例端口
 	_primaryValues: 获取单行数据的sql的 where 占位符的值
 	_table: 需要迁移的表的元数据信息
 */
-func GetTargetRowChecksumCode(host string, port int, primaryValues []interface{}, table *matemap.Table) (int, error) {
-	var checksumCode sql.NullInt64
+func GetTargetRowChecksumCode(host string, port int, primaryValues []interface{}, table *matemap.Table) (string, error) {
+	var checksumCode sql.NullString
 
 	// 获取数据库实例
 	instance, ok := gdbc.GetDynamicDBByHostPort(host, int64(port))
 	if !ok {
-		return int(checksumCode.Int64), fmt.Errorf("缓存中不存在该实例(%v:%v). 获取目标数据库实例(获取单行checksum code时)", host, port)
+		return checksumCode.String, fmt.Errorf("缓存中不存在该实例(%v:%v). 获取目标数据库实例(获取单行checksum code时)", host, port)
 	}
 
-	if err := instance.QueryRow(table.GetSelTargetRowChecksumSqlTpl(), primaryValues...).Scan(&checksumCode); err != nil {
-		return int(checksumCode.Int64), fmt.Errorf("失败. 获取目标实例表单行checksum值. %v:%v. %v:%v. primary: %v. %v",
+	err := instance.QueryRow(table.GetSelTargetRowChecksumSqlTpl(), primaryValues...).Scan(&checksumCode)
+	if err == sql.ErrNoRows { // 没有该行, checksum 值为空
+		return "", nil
+	}
+	if err != nil {
+		return checksumCode.String, fmt.Errorf("失败. 获取目标实例表单行checksum值. %v:%v. %v:%v. primary: %v. %v",
 			table.SourceSchema, table.SourceName, host, port, primaryValues, err)
 	}
 
-	return int(checksumCode.Int64), nil
+	return checksumCode.String, nil
 }
 
 /* 通过主键删除目标行
@@ -252,6 +348,34 @@ func GetSourceRowByPK(host string, port int, primaryValues []interface{}, table
 	return rs, nil
 }
 
+/* 通过主键值获取目标表数据, 没有该行返回 nil
+Params:
+	_host: 实例ip
+	_port: 实例端口
+	_primaryValues: 获取单行数据的sql的 where 占位符的值
+	_table: 需要迁移的表的元数据信息
+*/
+func GetTargetRowByPK(host string, port int, primaryValues []interface{}, table *matemap.Table) ([]interface{}, error) {
+	// 获取数据库实例
+	instance, ok := gdbc.GetDynamicDBByHostPort(host, int64(port))
+	if !ok {
+		return nil, fmt.Errorf("缓存中不存在该实例(%v:%v). 获取目标数据库实例(通过主键获取目标表数据)", host, port)
+	}
+
+	rows, err := instance.Query(table.GetSelTargetRowSqlTpl(), primaryValues...)
+	if err != nil {
+		return nil, fmt.Errorf("查询数据库失败, 通过主键在目标表获取数据. %v. value: %v %v", table.GetSelTargetRowSqlTpl(), primaryValues, err)
+	}
+	defer rows.Close()
+
+	rs, err := helper.GetRow(rows)
+	if err != nil {
+		return nil, fmt.Errorf("查询获取一行主键数据失败, 通过主键在目标表获取数据. %v. value: %v %v", table.GetSelTargetRowSqlTpl(), primaryValues, err)
+	}
+
+	return rs, nil
+}
+
 /* 通过主键 repalce into 目标行
 Params:
 	_host: 实例ip
@@ -302,6 +426,32 @@ func diffRecord2PrimaryRangeValue(record model.DataChecksum, table *matemap.Tabl
 	return primaryRangeValue, nil
 }
 
+/* 标记记录已经修复, 并记录修复时发现的不一致行数
+Params:
+	_id: 需要修复数据的记录ID
+	_diffRowCount: 不一致的行数
+*/
+func TagDiffRecordFixedWithCount(_id int64, _diffRowCount *DiffRowCount) int {
+	dataChecksumDao := new(dao.DataChecksumDao)
+
+	affected := dataChecksumDao.FixCompletedWithCountByID(_id, _diffRowCount.MissingRows, _diffRowCount.ExtraRows, _diffRowCount.DiffRows)
+
+	return affected
+}
+
+/* 记录修复时发现的不一致行数, 不标记修复
+Params:
+	_id: 需要修复数据的记录ID
+	_diffRowCount: 不一致的行数
+*/
+func TagDiffRecordCount(_id int64, _diffRowCount *DiffRowCount) int {
+	dataChecksumDao := new(dao.DataChecksumDao)
+
+	affected := dataChecksumDao.UpdateCountByID(_id, _diffRowCount.MissingRows, _diffRowCount.ExtraRows, _diffRowCount.DiffRows)
+
+	return affected
+}
+
 /* 标记记录已经修复
 Params:
 	_id: 需要修复数据的记录ID
@@ -0,0 +1,248 @@
+package mysqlchecksum
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/daiguadaidai/go-d-bus/gdbc"
+	"github.com/daiguadaidai/go-d-bus/logger"
+	"github.com/daiguadaidai/go-d-bus/matemap"
+	"github.com/daiguadaidai/go-d-bus/service/helper"
+)
+
+const (
+	CHECKSUM_BISECT_MAX_DEPTH = 64 // 二分的最大深度, 超过后直接逐行比较
+)
+
+// 二分查找不一致数据的一个主键范围
+type BisectRange struct {
+	MinValue       []interface{} // 范围最小值(包含)
+	MaxValue       []interface{} // 范围最大值
+	IsMaxExclusive bool          // 是否不包含最大值
+}
+
+// 获取范围的值, 用于sql语句中的占位符
+func (this *BisectRange) GetMinMaxValueSlice() []interface{} {
+	minMaxValueSlice := make([]interface{}, 0, len(this.MinValue)+len(this.MaxValue))
+	minMaxValueSlice = append(minMaxValueSlice, this.MinValue...)
+	minMaxValueSlice = append(minMaxValueSlice, this.MaxValue...)
+
+	return minMaxValueSlice
+}
+
+/* 通过二分查找不一致的行并修复
+不一致的范围按行数拆分成两半, 两边分别再次 checksum, 只对不一致的一半继续拆分,
+行数足够少时取出源和目标所有的主键逐行比较修复, 只在目标存在的行也会被删除
+Params:
+	_primaryRangeValue: 不一致的主键范围
+	_table: 需要迁移的表
+	_parallerTag: 协程号
+	_diffRowCount: 记录不一致的行数
+*/
+func (this *Checksum) FixDiffRowsBisect(primaryRangeValue *matemap.PrimaryRangeValue, table *matemap.Table, parallerTag int, diffRowCount *DiffRowCount) error {
+	pkColumnNames := table.FindSourcePKColumnNames()
+	bisectRange := &BisectRange{
+		MinValue: primaryRangeValue.GetMinValueSlice(pkColumnNames),
+		MaxValue: primaryRangeValue.GetMaxValueSlice(pkColumnNames),
+	}
+
+	return this.bisectFixRange(bisectRange, table, parallerTag, 0, diffRowCount)
+}
+
+/* 对一个范围进行二分查找并修复
+Params:
+	_bisectRange: 需要比较的范围
+	_table: 需要迁移的表
+	_parallerTag: 协程号
+	_depth: 当前二分深度
+	_diffRowCount: 记录不一致的行数
+*/
+func (this *Checksum) bisectFixRange(bisectRange *BisectRange, table *matemap.Table, parallerTag int, depth int, diffRowCount *DiffRowCount) error {
+	sourceHost := this.ConfigMap.Source.Host.String
+	sourcePort := int(this.ConfigMap.Source.Port.Int64)
+	targetHost := this.ConfigMap.Target.Host.String
+	targetPort := int(this.ConfigMap.Target.Port.Int64)
+
+	// 1. 比较该范围源和目标的 checksum 值
+	sourceCode, err := GetBisectRowsChecksumCode(sourceHost, sourcePort, bisectRange, table, true)
+	if err != nil {
+		return fmt.Errorf("协程: %v, 二分修复数据出错. %v", parallerTag, err)
+	}
+	targetCode, err := GetBisectRowsChecksumCode(targetHost, targetPort, bisectRange, table, false)
+	if err != nil {
+		return fmt.Errorf("协程: %v, 二分修复数据出错. %v", parallerTag, err)
+	}
+	if sourceCode == targetCode {
+		return nil
+	}
+
+	// 按行数多的一边进行拆分
+	sourceCount := matemap.GetChecksumCodeRowCount(sourceCode)
+	targetCount := matemap.GetChecksumCodeRowCount(targetCode)
+	isSource := sourceCount >= targetCount
+	rowCount := sourceCount
+	if !isSource {
+		rowCount = targetCount
+	}
+
+	// 2. 行数足够少, 取出两边所有的主键逐行比较修复
+	if rowCount <= this.Parser.ChecksumBisectRows || depth >= CHECKSUM_BISECT_MAX_DEPTH {
+		return this.bisectFixRows(bisectRange, table, parallerTag, diffRowCount)
+	}
+
+	// 3. 获取拆分点, 拆分成 [min, split) 和 [split, max] 两个范围
+	splitHost, splitPort := sourceHost, sourcePort
+	if !isSource {
+		splitHost, splitPort = targetHost, targetPort
+	}
+	splitValue, err := GetBisectSplitPKValue(splitHost, splitPort, bisectRange, table, isSource, rowCount/2)
+	if err != nil {
+		return fmt.Errorf("协程: %v, 二分修复数据出错. %v", parallerTag, err)
+	}
+	if splitValue == nil { // 比较期间数据被删除了, 直接逐行比较
+		return this.bisectFixRows(bisectRange, table, parallerTag, diffRowCount)
+	}
+
+	logger.M.Infof("协程: %v, 二分修复数据, 拆分不一致的范围. %v.%v. 深度: %v, 源行数: %v, 目标行数: %v. min: %v, max: %v, 拆分点: %v",
+		parallerTag, table.SourceSchema, table.SourceName, depth, sourceCount, targetCount, bisectRange.MinValue, bisectRange.MaxValue, splitValue)
+
+	leftRange := &BisectRange{MinValue: bisectRange.MinValue, MaxValue: splitValue, IsMaxExclusive: true}
+	if err := this.bisectFixRange(leftRange, table, parallerTag, depth+1, diffRowCount); err != nil {
+		return err
+	}
+	rightRange := &BisectRange{MinValue: splitValue, MaxValue: bisectRange.MaxValue, IsMaxExclusive: bisectRange.IsMaxExclusive}
+
+	return this.bisectFixRange(rightRange, table, parallerTag, depth+1, diffRowCount)
+}
+
+/* 取出范围中源和目标所有的主键, 逐行比较修复
+Params:
+	_bisectRange: 需要比较的范围
+	_table: 需要迁移的表
+	_parallerTag: 协程号
+	_diffRowCount: 记录不一致的行数
+*/
+func (this *Checksum) bisectFixRows(bisectRange *BisectRange, table *matemap.Table, parallerTag int, diffRowCount *DiffRowCount) error {
+	sourceRows, err := FindBisectPKRows(this.ConfigMap.Source.Host.String, int(this.ConfigMap.Source.Port.Int64), bisectRange, table, true)
+	if err != nil {
+		return fmt.Errorf("协程: %v, 二分修复数据出错. %v", parallerTag, err)
+	}
+	targetRows, err := FindBisectPKRows(this.ConfigMap.Target.Host.String, int(this.ConfigMap.Target.Port.Int64), bisectRange, table, false)
+	if err != nil {
+		return fmt.Errorf("协程: %v, 二分修复数据出错. %v", parallerTag, err)
+	}
+
+	for _, pkValues := range UnionPKRows(sourceRows, targetRows) {
+		if err := this.FixDiffRow(pkValues, table, parallerTag, diffRowCount); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/* 合并源和目标的主键值, 去掉重复的
+Params:
+	_sourceRows: 源的主键值
+	_targetRows: 目标的主键值
+*/
+func UnionPKRows(_sourceRows [][]interface{}, _targetRows [][]interface{}) [][]interface{} {
+	pkRows := make([][]interface{}, 0, len(_sourceRows)+len(_targetRows))
+	pkMap := make(map[string]bool)
+
+	for _, rows := range [][][]interface{}{_sourceRows, _targetRows} {
+		for _, row := range rows {
+			key := fmt.Sprintf("%v", row)
+			if pkMap[key] {
+				continue
+			}
+			pkMap[key] = true
+			pkRows = append(pkRows, row)
+		}
+	}
+
+	return pkRows
+}
+
+/* 获取二分范围多行数据的 checksum 值
+Params:
+	_host: 实例 host
+	_port: 实例 port
+	_bisectRange: 范围
+	_table: 需要迁移的表
+	_isSource: 是否是源实例
+*/
+func GetBisectRowsChecksumCode(host string, port int, bisectRange *BisectRange, table *matemap.Table, isSource bool) (string, error) {
+	var checksumCode sql.NullString
+
+	instance, ok := gdbc.GetDynamicDBByHostPort(host, int64(port))
+	if !ok {
+		return checksumCode.String, fmt.Errorf("缓存中不存在该实例(%v:%v). 获取二分范围多行checksum值", host, port)
+	}
+
+	checksumSql := table.GetBisectRowsChecksumSql(isSource, bisectRange.IsMaxExclusive)
+	if err := instance.QueryRow(checksumSql, bisectRange.GetMinMaxValueSlice()...).Scan(&checksumCode); err != nil {
+		return checksumCode.String, fmt.Errorf("失败. 获取二分范围多行checksum值. %v.%v. %v:%v. min:%v, max:%v. %v",
+			table.SourceSchema, table.SourceName, host, port, bisectRange.MinValue, bisectRange.MaxValue, err)
+	}
+
+	return checksumCode.String, nil
+}
+
+/* 获取二分范围中所有的主键值
+Params:
+	_host: 实例 host
+	_port: 实例 port
+	_bisectRange: 范围
+	_table: 需要迁移的表
+	_isSource: 是否是源实例
+*/
+func FindBisectPKRows(host string, port int, bisectRange *BisectRange, table *matemap.Table, isSource bool) ([][]interface{}, error) {
+	instance, ok := gdbc.GetDynamicDBByHostPort(host, int64(port))
+	if !ok {
+		return nil, fmt.Errorf("缓存中不存在该实例(%v:%v). 获取二分范围所有主键值", host, port)
+	}
+
+	pkSql := table.GetBisectPKSql(isSource, bisectRange.IsMaxExclusive)
+	rows, err := instance.Query(pkSql, bisectRange.GetMinMaxValueSlice()...)
+	if err != nil {
+		return nil, fmt.Errorf("失败. 获取二分范围所有主键值. %v. %v:%v. %v", pkSql, host, port, err)
+	}
+	defer rows.Close()
+
+	rs, err := helper.GetRows(rows)
+	if err != nil {
+		return nil, fmt.Errorf("失败. 获取二分范围所有主键值. %v:%v. %v", host, port, err)
+	}
+
+	return rs, nil
+}
+
+/* 获取二分范围中第 offset 行的主键值, 作为拆分点. 没有该行返回 nil
+Params:
+	_host: 实例 host
+	_port: 实例 port
+	_bisectRange: 范围
+	_table: 需要迁移的表
+	_isSource: 是否是源实例
+	_offset: 第几行, 从 0 开始
+*/
+func GetBisectSplitPKValue(host string, port int, bisectRange *BisectRange, table *matemap.Table, isSource bool, offset int) ([]interface{}, error) {
+	instance, ok := gdbc.GetDynamicDBByHostPort(host, int64(port))
+	if !ok {
+		return nil, fmt.Errorf("缓存中不存在该实例(%v:%v). 获取二分范围拆分点", host, port)
+	}
+
+	splitSql := table.GetBisectSplitPKSql(isSource, bisectRange.IsMaxExclusive, offset)
+	rows, err := instance.Query(splitSql, bisectRange.GetMinMaxValueSlice()...)
+	if err != nil {
+		return nil, fmt.Errorf("失败. 获取二分范围拆分点. %v. %v:%v. %v", splitSql, host, port, err)
+	}
+	defer rows.Close()
+
+	row, err := helper.GetRow(rows)
+	if err != nil {
+		return nil, fmt.Errorf("失败. 获取二分范围拆分点. %v:%v. %v", host, port, err)
+	}
+
+	return row, nil
+}
@@ -0,0 +1,40 @@
+package mysqlchecksum
+
+import (
+	"github.com/daiguadaidai/go-d-bus/matemap"
+	"testing"
+)
+
+func TestChecksum_FixDiffRowsBisect_TargetOnlyRow(t *testing.T) {
+	table := newFakeTable(t)
+	checksum, _, target := newFakeChecksum(t, table,
+		map[int64]string{1: "a", 2: "b", 3: "c", 5: "e", 6: "f"},
+		map[int64]string{1: "a", 2: "b", 3: "c", 4: "d", 5: "x", 6: "f"})
+
+	// id=4 只在目标存在, id=5 数据不一致
+	primaryRangeValue := matemap.NewPrimaryRangeValue(table.SourceSchema, table.SourceName,
+		map[string]interface{}{"id": 1}, map[string]interface{}{"id": 6}, nil)
+	isConsistent, diffRowCount, err := checksum.FixDiffRange(primaryRangeValue, table, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if isConsistent {
+		t.Fatal("修复前范围数据期望不一致")
+	}
+
+	if diffRowCount.MissingRows != 0 || diffRowCount.ExtraRows != 1 || diffRowCount.DiffRows != 1 {
+		t.Fatalf("期望目标多出 1 行, 数据不一致 1 行, 实际 %+v", diffRowCount)
+	}
+	rows := target.Rows()
+	if _, ok := rows[4]; ok || len(rows) != 5 || rows[5] != "e" {
+		t.Fatalf("修复后目标数据期望和源一样, 实际 %v", rows)
+	}
+
+	isConsistent, err = checksum.RowsChecksum(primaryRangeValue, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isConsistent {
+		t.Fatal("修复后范围数据期望一致")
+	}
+}
@@ -0,0 +1,209 @@
+package mysqlchecksum
+
+import (
+	"fmt"
+	"github.com/daiguadaidai/go-d-bus/dao/daohelper"
+	"github.com/daiguadaidai/go-d-bus/gdbc"
+	"github.com/daiguadaidai/go-d-bus/logger"
+	"github.com/daiguadaidai/go-d-bus/matemap"
+	"github.com/daiguadaidai/go-d-bus/model"
+	"time"
+)
+
+// 一个表源和目标的最小和最大主键值, 以及目标超出源主键范围的范围
+type TableBoundary struct {
+	Schema string
+	Table  string
+
+	SourceMin map[string]interface{} // 源最小主键值, 表没有数据为 nil
+	SourceMax map[string]interface{} // 源最大主键值, 表没有数据为 nil
+	TargetMin map[string]interface{} // 目标最小主键值, 表没有数据为 nil
+	TargetMax map[string]interface{} // 目标最大主键值, 表没有数据为 nil
+
+	ExtraRanges []*matemap.PrimaryRangeValue // 目标超出源主键范围的范围, 需要修复
+}
+
+// 源和目标的最小和最大主键值是否一样
+func (this *TableBoundary) IsConsistent(table *matemap.Table) bool {
+	return isPKMapEqual(this.SourceMin, this.TargetMin, table) && isPKMapEqual(this.SourceMax, this.TargetMax, table)
+}
+
+/* 比较一个表源和目标的最小和最大主键值.
+主键范围都是从源表生成的, 目标中小于源最小主键值或者大于源最大主键值的行不会被任何范围校验到,
+这些行组成的范围(包含源的最小或最大主键值)会被当做不一致的范围进行修复.
+源比目标多出的行在源的主键范围之内, 会被按范围校验到
+Params:
+	_tableName: 需要校验的表 schema.table
+*/
+func (this *Checksum) CheckTableBoundary(tableName string) (*TableBoundary, error) {
+	table, err := matemap.GetMigrationTable(tableName)
+	if err != nil {
+		return nil, fmt.Errorf("失败. 比较源和目标的最小和最大主键值. %v", err)
+	}
+
+	boundary := &TableBoundary{
+		Schema:      table.SourceSchema,
+		Table:       table.SourceName,
+		ExtraRanges: make([]*matemap.PrimaryRangeValue, 0, 2),
+	}
+
+	// 没有主键的表是整表校验, 不需要比较主键值
+	if table.NoUniqueKey {
+		return boundary, nil
+	}
+
+	sourceHost, sourcePort := this.ConfigMap.Source.Host.String, int(this.ConfigMap.Source.Port.Int64)
+	targetHost, targetPort := this.ConfigMap.Target.Host.String, int(this.ConfigMap.Target.Port.Int64)
+
+	// 1. 获取源和目标的最小和最大主键值
+	if boundary.SourceMin, err = GetBoundaryPKMap(sourceHost, sourcePort, table, table.GetBoundaryPKSql(true, false)); err != nil {
+		return nil, err
+	}
+	if boundary.SourceMax, err = GetBoundaryPKMap(sourceHost, sourcePort, table, table.GetBoundaryPKSql(true, true)); err != nil {
+		return nil, err
+	}
+	if boundary.TargetMin, err = GetBoundaryPKMap(targetHost, targetPort, table, table.GetBoundaryPKSql(false, false)); err != nil {
+		return nil, err
+	}
+	if boundary.TargetMax, err = GetBoundaryPKMap(targetHost, targetPort, table, table.GetBoundaryPKSql(false, true)); err != nil {
+		return nil, err
+	}
+
+	if boundary.IsConsistent(table) {
+		return boundary, nil
+	}
+	logger.M.Warnf("源和目标的最小和最大主键值不一样. %v.%v. 源 min: %v, max: %v. 目标 min: %v, max: %v",
+		table.SourceSchema, table.SourceName, boundary.SourceMin, boundary.SourceMax, boundary.TargetMin, boundary.TargetMax)
+
+	// 2. 目标没有数据, 源多出的行会被按范围校验到
+	if boundary.TargetMin == nil {
+		return boundary, nil
+	}
+
+	// 3. 源没有数据, 目标所有的行都是多出的
+	if boundary.SourceMin == nil {
+		boundary.ExtraRanges = append(boundary.ExtraRanges, matemap.NewPrimaryRangeValue(table.SourceSchema, table.SourceName,
+			boundary.TargetMin, boundary.TargetMax, boundary.TargetMax))
+		return boundary, nil
+	}
+
+	// 4. 目标中小于源最小主键值, 以及大于源最大主键值的行
+	pkColumnNames := table.FindSourcePKColumnNames()
+	before, err := GetBoundaryPKMap(targetHost, targetPort, table, table.GetTargetOutOfBoundaryPKSql(false),
+		getPKMapValues(boundary.SourceMin, pkColumnNames)...)
+	if err != nil {
+		return nil, err
+	}
+	if before != nil {
+		boundary.ExtraRanges = append(boundary.ExtraRanges, matemap.NewPrimaryRangeValue(table.SourceSchema, table.SourceName,
+			before, boundary.SourceMin, boundary.SourceMin))
+	}
+
+	after, err := GetBoundaryPKMap(targetHost, targetPort, table, table.GetTargetOutOfBoundaryPKSql(true),
+		getPKMapValues(boundary.SourceMax, pkColumnNames)...)
+	if err != nil {
+		return nil, err
+	}
+	if after != nil {
+		boundary.ExtraRanges = append(boundary.ExtraRanges, matemap.NewPrimaryRangeValue(table.SourceSchema, table.SourceName,
+			boundary.SourceMax, after, after))
+	}
+
+	return boundary, nil
+}
+
+/* 比较多个表源和目标的最小和最大主键值, 目标超出源主键范围的范围保存为不一致记录, 失败会重试
+Params:
+	_tableNames: 需要校验的表 schema.table
+	_handle: 处理保存好的不一致范围和记录
+*/
+func (this *Checksum) CheckTablesBoundary(tableNames []string, handle func(*matemap.PrimaryRangeValue, *model.DataChecksum)) error {
+	for _, tableName := range tableNames {
+		var boundary *TableBoundary
+		var err error
+		startTime := time.Now()
+		for i := 0; i < this.Parser.ErrRetryCount; i++ {
+			if boundary, err = this.CheckTableBoundary(tableName); err == nil {
+				break
+			}
+			logger.M.Error(err)
+			time.Sleep(time.Second)
+		}
+		if err != nil {
+			return fmt.Errorf("比较源和目标的最小和最大主键值失败, 并且重试次数已经达到上线:%v. %v. %v", this.Parser.ErrRetryCount, tableName, err)
+		}
+		if len(boundary.ExtraRanges) == 0 {
+			continue
+		}
+
+		for _, primaryRangeValue := range boundary.ExtraRanges {
+			var diffRecord *model.DataChecksum
+			for i := 0; i < this.Parser.ErrRetryCount; i++ {
+				if diffRecord, err = CreateDiffRecord(this.ConfigMap.TaskUUID, primaryRangeValue); err == nil {
+					break
+				}
+				logger.M.Error(err)
+				time.Sleep(time.Second)
+			}
+			if err != nil {
+				return fmt.Errorf("保存目标超出源主键范围的不一致记录失败, 并且重试次数已经达到上线:%v. %v. %v", this.Parser.ErrRetryCount, tableName, err)
+			}
+
+			logger.M.Warnf("目标中存在超出源主键范围的数据, 需要修复. %v.%v. min: %v, max: %v",
+				primaryRangeValue.Schema, primaryRangeValue.Table, primaryRangeValue.MinValue, primaryRangeValue.MaxValue)
+			handle(primaryRangeValue, diffRecord)
+		}
+
+		this.IncrTableStat(boundary.Schema, boundary.Table, int64(len(boundary.ExtraRanges)), int64(len(boundary.ExtraRanges)), 0, time.Since(startTime), 0)
+	}
+
+	return nil
+}
+
+/* 获取一个主键值, 使用源的主键字段名和类型, 没有数据返回 nil
+Params:
+	_host: 实例host
+	_port: 实例端口
+	_table: 需要迁移的表
+	_selectSql: 查询主键值的 sql
+	_args: sql 占位符的值
+*/
+func GetBoundaryPKMap(host string, port int, table *matemap.Table, selectSql string, args ...interface{}) (map[string]interface{}, error) {
+	instance, ok := gdbc.GetDynamicDBByHostPort(host, int64(port))
+	if !ok {
+		return nil, fmt.Errorf("缓存中不存在该实例(%v:%v). 获取表 %v.%v 的边界主键值", host, port, table.SourceSchema, table.SourceName)
+	}
+
+	row := instance.QueryRow(selectSql, args...)
+	pkMap, err := daohelper.Row2Map(row, table.FindSourcePKColumnNames(), table.FindSourcePKColumnTypes())
+	if err != nil {
+		return nil, fmt.Errorf("失败. 获取表的边界主键值. %v:%v. %v. %v", host, port, selectSql, err)
+	}
+
+	return pkMap, nil
+}
+
+// 按主键字段的顺序获取主键值, 用于 sql 语句中的占位符
+func getPKMapValues(pkMap map[string]interface{}, pkColumnNames []string) []interface{} {
+	values := make([]interface{}, 0, len(pkColumnNames))
+	for _, pkColumnName := range pkColumnNames {
+		values = append(values, pkMap[pkColumnName])
+	}
+
+	return values
+}
+
+// 比较两个主键值是否一样, 源和目标主键类型不一样(如: INT 和 BIGINT UNSIGNED)时也一样
+func isPKMapEqual(pkMap1 map[string]interface{}, pkMap2 map[string]interface{}, table *matemap.Table) bool {
+	if pkMap1 == nil || pkMap2 == nil {
+		return pkMap1 == nil && pkMap2 == nil
+	}
+
+	for _, pkColumnName := range table.FindSourcePKColumnNames() {
+		if matemap.GetChecksumValueString(pkMap1[pkColumnName]) != matemap.GetChecksumValueString(pkMap2[pkColumnName]) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,71 @@
+package mysqlchecksum
+
+import (
+	"github.com/daiguadaidai/go-d-bus/config"
+	"testing"
+)
+
+func TestChecksum_CheckTableBoundary_FixExtraRange(t *testing.T) {
+	table := newFakeTable(t)
+	checksum, _, target := newFakeChecksum(t, table,
+		map[int64]string{2: "b", 3: "c"},
+		map[int64]string{1: "a", 2: "b", 3: "c", 9: "i"})
+
+	// id=1 小于源最小主键值, id=9 大于源最大主键值, 不会被源生成的范围校验到
+	boundary, err := checksum.CheckTableBoundary(config.GetTableKey(table.SourceSchema, table.SourceName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if boundary.IsConsistent(table) {
+		t.Fatal("源和目标的最小和最大主键值期望不一样")
+	}
+	if len(boundary.ExtraRanges) != 2 {
+		t.Fatalf("期望目标超出源主键范围的范围有 2 个, 实际 %v", len(boundary.ExtraRanges))
+	}
+
+	for _, primaryRangeValue := range boundary.ExtraRanges {
+		isConsistent, diffRowCount, err := checksum.FixDiffRange(primaryRangeValue, table, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if isConsistent {
+			t.Fatalf("修复前范围数据期望不一致. min: %v, max: %v", primaryRangeValue.MinValue, primaryRangeValue.MaxValue)
+		}
+		if diffRowCount.ExtraRows != 1 || diffRowCount.MissingRows != 0 || diffRowCount.DiffRows != 0 {
+			t.Fatalf("期望目标多出 1 行, 实际 %+v", diffRowCount)
+		}
+	}
+
+	rows := target.Rows()
+	if len(rows) != 2 || rows[2] != "b" || rows[3] != "c" {
+		t.Fatalf("修复后目标数据期望 map[2:b 3:c], 实际 %v", rows)
+	}
+
+	boundary, err = checksum.CheckTableBoundary(config.GetTableKey(table.SourceSchema, table.SourceName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !boundary.IsConsistent(table) || len(boundary.ExtraRanges) != 0 {
+		t.Fatalf("修复后源和目标的最小和最大主键值期望一样, 实际 %+v", boundary)
+	}
+}
+
+func TestChecksum_CheckTableBoundary_EmptySource(t *testing.T) {
+	table := newFakeTable(t)
+	checksum, _, _ := newFakeChecksum(t, table,
+		map[int64]string{},
+		map[int64]string{4: "d", 7: "g"})
+
+	// 源表没有数据不会生成任何范围, 目标所有的行都是多出的
+	boundary, err := checksum.CheckTableBoundary(config.GetTableKey(table.SourceSchema, table.SourceName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(boundary.ExtraRanges) != 1 {
+		t.Fatalf("期望目标超出源主键范围的范围有 1 个, 实际 %v", len(boundary.ExtraRanges))
+	}
+	primaryRangeValue := boundary.ExtraRanges[0]
+	if primaryRangeValue.MinValue["id"] != boundary.TargetMin["id"] || primaryRangeValue.MaxValue["id"] != boundary.TargetMax["id"] {
+		t.Fatalf("期望范围是目标的最小和最大主键值, 实际 min: %v, max: %v", primaryRangeValue.MinValue, primaryRangeValue.MaxValue)
+	}
+}
@@ -0,0 +1,163 @@
+package mysqlchecksum
+
+import (
+	"fmt"
+	"github.com/daiguadaidai/go-d-bus/common"
+	"github.com/daiguadaidai/go-d-bus/gdbc"
+	"github.com/daiguadaidai/go-d-bus/logger"
+	"github.com/daiguadaidai/go-d-bus/matemap"
+	"github.com/daiguadaidai/go-d-bus/service/helper"
+	"strings"
+)
+
+/* 规范化后的多行 checksum 还是不一致时, 在Go中逐行比较源和目标范围中的数据
+源和目标字段类型不一样(如: INT 和 BIGINT, DATETIME 和 DATETIME(3), FLOAT 和 DOUBLE)时,
+sql 拼接出的字符串可能不一样, 在Go中按源字段的类型宽容的比较
+Params:
+	_primaryRangeValue: 数据范围
+	_table: 需要迁移的表
+	_parallerTag: 协程号
+Return: 是否一致
+*/
+func (this *Checksum) GoCompareRange(primaryRangeValue *matemap.PrimaryRangeValue, table *matemap.Table, parallerTag int) (bool, error) {
+	pkIndexes, err := findUsefulPKIndexes(table)
+	if err != nil {
+		return false, fmt.Errorf("checksum 协程 %v. 在Go中比较数据. %v", parallerTag, err)
+	}
+
+	sourceRows, err := FindRangeRows(this.ConfigMap.Source.Host.String, int(this.ConfigMap.Source.Port.Int64), primaryRangeValue, table, true)
+	if err != nil {
+		return false, fmt.Errorf("checksum 协程 %v. 在Go中比较数据. %v", parallerTag, err)
+	}
+	targetRows, err := FindRangeRows(this.ConfigMap.Target.Host.String, int(this.ConfigMap.Target.Port.Int64), primaryRangeValue, table, false)
+	if err != nil {
+		return false, fmt.Errorf("checksum 协程 %v. 在Go中比较数据. %v", parallerTag, err)
+	}
+	if len(sourceRows) != len(targetRows) {
+		return false, nil
+	}
+
+	// 通过主键值找到目标对应的行
+	targetRowMap := make(map[string][]interface{}, len(targetRows))
+	for _, targetRow := range targetRows {
+		targetRowMap[getRowPKKey(targetRow, pkIndexes)] = targetRow
+	}
+
+	for _, sourceRow := range sourceRows {
+		targetRow, ok := targetRowMap[getRowPKKey(sourceRow, pkIndexes)]
+		if !ok {
+			return false, nil
+		}
+
+		isConsistent, columnName, err := table.CompareChecksumRow(sourceRow, targetRow)
+		if err != nil {
+			return false, fmt.Errorf("checksum 协程 %v. 在Go中比较数据. %v.%v. %v", parallerTag, table.SourceSchema, table.SourceName, err)
+		}
+		if !isConsistent {
+			logger.M.Infof("checksum 协程%v. 在Go中比较数据也不一致. %v.%v. 字段: %v. 源: %v, 目标: %v",
+				parallerTag, table.SourceSchema, table.SourceName, columnName, common.ToJsonStr(sourceRow), common.ToJsonStr(targetRow))
+			return false, nil
+		}
+	}
+
+	logger.M.Infof("checksum 协程%v. checksum 不一致, 但在Go中比较数据一致, 可能是源和目标字段类型不一样. %v.%v. min:%v, max:%v",
+		parallerTag, primaryRangeValue.Schema, primaryRangeValue.Table, primaryRangeValue.MinValue, primaryRangeValue.MaxValue)
+
+	return true, nil
+}
+
+/* 规范化后的单行 checksum 不一致时, 在Go中比较源和目标该行的数据, 一致就不需要修复
+Params:
+	_pkValues: 该行的主键值
+	_table: 需要迁移的表
+	_parallerTag: 协程号
+Return: 是否一致
+*/
+func (this *Checksum) GoCompareRow(pkValues []interface{}, table *matemap.Table, parallerTag int) (bool, error) {
+	sourceRow, err := GetSourceRowByPK(this.ConfigMap.Source.Host.String, int(this.ConfigMap.Source.Port.Int64), pkValues, table)
+	if err != nil {
+		return false, fmt.Errorf("协程: %v, 在Go中比较数据. %v", parallerTag, err)
+	}
+	targetRow, err := GetTargetRowByPK(this.ConfigMap.Target.Host.String, int(this.ConfigMap.Target.Port.Int64), pkValues, table)
+	if err != nil {
+		return false, fmt.Errorf("协程: %v, 在Go中比较数据. %v", parallerTag, err)
+	}
+	if sourceRow == nil || targetRow == nil {
+		return sourceRow == nil && targetRow == nil, nil
+	}
+
+	isConsistent, _, err := table.CompareChecksumRow(sourceRow, targetRow)
+	if err != nil {
+		return false, fmt.Errorf("协程: %v, 在Go中比较数据. %v.%v. Primary: %v. %v", parallerTag, table.SourceSchema, table.SourceName, pkValues, err)
+	}
+	if isConsistent {
+		logger.M.Infof("协程: %v, checksum 不一致, 但在Go中比较数据一致, 不需要修复. %v.%v. Primary: %v",
+			parallerTag, table.SourceSchema, table.SourceName, pkValues)
+	}
+
+	return isConsistent, nil
+}
+
+/* 获取源或目标主键范围中的所有行(需要迁移的字段)
+Param:
+	_host: 实例host
+	_port: 实例端口
+	_primaryRangeValue 主键范围值
+	_table 需要迁移的表元数据
+	_isSource: 是否是源
+*/
+func FindRangeRows(host string, port int, primaryRangeValue *matemap.PrimaryRangeValue, table *matemap.Table, isSource bool) ([][]interface{}, error) {
+	instance, ok := gdbc.GetDynamicDBByHostPort(host, int64(port))
+	if !ok {
+		return nil, fmt.Errorf("缓存中不存在该实例(%v:%v). 获取范围中所有行", host, port)
+	}
+
+	selectSql := table.GetSelPerBatchSqlTpl()
+	if !isSource {
+		selectSql = table.GetSelPerBatchTargetSqlTpl()
+	}
+
+	// 获取范围值, 用于sql语句中的占位符
+	minMaxValue := primaryRangeValue.GetMinMaxValueSlice(table.FindSourcePKColumnNames())
+	rows, err := instance.Query(selectSql, minMaxValue...)
+	if err != nil {
+		return nil, fmt.Errorf("查询范围中所有行失败. %v. %v", selectSql, err)
+	}
+	defer rows.Close()
+
+	rs, err := helper.GetRows(rows)
+	if err != nil {
+		return nil, fmt.Errorf("获取范围中所有行出错. %v.", err)
+	}
+
+	return rs, nil
+}
+
+// 获取主键字段在需要迁移的字段中的位置
+func findUsefulPKIndexes(table *matemap.Table) ([]int, error) {
+	usefulIndexMap := make(map[string]int)
+	for i, columnName := range table.FindUsefulColumnNames() {
+		usefulIndexMap[columnName] = i
+	}
+
+	pkIndexes := make([]int, 0, 1)
+	for _, pkColumnName := range table.FindSourcePKColumnNames() {
+		index, ok := usefulIndexMap[pkColumnName]
+		if !ok {
+			return nil, fmt.Errorf("主键字段 %v 不是需要迁移的字段. %v.%v", pkColumnName, table.SourceSchema, table.SourceName)
+		}
+		pkIndexes = append(pkIndexes, index)
+	}
+
+	return pkIndexes, nil
+}
+
+// 获取一行数据的主键值组成的 key, 源和目标主键类型不一样(如: INT 和 BIGINT UNSIGNED)时也一样
+func getRowPKKey(row []interface{}, pkIndexes []int) string {
+	pkValueStrs := make([]string, len(pkIndexes))
+	for i, pkIndex := range pkIndexes {
+		pkValueStrs[i] = matemap.GetChecksumValueString(row[pkIndex])
+	}
+
+	return strings.Join(pkValueStrs, "\x00")
+}
@@ -0,0 +1,64 @@
+package mysqlchecksum
+
+import (
+	"github.com/daiguadaidai/go-d-bus/logger"
+	"github.com/daiguadaidai/go-d-bus/matemap"
+	"github.com/daiguadaidai/go-d-bus/service/mysqlrowcopy"
+	"time"
+)
+
+/* 生成一个表所有的主键范围, 每个范围的行数和 row copy 一样. 没有主键的表整表作为一个范围
+Params:
+	_tableName: 表名 schema.table
+	_handle: 处理每一个生成的主键范围
+*/
+func (this *Checksum) GenerateTablePrimaryRangeValues(tableName string, handle func(*matemap.PrimaryRangeValue)) error {
+	table, err := matemap.GetMigrationTable(tableName)
+	if err != nil {
+		return err
+	}
+
+	if table.NoUniqueKey {
+		handle(matemap.NewPrimaryRangeValue(table.SourceSchema, table.SourceName,
+			map[string]interface{}{}, map[string]interface{}{}, nil))
+		return nil
+	}
+
+	host := this.ConfigMap.Source.Host.String
+	port := int(this.ConfigMap.Source.Port.Int64)
+
+	firstPrimaryMap, err := mysqlrowcopy.GetTableFirstPrimaryMap(host, port, table.SourceSchema, table.SourceName)
+	if err != nil {
+		return err
+	}
+	if len(firstPrimaryMap) == 0 {
+		logger.M.Warnf("警告. 源表没有数据, 不需要按范围校验, 目标中的数据在比较最小和最大主键值时检查. %v", tableName)
+		return nil
+	}
+
+	currPrimaryRangeValue := matemap.NewPrimaryRangeValue(table.SourceSchema, table.SourceName, firstPrimaryMap, firstPrimaryMap, firstPrimaryMap)
+	errRetryCount := 0
+	for {
+		nextPrimaryRangeValue, err := currPrimaryRangeValue.GetNextPrimaryRangeValue(this.Parser.RowCopyLimit, host, port)
+		if err != nil {
+			errRetryCount++
+			if errRetryCount > this.Parser.ErrRetryCount {
+				return err
+			}
+			logger.M.Errorf("错误. checksum 生成表的下一个主键范围, 重试第%v次. %v. %v", errRetryCount, tableName, err)
+			time.Sleep(time.Second)
+			continue
+		}
+		errRetryCount = 0
+
+		// 该表的主键范围已经生成完
+		if nextPrimaryRangeValue == nil {
+			logger.M.Infof("完成. 表的主键范围已经生成完. %v. 最后一个范围 min: %v, max: %v",
+				tableName, currPrimaryRangeValue.MinValue, currPrimaryRangeValue.MaxValue)
+			return nil
+		}
+
+		handle(nextPrimaryRangeValue)
+		currPrimaryRangeValue = nextPrimaryRangeValue
+	}
+}
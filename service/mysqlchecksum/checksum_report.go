@@ -0,0 +1,261 @@
+package mysqlchecksum
+
+import (
+	"fmt"
+	"github.com/daiguadaidai/go-d-bus/common"
+	"github.com/daiguadaidai/go-d-bus/config"
+	"github.com/daiguadaidai/go-d-bus/dao"
+	"github.com/daiguadaidai/go-d-bus/gdbc"
+	"github.com/daiguadaidai/go-d-bus/matemap"
+	"github.com/go-sql-driver/mysql"
+	"sort"
+	"time"
+)
+
+const (
+	REPORT_TIME_LAYOUT     = "2006-01-02 15:04:05"
+	REPORT_ROW_COUNT_UNSET = -1 // 没有统计表的行数
+)
+
+// 一个表的 checksum 报告
+type TableReport struct {
+	SourceSchema string `json:"source_schema"`
+	SourceTable  string `json:"source_table"`
+	TargetSchema string `json:"target_schema"`
+	TargetTable  string `json:"target_table"`
+
+	SourceRows int64 `json:"source_rows"` // 源表行数, 没有统计为 -1
+	TargetRows int64 `json:"target_rows"` // 目标表行数, 没有统计为 -1
+
+	RowCopyChunkCount int64 `json:"row_copy_chunk_count"` // row copy 的 chunk 数
+	RowCopyElapsedMs  int64 `json:"row_copy_elapsed_ms"`  // row copy 的耗时(毫秒)
+
+	ChunkCount       int64 `json:"chunk_count"`        // 第一次校验的范围数
+	DiffChunkCount   int64 `json:"diff_chunk_count"`   // 第一次校验(包含滚动校验)不一致的范围数
+	FixedChunkCount  int64 `json:"fixed_chunk_count"`  // 修复或再次校验后一致的范围数
+	RemainChunkCount int64 `json:"remain_chunk_count"` // 还没有修复的范围数
+
+	MissingRows int64 `json:"missing_rows"` // 修复时发现目标缺少的行数
+	ExtraRows   int64 `json:"extra_rows"`   // 修复时发现目标多出的行数
+	DiffRows    int64 `json:"diff_rows"`    // 修复时发现数据不一致的行数
+
+	ChecksumElapsedMs int64  `json:"checksum_elapsed_ms"` // 多行校验的耗时(毫秒)
+	FixElapsedMs      int64  `json:"fix_elapsed_ms"`      // 修复数据的耗时(毫秒)
+	ChecksumStartedAt string `json:"checksum_started_at"` // 第一次保存统计的时间
+	ChecksumUpdatedAt string `json:"checksum_updated_at"` // 最后一次保存统计的时间
+}
+
+// 表的行数是否一致, 没有统计行数当做一致
+func (this *TableReport) IsRowCountConsistent() bool {
+	return this.SourceRows == this.TargetRows
+}
+
+// 还没有修复的不一致范围
+type ReportDiffRange struct {
+	SourceSchema string `json:"source_schema"`
+	SourceTable  string `json:"source_table"`
+	MinValue     string `json:"min_value"`
+	MaxValue     string `json:"max_value"`
+	CreatedAt    string `json:"created_at"`
+}
+
+// 不一致数据的样例
+type ReportDiffRow struct {
+	SourceSchema string `json:"source_schema"`
+	SourceTable  string `json:"source_table"`
+	DiffType     string `json:"diff_type"` // missing, extra, diff
+	PKValue      string `json:"pk_value"`
+	SourceRow    string `json:"source_row"` // 修复前源的数据, json
+	TargetRow    string `json:"target_row"` // 修复前目标的数据, json
+	CreatedAt    string `json:"created_at"`
+}
+
+// 任务的 checksum 报告, 用于附加到切换工单
+type ChecksumReport struct {
+	TaskUUID    string `json:"task_uuid"`
+	GeneratedAt string `json:"generated_at"`
+
+	Tables           []*TableReport     `json:"tables"`
+	RemainDiffRanges []*ReportDiffRange `json:"remain_diff_ranges"`
+	DiffRowSamples   []*ReportDiffRow   `json:"diff_row_samples"`
+}
+
+// 所有的表是否都一致: 没有未修复的范围, 并且行数一致
+func (this *ChecksumReport) IsConsistent() bool {
+	if len(this.RemainDiffRanges) > 0 {
+		return false
+	}
+	for _, tableReport := range this.Tables {
+		if !tableReport.IsRowCountConsistent() {
+			return false
+		}
+	}
+
+	return true
+}
+
+/* 通过元数据库中保存的 row copy chunk, checksum 统计, 不一致记录和不一致数据样例生成任务的报告
+Params:
+	_configMap: 配置信息
+	_countRows: 是否 SELECT COUNT(*) 获取源和目标表的行数
+*/
+func NewChecksumReport(configMap *config.ConfigMap, countRows bool) (*ChecksumReport, error) {
+	report := &ChecksumReport{
+		TaskUUID:         configMap.TaskUUID,
+		GeneratedAt:      time.Now().Format(REPORT_TIME_LAYOUT),
+		Tables:           make([]*TableReport, 0, 1),
+		RemainDiffRanges: make([]*ReportDiffRange, 0, 1),
+		DiffRowSamples:   make([]*ReportDiffRow, 0, 1),
+	}
+
+	// 1. 所有需要迁移的表, 按表名排序
+	tableNames := make([]string, 0, 1)
+	for tableName, _ := range matemap.FindAllMigrationTableNameMap() {
+		tableNames = append(tableNames, tableName)
+	}
+	sort.Strings(tableNames)
+
+	tableReportMap := make(map[string]*TableReport, len(tableNames))
+	for _, tableName := range tableNames {
+		table, err := matemap.GetMigrationTable(tableName)
+		if err != nil {
+			return nil, fmt.Errorf("失败. 生成报告. %v", err)
+		}
+
+		tableReport := &TableReport{
+			SourceSchema: table.SourceSchema,
+			SourceTable:  table.SourceName,
+			TargetSchema: table.TargetSchema,
+			TargetTable:  table.TargetName,
+			SourceRows:   REPORT_ROW_COUNT_UNSET,
+			TargetRows:   REPORT_ROW_COUNT_UNSET,
+		}
+		if countRows {
+			if tableReport.SourceRows, err = GetTableRowCount(configMap.Source.Host.String, int(configMap.Source.Port.Int64),
+				table.SourceSchema, table.SourceName); err != nil {
+				return nil, err
+			}
+			if tableReport.TargetRows, err = GetTableRowCount(configMap.Target.Host.String, int(configMap.Target.Port.Int64),
+				table.TargetSchema, table.TargetName); err != nil {
+				return nil, err
+			}
+		}
+
+		report.Tables = append(report.Tables, tableReport)
+		tableReportMap[tableName] = tableReport
+	}
+
+	// 2. row copy 的 chunk 数和耗时
+	rowCopyChunkDao := new(dao.RowCopyChunkDao)
+	rowCopyChunks, err := rowCopyChunkDao.FindByTaskUUID(configMap.TaskUUID)
+	if err != nil {
+		return nil, fmt.Errorf("失败. 生成报告, 获取 row copy chunk. %v", err)
+	}
+	for _, rowCopyChunk := range rowCopyChunks {
+		tableReport, ok := tableReportMap[common.FormatTableName(rowCopyChunk.Schema.String, rowCopyChunk.Source.String, "")]
+		if !ok {
+			continue
+		}
+		tableReport.RowCopyChunkCount++
+		tableReport.RowCopyElapsedMs += rowCopyChunk.ElapsedMs.Int64
+	}
+
+	// 3. checksum 的统计
+	checksumTableStatDao := new(dao.ChecksumTableStatDao)
+	stats, err := checksumTableStatDao.FindByTaskUUID(configMap.TaskUUID)
+	if err != nil {
+		return nil, fmt.Errorf("失败. 生成报告, 获取 checksum 统计. %v", err)
+	}
+	for _, stat := range stats {
+		tableReport, ok := tableReportMap[common.FormatTableName(stat.Schema.String, stat.Table.String, "")]
+		if !ok {
+			continue
+		}
+		tableReport.ChunkCount = stat.ChunkCount.Int64
+		tableReport.DiffChunkCount = stat.DiffChunkCount.Int64
+		tableReport.FixedChunkCount = stat.FixedChunkCount.Int64
+		tableReport.ChecksumElapsedMs = stat.ChecksumElapsedMs.Int64
+		tableReport.FixElapsedMs = stat.FixElapsedMs.Int64
+		tableReport.ChecksumStartedAt = formatReportTime(stat.CreatedAt)
+		tableReport.ChecksumUpdatedAt = formatReportTime(stat.UpdatedAt)
+	}
+
+	// 4. 不一致记录, 累加修复时发现的行数, 没有修复的是剩下的不一致范围
+	dataChecksumDao := new(dao.DataChecksumDao)
+	records, err := dataChecksumDao.FindByTaskUUID(configMap.TaskUUID, "*")
+	if err != nil {
+		return nil, fmt.Errorf("失败. 生成报告, 获取不一致记录. %v", err)
+	}
+	for _, record := range records {
+		tableReport, ok := tableReportMap[common.FormatTableName(record.SourceSchema.String, record.SourceTable.String, "")]
+		if !ok {
+			continue
+		}
+		tableReport.MissingRows += record.MissingRows.Int64
+		tableReport.ExtraRows += record.ExtraRows.Int64
+		tableReport.DiffRows += record.DiffRows.Int64
+
+		if record.IsFix.Int64 != 0 {
+			continue
+		}
+		tableReport.RemainChunkCount++
+		report.RemainDiffRanges = append(report.RemainDiffRanges, &ReportDiffRange{
+			SourceSchema: record.SourceSchema.String,
+			SourceTable:  record.SourceTable.String,
+			MinValue:     record.MinIDValue.String,
+			MaxValue:     record.MaxIDValue.String,
+			CreatedAt:    formatReportTime(record.CreatedAt),
+		})
+	}
+
+	// 5. 不一致数据的样例
+	checksumDiffRowDao := new(dao.ChecksumDiffRowDao)
+	diffRows, err := checksumDiffRowDao.FindByTaskUUID(configMap.TaskUUID)
+	if err != nil {
+		return nil, fmt.Errorf("失败. 生成报告, 获取不一致数据样例. %v", err)
+	}
+	for _, diffRow := range diffRows {
+		report.DiffRowSamples = append(report.DiffRowSamples, &ReportDiffRow{
+			SourceSchema: diffRow.Schema.String,
+			SourceTable:  diffRow.Table.String,
+			DiffType:     diffRow.DiffType.String,
+			PKValue:      diffRow.PKValue.String,
+			SourceRow:    diffRow.SourceRow.String,
+			TargetRow:    diffRow.TargetRow.String,
+			CreatedAt:    formatReportTime(diffRow.CreatedAt),
+		})
+	}
+
+	return report, nil
+}
+
+/* 获取表的行数
+Params:
+	_host: 实例host
+	_port: 实例端口
+	_schema: 数据库名
+	_table: 表名
+*/
+func GetTableRowCount(host string, port int, schema string, table string) (int64, error) {
+	instance, ok := gdbc.GetDynamicDBByHostPort(host, int64(port))
+	if !ok {
+		return 0, fmt.Errorf("缓存中不存在该实例(%v:%v). 获取表的行数", host, port)
+	}
+
+	countSql := fmt.Sprintf("/* go-d-bus */ SELECT COUNT(*) FROM %v", common.FormatTableName(schema, table, "`"))
+	var rowCount int64
+	if err := instance.QueryRow(countSql).Scan(&rowCount); err != nil {
+		return 0, fmt.Errorf("失败. 获取表的行数. %v:%v. %v. %v", host, port, countSql, err)
+	}
+
+	return rowCount, nil
+}
+
+// 格式化报告中的时间, 没有值为空
+func formatReportTime(t mysql.NullTime) string {
+	if !t.Valid {
+		return ""
+	}
+
+	return t.Time.Format(REPORT_TIME_LAYOUT)
+}
@@ -0,0 +1,167 @@
+package mysqlchecksum
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/daiguadaidai/go-d-bus/parser"
+	"html/template"
+	"io"
+	"strconv"
+	"time"
+)
+
+/* 按指定的格式输出报告
+Params:
+	_format: 报告格式: json, csv, html
+	_w: 输出
+*/
+func (this *ChecksumReport) Write(format string, w io.Writer) error {
+	switch format {
+	case parser.REPORT_FORMAT_JSON:
+		return this.WriteJson(w)
+	case parser.REPORT_FORMAT_CSV:
+		return this.WriteCsv(w)
+	case parser.REPORT_FORMAT_HTML:
+		return this.WriteHtml(w)
+	}
+
+	return fmt.Errorf("失败. 不支持的报告格式: %v", format)
+}
+
+// 输出 json 格式的报告
+func (this *ChecksumReport) WriteJson(w io.Writer) error {
+	raw, err := json.MarshalIndent(this, "", "    ")
+	if err != nil {
+		return fmt.Errorf("失败. 报告转化为 json. %v", err)
+	}
+	if _, err = w.Write(append(raw, '\n')); err != nil {
+		return fmt.Errorf("失败. 输出 json 报告. %v", err)
+	}
+
+	return nil
+}
+
+// 输出 csv 格式的报告, 依次是: 每个表的统计, 还没有修复的范围, 不一致数据样例, 每一部分之间空一行
+func (this *ChecksumReport) WriteCsv(w io.Writer) error {
+	records := make([][]string, 0, len(this.Tables)+len(this.RemainDiffRanges)+len(this.DiffRowSamples)+5)
+
+	records = append(records, []string{"source_schema", "source_table", "target_schema", "target_table",
+		"source_rows", "target_rows", "row_copy_chunk_count", "row_copy_elapsed_ms",
+		"chunk_count", "diff_chunk_count", "fixed_chunk_count", "remain_chunk_count",
+		"missing_rows", "extra_rows", "diff_rows",
+		"checksum_elapsed_ms", "fix_elapsed_ms", "checksum_started_at", "checksum_updated_at"})
+	for _, t := range this.Tables {
+		records = append(records, []string{t.SourceSchema, t.SourceTable, t.TargetSchema, t.TargetTable,
+			formatInt(t.SourceRows), formatInt(t.TargetRows), formatInt(t.RowCopyChunkCount), formatInt(t.RowCopyElapsedMs),
+			formatInt(t.ChunkCount), formatInt(t.DiffChunkCount), formatInt(t.FixedChunkCount), formatInt(t.RemainChunkCount),
+			formatInt(t.MissingRows), formatInt(t.ExtraRows), formatInt(t.DiffRows),
+			formatInt(t.ChecksumElapsedMs), formatInt(t.FixElapsedMs), t.ChecksumStartedAt, t.ChecksumUpdatedAt})
+	}
+
+	records = append(records, nil)
+	records = append(records, []string{"source_schema", "source_table", "min_value", "max_value", "created_at"})
+	for _, r := range this.RemainDiffRanges {
+		records = append(records, []string{r.SourceSchema, r.SourceTable, r.MinValue, r.MaxValue, r.CreatedAt})
+	}
+
+	records = append(records, nil)
+	records = append(records, []string{"source_schema", "source_table", "diff_type", "pk_value", "source_row", "target_row", "created_at"})
+	for _, r := range this.DiffRowSamples {
+		records = append(records, []string{r.SourceSchema, r.SourceTable, r.DiffType, r.PKValue, r.SourceRow, r.TargetRow, r.CreatedAt})
+	}
+
+	csvWriter := csv.NewWriter(w)
+	for _, record := range records {
+		// 空行分隔每一部分, csv.Writer 写入空的记录会输出空行
+		if err := csvWriter.Write(record); err != nil {
+			return fmt.Errorf("失败. 输出 csv 报告. %v", err)
+		}
+	}
+	csvWriter.Flush()
+	if err := csvWriter.Error(); err != nil {
+		return fmt.Errorf("失败. 输出 csv 报告. %v", err)
+	}
+
+	return nil
+}
+
+// 输出 html 格式的报告
+func (this *ChecksumReport) WriteHtml(w io.Writer) error {
+	if err := reportHtmlTpl.Execute(w, this); err != nil {
+		return fmt.Errorf("失败. 输出 html 报告. %v", err)
+	}
+
+	return nil
+}
+
+func formatInt(i int64) string {
+	return strconv.FormatInt(i, 10)
+}
+
+// 毫秒转化为方便阅读的时间: 1h2m3.4s
+func formatElapsedMs(ms int64) string {
+	return (time.Duration(ms) * time.Millisecond).String()
+}
+
+var reportHtmlTpl = template.Must(template.New("report").Funcs(template.FuncMap{
+	"elapsed": formatElapsedMs,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>go-d-bus checksum report {{.TaskUUID}}</title>
+<style>
+body { font-family: sans-serif; font-size: 13px; }
+table { border-collapse: collapse; margin-bottom: 24px; }
+th, td { border: 1px solid #999; padding: 4px 8px; text-align: left; }
+th { background: #eee; }
+td.num { text-align: right; }
+tr.diff td { background: #fdd; }
+pre { margin: 0; white-space: pre-wrap; word-break: break-all; }
+</style>
+</head>
+<body>
+<h1>go-d-bus checksum report</h1>
+<p>task uuid: {{.TaskUUID}}<br>generated at: {{.GeneratedAt}}<br>consistent: {{.IsConsistent}}</p>
+
+<h2>tables</h2>
+<table>
+<tr>
+<th>source</th><th>target</th><th>source rows</th><th>target rows</th>
+<th>row copy chunks</th><th>row copy time</th>
+<th>chunks checked</th><th>chunks mismatched</th><th>chunks fixed</th><th>chunks remain</th>
+<th>missing rows</th><th>extra rows</th><th>diff rows</th>
+<th>checksum time</th><th>fix time</th><th>checksum started at</th><th>checksum updated at</th>
+</tr>
+{{- range .Tables}}
+<tr{{if or (gt .RemainChunkCount 0) (not .IsRowCountConsistent)}} class="diff"{{end}}>
+<td>{{.SourceSchema}}.{{.SourceTable}}</td><td>{{.TargetSchema}}.{{.TargetTable}}</td>
+<td class="num">{{.SourceRows}}</td><td class="num">{{.TargetRows}}</td>
+<td class="num">{{.RowCopyChunkCount}}</td><td class="num">{{elapsed .RowCopyElapsedMs}}</td>
+<td class="num">{{.ChunkCount}}</td><td class="num">{{.DiffChunkCount}}</td><td class="num">{{.FixedChunkCount}}</td><td class="num">{{.RemainChunkCount}}</td>
+<td class="num">{{.MissingRows}}</td><td class="num">{{.ExtraRows}}</td><td class="num">{{.DiffRows}}</td>
+<td class="num">{{elapsed .ChecksumElapsedMs}}</td><td class="num">{{elapsed .FixElapsedMs}}</td>
+<td>{{.ChecksumStartedAt}}</td><td>{{.ChecksumUpdatedAt}}</td>
+</tr>
+{{- end}}
+</table>
+
+<h2>remain diff ranges ({{len .RemainDiffRanges}})</h2>
+<table>
+<tr><th>source</th><th>min value</th><th>max value</th><th>created at</th></tr>
+{{- range .RemainDiffRanges}}
+<tr><td>{{.SourceSchema}}.{{.SourceTable}}</td><td><pre>{{.MinValue}}</pre></td><td><pre>{{.MaxValue}}</pre></td><td>{{.CreatedAt}}</td></tr>
+{{- end}}
+</table>
+
+<h2>diff row samples ({{len .DiffRowSamples}})</h2>
+<table>
+<tr><th>source</th><th>type</th><th>primary key</th><th>source row</th><th>target row</th><th>created at</th></tr>
+{{- range .DiffRowSamples}}
+<tr><td>{{.SourceSchema}}.{{.SourceTable}}</td><td>{{.DiffType}}</td><td><pre>{{.PKValue}}</pre></td><td><pre>{{.SourceRow}}</pre></td><td><pre>{{.TargetRow}}</pre></td><td>{{.CreatedAt}}</td></tr>
+{{- end}}
+</table>
+</body>
+</html>
+`))
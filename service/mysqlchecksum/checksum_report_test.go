@@ -0,0 +1,142 @@
+package mysqlchecksum
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"github.com/daiguadaidai/go-d-bus/parser"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func newTestChecksumReport() *ChecksumReport {
+	return &ChecksumReport{
+		TaskUUID:    "task-1",
+		GeneratedAt: "2020-01-02 03:04:05",
+		Tables: []*TableReport{
+			{
+				SourceSchema:      "test",
+				SourceTable:       "t",
+				TargetSchema:      "test_new",
+				TargetTable:       "t",
+				SourceRows:        10,
+				TargetRows:        9,
+				RowCopyChunkCount: 2,
+				RowCopyElapsedMs:  1500,
+				ChunkCount:        2,
+				DiffChunkCount:    1,
+				FixedChunkCount:   0,
+				RemainChunkCount:  1,
+				MissingRows:       1,
+				ChecksumElapsedMs: 61000,
+				FixElapsedMs:      20,
+				ChecksumStartedAt: "2020-01-02 03:00:00",
+				ChecksumUpdatedAt: "2020-01-02 03:04:00",
+			},
+		},
+		RemainDiffRanges: []*ReportDiffRange{
+			{SourceSchema: "test", SourceTable: "t", MinValue: `{"id":1}`, MaxValue: `{"id":5}`, CreatedAt: "2020-01-02 03:01:00"},
+		},
+		DiffRowSamples: []*ReportDiffRow{
+			{
+				SourceSchema: "test",
+				SourceTable:  "t",
+				DiffType:     "diff",
+				PKValue:      `[3]`,
+				SourceRow:    `[3,"<script>alert(\"x\")</script>, a"]`,
+				TargetRow:    `[3,"b & c"]`,
+				CreatedAt:    "2020-01-02 03:02:00",
+			},
+		},
+	}
+}
+
+func TestChecksumReport_WriteJson(t *testing.T) {
+	report := newTestChecksumReport()
+
+	buf := new(bytes.Buffer)
+	if err := report.Write(parser.REPORT_FORMAT_JSON, buf); err != nil {
+		t.Fatal(err)
+	}
+
+	decoded := new(ChecksumReport)
+	if err := json.Unmarshal(buf.Bytes(), decoded); err != nil {
+		t.Fatalf("json 报告解析失败. %v. %v", err, buf.String())
+	}
+	if !reflect.DeepEqual(report, decoded) {
+		t.Fatalf("json 报告和原报告不一样: %v", buf.String())
+	}
+	if !strings.Contains(buf.String(), `"remain_chunk_count": 1`) {
+		t.Fatalf("json 报告字段名不正确: %v", buf.String())
+	}
+}
+
+func TestChecksumReport_WriteCsv(t *testing.T) {
+	report := newTestChecksumReport()
+
+	buf := new(bytes.Buffer)
+	if err := report.Write(parser.REPORT_FORMAT_CSV, buf); err != nil {
+		t.Fatal(err)
+	}
+
+	// 每一部分之间空一行
+	if sections := strings.Split(strings.TrimSpace(buf.String()), "\n\n"); len(sections) != 3 {
+		t.Fatalf("期望 3 部分, 实际 %v: %v", len(sections), buf.String())
+	}
+
+	reader := csv.NewReader(strings.NewReader(buf.String()))
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 6 {
+		t.Fatalf("期望 3 个表头和 3 行数据, 实际 %v: %v", len(records), records)
+	}
+
+	tableRecord := records[1]
+	if tableRecord[0] != "test" || tableRecord[4] != "10" || tableRecord[5] != "9" || tableRecord[11] != "1" || tableRecord[15] != "61000" {
+		t.Fatalf("表的统计不正确: %v", tableRecord)
+	}
+	if rangeRecord := records[3]; rangeRecord[2] != `{"id":1}` || rangeRecord[3] != `{"id":5}` {
+		t.Fatalf("没有修复的范围不正确: %v", rangeRecord)
+	}
+	// 包含逗号和引号的数据需要能原样读出
+	if rowRecord := records[5]; rowRecord[4] != report.DiffRowSamples[0].SourceRow || rowRecord[5] != report.DiffRowSamples[0].TargetRow {
+		t.Fatalf("不一致数据样例不正确: %v", rowRecord)
+	}
+}
+
+func TestChecksumReport_WriteHtml(t *testing.T) {
+	report := newTestChecksumReport()
+
+	buf := new(bytes.Buffer)
+	if err := report.Write(parser.REPORT_FORMAT_HTML, buf); err != nil {
+		t.Fatal(err)
+	}
+	html := buf.String()
+
+	for _, expect := range []string{
+		"task uuid: task-1",
+		"consistent: false",
+		`<tr class="diff">`,
+		"<td>test.t</td><td>test_new.t</td>",
+		"1m1s",
+		"<pre>{&#34;id&#34;:1}</pre>",
+		// 数据样例需要转义, 不能当做 html 执行
+		"&lt;script&gt;alert(\\&#34;x\\&#34;)&lt;/script&gt;, a",
+		"b &amp; c",
+	} {
+		if !strings.Contains(html, expect) {
+			t.Fatalf("html 报告中没有 %v: %v", expect, html)
+		}
+	}
+	if strings.Contains(html, "<script>") {
+		t.Fatalf("html 报告中的数据样例没有转义: %v", html)
+	}
+
+	if err := report.Write("xml", buf); err == nil {
+		t.Fatal("不支持的报告格式应该报错")
+	}
+}
@@ -0,0 +1,114 @@
+package mysqlchecksum
+
+import (
+	"github.com/daiguadaidai/go-d-bus/logger"
+	"github.com/daiguadaidai/go-d-bus/matemap"
+	"github.com/daiguadaidai/go-d-bus/service/mysqlrowcopy"
+	"sort"
+	"time"
+)
+
+const (
+	ROLLING_CHECKSUM_PARALLER_TAG = -1              // 滚动校验的协程号, 用于日志中区分第一波校验的协程
+	ROLLING_CHECKSUM_WAIT_TIME    = 5 * time.Second // 等待 row copy 完成和应用binlog开始的检测间隔
+	ROLLING_CHECKSUM_RECHECK_TIME = time.Second     // 发现不一致后间隔多久再次校验
+	ROLLING_CHECKSUM_RECHECK      = 2               // 发现不一致后最多再次校验几次, 都不一致才告警
+)
+
+/* 循环对所有迁移的表进行滚动校验
+row copy 完成后第一波 checksum 只会再次校验不一致的记录, 应用binlog可能还要运行很久,
+滚动校验按设置的速度一轮一轮的重新校验所有表的所有范围, 发现不一致告警并保存不一致记录,
+在切换之前发现应用binlog的问题. 第二波修复已经结束后保存的不一致记录不会自动修复, 确认原因后可以使用 checksum --fix=true 修复
+*/
+func (this *Checksum) LoopRollingChecksum() {
+	// 1. 等待 row copy 完成, 开启了应用binlog需要等待应用binlog开始, 之后校验会等待应用binlog追上源数据位点
+	for {
+		if ok, _ := mysqlrowcopy.TaskRowCopyIsComplete(this.ConfigMap.TaskUUID); ok {
+			if this.ApplyBinlog == nil || this.ApplyBinlog.IsStarted() {
+				break
+			}
+		}
+		time.Sleep(ROLLING_CHECKSUM_WAIT_TIME)
+	}
+	logger.M.Infof("开始进行滚动校验. %v", this.ConfigMap.TaskUUID)
+
+	chunkInterval := time.Duration(this.Parser.RollingChecksumChunkInterval * float64(time.Second))
+	roundInterval := time.Duration(this.Parser.RollingChecksumRoundInterval) * time.Second
+
+	// 2. 一轮一轮的校验所有的表
+	for round := 1; ; round++ {
+		tableNames := make([]string, 0, 1)
+		for tableName, _ := range matemap.FindAllMigrationTableNameMap() {
+			tableNames = append(tableNames, tableName)
+		}
+		sort.Strings(tableNames)
+
+		chunkCount, diffCount := 0, 0
+		for _, tableName := range tableNames {
+			err := this.GenerateTablePrimaryRangeValues(tableName, func(primaryRangeValue *matemap.PrimaryRangeValue) {
+				// 限流时暂停, 并且和 row copy 共用从源读取的行数上限
+				this.Throttler.WaitRollingChecksum()
+				this.Throttler.WaitRollingChecksumRate(this.Parser.RowCopyLimit)
+
+				chunkCount++
+				if !this.RollingChecksum(primaryRangeValue, round) {
+					diffCount++
+				}
+				time.Sleep(chunkInterval)
+			})
+			if err != nil {
+				logger.M.Errorf("错误. 滚动校验第 %v 轮, 生成表的主键范围失败, 跳过该表. %v. %v", round, tableName, err)
+			}
+		}
+
+		logger.M.Infof("滚动校验第 %v 轮完成. 表数: %v, 范围数: %v, 不一致的范围数: %v. %vs 后开始下一轮",
+			round, len(tableNames), chunkCount, diffCount, this.Parser.RollingChecksumRoundInterval)
+		time.Sleep(roundInterval)
+	}
+}
+
+/* 滚动校验一个范围, 不一致时再次校验, 还是不一致告警并保存不一致记录
+Params:
+	_primaryRangeValue: 数据范围
+	_round: 第几轮
+Return: 是否一致, 校验出错当做一致, 下一轮再校验
+*/
+func (this *Checksum) RollingChecksum(primaryRangeValue *matemap.PrimaryRangeValue, round int) bool {
+	for i := 0; ; i++ {
+		is_consistent, err := this.RowsChecksum(primaryRangeValue, ROLLING_CHECKSUM_PARALLER_TAG)
+		if err != nil {
+			logger.M.Errorf("错误. 滚动校验第 %v 轮. %v", round, err)
+			return true
+		}
+		if is_consistent {
+			return true
+		}
+		if i >= ROLLING_CHECKSUM_RECHECK {
+			break
+		}
+
+		// 数据可能正在变化, 间隔一会再次校验
+		time.Sleep(ROLLING_CHECKSUM_RECHECK_TIME)
+	}
+
+	logger.M.Errorf("告警. 滚动校验第 %v 轮发现数据不一致, 可能是应用binlog出现了问题. %v.%v. min: %v, max: %v",
+		round, primaryRangeValue.Schema, primaryRangeValue.Table, primaryRangeValue.MinValue, primaryRangeValue.MaxValue)
+
+	// 一直不一致的范围每一轮都会发现, 已经有还没修复的不一致记录不再重复保存
+	hasDiffRecord, err := HasNoFixDiffRecord(this.ConfigMap.TaskUUID, primaryRangeValue)
+	if err != nil {
+		logger.M.Errorf("错误. 滚动校验获取范围还没修复的不一致记录失败. %v", err)
+	}
+	if hasDiffRecord {
+		logger.M.Warnf("警告. 滚动校验第 %v 轮, 该范围已经有还没修复的不一致记录, 不重复保存. %v.%v. min: %v, max: %v",
+			round, primaryRangeValue.Schema, primaryRangeValue.Table, primaryRangeValue.MinValue, primaryRangeValue.MaxValue)
+		return false
+	}
+
+	if _, err = CreateDiffRecord(this.ConfigMap.TaskUUID, primaryRangeValue); err != nil {
+		logger.M.Errorf("错误. 滚动校验保存不一致记录失败. %v", err)
+	}
+	this.IncrTableStat(primaryRangeValue.Schema, primaryRangeValue.Table, 0, 1, 0, 0, 0)
+
+	return false
+}
@@ -0,0 +1,131 @@
+package mysqlchecksum
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/daiguadaidai/go-d-bus/gdbc"
+	"github.com/daiguadaidai/go-d-bus/logger"
+	"github.com/daiguadaidai/go-d-bus/service/mysqlapplybinlog"
+	"github.com/daiguadaidai/go-d-bus/service/mysqlrowcopy"
+	"sync"
+	"time"
+)
+
+const (
+	CHECKSUM_SNAPSHOT_REUSE_TIME = 10 * time.Second // 一个快照最多被后面的范围复用多久, 太旧的快照会让目标上被修改过的范围都要重新校验
+)
+
+// 多行 checksum 读取源数据使用的快照, 快照和位点在全局读锁中获取, 完全一致
+type ChecksumSnapshot struct {
+	Conn       *sql.Conn
+	LogFilePos *mysqlapplybinlog.LogFilePos
+	StartTime  time.Time
+}
+
+/* 快照连接池
+每个 checksum 协程使用时取出一个快照连接, 用完放回. 快照没有过期的时候后面的范围直接复用, 过期了在同一个连接上重新开启快照,
+不需要每个范围都获取一个新的连接和加一次全局读锁
+*/
+type ChecksumSnapshotPool struct {
+	Host string
+	Port int
+
+	idleSnapshots []*ChecksumSnapshot
+	mu            sync.Mutex
+}
+
+/* 创建一个快照连接池, 使用的时候才会获取连接
+Params:
+	_host: 源实例 host, 必须是应用binlog解析的实例
+	_port: 源实例 port
+*/
+func NewChecksumSnapshotPool(_host string, _port int) *ChecksumSnapshotPool {
+	return &ChecksumSnapshotPool{
+		Host:          _host,
+		Port:          _port,
+		idleSnapshots: make([]*ChecksumSnapshot, 0),
+	}
+}
+
+/* 取出一个快照, 没有空闲的快照连接就获取一个新的连接
+Params:
+	_fresh: 是否必须使用新开启的快照. 等待了应用binlog还是不一致, 重新校验时旧的快照没有用
+*/
+func (this *ChecksumSnapshotPool) Get(_fresh bool) (*ChecksumSnapshot, error) {
+	ctx := context.Background()
+
+	snapshot := this.popIdle()
+	if snapshot == nil {
+		instance, ok := gdbc.GetDynamicDBByHostPort(this.Host, int64(this.Port))
+		if !ok {
+			return nil, fmt.Errorf("缓存中不存在该实例(%v:%v). 获取源数据库实例(获取快照连接时)", this.Host, this.Port)
+		}
+		conn, err := instance.Conn(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("失败. 获取快照连接. %v:%v. %v", this.Host, this.Port, err)
+		}
+		snapshot = &ChecksumSnapshot{Conn: conn}
+	}
+
+	if !_fresh && snapshot.LogFilePos != nil && time.Since(snapshot.StartTime) < CHECKSUM_SNAPSHOT_REUSE_TIME {
+		return snapshot, nil
+	}
+
+	logFile, logPos, _, err := mysqlrowcopy.StartLockedSnapshot(ctx, snapshot.Conn)
+	if err != nil {
+		snapshot.Conn.Close()
+		return nil, fmt.Errorf("失败. 开启快照. %v:%v. %v", this.Host, this.Port, err)
+	}
+	snapshot.LogFilePos = mysqlapplybinlog.NewLogFilePos(logFile, logPos)
+	snapshot.StartTime = time.Now()
+
+	return snapshot, nil
+}
+
+/* 放回一个快照, 使用时发生了错误的快照连接直接关闭
+Params:
+	_snapshot: 快照
+	_err: 使用快照时发生的错误
+*/
+func (this *ChecksumSnapshotPool) Put(_snapshot *ChecksumSnapshot, _err error) {
+	if _err != nil {
+		_snapshot.Conn.Close()
+		return
+	}
+
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	this.idleSnapshots = append(this.idleSnapshots, _snapshot)
+}
+
+// 结束所有空闲的快照事务并释放连接
+func (this *ChecksumSnapshotPool) Close() {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	ctx := context.Background()
+	for _, snapshot := range this.idleSnapshots {
+		if _, err := snapshot.Conn.ExecContext(ctx, "/* go-d-bus */ COMMIT"); err != nil {
+			logger.M.Warnf("警告. 关闭 checksum 快照连接结束事务失败. %v", err)
+		}
+		snapshot.Conn.Close()
+	}
+	this.idleSnapshots = this.idleSnapshots[:0]
+}
+
+// 取出一个空闲的快照, 没有返回 nil
+func (this *ChecksumSnapshotPool) popIdle() *ChecksumSnapshot {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if len(this.idleSnapshots) == 0 {
+		return nil
+	}
+
+	snapshot := this.idleSnapshots[len(this.idleSnapshots)-1]
+	this.idleSnapshots = this.idleSnapshots[:len(this.idleSnapshots)-1]
+
+	return snapshot
+}
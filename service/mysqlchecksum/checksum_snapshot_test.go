@@ -0,0 +1,69 @@
+package mysqlchecksum
+
+import (
+	"github.com/daiguadaidai/go-d-bus/matemap"
+	"reflect"
+	"testing"
+)
+
+func TestChecksumSnapshotPool_Get(t *testing.T) {
+	table := newFakeTable(t)
+	_, source, _ := newFakeChecksum(t, table, map[int64]string{1: "a"}, map[int64]string{1: "a"})
+	pool := NewChecksumSnapshotPool(FAKE_SOURCE_HOST, FAKE_PORT)
+
+	snapshot, err := pool.Get(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snapshot.LogFilePos.LogFile != "mysql-bin.000001" || snapshot.LogFilePos.LogPos != 100 {
+		t.Fatalf("快照位点不对. %v:%v", snapshot.LogFilePos.LogFile, snapshot.LogFilePos.LogPos)
+	}
+
+	// 位点在全局读锁中获取, 和快照完全一致
+	expectSqls := []string{
+		"/* go-d-bus */ FLUSH TABLES WITH READ LOCK",
+		"/* go-d-bus */ SET SESSION TRANSACTION ISOLATION LEVEL REPEATABLE READ",
+		"/* go-d-bus */ START TRANSACTION WITH CONSISTENT SNAPSHOT",
+		"/* go-d-bus */ SHOW MASTER STATUS",
+		"/* go-d-bus */ UNLOCK TABLES",
+	}
+	if sqls := source.SnapshotSqls(); !reflect.DeepEqual(sqls, expectSqls) {
+		t.Fatalf("开启快照的 sql 不对. 期望 %v, 实际 %v", expectSqls, sqls)
+	}
+
+	primaryRangeValue := matemap.NewPrimaryRangeValue(table.SourceSchema, table.SourceName,
+		map[string]interface{}{"id": 1}, map[string]interface{}{"id": 1}, nil)
+	checksumCode, err := GetSourceRowsChecksumCodeInSnapshot(snapshot, primaryRangeValue, table)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checksumCode != source.rowsChecksumCode([]int64{1}) {
+		t.Fatalf("快照中的 checksum 值不对. %v", checksumCode)
+	}
+	pool.Put(snapshot, nil)
+
+	// 没有过期的快照直接复用, 不需要再加锁
+	reused, err := pool.Get(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reused != snapshot || len(source.SnapshotSqls()) != len(expectSqls) {
+		t.Fatalf("没有过期的快照应该直接复用. %v", source.SnapshotSqls())
+	}
+	pool.Put(reused, nil)
+
+	// 重新校验需要新的快照, 还是使用同一个连接
+	fresh, err := pool.Get(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fresh.Conn != snapshot.Conn || fresh.LogFilePos.LogPos != 200 || len(source.SnapshotSqls()) != 2*len(expectSqls) {
+		t.Fatalf("应该在同一个连接上开启新的快照. %v:%v, %v", fresh.LogFilePos.LogFile, fresh.LogFilePos.LogPos, source.SnapshotSqls())
+	}
+	pool.Put(fresh, nil)
+
+	pool.Close()
+	if sqls := source.SnapshotSqls(); sqls[len(sqls)-1] != "/* go-d-bus */ COMMIT" {
+		t.Fatalf("关闭时应该结束快照事务. %v", sqls)
+	}
+}
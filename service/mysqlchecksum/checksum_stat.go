@@ -0,0 +1,127 @@
+package mysqlchecksum
+
+import (
+	"database/sql"
+	"github.com/daiguadaidai/go-d-bus/common"
+	"github.com/daiguadaidai/go-d-bus/dao"
+	"github.com/daiguadaidai/go-d-bus/logger"
+	"github.com/daiguadaidai/go-d-bus/matemap"
+	"github.com/daiguadaidai/go-d-bus/model"
+	"time"
+)
+
+/* 累加表的 checksum 统计, 用于生成报告. 保存统计失败只打印日志, 不影响校验
+Params:
+	_schema: 数据库名
+	_table: 表名
+	_chunkCount: 第一次校验的范围数
+	_diffChunkCount: 第一次校验不一致的范围数
+	_fixedChunkCount: 修复或再次校验后一致的范围数
+	_checksumElapsed: 多行校验的耗时
+	_fixElapsed: 修复数据的耗时
+*/
+func (this *Checksum) IncrTableStat(
+	schema string,
+	table string,
+	chunkCount int64,
+	diffChunkCount int64,
+	fixedChunkCount int64,
+	checksumElapsed time.Duration,
+	fixElapsed time.Duration,
+) {
+	checksumTableStatDao := new(dao.ChecksumTableStatDao)
+	err := checksumTableStatDao.Incr(this.ConfigMap.TaskUUID, schema, table, chunkCount, diffChunkCount, fixedChunkCount,
+		checksumElapsed.Nanoseconds()/int64(time.Millisecond), fixElapsed.Nanoseconds()/int64(time.Millisecond))
+	if err != nil {
+		logger.M.Warnf("警告. 保存表的 checksum 统计失败. %v.%v. %v", schema, table, err)
+	}
+}
+
+/* 记录一个范围多行校验的统计. 修复后再次校验的范围一致算修复成功, 不算在第一次校验的范围数中
+Params:
+	_primaryRangeValue: 数据范围
+	_isConsistent: 是否一致
+	_elapsed: 校验耗时
+*/
+func (this *Checksum) IncrChunkStat(primaryRangeValue *matemap.PrimaryRangeValue, isConsistent bool, elapsed time.Duration) {
+	var chunkCount, diffChunkCount, fixedChunkCount int64
+	if primaryRangeValue.IsRecheck {
+		if isConsistent {
+			fixedChunkCount = 1
+		}
+	} else {
+		chunkCount = 1
+		if !isConsistent {
+			diffChunkCount = 1
+		}
+	}
+
+	this.IncrTableStat(primaryRangeValue.Schema, primaryRangeValue.Table, chunkCount, diffChunkCount, fixedChunkCount, elapsed, 0)
+}
+
+/* 保存一行不一致数据的样例, 每个表最多保存 --checksum-diff-sample-rows 行. 保存失败只打印日志, 不影响修复
+Params:
+	_diffType: 不一致类型: missing, extra, diff
+	_pkValues: 该行的主键值
+	_table: 需要迁移的表
+	_sourceRow: 源该行的数据, 目标多出的行为 nil
+	_parallerTag: 协程号
+*/
+func (this *Checksum) SaveDiffRowSample(diffType string, pkValues []interface{}, table *matemap.Table, sourceRow []interface{}, parallerTag int) {
+	if !this.takeDiffRowSample(table) {
+		return
+	}
+
+	// 修复前目标的数据, 目标缺少的行为 nil
+	var targetRow []interface{}
+	if diffType != model.CHECKSUM_DIFF_ROW_TYPE_MISSING {
+		var err error
+		if targetRow, err = GetTargetRowByPK(this.ConfigMap.Target.Host.String, int(this.ConfigMap.Target.Port.Int64), pkValues, table); err != nil {
+			logger.M.Warnf("协程: %v, 警告. 保存不一致数据样例, 通过主键值获取目标表数据失败. %v.%v. %v. %v",
+				parallerTag, table.TargetSchema, table.TargetName, pkValues, err)
+			return
+		}
+	}
+
+	checksumDiffRow := &model.ChecksumDiffRow{
+		TaskUUID:  sql.NullString{String: this.ConfigMap.TaskUUID, Valid: true},
+		Schema:    sql.NullString{String: table.SourceSchema, Valid: true},
+		Table:     sql.NullString{String: table.SourceName, Valid: true},
+		DiffType:  sql.NullString{String: diffType, Valid: true},
+		PKValue:   sql.NullString{String: common.ToJsonStr(pkValues), Valid: true},
+		SourceRow: getDiffSampleRowJson(sourceRow),
+		TargetRow: getDiffSampleRowJson(targetRow),
+	}
+
+	checksumDiffRowDao := new(dao.ChecksumDiffRowDao)
+	if err := checksumDiffRowDao.Create(checksumDiffRow); err != nil {
+		logger.M.Warnf("协程: %v, 警告. 保存不一致数据样例失败. %v.%v. %v. %v", parallerTag, table.SourceSchema, table.SourceName, pkValues, err)
+	}
+}
+
+// 表保存的不一致数据样例是否还没有达到上限, 没有达到则占用一个
+func (this *Checksum) takeDiffRowSample(table *matemap.Table) bool {
+	if this.Parser.ChecksumDiffSampleRows <= 0 {
+		return false
+	}
+
+	this.diffSampleLock.Lock()
+	defer this.diffSampleLock.Unlock()
+
+	tableName := common.FormatTableName(table.SourceSchema, table.SourceName, "")
+	if this.diffSampleCounts[tableName] >= this.Parser.ChecksumDiffSampleRows {
+		return false
+	}
+	this.diffSampleCounts[tableName]++
+
+	return true
+}
+
+// 一行数据转化为 json 保存, nil 保存为 NULL
+func getDiffSampleRowJson(row []interface{}) sql.NullString {
+	if row == nil {
+		return sql.NullString{}
+	}
+
+	return sql.NullString{String: common.ToJsonStr(row), Valid: true}
+}
@@ -0,0 +1,68 @@
+package mysqlchecksum
+
+import (
+	"testing"
+)
+
+func TestGetRowChecksumCode_NoRow(t *testing.T) {
+	table := newFakeTable(t)
+	newFakeChecksum(t, table, map[int64]string{1: "a"}, map[int64]string{2: "b"})
+
+	// 源没有 id=2, 目标没有 id=1, 没有该行返回空字符串
+	sourceCode, err := GetSourceRowChecksumCode(FAKE_SOURCE_HOST, FAKE_PORT, []interface{}{2}, table)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sourceCode != "" {
+		t.Fatalf("源没有该行期望空字符串, 实际 %v", sourceCode)
+	}
+
+	targetCode, err := GetTargetRowChecksumCode(FAKE_TARGET_HOST, FAKE_PORT, []interface{}{1}, table)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if targetCode != "" {
+		t.Fatalf("目标没有该行期望空字符串, 实际 %v", targetCode)
+	}
+}
+
+func TestChecksum_FixDiffRow(t *testing.T) {
+	table := newFakeTable(t)
+	checksum, _, target := newFakeChecksum(t, table,
+		map[int64]string{1: "a", 2: "b"},
+		map[int64]string{1: "a", 3: "c"})
+
+	diffRowCount := new(DiffRowCount)
+	// id=2 只在源存在, id=3 只在目标存在
+	for _, id := range []int{2, 3} {
+		if err := checksum.FixDiffRow([]interface{}{id}, table, 0, diffRowCount); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if diffRowCount.MissingRows != 1 || diffRowCount.ExtraRows != 1 || diffRowCount.DiffRows != 0 {
+		t.Fatalf("期望目标缺少 1 行, 多出 1 行, 实际 %+v", diffRowCount)
+	}
+	rows := target.Rows()
+	if len(rows) != 2 || rows[1] != "a" || rows[2] != "b" {
+		t.Fatalf("修复后目标数据期望 map[1:a 2:b], 实际 %v", rows)
+	}
+}
+
+func TestChecksum_FixDiffRow_DeleteExtraDryRun(t *testing.T) {
+	table := newFakeTable(t)
+	checksum, _, target := newFakeChecksum(t, table, map[int64]string{1: "a"}, map[int64]string{1: "a", 3: "c"})
+	checksum.Parser.ChecksumDeleteExtraDryRun = true
+
+	diffRowCount := new(DiffRowCount)
+	if err := checksum.FixDiffRow([]interface{}{3}, table, 0, diffRowCount); err != nil {
+		t.Fatal(err)
+	}
+
+	if diffRowCount.ExtraRows != 1 {
+		t.Fatalf("期望目标多出 1 行, 实际 %+v", diffRowCount)
+	}
+	if _, ok := target.Rows()[3]; !ok {
+		t.Fatal("dry run 不应该删除目标多出的行")
+	}
+}
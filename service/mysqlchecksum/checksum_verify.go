@@ -0,0 +1,326 @@
+package mysqlchecksum
+
+import (
+	"fmt"
+	"github.com/daiguadaidai/go-d-bus/config"
+	"github.com/daiguadaidai/go-d-bus/logger"
+	"github.com/daiguadaidai/go-d-bus/matemap"
+	"github.com/daiguadaidai/go-d-bus/model"
+	"github.com/daiguadaidai/go-d-bus/parser"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 单独运行 checksum 的结果汇总
+type VerifySummary struct {
+	TableCount      int // 校验的表数
+	ChunkCount      int // 校验的范围数
+	DiffChunkCount  int // 第一次校验不一致的范围数
+	FixedChunkCount int // 修复或再次校验后一致的范围数
+
+	BoundaryDiffChunkCount int // 目标超出源主键范围的范围数(count, full 级别), 包含在不一致的范围数中
+
+	MissingRows int // 修复时发现目标缺少的行数
+	ExtraRows   int // 修复时发现目标多出的行数
+	DiffRows    int // 修复时发现数据不一致的行数
+
+	RemainDiffRanges []*matemap.PrimaryRangeValue // 最终还是不一致的范围
+}
+
+// 所有的范围最终是否都一致
+func (this *VerifySummary) IsConsistent() bool {
+	return len(this.RemainDiffRanges) == 0
+}
+
+// 汇总结果的字符串, 用于打印
+func (this *VerifySummary) String() string {
+	lines := make([]string, 0, len(this.RemainDiffRanges)+2)
+	lines = append(lines, fmt.Sprintf("checksum 汇总. 表数: %v, 范围数: %v, 第一次校验不一致的范围数: %v, 修复或再次校验后一致的范围数: %v, 还是不一致的范围数: %v",
+		this.TableCount, this.ChunkCount, this.DiffChunkCount, this.FixedChunkCount, len(this.RemainDiffRanges)))
+	lines = append(lines, fmt.Sprintf("修复时发现的行数. 目标缺少行数: %v, 目标多出行数: %v, 数据不一致行数: %v",
+		this.MissingRows, this.ExtraRows, this.DiffRows))
+	if this.BoundaryDiffChunkCount > 0 {
+		lines = append(lines, fmt.Sprintf("目标超出源主键范围的范围数: %v", this.BoundaryDiffChunkCount))
+	}
+	for _, primaryRangeValue := range this.RemainDiffRanges {
+		lines = append(lines, fmt.Sprintf("不一致: %v.%v. min: %v, max: %v",
+			primaryRangeValue.Schema, primaryRangeValue.Table, primaryRangeValue.MinValue, primaryRangeValue.MaxValue))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// 第一次校验不一致的范围, 以及保存到数据库中的不一致记录
+type verifyDiffRange struct {
+	PrimaryRangeValue *matemap.PrimaryRangeValue
+	Record            *model.DataChecksum
+}
+
+/* 不需要启动迁移任务, 单独对源和目标的数据进行校验
+自己生成主键范围(和 row copy 一样), 第一次校验不一致的范围保存到 data_checksum 中,
+所有范围校验完成后, 对不一致的范围进行修复(或者只再次校验), 最后汇总结果
+*/
+type ChecksumVerify struct {
+	Checksum   *Checksum
+	TableNames []string // 需要校验的表 schema.table
+	Fix        bool     // 是否修复不一致的数据
+
+	Summary     *VerifySummary
+	diffRanges  []*verifyDiffRange
+	summaryLock sync.Mutex
+}
+
+/* 创建单独运行的 checksum
+Params:
+	_parser: 命令行解析的信息
+	_configMap: 配置信息
+	_tableNames: 需要校验的表, 为空校验所有需要迁移的表
+	_fix: 是否修复不一致的数据
+*/
+func NewChecksumVerify(
+	parser *parser.RunParser,
+	configMap *config.ConfigMap,
+	tableNames []string,
+	fix bool,
+) (*ChecksumVerify, error) {
+	checksum, err := NewChecksum(parser, configMap, make(chan *matemap.PrimaryRangeValue, parser.ChecksumParaller), make(chan bool, 1))
+	if err != nil {
+		return nil, err
+	}
+
+	// 没有指定表则校验所有需要迁移的表
+	if len(tableNames) == 0 {
+		for tableName, _ := range matemap.FindAllMigrationTableNameMap() {
+			tableNames = append(tableNames, tableName)
+		}
+	}
+	for _, tableName := range tableNames {
+		if _, err := matemap.GetMigrationTable(tableName); err != nil {
+			return nil, fmt.Errorf("失败. 需要校验的表不是任务需要迁移的表. %v", err)
+		}
+	}
+	sort.Strings(tableNames)
+
+	checksumVerify := &ChecksumVerify{
+		Checksum:   checksum,
+		TableNames: tableNames,
+		Fix:        fix,
+		Summary:    &VerifySummary{TableCount: len(tableNames)},
+	}
+
+	return checksumVerify, nil
+}
+
+// 开始校验, 完成后返回汇总结果
+func (this *ChecksumVerify) Start() *VerifySummary {
+	wg := new(sync.WaitGroup)
+
+	// 1. 生成主键范围, 并发进行多行校验
+	wg.Add(1)
+	go this.LoopGeneratePrimaryRangeValue(wg)
+	for i := 0; i < this.Checksum.Parser.ChecksumParaller; i++ {
+		wg.Add(1)
+		go this.LoopChecksum(wg, i)
+	}
+	wg.Wait()
+
+	// 比较每个表源和目标的最小和最大主键值, 目标超出源主键范围(包括源表没有数据)的范围也需要修复
+	err := this.Checksum.CheckTablesBoundary(this.TableNames, func(primaryRangeValue *matemap.PrimaryRangeValue, diffRecord *model.DataChecksum) {
+		this.Summary.ChunkCount++
+		this.Summary.DiffChunkCount++
+		this.Summary.BoundaryDiffChunkCount++
+		this.diffRanges = append(this.diffRanges, &verifyDiffRange{PrimaryRangeValue: primaryRangeValue, Record: diffRecord})
+	})
+	if err != nil {
+		logger.M.Fatalf("错误. %v. 退出. %v", err, this.Checksum.Parser.TaskUUID)
+	}
+
+	logger.M.Infof("第一次校验完成. 范围数: %v, 不一致的范围数: %v", this.Summary.ChunkCount, this.Summary.DiffChunkCount)
+
+	// 2. 并发对不一致的范围进行修复, 或者只再次校验
+	diffRangeChan := make(chan *verifyDiffRange, len(this.diffRanges))
+	for _, diffRange := range this.diffRanges {
+		diffRangeChan <- diffRange
+	}
+	close(diffRangeChan)
+
+	paraller := this.Checksum.Parser.ChecksumParaller
+	if this.Fix {
+		paraller = this.Checksum.Parser.ChecksumFixParaller
+	}
+	for i := 0; i < paraller; i++ {
+		wg.Add(1)
+		go this.LoopFixDiffRanges(wg, diffRangeChan, i)
+	}
+	wg.Wait()
+
+	if this.Checksum.FixSqlWriter != nil {
+		this.Checksum.FixSqlWriter.Close()
+	}
+
+	logger.M.Infof("!!!!!!!!!!!!! 单独运行的checksum任务总体完成 !!!!!!!!!!!!!")
+
+	return this.Summary
+}
+
+// 循环生成所有需要校验的表的主键范围, 一个表一个表生成
+func (this *ChecksumVerify) LoopGeneratePrimaryRangeValue(wg *sync.WaitGroup) {
+	defer wg.Done()
+	defer close(this.Checksum.ChecksumRowsChan)
+
+	for _, tableName := range this.TableNames {
+		err := this.Checksum.GenerateTablePrimaryRangeValues(tableName, func(primaryRangeValue *matemap.PrimaryRangeValue) {
+			this.Checksum.ChecksumRowsChan <- primaryRangeValue
+		})
+		if err != nil {
+			logger.M.Fatalf("错误. checksum 生成表的主键范围失败, 并且重试次数已经达到上线:%v. 退出. %v. %v",
+				this.Checksum.Parser.ErrRetryCount, tableName, err)
+		}
+	}
+
+	logger.M.Infof("所有表的主键范围已经生成完. %v", this.Checksum.ConfigMap.TaskUUID)
+}
+
+/* 循环对生成的范围进行多行校验, 不一致的范围保存到数据库中
+Params:
+	_parallerTag: 协程编号
+*/
+func (this *ChecksumVerify) LoopChecksum(wg *sync.WaitGroup, parallerTag int) {
+	defer wg.Done()
+
+	logger.M.Infof("开始进行数据校验, 启动协程%v", parallerTag)
+
+	for primaryRangeValue := range this.Checksum.ChecksumRowsChan {
+		isError := false
+		var is_consistent bool
+		var err error
+		for i := 0; i < this.Checksum.Parser.ErrRetryCount; i++ {
+			startTime := time.Now()
+			is_consistent, err = this.Checksum.RowsChecksum(primaryRangeValue, parallerTag)
+			if err != nil {
+				logger.M.Error(err)
+				isError = true
+				time.Sleep(time.Second)
+				continue
+			}
+			this.Checksum.IncrChunkStat(primaryRangeValue, is_consistent, time.Since(startTime))
+
+			isError = false
+			break
+		}
+		if isError {
+			logger.M.Fatalf("错误, 进行多行数据checksum错误, 并且重试次数已经达到上线:%v. 退出. %v", this.Checksum.Parser.ErrRetryCount, this.Checksum.Parser.TaskUUID)
+		}
+
+		// 不一致的范围保存到数据库
+		var diffRecord *model.DataChecksum
+		if !is_consistent {
+			for i := 0; i < this.Checksum.Parser.ErrRetryCount; i++ {
+				diffRecord, err = CreateDiffRecord(this.Checksum.ConfigMap.TaskUUID, primaryRangeValue)
+				if err != nil {
+					logger.M.Errorf("checksum 协程 %v. %v", parallerTag, err)
+					isError = true
+					time.Sleep(time.Second)
+					continue
+				}
+
+				isError = false
+				break
+			}
+			if isError {
+				logger.M.Fatalf("错误, 保存不一致数据失败, 并且重试次数已经达到上线:%v. 退出. %v", this.Checksum.Parser.ErrRetryCount, this.Checksum.Parser.TaskUUID)
+			}
+		}
+
+		this.summaryLock.Lock()
+		this.Summary.ChunkCount++
+		if !is_consistent {
+			this.Summary.DiffChunkCount++
+			this.diffRanges = append(this.diffRanges, &verifyDiffRange{PrimaryRangeValue: primaryRangeValue, Record: diffRecord})
+		}
+		this.summaryLock.Unlock()
+	}
+}
+
+/* 循环对第一次校验不一致的范围进行修复或再次校验
+Params:
+	_diffRangeChan: 不一致的范围
+	_parallerTag: 协程编号
+*/
+func (this *ChecksumVerify) LoopFixDiffRanges(wg *sync.WaitGroup, diffRangeChan chan *verifyDiffRange, parallerTag int) {
+	defer wg.Done()
+
+	for diffRange := range diffRangeChan {
+		isError := false
+		for i := 0; i < this.Checksum.Parser.ErrRetryCount; i++ {
+			if err := this.FixDiffRange(diffRange, parallerTag); err != nil {
+				logger.M.Error(err)
+				isError = true
+				time.Sleep(time.Second)
+				continue
+			}
+
+			isError = false
+			break
+		}
+		if isError {
+			logger.M.Fatalf("错误, 进行checksum修复数据(再次checksum)错误, 并且重试次数已经达到上线:%v. 退出. %v", this.Checksum.Parser.ErrRetryCount, this.Checksum.Parser.TaskUUID)
+		}
+	}
+}
+
+/* 修复(没有开启修复则跳过)后再次校验一个不一致的范围, 一致则标记不一致记录已经修复
+Params:
+	_diffRange: 不一致的范围
+	_parallerTag: 协程编号
+*/
+func (this *ChecksumVerify) FixDiffRange(diffRange *verifyDiffRange, parallerTag int) error {
+	primaryRangeValue := diffRange.PrimaryRangeValue
+	table, err := matemap.GetMigrationTableBySchemaTable(primaryRangeValue.Schema, primaryRangeValue.Table)
+	if err != nil {
+		return fmt.Errorf("失败. 获取目标需要迁移的表(修复数据). %v:%v. %v", primaryRangeValue.Schema, primaryRangeValue.Table, err)
+	}
+
+	// 1. 修复不一致的数据
+	startTime := time.Now()
+	diffRowCount := new(DiffRowCount)
+	if this.Fix {
+		if _, diffRowCount, err = this.Checksum.FixDiffRange(primaryRangeValue, table, parallerTag); err != nil {
+			return err
+		}
+	}
+
+	// 2. 再次校验, 第一次校验时数据可能正在变化
+	is_consistent, err := this.Checksum.RowsChecksum(primaryRangeValue, parallerTag)
+	if err != nil {
+		return fmt.Errorf("修复数据后再次校验时. %v", err)
+	}
+	var fixedChunkCount int64
+	if is_consistent {
+		fixedChunkCount = 1
+	}
+	this.Checksum.IncrTableStat(primaryRangeValue.Schema, primaryRangeValue.Table, 0, 0, fixedChunkCount, 0, time.Since(startTime))
+
+	if is_consistent {
+		TagDiffRecordFixedWithCount(diffRange.Record.Id.Int64, diffRowCount)
+	} else if table.NoUniqueKey {
+		logger.M.Errorf("错误. 没有主键的表整表校验数据不一致, 无法自动修复, 请人工处理. %v.%v",
+			primaryRangeValue.Schema, primaryRangeValue.Table)
+	}
+
+	this.summaryLock.Lock()
+	defer this.summaryLock.Unlock()
+
+	this.Summary.MissingRows += diffRowCount.MissingRows
+	this.Summary.ExtraRows += diffRowCount.ExtraRows
+	this.Summary.DiffRows += diffRowCount.DiffRows
+	if is_consistent {
+		this.Summary.FixedChunkCount++
+	} else {
+		this.Summary.RemainDiffRanges = append(this.Summary.RemainDiffRanges, primaryRangeValue)
+	}
+
+	return nil
+}
@@ -0,0 +1,422 @@
+package mysqlchecksum
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"github.com/daiguadaidai/go-d-bus/common"
+	"github.com/daiguadaidai/go-d-bus/config"
+	"github.com/daiguadaidai/go-d-bus/gdbc"
+	"github.com/daiguadaidai/go-d-bus/logger"
+	"github.com/daiguadaidai/go-d-bus/matemap"
+	"github.com/daiguadaidai/go-d-bus/model"
+	"github.com/daiguadaidai/go-d-bus/parser"
+	"go.uber.org/zap"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const (
+	FAKE_SOURCE_HOST = "fake-source"
+	FAKE_TARGET_HOST = "fake-target"
+	FAKE_PORT        = 3306
+)
+
+// 测试使用的内存实例, 只有一个表: test.t(id INT PRIMARY KEY, name VARCHAR), 只能执行该表 sql 模板生成的 sql
+type fakeInstance struct {
+	table    *matemap.Table
+	isSource bool
+	lock     sync.Mutex
+	rows     map[int64]string // id -> name
+
+	snapshotSqls []string // 执行过的开启快照相关的 sql, 用于测试快照的获取
+	logPos       int      // SHOW MASTER STATUS 返回的位点, 每次获取都增加, 模拟源实例一直在写入
+}
+
+// 开启快照相关的 sql, 不会修改数据
+var fakeSnapshotSqls = []string{
+	"/* go-d-bus */ FLUSH TABLES WITH READ LOCK",
+	"/* go-d-bus */ UNLOCK TABLES",
+	"/* go-d-bus */ SET SESSION TRANSACTION ISOLATION LEVEL REPEATABLE READ",
+	"/* go-d-bus */ START TRANSACTION WITH CONSISTENT SNAPSHOT",
+	"/* go-d-bus */ COMMIT",
+}
+
+var fakeInstances sync.Map // dsn -> *fakeInstance
+
+func init() {
+	sql.Register("go-d-bus-fake", fakeDriver{})
+}
+
+/* 创建测试用的表, 源和目标表结构一样, 注册到需要迁移的表中
+Params:
+	_t: 测试
+*/
+func newFakeTable(t *testing.T) *matemap.Table {
+	columns := []matemap.Column{
+		{Name: "id", Type: common.MYSQL_TYPE_INT},
+		{Name: "name", Type: common.MYSQL_TYPE_VARCHAR},
+	}
+	table := &matemap.Table{
+		SourceSchema:  "test",
+		SourceName:    "t",
+		TargetSchema:  "test",
+		TargetName:    "t",
+		SourceColumns: columns,
+		TargetColumns: columns,
+	}
+	if err := table.InitColumnMapInfo(); err != nil {
+		t.Fatal(err)
+	}
+	table.InitSourceUsefulColumns()
+	table.InitSourcePKColumns([]string{"id"})
+	table.InitTargetPKColumnsFromSource()
+	table.InitALLSqlTpl()
+	matemap.SetMigrationTableMap(config.GetTableKey(table.SourceSchema, table.SourceName), table)
+
+	return table
+}
+
+/* 创建使用内存源和目标实例的 checksum, 并且初始化源和目标的数据
+Params:
+	_t: 测试
+	_table: 测试用的表
+	_sourceRows: 源的数据 id -> name
+	_targetRows: 目标的数据 id -> name
+*/
+func newFakeChecksum(t *testing.T, table *matemap.Table, sourceRows map[int64]string, targetRows map[int64]string) (*Checksum, *fakeInstance, *fakeInstance) {
+	logger.M = zap.NewNop().Sugar()
+
+	source := newFakeInstance(t, FAKE_SOURCE_HOST, table, true, sourceRows)
+	target := newFakeInstance(t, FAKE_TARGET_HOST, table, false, targetRows)
+
+	checksum := &Checksum{
+		Parser: &parser.RunParser{
+			ErrRetryCount:      1,
+			ChecksumFixMode:    parser.CHECKSUM_FIX_MODE_BISECT,
+			ChecksumBisectRows: 1,
+		},
+		ConfigMap: &config.ConfigMap{
+			TaskUUID: "test",
+			Source:   &model.Source{Host: sql.NullString{String: FAKE_SOURCE_HOST, Valid: true}, Port: sql.NullInt64{Int64: FAKE_PORT, Valid: true}},
+			Target:   &model.Target{Host: sql.NullString{String: FAKE_TARGET_HOST, Valid: true}, Port: sql.NullInt64{Int64: FAKE_PORT, Valid: true}},
+		},
+		diffSampleCounts: make(map[string]int),
+	}
+
+	return checksum, source, target
+}
+
+func newFakeInstance(t *testing.T, host string, table *matemap.Table, isSource bool, rows map[int64]string) *fakeInstance {
+	instance := &fakeInstance{table: table, isSource: isSource, rows: make(map[int64]string)}
+	for id, name := range rows {
+		instance.rows[id] = name
+	}
+
+	dsn := fmt.Sprintf("%v:%v", host, FAKE_PORT)
+	fakeInstances.Store(dsn, instance)
+	db, err := sql.Open("go-d-bus-fake", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gdbc.AddInstanceToCache(host, FAKE_PORT, db)
+
+	return instance
+}
+
+// 实例中的数据, 用于测试结果的比较
+func (this *fakeInstance) Rows() map[int64]string {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	rows := make(map[int64]string, len(this.rows))
+	for id, name := range this.rows {
+		rows[id] = name
+	}
+
+	return rows
+}
+
+// 执行过的开启快照相关的 sql
+func (this *fakeInstance) SnapshotSqls() []string {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	return append([]string{}, this.snapshotSqls...)
+}
+
+// 范围 [min, max] 或者 [min, max) 中的所有 id, 从小到大
+func (this *fakeInstance) rangeIds(min int64, max int64, isMaxExclusive bool) []int64 {
+	ids := make([]int64, 0, len(this.rows))
+	for id := range this.rows {
+		if id < min || id > max || (isMaxExclusive && id == max) {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	return ids
+}
+
+// 所有的 id, 从小到大
+func (this *fakeInstance) allIds() []int64 {
+	return this.rangeIds(-1<<63, 1<<63-1, false)
+}
+
+// 多行 checksum 值: 行数:每一行的数据, 源和目标数据一样时值一样
+func (this *fakeInstance) rowsChecksumCode(ids []int64) string {
+	items := make([]string, 0, len(ids))
+	for _, id := range ids {
+		items = append(items, fmt.Sprintf("%v=%v", id, this.rows[id]))
+	}
+
+	return fmt.Sprintf("%v:%v", len(ids), strings.Join(items, ","))
+}
+
+func singleColumnRows(column string, values ...driver.Value) *fakeRows {
+	rows := &fakeRows{columns: []string{column}}
+	for _, value := range values {
+		rows.values = append(rows.values, []driver.Value{value})
+	}
+
+	return rows
+}
+
+func idRows(ids []int64) *fakeRows {
+	values := make([]driver.Value, 0, len(ids))
+	for _, id := range ids {
+		values = append(values, id)
+	}
+
+	return singleColumnRows("id", values...)
+}
+
+func firstIdRows(ids []int64, isLast bool) *fakeRows {
+	if len(ids) == 0 {
+		return idRows(nil)
+	}
+	if isLast {
+		return idRows(ids[len(ids)-1:])
+	}
+
+	return idRows(ids[:1])
+}
+
+// 执行查询, 只支持该表 sql 模板生成的 sql
+func (this *fakeInstance) query(query string, args []int64) (*fakeRows, error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	if query == "/* go-d-bus */ SHOW MASTER STATUS" {
+		this.snapshotSqls = append(this.snapshotSqls, query)
+		this.logPos += 100
+		return &fakeRows{
+			columns: []string{"File", "Position", "Binlog_Do_DB", "Binlog_Ignore_DB", "Executed_Gtid_Set"},
+			values:  [][]driver.Value{{"mysql-bin.000001", int64(this.logPos), "", "", ""}},
+		}, nil
+	}
+
+	table := this.table
+	isSource := this.isSource
+
+	rowChecksumSql, rowsChecksumSql, pkRowsSql, rowSql := table.GetSelTargetRowChecksumSqlTpl(), table.GetSelTargetRowsChecksumSqlTpl(),
+		table.GetSelPerBatchTargetPKSqlTpl(), table.GetSelTargetRowSqlTpl()
+	if isSource {
+		rowChecksumSql, rowsChecksumSql, pkRowsSql, rowSql = table.GetSelSourceRowChecksumSqlTpl(), table.GetSelSourceRowsChecksumSqlTpl(),
+			table.GetSelPerBatchSourcePKSqlTpl(), table.GetSelSourceRowSqlTpl()
+	}
+
+	switch query {
+	case rowChecksumSql:
+		name, ok := this.rows[args[0]]
+		if !ok {
+			return singleColumnRows("checksum"), nil
+		}
+		return singleColumnRows("checksum", name), nil
+	case rowSql:
+		rows := &fakeRows{columns: []string{"id", "name"}}
+		if name, ok := this.rows[args[0]]; ok {
+			rows.values = append(rows.values, []driver.Value{args[0], name})
+		}
+		return rows, nil
+	case rowsChecksumSql:
+		return singleColumnRows("checksum", this.rowsChecksumCode(this.rangeIds(args[0], args[1], false))), nil
+	case pkRowsSql:
+		return idRows(this.rangeIds(args[0], args[1], false)), nil
+	case table.GetBoundaryPKSql(isSource, false):
+		return firstIdRows(this.allIds(), false), nil
+	case table.GetBoundaryPKSql(isSource, true):
+		return firstIdRows(this.allIds(), true), nil
+	}
+
+	for _, isMaxExclusive := range []bool{false, true} {
+		switch query {
+		case table.GetBisectRowsChecksumSql(isSource, isMaxExclusive):
+			return singleColumnRows("checksum", this.rowsChecksumCode(this.rangeIds(args[0], args[1], isMaxExclusive))), nil
+		case table.GetBisectPKSql(isSource, isMaxExclusive):
+			return idRows(this.rangeIds(args[0], args[1], isMaxExclusive)), nil
+		}
+
+		splitPrefix := table.GetBisectPKSql(isSource, isMaxExclusive) + " LIMIT "
+		if strings.HasPrefix(query, splitPrefix) {
+			offset, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(query, splitPrefix), ", 1"))
+			if err != nil {
+				return nil, err
+			}
+			ids := this.rangeIds(args[0], args[1], isMaxExclusive)
+			if offset >= len(ids) {
+				return idRows(nil), nil
+			}
+			return idRows(ids[offset : offset+1]), nil
+		}
+	}
+
+	if !isSource {
+		ids := this.allIds()
+		switch query {
+		case table.GetTargetOutOfBoundaryPKSql(false):
+			before := make([]int64, 0, 1)
+			for _, id := range ids {
+				if id < args[0] {
+					before = append(before, id)
+				}
+			}
+			return firstIdRows(before, false), nil
+		case table.GetTargetOutOfBoundaryPKSql(true):
+			after := make([]int64, 0, 1)
+			for _, id := range ids {
+				if id > args[0] {
+					after = append(after, id)
+				}
+			}
+			return firstIdRows(after, true), nil
+		}
+	}
+
+	return nil, fmt.Errorf("fake instance 不支持的查询: %v", query)
+}
+
+/* 执行修改, 只支持目标的 DELETE 和 INSERT ... ON DUPLICATE KEY UPDATE.
+sql 中的值是直接拼接的, 通过该表的 sql 模板生成 sql 比较找到对应的行
+Params:
+	_query: sql
+	_sourceRows: 源的数据, 用于找到 INSERT 的行
+*/
+func (this *fakeInstance) exec(query string, sourceRows map[int64]string) error {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	for _, snapshotSql := range fakeSnapshotSqls {
+		if query == snapshotSql {
+			this.snapshotSqls = append(this.snapshotSqls, query)
+			return nil
+		}
+	}
+
+	for id := range this.rows {
+		if query == this.table.GetDelSqlTpl([]interface{}{id}) {
+			delete(this.rows, id)
+			return nil
+		}
+	}
+
+	for id, name := range sourceRows {
+		insertSql, err := this.table.GetInsOnDupUpdateBatchSqlTpl_V3([][]interface{}{{id, name}})
+		if err != nil {
+			return err
+		}
+		if query == insertSql {
+			this.rows[id] = name
+			return nil
+		}
+	}
+
+	return fmt.Errorf("fake instance 不支持的修改: %v", query)
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(dsn string) (driver.Conn, error) {
+	instance, ok := fakeInstances.Load(dsn)
+	if !ok {
+		return nil, fmt.Errorf("fake instance 不存在: %v", dsn)
+	}
+
+	return &fakeConn{instance: instance.(*fakeInstance)}, nil
+}
+
+type fakeConn struct {
+	instance *fakeInstance
+}
+
+func (this *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, fmt.Errorf("fake instance 不支持 prepare")
+}
+
+func (this *fakeConn) Close() error { return nil }
+
+func (this *fakeConn) Begin() (driver.Tx, error) {
+	return nil, fmt.Errorf("fake instance 不支持事务")
+}
+
+func (this *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	int64Args := make([]int64, 0, len(args))
+	for _, arg := range args {
+		value, ok := arg.Value.(int64)
+		if !ok {
+			return nil, fmt.Errorf("fake instance 只支持整数参数: %v", arg.Value)
+		}
+		int64Args = append(int64Args, value)
+	}
+
+	return this.instance.query(query, int64Args)
+}
+
+func (this *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	// INSERT 的数据从源获取
+	var sourceRows map[int64]string
+	if source, ok := fakeInstances.Load(fmt.Sprintf("%v:%v", FAKE_SOURCE_HOST, FAKE_PORT)); ok {
+		sourceRows = source.(*fakeInstance).Rows()
+	}
+	if err := this.instance.exec(query, sourceRows); err != nil {
+		return nil, err
+	}
+
+	return driver.RowsAffected(1), nil
+}
+
+type fakeRows struct {
+	columns []string
+	values  [][]driver.Value
+	index   int
+}
+
+func (this *fakeRows) Columns() []string { return this.columns }
+
+func (this *fakeRows) Close() error { return nil }
+
+func (this *fakeRows) Next(dest []driver.Value) error {
+	if this.index >= len(this.values) {
+		return io.EOF
+	}
+	copy(dest, this.values[this.index])
+	this.index++
+
+	return nil
+}
+
+// id 字段是整数, 其他是字符串, helper.GetRows 通过该类型转化值
+func (this *fakeRows) ColumnTypeScanType(index int) reflect.Type {
+	if this.columns[index] == "id" {
+		return reflect.TypeOf(int64(0))
+	}
+
+	return reflect.TypeOf("")
+}
@@ -0,0 +1,495 @@
+package mysqlchecksum
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/daiguadaidai/go-d-bus/common"
+	"github.com/daiguadaidai/go-d-bus/config"
+	"github.com/daiguadaidai/go-d-bus/gdbc"
+	"github.com/daiguadaidai/go-d-bus/logger"
+	"github.com/daiguadaidai/go-d-bus/matemap"
+	"github.com/daiguadaidai/go-d-bus/model"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	FIX_SQL_TYPE_REPLACE = "replace" // 使用源数据替换目标数据
+	FIX_SQL_TYPE_DELETE  = "delete"  // 删除目标多出的行
+
+	FIX_SQL_HEADER_PREFIX = "-- go-d-bus fix: " // 每条修复sql的开始, 后面是 json 格式的修复信息
+	FIX_SQL_BEFORE_PREFIX = "-- before: "       // 修复前目标的数据
+	FIX_SQL_AFTER_PREFIX  = "-- after: "        // 修复后目标的数据(源数据)
+)
+
+/* 一条修复sql, 修复sql文件中的格式如下:
+-- go-d-bus fix: {"type":"replace","schema":"db","table":"t","pk_value":{"id":1},...}
+-- before: [1,"a"]
+-- after: [1,"b"]
+INSERT INTO ... ;
+执行前比较源和目标该行当前的 checksum 值和生成时是否一样, 一样才执行.
+执行的是通过修复信息重新生成的sql, 文件中的sql和修复后的数据被修改过则不执行
+*/
+type FixSql struct {
+	Type              string          `json:"type"`               // 修复类型: replace, delete
+	Schema            string          `json:"schema"`             // 源库名
+	Table             string          `json:"table"`              // 源表名
+	PKValue           json.RawMessage `json:"pk_value"`           // 该行的主键值
+	ChecksumAlgorithm string          `json:"checksum_algorithm"` // 生成 checksum 值使用的算法
+	SourceCode        string          `json:"source_code"`        // 生成时源该行的 checksum 值
+	TargetCode        string          `json:"target_code"`        // 生成时目标该行的 checksum 值
+
+	Before []interface{} `json:"-"` // 修复前目标的数据
+	After  []interface{} `json:"-"` // 修复后目标的数据(源数据)
+	Sql    string        `json:"-"` // 修复的sql
+
+	afterJson string // 从文件中读取的修复后的数据, 执行前和源该行当前的数据比较
+}
+
+/* 创建一条修复sql
+Params:
+	_typ: 修复类型
+	_table: 需要迁移的表
+	_pkValues: 该行的主键值
+	_sourceCode: 源该行的 checksum 值
+	_targetCode: 目标该行的 checksum 值
+*/
+func NewFixSql(typ string, table *matemap.Table, pkValues []interface{}, sourceCode string, targetCode string) (*FixSql, error) {
+	pkValueMap := make(map[string]interface{})
+	for i, pkColumnName := range table.FindSourcePKColumnNames() {
+		pkValueMap[pkColumnName] = pkValues[i]
+	}
+	pkValue, err := common.Map2Json(pkValueMap)
+	if err != nil {
+		return nil, fmt.Errorf("失败. 主键值转化成json. %v.%v. %v. %v", table.SourceSchema, table.SourceName, pkValues, err)
+	}
+
+	return &FixSql{
+		Type:              typ,
+		Schema:            table.SourceSchema,
+		Table:             table.SourceName,
+		PKValue:           json.RawMessage(pkValue),
+		ChecksumAlgorithm: matemap.GetChecksumAlgorithm(),
+		SourceCode:        sourceCode,
+		TargetCode:        targetCode,
+	}, nil
+}
+
+/* 获取主键值, 顺序和源表主键字段一样
+Params:
+	_table: 需要迁移的表
+*/
+func (this *FixSql) GetPKValues(table *matemap.Table) ([]interface{}, error) {
+	pkValueMap, err := common.Json2MapBySqlType(string(this.PKValue), table.FindSourcePKColumnTypeMap())
+	if err != nil {
+		return nil, fmt.Errorf("失败. 主键值 json 转化成 map. %v.%v. %v. %v", this.Schema, this.Table, string(this.PKValue), err)
+	}
+
+	pkColumnNames := table.FindSourcePKColumnNames()
+	pkValues := make([]interface{}, 0, len(pkColumnNames))
+	for _, pkColumnName := range pkColumnNames {
+		pkValue, ok := pkValueMap[pkColumnName]
+		if !ok {
+			return nil, fmt.Errorf("失败. 修复sql中没有主键字段 %v. %v.%v. %v", pkColumnName, this.Schema, this.Table, string(this.PKValue))
+		}
+		pkValues = append(pkValues, pkValue)
+	}
+
+	return pkValues, nil
+}
+
+/* 通过修复类型和主键值生成修复sql, 只会修改目标表中该主键的一行
+Params:
+	_table: 需要迁移的表
+	_pkValues: 该行的主键值
+	_sourceRow: 源该行的数据, 删除时为 nil
+*/
+func (this *FixSql) GenerateSql(table *matemap.Table, pkValues []interface{}, sourceRow []interface{}) (string, error) {
+	switch this.Type {
+	case FIX_SQL_TYPE_DELETE:
+		return table.GetDelSqlTpl(pkValues), nil
+	case FIX_SQL_TYPE_REPLACE:
+		if len(sourceRow) == 0 {
+			return "", fmt.Errorf("失败. 生成修复sql, 没有源该行的数据. %v.%v. %v", this.Schema, this.Table, pkValues)
+		}
+		replaceSql, err := table.GetInsOnDupUpdateBatchSqlTpl_V3([][]interface{}{sourceRow})
+		if err != nil {
+			return "", fmt.Errorf("失败. 生成修复sql. %v.%v. %v. %v", this.Schema, this.Table, pkValues, err)
+		}
+		return replaceSql, nil
+	}
+
+	return "", fmt.Errorf("失败. 不支持的修复类型: %v. %v.%v. %v", this.Type, this.Schema, this.Table, pkValues)
+}
+
+// 转化成写入文件的字符串
+func (this *FixSql) String() string {
+	header, _ := json.Marshal(this)
+
+	lines := make([]string, 0, 5)
+	lines = append(lines, FIX_SQL_HEADER_PREFIX+string(header))
+	lines = append(lines, FIX_SQL_BEFORE_PREFIX+common.ToJsonStr(this.Before))
+	lines = append(lines, FIX_SQL_AFTER_PREFIX+common.ToJsonStr(this.After))
+	lines = append(lines, strings.TrimSpace(this.Sql)+";")
+
+	return strings.Join(lines, "\n") + "\n\n"
+}
+
+// 把修复sql按顺序写入文件, 不直接修改目标数据
+type FixSqlWriter struct {
+	FileName string
+	file     *os.File
+	lock     sync.Mutex
+}
+
+/* 创建修复sql文件, 文件已经存在则追加
+Params:
+	_fileName: 文件名
+*/
+func NewFixSqlWriter(fileName string) (*FixSqlWriter, error) {
+	file, err := os.OpenFile(fileName, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("失败. 打开修复sql文件. %v. %v", fileName, err)
+	}
+
+	return &FixSqlWriter{FileName: fileName, file: file}, nil
+}
+
+/* 写入一条修复sql
+Params:
+	_fixSql: 修复sql
+*/
+func (this *FixSqlWriter) Write(fixSql *FixSql) error {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	if _, err := this.file.WriteString(fixSql.String()); err != nil {
+		return fmt.Errorf("失败. 写入修复sql文件. %v. %v", this.FileName, err)
+	}
+
+	return nil
+}
+
+func (this *FixSqlWriter) Close() error {
+	return this.file.Close()
+}
+
+/* 读取修复sql文件中所有的修复sql, 删除了sql语句的修复信息会被忽略
+Params:
+	_fileName: 文件名
+*/
+func ReadFixSqlFile(fileName string) ([]*FixSql, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("失败. 打开修复sql文件. %v. %v", fileName, err)
+	}
+	defer file.Close()
+
+	fixSqls := make([]*FixSql, 0, 100)
+	var fixSql *FixSql
+	sqlLines := make([]string, 0, 1)
+
+	// 上一条修复sql读取完成
+	appendFixSql := func() {
+		if fixSql == nil {
+			return
+		}
+		fixSql.Sql = strings.TrimSuffix(strings.TrimSpace(strings.Join(sqlLines, "\n")), ";")
+		if fixSql.Sql == "" {
+			logger.M.Warnf("警告. 修复sql被删除, 忽略. %v.%v. %v", fixSql.Schema, fixSql.Table, string(fixSql.PKValue))
+		} else {
+			fixSqls = append(fixSqls, fixSql)
+		}
+		fixSql = nil
+		sqlLines = sqlLines[:0]
+	}
+
+	reader := bufio.NewReader(file)
+	isHeader := false
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, fmt.Errorf("失败. 读取修复sql文件. %v. %v", fileName, err)
+		}
+		isEOF := err == io.EOF
+		line = strings.TrimSuffix(line, "\n")
+
+		if strings.HasPrefix(line, FIX_SQL_HEADER_PREFIX) {
+			appendFixSql()
+
+			fixSql = new(FixSql)
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, FIX_SQL_HEADER_PREFIX)), fixSql); err != nil {
+				return nil, fmt.Errorf("失败. 解析修复sql信息. %v. %v", line, err)
+			}
+			isHeader = true
+		} else if fixSql != nil && isHeader && strings.HasPrefix(line, FIX_SQL_AFTER_PREFIX) {
+			fixSql.afterJson = strings.TrimPrefix(line, FIX_SQL_AFTER_PREFIX)
+		} else if fixSql != nil && !(isHeader && strings.HasPrefix(line, "-- ")) {
+			isHeader = false
+			sqlLines = append(sqlLines, line)
+		}
+
+		if isEOF {
+			break
+		}
+	}
+	appendFixSql()
+
+	return fixSqls, nil
+}
+
+// 执行修复sql文件的结果汇总
+type ApplyFixSummary struct {
+	TotalCount      int // 修复sql总数
+	AppliedCount    int // 执行了的修复sql数
+	ConsistentCount int // 已经一致不需要执行的修复sql数
+	ChangedCount    int // 生成后数据发生了变化, 没有执行的修复sql数
+	ModifiedCount   int // 文件中的sql或修复后的数据被修改过, 没有执行的修复sql数
+
+	FixedRecordCount   int // 执行后再次校验范围数据一致, 标记修复的不一致记录数
+	UnfixedRecordCount int // 执行后再次校验范围数据还是不一致, 保持没有修复的不一致记录数
+}
+
+// 汇总结果的字符串, 用于打印
+func (this *ApplyFixSummary) String() string {
+	return fmt.Sprintf("执行修复sql汇总. 总数: %v, 执行: %v, 已经一致不需要执行: %v, 数据发生了变化没有执行: %v, sql被修改过没有执行: %v. "+
+		"不一致记录标记修复: %v, 还没有修复: %v",
+		this.TotalCount, this.AppliedCount, this.ConsistentCount, this.ChangedCount, this.ModifiedCount,
+		this.FixedRecordCount, this.UnfixedRecordCount)
+}
+
+// 是否有生成后数据发生了变化没有执行的修复sql
+func (this *ApplyFixSummary) HasChanged() bool {
+	return this.ChangedCount > 0
+}
+
+// 是否有sql被修改过没有执行的修复sql
+func (this *ApplyFixSummary) HasModified() bool {
+	return this.ModifiedCount > 0
+}
+
+/* 按顺序执行修复sql文件中的修复sql, 执行前再次比较源和目标该行的 checksum 值,
+和生成时一样才执行, 数据发生了变化说明审核的sql已经不正确, 需要重新生成.
+执行完成后再次校验这些表还没有修复的不一致记录, 范围数据一致才标记修复
+Params:
+	_configMap: 配置信息
+	_fileName: 修复sql文件
+	_errRetryCount: 出错重试次数
+*/
+func ApplyFixSqlFile(configMap *config.ConfigMap, fileName string, errRetryCount int) (*ApplyFixSummary, error) {
+	fixSqls, err := ReadFixSqlFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &ApplyFixSummary{TotalCount: len(fixSqls)}
+	for _, fixSql := range fixSqls {
+		var status int
+		for i := 0; i < errRetryCount; i++ {
+			if status, err = ApplyFixSql(configMap, fixSql); err != nil {
+				logger.M.Error(err)
+				time.Sleep(time.Second)
+				continue
+			}
+			break
+		}
+		if err != nil {
+			return summary, fmt.Errorf("失败. 执行修复sql, 并且重试次数已经达到上线:%v. %v", errRetryCount, err)
+		}
+
+		switch status {
+		case APPLY_FIX_SQL_STATUS_APPLIED:
+			summary.AppliedCount++
+		case APPLY_FIX_SQL_STATUS_CONSISTENT:
+			summary.ConsistentCount++
+		case APPLY_FIX_SQL_STATUS_CHANGED:
+			summary.ChangedCount++
+		case APPLY_FIX_SQL_STATUS_MODIFIED:
+			summary.ModifiedCount++
+		}
+	}
+
+	if err = TagFixedDiffRecordsAfterApply(configMap, fixSqls, errRetryCount, summary); err != nil {
+		return summary, err
+	}
+
+	return summary, nil
+}
+
+/* 执行修复sql后, 再次校验修复sql文件中的表还没有修复的不一致记录, 范围数据一致才标记修复
+Params:
+	_configMap: 配置信息
+	_fixSqls: 修复sql文件中的修复sql
+	_errRetryCount: 出错重试次数
+	_summary: 执行修复sql的结果汇总, 记录标记修复和还没有修复的记录数
+*/
+func TagFixedDiffRecordsAfterApply(configMap *config.ConfigMap, fixSqls []*FixSql, errRetryCount int, summary *ApplyFixSummary) error {
+	fixTables := make(map[string]bool)
+	for _, fixSql := range fixSqls {
+		fixTables[config.GetTableKey(fixSql.Schema, fixSql.Table)] = true
+	}
+
+	diffRecords, err := FindNoFixDiffRecords(configMap.TaskUUID)
+	if err != nil {
+		return fmt.Errorf("失败. 获取还没有修复的不一致记录(执行修复sql后). %v", err)
+	}
+
+	for _, diffRecord := range diffRecords {
+		if !fixTables[config.GetTableKey(diffRecord.SourceSchema.String, diffRecord.SourceTable.String)] {
+			continue
+		}
+
+		var isConsistent bool
+		for i := 0; i < errRetryCount; i++ {
+			if isConsistent, err = IsDiffRecordConsistent(configMap, diffRecord); err != nil {
+				logger.M.Error(err)
+				time.Sleep(time.Second)
+				continue
+			}
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("失败. 再次校验不一致记录, 并且重试次数已经达到上线:%v. %v", errRetryCount, err)
+		}
+
+		if !isConsistent {
+			summary.UnfixedRecordCount++
+			logger.M.Warnf("警告. 执行修复sql后范围数据还是不一致, 不一致记录保持没有修复. id: %v. %v.%v. min: %v max: %v",
+				diffRecord.Id.Int64, diffRecord.SourceSchema.String, diffRecord.SourceTable.String,
+				diffRecord.MinIDValue.String, diffRecord.MaxIDValue.String)
+			continue
+		}
+
+		if affected := TagDiffRecordFixed(diffRecord.Id.Int64); affected < 1 {
+			logger.M.Warnf("标记不一致数据修复(未成功). id: %v", diffRecord.Id.Int64)
+			continue
+		}
+		summary.FixedRecordCount++
+		logger.M.Infof("执行修复sql后范围数据一致, 已经标记不一致数据修复完成. id: %v. %v.%v. min: %v max: %v",
+			diffRecord.Id.Int64, diffRecord.SourceSchema.String, diffRecord.SourceTable.String,
+			diffRecord.MinIDValue.String, diffRecord.MaxIDValue.String)
+	}
+
+	return nil
+}
+
+/* 比较不一致记录范围内源和目标的数据是否一致
+Params:
+	_configMap: 配置信息
+	_diffRecord: 不一致记录
+*/
+func IsDiffRecordConsistent(configMap *config.ConfigMap, diffRecord model.DataChecksum) (bool, error) {
+	table, err := matemap.GetMigrationTableBySchemaTable(diffRecord.SourceSchema.String, diffRecord.SourceTable.String)
+	if err != nil {
+		return false, fmt.Errorf("失败. 获取需要迁移的表(再次校验不一致记录). %v.%v. %v",
+			diffRecord.SourceSchema.String, diffRecord.SourceTable.String, err)
+	}
+
+	primaryRangeValue, err := diffRecord2PrimaryRangeValue(diffRecord, table)
+	if err != nil {
+		return false, err
+	}
+
+	sourceCode, err := GetSourceRowsChecksumCode(configMap.Source.Host.String, int(configMap.Source.Port.Int64), primaryRangeValue, table)
+	if err != nil {
+		return false, err
+	}
+	targetCode, err := GetTargetRowsChecksumCode(configMap.Target.Host.String, int(configMap.Target.Port.Int64), primaryRangeValue, table)
+	if err != nil {
+		return false, err
+	}
+
+	return sourceCode == targetCode, nil
+}
+
+const (
+	APPLY_FIX_SQL_STATUS_APPLIED    = iota // 执行了修复sql
+	APPLY_FIX_SQL_STATUS_CONSISTENT        // 已经一致, 不需要执行
+	APPLY_FIX_SQL_STATUS_CHANGED           // 生成后数据发生了变化, 没有执行
+	APPLY_FIX_SQL_STATUS_MODIFIED          // 文件中的sql或修复后的数据被修改过, 没有执行
+)
+
+/* 再次比较该行数据后执行一条修复sql.
+不直接执行文件中的sql, 而是通过修复类型, 主键值和源该行当前的数据重新生成, 保证只修改目标表中该主键的一行.
+重新生成的sql(以及修复后的数据)和文件中的不一样说明审核后被修改过, 不执行
+Params:
+	_configMap: 配置信息
+	_fixSql: 修复sql
+*/
+func ApplyFixSql(configMap *config.ConfigMap, fixSql *FixSql) (int, error) {
+	if fixSql.ChecksumAlgorithm != matemap.GetChecksumAlgorithm() {
+		return 0, fmt.Errorf("失败. 修复sql生成时使用的 checksum 算法 %v 和当前的 %v 不一样, 请使用 --checksum-algorithm=%v",
+			fixSql.ChecksumAlgorithm, matemap.GetChecksumAlgorithm(), fixSql.ChecksumAlgorithm)
+	}
+
+	table, err := matemap.GetMigrationTableBySchemaTable(fixSql.Schema, fixSql.Table)
+	if err != nil {
+		return 0, fmt.Errorf("失败. 获取需要迁移的表(执行修复sql). %v.%v. %v", fixSql.Schema, fixSql.Table, err)
+	}
+	pkValues, err := fixSql.GetPKValues(table)
+	if err != nil {
+		return 0, err
+	}
+
+	// 1. 再次比较源和目标该行的 checksum 值
+	sourceCode, err := GetSourceRowChecksumCode(configMap.Source.Host.String, int(configMap.Source.Port.Int64), pkValues, table)
+	if err != nil {
+		return 0, fmt.Errorf("执行修复sql. %v", err)
+	}
+	targetCode, err := GetTargetRowChecksumCode(configMap.Target.Host.String, int(configMap.Target.Port.Int64), pkValues, table)
+	if err != nil {
+		return 0, fmt.Errorf("执行修复sql. %v", err)
+	}
+	if sourceCode == targetCode {
+		logger.M.Infof("该行数据已经一致, 不需要执行修复sql. %v.%v. Primary: %v", fixSql.Schema, fixSql.Table, pkValues)
+		return APPLY_FIX_SQL_STATUS_CONSISTENT, nil
+	}
+	if sourceCode != fixSql.SourceCode || targetCode != fixSql.TargetCode {
+		logger.M.Warnf("警告. 生成修复sql后该行数据发生了变化, 不执行修复sql, 请重新生成. %v.%v. Primary: %v",
+			fixSql.Schema, fixSql.Table, pkValues)
+		return APPLY_FIX_SQL_STATUS_CHANGED, nil
+	}
+
+	// 2. 通过修复信息重新生成修复sql, 和文件中的不一样则不执行
+	var sourceRow []interface{}
+	if fixSql.Type == FIX_SQL_TYPE_REPLACE {
+		if sourceRow, err = GetSourceRowByPK(configMap.Source.Host.String, int(configMap.Source.Port.Int64), pkValues, table); err != nil {
+			return 0, fmt.Errorf("执行修复sql. %v", err)
+		}
+		if len(sourceRow) == 0 {
+			logger.M.Warnf("警告. 比较后源该行被删除, 不执行修复sql, 请重新生成. %v.%v. Primary: %v", fixSql.Schema, fixSql.Table, pkValues)
+			return APPLY_FIX_SQL_STATUS_CHANGED, nil
+		}
+		if fixSql.afterJson != "" && fixSql.afterJson != common.ToJsonStr(sourceRow) {
+			logger.M.Warnf("警告. 修复后的数据和源该行的数据不一样, 修复sql文件被修改过, 不执行. %v.%v. Primary: %v. after: %v",
+				fixSql.Schema, fixSql.Table, pkValues, fixSql.afterJson)
+			return APPLY_FIX_SQL_STATUS_MODIFIED, nil
+		}
+	}
+	applySql, err := fixSql.GenerateSql(table, pkValues, sourceRow)
+	if err != nil {
+		return 0, err
+	}
+	if strings.TrimSpace(applySql) != strings.TrimSpace(fixSql.Sql) {
+		logger.M.Warnf("警告. 修复sql和通过修复信息生成的不一样, 修复sql文件被修改过, 不执行. %v.%v -> %v.%v. Primary: %v. 文件中: %v. 生成: %v",
+			table.SourceSchema, table.SourceName, table.TargetSchema, table.TargetName, pkValues, fixSql.Sql, applySql)
+		return APPLY_FIX_SQL_STATUS_MODIFIED, nil
+	}
+
+	// 3. 在目标执行重新生成的修复sql
+	instance, ok := gdbc.GetDynamicDBByHostPort(configMap.Target.Host.String, configMap.Target.Port.Int64)
+	if !ok {
+		return 0, fmt.Errorf("缓存中不存在该实例(%v:%v). 执行修复sql", configMap.Target.Host.String, configMap.Target.Port.Int64)
+	}
+	if _, err := instance.Exec(applySql); err != nil {
+		return 0, fmt.Errorf("失败. 执行修复sql. %v.%v. Primary: %v. %v. %v", fixSql.Schema, fixSql.Table, pkValues, applySql, err)
+	}
+	logger.M.Warnf("执行修复sql(%v). %v.%v -> %v.%v. Primary: %v",
+		fixSql.Type, table.SourceSchema, table.SourceName, table.TargetSchema, table.TargetName, pkValues)
+
+	return APPLY_FIX_SQL_STATUS_APPLIED, nil
+}
@@ -0,0 +1,192 @@
+package mysqlchecksum
+
+import (
+	"github.com/daiguadaidai/go-d-bus/logger"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFixSql_StringReadFixSqlFile(t *testing.T) {
+	logger.M = zap.NewNop().Sugar()
+	table := newFakeTable(t)
+
+	replaceSql, err := NewFixSql(FIX_SQL_TYPE_REPLACE, table, []interface{}{1}, "source-1", "target-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	replaceSql.Before = []interface{}{1, "a"}
+	replaceSql.After = []interface{}{1, "b"}
+	replaceSql.Sql = "INSERT INTO `test`.`t` (`id`, `name`) VALUES (1, 'b') ON DUPLICATE KEY UPDATE `name` = 'b'"
+
+	deleteSql, err := NewFixSql(FIX_SQL_TYPE_DELETE, table, []interface{}{2}, "", "target-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	deleteSql.Before = []interface{}{2, "c"}
+	deleteSql.Sql = "DELETE FROM `test`.`t` WHERE `id` = 2"
+
+	removedSql, err := NewFixSql(FIX_SQL_TYPE_DELETE, table, []interface{}{3}, "", "target-3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	removedSql.Before = []interface{}{3, "d"}
+	removedSql.Sql = "DELETE FROM `test`.`t` WHERE `id` = 3"
+
+	// 1. 写入的格式: 修复信息, 修复前数据, 修复后数据, sql
+	lines := strings.Split(replaceSql.String(), "\n")
+	if len(lines) != 6 {
+		t.Fatalf("期望 4 行加一个空行, 实际 %q", lines)
+	}
+	if !strings.HasPrefix(lines[0], FIX_SQL_HEADER_PREFIX+`{"type":"replace","schema":"test","table":"t","pk_value":{"id":1}`) {
+		t.Fatalf("修复信息不正确: %v", lines[0])
+	}
+	if lines[1] != FIX_SQL_BEFORE_PREFIX+`[1,"a"]` || lines[2] != FIX_SQL_AFTER_PREFIX+`[1,"b"]` {
+		t.Fatalf("修复前后数据不正确: %v, %v", lines[1], lines[2])
+	}
+	if lines[3] != replaceSql.Sql+";" {
+		t.Fatalf("修复sql不正确: %v", lines[3])
+	}
+
+	// 2. 审核时删除了第三条修复sql的语句
+	removed := strings.Replace(removedSql.String(), removedSql.Sql+";", "", 1)
+	content := replaceSql.String() + deleteSql.String() + removed
+
+	dir, err := ioutil.TempDir("", "fix_sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fileName := filepath.Join(dir, "fix.sql")
+	if err := ioutil.WriteFile(fileName, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	fixSqls, err := ReadFixSqlFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fixSqls) != 2 {
+		t.Fatalf("删除了语句的修复sql应该被忽略, 期望 2 条, 实际 %v", len(fixSqls))
+	}
+
+	for i, expect := range []*FixSql{replaceSql, deleteSql} {
+		fixSql := fixSqls[i]
+		if fixSql.Type != expect.Type || fixSql.Schema != expect.Schema || fixSql.Table != expect.Table ||
+			fixSql.SourceCode != expect.SourceCode || fixSql.TargetCode != expect.TargetCode ||
+			fixSql.ChecksumAlgorithm != expect.ChecksumAlgorithm {
+			t.Fatalf("第 %v 条修复信息不一样. 期望 %+v, 实际 %+v", i, expect, fixSql)
+		}
+		if fixSql.Sql != expect.Sql {
+			t.Fatalf("第 %v 条修复sql不一样(修复前后数据不是sql). 期望 %v, 实际 %v", i, expect.Sql, fixSql.Sql)
+		}
+
+		pkValues, err := fixSql.GetPKValues(table)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectPKValues, _ := expect.GetPKValues(table)
+		if len(pkValues) != 1 || pkValues[0] != expectPKValues[0] {
+			t.Fatalf("第 %v 条主键值不一样. 期望 %v, 实际 %v", i, expectPKValues, pkValues)
+		}
+	}
+}
+
+/* 通过源和目标当前的数据生成一条修复sql, 写入文件后再读取出来
+Params:
+	_t: 测试
+	_checksum: 使用内存实例的 checksum
+	_typ: 修复类型
+	_id: 主键值
+	_edit: 修改写入文件的内容, 模拟审核时修改了文件
+*/
+func newFakeFixSqlFromFile(t *testing.T, checksum *Checksum, typ string, id int64, edit func(string) string) *FixSql {
+	table := newFakeTable(t)
+	configMap := checksum.ConfigMap
+	pkValues := []interface{}{id}
+
+	sourceCode, err := GetSourceRowChecksumCode(configMap.Source.Host.String, int(configMap.Source.Port.Int64), pkValues, table)
+	if err != nil {
+		t.Fatal(err)
+	}
+	targetCode, err := GetTargetRowChecksumCode(configMap.Target.Host.String, int(configMap.Target.Port.Int64), pkValues, table)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fixSql, err := NewFixSql(typ, table, pkValues, sourceCode, targetCode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if typ == FIX_SQL_TYPE_REPLACE {
+		if fixSql.After, err = GetSourceRowByPK(configMap.Source.Host.String, int(configMap.Source.Port.Int64), pkValues, table); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if fixSql.Sql, err = fixSql.GenerateSql(table, pkValues, fixSql.After); err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "fix_sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fileName := filepath.Join(dir, "fix.sql")
+	if err := ioutil.WriteFile(fileName, []byte(edit(fixSql.String())), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	fixSqls, err := ReadFixSqlFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fixSqls) != 1 {
+		t.Fatalf("期望 1 条修复sql, 实际 %v", len(fixSqls))
+	}
+
+	return fixSqls[0]
+}
+
+func TestApplyFixSql_RegenerateSql(t *testing.T) {
+	table := newFakeTable(t)
+	checksum, _, target := newFakeChecksum(t, table,
+		map[int64]string{1: "b"},
+		map[int64]string{1: "a", 2: "c"})
+	unchanged := func(content string) string { return content }
+
+	// 1. 修复sql被改成了删除其他的行, 不执行
+	fixSql := newFakeFixSqlFromFile(t, checksum, FIX_SQL_TYPE_REPLACE, 1, func(content string) string {
+		replaceSql, _ := table.GetInsOnDupUpdateBatchSqlTpl_V3([][]interface{}{{int64(1), "b"}})
+		return strings.Replace(content, strings.TrimSpace(replaceSql), table.GetDelSqlTpl([]interface{}{int64(2)}), 1)
+	})
+	if status, err := ApplyFixSql(checksum.ConfigMap, fixSql); err != nil || status != APPLY_FIX_SQL_STATUS_MODIFIED {
+		t.Fatalf("修改过的修复sql期望不执行, 实际 %v, %v", status, err)
+	}
+
+	// 2. 修复后的数据被修改过, 不执行
+	fixSql = newFakeFixSqlFromFile(t, checksum, FIX_SQL_TYPE_REPLACE, 1, func(content string) string {
+		return strings.Replace(content, FIX_SQL_AFTER_PREFIX+`[1,"b"]`, FIX_SQL_AFTER_PREFIX+`[1,"x"]`, 1)
+	})
+	if status, err := ApplyFixSql(checksum.ConfigMap, fixSql); err != nil || status != APPLY_FIX_SQL_STATUS_MODIFIED {
+		t.Fatalf("修改过修复后数据的修复sql期望不执行, 实际 %v, %v", status, err)
+	}
+	if rows := target.Rows(); len(rows) != 2 || rows[1] != "a" || rows[2] != "c" {
+		t.Fatalf("没有执行修复sql, 目标数据期望不变, 实际 %v", rows)
+	}
+
+	// 3. 没有修改过的修复sql执行重新生成的sql
+	fixSql = newFakeFixSqlFromFile(t, checksum, FIX_SQL_TYPE_REPLACE, 1, unchanged)
+	if status, err := ApplyFixSql(checksum.ConfigMap, fixSql); err != nil || status != APPLY_FIX_SQL_STATUS_APPLIED {
+		t.Fatalf("期望执行修复sql, 实际 %v, %v", status, err)
+	}
+	fixSql = newFakeFixSqlFromFile(t, checksum, FIX_SQL_TYPE_DELETE, 2, unchanged)
+	if status, err := ApplyFixSql(checksum.ConfigMap, fixSql); err != nil || status != APPLY_FIX_SQL_STATUS_APPLIED {
+		t.Fatalf("期望执行修复sql, 实际 %v, %v", status, err)
+	}
+	if rows := target.Rows(); len(rows) != 1 || rows[1] != "b" {
+		t.Fatalf("修复后目标数据期望 map[1:b], 实际 %v", rows)
+	}
+}
@@ -0,0 +1,158 @@
+package mysqlrowcopy
+
+import (
+	"github.com/daiguadaidai/go-d-bus/logger"
+	"github.com/daiguadaidai/go-d-bus/parser"
+	"sync"
+	"time"
+)
+
+const (
+	CHUNK_SIZER_WEIGHT  = 0.75 // 计算每秒行数和平均每行字节数时, 历史值所占的权重
+	CHUNK_SIZER_NUM_LEN = 8    // 非字符串类型的字段估算的字节数
+)
+
+// 每个表 row copy 的统计信息
+type TableChunkStat struct {
+	Limit       int     // 当前每次 row copy 的行数
+	RowsPerSec  float64 // 查询和插入平均每秒处理的行数
+	BytesPerRow float64 // 平均每行的字节数
+}
+
+// 根据 row copy 的耗时, 动态调整每个表每次 row copy 的行数, 原理和 pt-table-checksum --chunk-time 相同
+type ChunkSizer struct {
+	sync.Mutex
+
+	ChunkTime   float64 // 每次 row copy 期望的耗时(秒), <= 0 则使用固定的行数
+	MinLimit    int     // 每次最少行数
+	MaxLimit    int     // 每次最多行数
+	MaxBytes    int     // 每次最多字节数
+	DefaultSize int     // 初始行数
+
+	TableStatMap map[string]*TableChunkStat // 每个表的统计信息 map: {"schema.table": TableChunkStat}
+}
+
+/* 创建一个自适应行数计算器
+Params:
+    _runParser: 命令行解析的信息
+*/
+func NewChunkSizer(runParser *parser.RunParser) *ChunkSizer {
+	return &ChunkSizer{
+		ChunkTime:    runParser.RowCopyChunkTime,
+		MinLimit:     runParser.RowCopyMinLimit,
+		MaxLimit:     runParser.RowCopyMaxLimit,
+		MaxBytes:     runParser.RowCopyChunkMaxBytes,
+		DefaultSize:  runParser.RowCopyLimit,
+		TableStatMap: make(map[string]*TableChunkStat),
+	}
+}
+
+// 是否开启了自适应行数
+func (this *ChunkSizer) Enabled() bool {
+	return this.ChunkTime > 0
+}
+
+/* 获取表下一次 row copy 的行数
+Params:
+    _tableName: 表名 schema.table
+*/
+func (this *ChunkSizer) GetLimit(tableName string) int {
+	if !this.Enabled() {
+		return this.DefaultSize
+	}
+
+	this.Lock()
+	defer this.Unlock()
+
+	stat, ok := this.TableStatMap[tableName]
+	if !ok {
+		return this.DefaultSize
+	}
+
+	return stat.Limit
+}
+
+/* 记录一次 row copy 的耗时, 并计算表下一次 row copy 的行数
+Params:
+    _tableName: 表名 schema.table
+    _rowCnt: 本次拷贝的行数
+    _byteCnt: 本次拷贝的字节数
+    _elapsed: 本次查询和插入的总耗时
+*/
+func (this *ChunkSizer) Record(tableName string, rowCnt int, byteCnt int, elapsed time.Duration) {
+	if !this.Enabled() || rowCnt <= 0 {
+		return
+	}
+
+	seconds := elapsed.Seconds()
+	if seconds <= 0 {
+		seconds = 0.001
+	}
+	rowsPerSec := float64(rowCnt) / seconds
+	bytesPerRow := float64(byteCnt) / float64(rowCnt)
+
+	this.Lock()
+	defer this.Unlock()
+
+	stat, ok := this.TableStatMap[tableName]
+	if !ok {
+		stat = &TableChunkStat{Limit: this.DefaultSize, RowsPerSec: rowsPerSec, BytesPerRow: bytesPerRow}
+		this.TableStatMap[tableName] = stat
+	} else {
+		stat.RowsPerSec = CHUNK_SIZER_WEIGHT*stat.RowsPerSec + (1-CHUNK_SIZER_WEIGHT)*rowsPerSec
+		stat.BytesPerRow = CHUNK_SIZER_WEIGHT*stat.BytesPerRow + (1-CHUNK_SIZER_WEIGHT)*bytesPerRow
+	}
+
+	limit := this.calcLimit(stat)
+	if limit != stat.Limit {
+		logger.M.Infof("自适应 row copy 行数. 表: %v. %v -> %v. 每秒行数: %.0f, 平均每行字节数: %.0f",
+			tableName, stat.Limit, limit, stat.RowsPerSec, stat.BytesPerRow)
+		stat.Limit = limit
+	}
+}
+
+// 通过每秒处理行数和每行字节数计算行数, 并限制在上下限之间
+func (this *ChunkSizer) calcLimit(stat *TableChunkStat) int {
+	limit := int(stat.RowsPerSec * this.ChunkTime)
+
+	// 大字段的表每次拷贝的字节数不能太大
+	if stat.BytesPerRow > 0 && this.MaxBytes > 0 {
+		maxBytesLimit := int(float64(this.MaxBytes) / stat.BytesPerRow)
+		if limit > maxBytesLimit {
+			limit = maxBytesLimit
+		}
+	}
+
+	if limit < this.MinLimit {
+		limit = this.MinLimit
+	}
+	if limit > this.MaxLimit {
+		limit = this.MaxLimit
+	}
+
+	return limit
+}
+
+/* 估算数据的字节数
+Params:
+    _rows: row copy 的数据
+*/
+func GetRowsByteCount(rows [][]interface{}) int {
+	byteCnt := 0
+	for _, row := range rows {
+		for _, value := range row {
+			switch v := value.(type) {
+			case []byte:
+				byteCnt += len(v)
+			case string:
+				byteCnt += len(v)
+			case nil:
+				byteCnt += 1
+			default:
+				byteCnt += CHUNK_SIZER_NUM_LEN
+			}
+		}
+	}
+
+	return byteCnt
+}
@@ -0,0 +1,90 @@
+package mysqlrowcopy
+
+import (
+	"github.com/daiguadaidai/go-d-bus/logger"
+	"go.uber.org/zap"
+	"testing"
+	"time"
+)
+
+func newTestChunkSizer(chunkTime float64) *ChunkSizer {
+	logger.M = zap.NewNop().Sugar()
+
+	return &ChunkSizer{
+		ChunkTime:    chunkTime,
+		MinLimit:     100,
+		MaxLimit:     10000,
+		MaxBytes:     0,
+		DefaultSize:  1000,
+		TableStatMap: make(map[string]*TableChunkStat),
+	}
+}
+
+func TestChunkSizer_Disabled(t *testing.T) {
+	chunkSizer := newTestChunkSizer(0)
+
+	chunkSizer.Record("db.t", 1000, 8000, time.Millisecond)
+	if limit := chunkSizer.GetLimit("db.t"); limit != 1000 {
+		t.Fatalf("没有开启自适应行数应该使用固定的行数, 实际 %v", limit)
+	}
+}
+
+func TestChunkSizer_Record(t *testing.T) {
+	chunkSizer := newTestChunkSizer(0.5)
+
+	if limit := chunkSizer.GetLimit("db.t"); limit != 1000 {
+		t.Fatalf("没有统计信息应该使用初始行数, 实际 %v", limit)
+	}
+
+	// 每秒 10000 行, 期望 0.5 秒, 增大到 5000
+	chunkSizer.Record("db.t", 1000, 8000, 100*time.Millisecond)
+	if limit := chunkSizer.GetLimit("db.t"); limit != 5000 {
+		t.Fatalf("拷贝很快应该增大行数, 期望 5000, 实际 %v", limit)
+	}
+
+	// 每秒 2000 行, 和历史值加权后每秒 0.75*10000 + 0.25*2000 = 8000 行, 减小到 4000
+	chunkSizer.Record("db.t", 1000, 8000, 500*time.Millisecond)
+	if limit := chunkSizer.GetLimit("db.t"); limit != 4000 {
+		t.Fatalf("拷贝变慢应该减小行数, 期望 4000, 实际 %v", limit)
+	}
+
+	// 每个表单独统计
+	if limit := chunkSizer.GetLimit("db.t2"); limit != 1000 {
+		t.Fatalf("其他表应该使用初始行数, 实际 %v", limit)
+	}
+
+	// 没有拷贝到数据不统计
+	chunkSizer.Record("db.t", 0, 0, time.Hour)
+	if limit := chunkSizer.GetLimit("db.t"); limit != 4000 {
+		t.Fatalf("没有拷贝到数据不应该改变行数, 实际 %v", limit)
+	}
+}
+
+func TestChunkSizer_CalcLimit(t *testing.T) {
+	chunkSizer := newTestChunkSizer(0.5)
+
+	cases := []struct {
+		maxBytes    int
+		rowsPerSec  float64
+		bytesPerRow float64
+		expect      int
+	}{
+		{0, 4000, 10, 2000},            // 按耗时计算
+		{0, 100000, 10, 10000},         // 不超过最多行数
+		{0, 10, 10, 100},               // 不少于最少行数
+		{0, 0, 0, 100},                 // 没有速度使用最少行数
+		{1000000, 4000, 2000, 500},     // 大字段不超过最多字节数
+		{1000000, 4000, 100000, 100},   // 按字节数计算后也不少于最少行数
+		{1000000, 100000000, 1, 10000}, // 最多字节数允许的行数很多, 也不超过最多行数
+		{1000000, 4000, 0, 2000},       // 没有字节数不限制
+		{0, 4000, 1000000000, 2000},    // 没有设置最多字节数不限制
+	}
+
+	for i, c := range cases {
+		chunkSizer.MaxBytes = c.maxBytes
+		limit := chunkSizer.calcLimit(&TableChunkStat{RowsPerSec: c.rowsPerSec, BytesPerRow: c.bytesPerRow})
+		if limit != c.expect {
+			t.Fatalf("case %v: 期望 %v, 实际 %v", i, c.expect, limit)
+		}
+	}
+}
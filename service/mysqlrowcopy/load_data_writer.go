@@ -0,0 +1,116 @@
+package mysqlrowcopy
+
+import (
+	"fmt"
+	"github.com/daiguadaidai/go-d-bus/common"
+	"github.com/daiguadaidai/go-d-bus/gdbc"
+	"github.com/daiguadaidai/go-d-bus/matemap"
+	"github.com/daiguadaidai/go-d-bus/parser"
+	"github.com/daiguadaidai/go-d-bus/setting"
+	"github.com/go-sql-driver/mysql"
+	"go.uber.org/atomic"
+	"io"
+)
+
+const (
+	LOAD_DATA_BUFFER_ROWS = 100 // LOAD DATA 每积累多少行写入一次 reader
+)
+
+var loadDataReaderSeq = atomic.NewInt64(0) // 用于生成唯一的 reader 名称
+
+/* 将 row copy 的数据写入目标表, 根据任务设置的写入方式选择 INSERT IGNORE 或者 LOAD DATA
+Params:
+    _schema: 数据库
+    _tableName: 表
+    _rows: 需要写入的数据
+*/
+func (this *RowCopy) WriteRowCopyData(schema string, tableName string, rows [][]interface{}) error {
+	if this.Parser.RowCopyWriter == parser.ROW_COPY_WRITER_LOAD_DATA {
+		return LoadRowCopyData(this.ConfigMap.Target.Host.String, int(this.ConfigMap.Target.Port.Int64), schema, tableName, rows)
+	}
+
+	return InsertRowCopyData_V2(this.ConfigMap.Target.Host.String, int(this.ConfigMap.Target.Port.Int64), schema, tableName, rows)
+}
+
+/* 通过 LOAD DATA LOCAL INFILE 将数据流式写入目标表, 不需要拼接 INSERT 语句
+目标实例需要开启 local_infile
+Params:
+    _host: 实例 host
+    _port: 实例 port
+    _schema: 数据库
+    _tableName: 表
+    _rows: 需要写入的数据
+*/
+func LoadRowCopyData(host string, port int, schema string, tableName string, rows [][]interface{}) error {
+	table, err := matemap.GetMigrationTableBySchemaTable(schema, tableName)
+	if err != nil {
+		return err
+	}
+
+	instance, ok := gdbc.GetDynamicDBByHostPort(host, int64(port))
+	if !ok {
+		return fmt.Errorf("缓存中不存在该实例(%v:%v). RowCopy LOAD DATA 数据", host, port)
+	}
+
+	// 每次写入都注册一个唯一的 reader, 完成后注销
+	readerName := fmt.Sprintf("go-d-bus-%v-%v-%v", schema, tableName, loadDataReaderSeq.Inc())
+	pr, pw := io.Pipe()
+	mysql.RegisterReaderHandler(readerName, func() io.Reader { return pr })
+	defer mysql.DeregisterReaderHandler(readerName)
+
+	// 在协程中将数据写入 pipe, driver 读取 pipe 发送给目标实例
+	writeErrChan := make(chan error, 1)
+	go func() {
+		err := WriteLoadDataRows(pw, rows, table.FindSourceUsefulBitColumns(), table.FindSourceUsefulBinaryColumns())
+		pw.CloseWithError(err)
+		writeErrChan <- err
+	}()
+
+	// 源实例的数据链接(InitSourceDB)使用 setting.DefaultMysqlCharset, 读取到的字符串是这个字符集的.
+	// --mysql-charset 只用于元数据库的链接. 二进制字段以十六进制写入, 不受字符集影响
+	_, execErr := instance.Exec(table.GetLoadDataSql(readerName, setting.DefaultMysqlCharset))
+	pr.Close() // 执行失败的时候 driver 可能没有读完数据, 关闭后写协程才能退出
+	writeErr := <-writeErrChan
+
+	if writeErr != nil && writeErr != io.ErrClosedPipe {
+		return fmt.Errorf("RowCopy, 生成 LOAD DATA 数据失败. %v", writeErr)
+	}
+	if execErr != nil {
+		return execErr
+	}
+
+	return nil
+}
+
+/* 将数据按 LOAD DATA 格式写入 writer, 每积累一批写入一次
+Params:
+    _w: 写入的目标
+    _rows: 需要写入的数据
+    _bitColumns: 哪些字段是 bit 类型
+    _binaryColumns: 哪些字段是二进制类型
+*/
+func WriteLoadDataRows(w io.Writer, rows [][]interface{}, bitColumns []bool, binaryColumns []bool) error {
+	buf := make([]byte, 0, 16*1024)
+
+	var err error
+	for i, row := range rows {
+		if buf, err = common.AppendLoadDataRow(buf, row, bitColumns, binaryColumns); err != nil {
+			return err
+		}
+
+		if (i+1)%LOAD_DATA_BUFFER_ROWS == 0 {
+			if _, err = w.Write(buf); err != nil {
+				return err
+			}
+			buf = buf[:0]
+		}
+	}
+
+	if len(buf) > 0 {
+		if _, err = w.Write(buf); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
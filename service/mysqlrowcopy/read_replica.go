@@ -0,0 +1,120 @@
+package mysqlrowcopy
+
+import (
+	"fmt"
+	"github.com/daiguadaidai/go-d-bus/config"
+	"github.com/daiguadaidai/go-d-bus/logger"
+	"github.com/daiguadaidai/go-d-bus/parser"
+	"github.com/daiguadaidai/go-d-bus/service/helper"
+	"github.com/daiguadaidai/go-d-bus/service/mysqlapplybinlog"
+	"go.uber.org/atomic"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	READ_REPLICA_CHECK_INTERVAL = time.Second // 从库没有追上开始位点时, 多久检测一次
+)
+
+/* 读取数据的从库, row copy 和 checksum 从从库读取数据, 只有 binlog 从源实例读取
+从库需要应用到任务开始时的 binlog 位点之后才能读取数据, 之前的数据变更才不会丢失
+*/
+type ReadReplica struct {
+	Host string
+	Port int
+
+	StartLogFile string // 任务开始应用 binlog 的位点(源实例)
+	StartLogPos  int
+
+	caughtUp *atomic.Bool // 从库已经应用到开始位点之后, 位点只会增大, 检测通过一次后不需要再检测
+	mu       sync.Mutex
+}
+
+/* 创建读取数据的从库, 没有指定从库返回 nil
+Params:
+    _runParser: 命令行解析的信息
+    _configMap: 配置信息
+*/
+func NewReadReplica(runParser *parser.RunParser, configMap *config.ConfigMap) *ReadReplica {
+	if !configMap.Source.HasReadReplica() {
+		return nil
+	}
+
+	return &ReadReplica{
+		Host:         configMap.Source.ReadHost.String,
+		Port:         int(configMap.Source.ReadPort.Int64),
+		StartLogFile: runParser.StartLogFile,
+		StartLogPos:  runParser.StartLogPos,
+		caughtUp:     atomic.NewBool(false),
+	}
+}
+
+// 等待从库应用到任务开始的 binlog 位点之后
+func (this *ReadReplica) WaitCaughtUp() error {
+	if this.caughtUp.Load() {
+		return nil
+	}
+
+	// 只需要一个协程检测, 其他的协程等待结果
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	for !this.caughtUp.Load() {
+		logFile, logPos, err := GetReplicaExecutedPos(this.Host, this.Port)
+		if err != nil {
+			return err
+		}
+
+		cmp := mysqlapplybinlog.CompareLogFile(logFile, this.StartLogFile)
+		if cmp > 0 || (cmp == 0 && logPos >= this.StartLogPos) {
+			this.caughtUp.Store(true)
+			logger.M.Infof("成功. 从库 %v:%v 已经应用到 %v:%v, 超过了开始位点 %v:%v. 开始从从库读取数据",
+				this.Host, this.Port, logFile, logPos, this.StartLogFile, this.StartLogPos)
+			break
+		}
+
+		logger.M.Warnf("警告. 从库 %v:%v 应用到 %v:%v, 还没有到开始位点 %v:%v. 等待从库追上后再读取数据",
+			this.Host, this.Port, logFile, logPos, this.StartLogFile, this.StartLogPos)
+		time.Sleep(READ_REPLICA_CHECK_INTERVAL)
+	}
+
+	return nil
+}
+
+/* 获取从库已经执行到的主库 binlog 位点
+Params:
+    _host: 从库 host
+    _port: 从库 port
+*/
+func GetReplicaExecutedPos(host string, port int) (string, int, error) {
+	statusMap, err := helper.GetReplicaStatus(host, port)
+	if err != nil {
+		return "", 0, err
+	}
+
+	logFile := helper.GetReplicaStatusValue(statusMap, "Relay_Master_Log_File").String
+	logPos, _ := strconv.Atoi(helper.GetReplicaStatusValue(statusMap, "Exec_Master_Log_Pos").String)
+	if logFile == "" {
+		return "", 0, fmt.Errorf("失败. 没有获取到从库应用的位点. %v:%v", host, port)
+	}
+
+	return logFile, logPos, nil
+}
+
+/* 获取读取数据的实例, 指定了从库则等待从库追上开始位点后使用从库, 否则使用源实例
+Params:
+    _readReplica: 读取数据的从库, 可以为 nil
+    _configMap: 配置信息
+*/
+func GetReadHostPort(readReplica *ReadReplica, configMap *config.ConfigMap) (string, int, error) {
+	if readReplica == nil {
+		return configMap.Source.Host.String, int(configMap.Source.Port.Int64), nil
+	}
+
+	if err := readReplica.WaitCaughtUp(); err != nil {
+		return "", 0, err
+	}
+
+	return readReplica.Host, readReplica.Port, nil
+}
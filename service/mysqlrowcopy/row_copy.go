@@ -8,10 +8,10 @@ import (
 	"github.com/daiguadaidai/go-d-bus/logger"
 	"github.com/daiguadaidai/go-d-bus/matemap"
 	"github.com/daiguadaidai/go-d-bus/parser"
+	"github.com/daiguadaidai/go-d-bus/service/throttler"
 	"github.com/daiguadaidai/go-d-bus/service/helper"
 	"go.uber.org/atomic"
 	"runtime/debug"
-	"strings"
 	"sync"
 	"time"
 )
@@ -76,6 +76,36 @@ type RowCopy struct {
 	// 第一次checksum是每一次rowcopy完都进行, 如果发生了数据不一致,
 	// 会在最后所有的rowcopy完成后再次对第一次不一致的进行checksum操作
 	NotifySecondChecksum chan bool
+
+	// 一致性快照, 开启了快照则 row copy 从快照连接中读取数据
+	Snapshot *Snapshot
+
+	// 没有主键和唯一键的表, 不通过主键范围进行 row copy map: {"schema.table": true}
+	NoKeyRowCopyTableMap map[string]bool
+	NoKeyRowCopyWG       sync.WaitGroup // 没有主键的表 row copy 完成后才能标记任务 row copy 完成
+
+	// 根据 row copy 耗时动态调整每个表每次 row copy 的行数
+	ChunkSizer *ChunkSizer
+
+	// 决定下一个生成主键范围值的表
+	TableScheduler *TableScheduler
+
+	// 大表拆分后的范围, 每个范围单独生成主键范围值 map: {"schema.table#1": RowCopyRange}
+	RowCopyRangeMap map[string]*RowCopyRange
+	// 每个拆分的表还没有完成的范围 map: {"schema.table": {"schema.table#1": true}}
+	RowCopyRangeRemainMap map[string]map[string]bool
+
+	// 之前没有完成的 chunk, 启动后需要重新 row copy
+	WaitingRowCopyChunks []*matemap.PrimaryRangeValue
+
+	// 读取数据的从库, 没有指定为 nil, 从源实例读取
+	ReadReplica *ReadReplica
+
+	// 限流器, 限流时暂停生成主键范围值, 没有开启为 nil
+	Throttler *throttler.Throttler
+
+	// 消费主键范围值的协程池, 运行时可以调整并发数
+	ConsumerPool *helper.WorkerPool
 }
 
 /* 创建一个 row Copy 对象
@@ -115,6 +145,14 @@ func NewRowCopy(
 	rowCopy.NeedRowCopyTableMap = needRowCopyTableMap
 	logger.M.Infof("成功. 初始化还需要迁移的表: %v", needRowCopyTableMap)
 
+	// 没有主键的表从需要生成主键范围的表中移除, 单独进行 row copy
+	rowCopy.NoKeyRowCopyTableMap = rowCopy.SplitNoKeyRowCopyTables()
+	logger.M.Infof("成功. 初始化还需要迁移的没有主键的表: %v", rowCopy.NoKeyRowCopyTableMap)
+	if len(rowCopy.NoKeyRowCopyTableMap) > 0 && !runParser.EnableSnapshot {
+		return nil, fmt.Errorf("失败. 有没有主键的表需要 row copy, 必须使用一致性快照(--enable-snapshot=true), "+
+			"否则拷贝的数据和应用binlog的开始位点不一致. %v", rowCopy.NoKeyRowCopyTableMap)
+	}
+
 	// 初始化每个表最大的主键范围值, rowCopy截止的id范围 map: {"schema.table": PrimaryRangeValue}
 	// MaxPrimaryRangeValueMap map[string]*matemap.PrimaryRangeValue
 	maxPrimaryRangeValueMap, maxNoDataTables, err := rowCopy.GetMaxPrimaryRangeValueMap()
@@ -134,6 +172,18 @@ func NewRowCopy(
 	rowCopy.TagCompleteNeedRowCopyTables(currNoDataTables) // 将没数据的表直接标记完成
 	logger.M.Infof("成功. 初始化需要迁移的表当前row copy到的主键值. 没有数据的表: %v", currNoDataTables)
 
+	// 将需要拆分的大表拆分成多个范围
+	if err := rowCopy.SplitRowCopyRanges(); err != nil {
+		return nil, err
+	}
+	logger.M.Infof("成功. 初始化大表拆分的范围: %v", len(rowCopy.RowCopyRangeMap))
+
+	// 加载之前保存的 chunk 进度, 只需要重新 row copy 没有完成的 chunk
+	if err := rowCopy.LoadRowCopyChunks(); err != nil {
+		return nil, err
+	}
+	logger.M.Infof("成功. 初始化之前没有完成的 row copy chunk: %v", len(rowCopy.WaitingRowCopyChunks))
+
 	// 如果表的当前 row copy 到的主键值 >= 表 row copy 截止的 主键值
 	// greaterTables := rowCopy.FindCurrGreaterMaxPrimaryTables()
 	// rowCopy.TagCompleteNeedRowCopyTables(greaterTables) // 将当前rowcopy的值 >= 截止的rowcopy表直接标记完成
@@ -144,18 +194,21 @@ func NewRowCopy(
 	for key, value := range rowCopy.CurrentPrimaryRangeValueMap {
 		rowCopy.CompletePrimaryRangeValueMap.Store(key, value)
 	}
+	for key, rowCopyRange := range rowCopy.RowCopyRangeMap {
+		rowCopy.CompletePrimaryRangeValueMap.Store(key, rowCopyRange.Current)
+	}
 	logger.M.Infof("成功. 初始化需要迁移的表已经完成row copy进度信息")
 
 	// 初始化 cache row copy 的主键
 	rowCopy.WaitingTagCompletePrirmaryRangeValueMap = make(map[string]*ordered_map.OrderedMap)
-	for tableName, _ := range rowCopy.NeedRowCopyTableMap {
+	for _, tableName := range rowCopy.FindRowCopyKeys() {
 		rowCopy.WaitingTagCompletePrirmaryRangeValueMap[tableName] = ordered_map.NewOrderedMap()
 	}
 	logger.M.Infof("成功. 初始化保存 row copy 进度有序map, 每当生成row copy当主键时会将该主键添加到有序map中, 当该row copy完成时, 该主键会从有序map中删除")
 
 	// 初始化 每个表当前消费的最小 和最大 的主键值变量
 	rowCopy.RowCopyConsumeMinMaxValue = make(map[string]sync.Map)
-	for tableName, _ := range rowCopy.NeedRowCopyTableMap {
+	for _, tableName := range rowCopy.FindRowCopyKeys() {
 		rowCopy.RowCopyConsumeMinMaxValue[tableName] = sync.Map{}
 	}
 
@@ -168,7 +221,7 @@ func NewRowCopy(
 
 	// 初始化表还有几个row copy没有消费
 	rowCopy.RowCopyNoComsumeTimes = make(map[string]int)
-	for tableName, _ := range rowCopy.NeedRowCopyTableMap {
+	for _, tableName := range rowCopy.FindRowCopyKeys() {
 		rowCopy.RowCopyNoComsumeTimes[tableName] = 0
 	}
 
@@ -181,6 +234,29 @@ func NewRowCopy(
 	// 初始化已经完成的row copy完成缓存
 	rowCopy.RowCopyCompletedTableMap = make(map[string]struct{})
 
+	// 初始化自适应 row copy 行数
+	rowCopy.ChunkSizer = NewChunkSizer(runParser)
+
+	// 初始化读取数据的从库
+	rowCopy.ReadReplica = NewReadReplica(runParser, configMap)
+	if rowCopy.ReadReplica != nil {
+		logger.M.Infof("成功. 初始化 row copy 读取数据的从库: %v:%v", rowCopy.ReadReplica.Host, rowCopy.ReadReplica.Port)
+	}
+
+	// 初始化 row copy 表调度器
+	pendingCountMap := make(map[string]int)
+	for tableName, _ := range rowCopy.NeedRowCopyTableMap {
+		pendingCountMap[tableName] = 1
+	}
+	for _, rowCopyRange := range rowCopy.RowCopyRangeMap { // 拆分的表每个范围一个协程生成主键值
+		pendingCountMap[rowCopyRange.TableName]++
+	}
+	tableScheduler, err := NewTableScheduler(runParser, configMap, pendingCountMap)
+	if err != nil {
+		return nil, err
+	}
+	rowCopy.TableScheduler = tableScheduler
+
 	return rowCopy, nil
 }
 
@@ -195,6 +271,11 @@ func (this *RowCopy) Start() {
 		logger.M.Infof("!!!!!!!!!!!!! 整个row copy完成. !!!!!!!!!!!!")
 	}()
 
+	// row copy 结束后释放快照
+	if this.Snapshot != nil {
+		defer this.Snapshot.Close()
+	}
+
 	isComplete, err := TaskRowCopyIsComplete(this.ConfigMap.TaskUUID)
 	if err != nil {
 		logger.M.Errorf("失败. 获取任务 row copy 是否完成失败. 将不进行row copy行为. %v. %v", this.ConfigMap.TaskUUID, err)
@@ -213,11 +294,26 @@ func (this *RowCopy) Start() {
 
 	// 消费 PrimaryRangeValueChan 通道中的主键方位值
 	logger.M.Infof("设置了 %v 个并发执行 row copy 操作.", this.Parser.RowCopyParaller)
-	this.RowCopyComsumerCount.Add(int64(this.Parser.RowCopyParaller)) // 记录当前有多少个 row copy 并发
-	for parallerTag := 0; parallerTag < this.Parser.RowCopyParaller; parallerTag++ {
+	maxParaller := 0
+	if this.Snapshot != nil { // 开启了快照, 每个协程需要一个快照连接, 最多只能调整到启动时的并发数
+		maxParaller = len(this.Snapshot.Conns) - 1
+	}
+	this.ConsumerPool = helper.NewWorkerPool("row copy", this.Parser.RowCopyParaller, maxParaller, func(parallerTag int) {
+		this.RowCopyComsumerCount.Inc() // 记录当前有多少个 row copy 并发
 		wg.Add(1)
 		go this.LoopConsumePrimaryRangeValue(wg, parallerTag)
-	}
+	})
+	this.ConsumerPool.Start()
+
+	// 循环获取 row copy 并发数, 运行时调整并发数
+	go this.ConsumerPool.LoopWatchParaller(func() (int, error) {
+		return GetTaskRowCopyParaller(this.ConfigMap.TaskUUID)
+	})
+
+	// 没有主键的表单独进行 row copy
+	wg.Add(1)
+	this.NoKeyRowCopyWG.Add(1)
+	go this.LoopCopyNoKeyTables(wg)
 
 	// 循环, 缓存和删除主键值
 	wg.Add(1)
@@ -232,11 +328,26 @@ func (this *RowCopy) Start() {
 
 // 循环生成主键值
 func (this *RowCopy) LoopGeneratePrimaryRangeValue(wg *sync.WaitGroup) {
+	// 拆分后的每个范围单独一个协程生成主键值, 所有的都生成完后才能关闭通道
+	rangeWG := new(sync.WaitGroup)
 	defer func() {
+		// 出错退出时剩下的表也不再参与调度, 避免范围协程一直等待
+		for tableName, _ := range this.NeedRowCopyTableMap {
+			this.TableScheduler.Finish(tableName)
+		}
+		rangeWG.Wait()
 		close(this.PrimaryRangeValueChan)
 		wg.Done()
 	}()
 
+	// 先重新 row copy 之前没有完成的 chunk
+	this.SendWaitingRowCopyChunks()
+
+	for _, rowCopyRange := range this.RowCopyRangeMap {
+		rangeWG.Add(1)
+		go this.LoopGenerateRangePrimaryRangeValue(rangeWG, rowCopyRange)
+	}
+
 	// 当前错误重试次数
 	errRetryCount := 0
 
@@ -246,6 +357,9 @@ func (this *RowCopy) LoopGeneratePrimaryRangeValue(wg *sync.WaitGroup) {
 			return
 		}
 
+		// 限流时暂停生成主键范围值
+		this.Throttler.WaitRowCopy()
+
 		ok, err := this.GeneratePrimaryRangeValue()
 		if err != nil {
 			errRetryCount++
@@ -261,8 +375,8 @@ func (this *RowCopy) LoopGeneratePrimaryRangeValue(wg *sync.WaitGroup) {
 
 }
 
-/* 随机生成一个表的主键范围值
-1. 随机生成id
+/* 按调度策略生成一个表的主键范围值
+1. 通过调度器选择表, 生成id
 2. 将id放入PrimaryRangeValueChan中
 3. 设置CurrentPrimaryValueMap的值为当前
 Return:
@@ -276,17 +390,29 @@ func (this *RowCopy) GeneratePrimaryRangeValue() (bool, error) {
 		}
 	}()
 
-	tableName, ok := common.GetRandomMapKey(this.NeedRowCopyTableMap)
-	if !ok { // 所有的表的 row copy 主键值范围数据都已经生成完了
+	tableName, ok, hasTable := this.TableScheduler.Next(this.NeedRowCopyTableMap)
+	if !hasTable { // 所有的表的 row copy 主键值范围数据都已经生成完了
 		logger.M.Infof("所有表的主键值已经生成完. 退出生成主键值的协程 %v %v:%v", this.ConfigMap.TaskUUID, this.ConfigMap.Source.Host.String, this.ConfigMap.Source.Port.Int64)
 
 		return true, nil
 	}
+	if !ok { // 还需要生成的表都达到了并发上限, 或者轮到了拆分的表, 等待正在进行的 row copy 完成
+		time.Sleep(TABLE_SCHEDULER_WAIT_TIME)
+		return false, nil
+	}
+
+	// 调度器已经获取了该表的一个并发数, 没有放入通道需要释放
+	isSent := false
+	defer func() {
+		if !isSent {
+			this.TableScheduler.Release(tableName)
+		}
+	}()
 
 	// 获取该表当前的 row copy 主键值
 	currPrimaryRangeValue := this.CurrentPrimaryRangeValueMap[tableName]
 	// 获取表的下一个主键范围值
-	nextPrimaryRangeValue, err := currPrimaryRangeValue.GetNextPrimaryRangeValue(this.Parser.RowCopyLimit, this.ConfigMap.Source.Host.String, int(this.ConfigMap.Source.Port.Int64))
+	nextPrimaryRangeValue, err := currPrimaryRangeValue.GetNextPrimaryRangeValue(this.ChunkSizer.GetLimit(tableName), this.ConfigMap.Source.Host.String, int(this.ConfigMap.Source.Port.Int64))
 	if err != nil {
 		return false, fmt.Errorf("row copy 生成表的下一个主键值失败. 停止产生相关表主键值. %v. %v", tableName, err)
 	}
@@ -295,7 +421,7 @@ func (this *RowCopy) GeneratePrimaryRangeValue() (bool, error) {
 	if nextPrimaryRangeValue == nil {
 		logger.M.Warnf("警告. 检测到表的主键值已经生成到最后了. 该表 row copy 完成. 表: %v: 最小值: %v, 截止值: %v", tableName, currPrimaryRangeValue.MinValue, currPrimaryRangeValue.MaxValue)
 
-		delete(this.NeedRowCopyTableMap, tableName)
+		this.FinishNeedRowCopyTable(tableName)
 		return false, nil
 	}
 	logger.M.Infof("成功. 生成主键ID值. 表: %v. 最小值: %v, 最大值: %v, 截止值: %v", tableName, nextPrimaryRangeValue.MinValue, nextPrimaryRangeValue.MaxValue, this.MaxPrimaryRangeValueMap[tableName].MaxValue)
@@ -306,16 +432,22 @@ func (this *RowCopy) GeneratePrimaryRangeValue() (bool, error) {
 		logger.M.Warnf("警告. 检测到新生成的主键范围值的最小值 >= row copy 截止的主键值. 该新生成的主键值不要进行 row copy, 标记该表已经row copy 完成. 表: %v: 最小值: %v, 截止值: %v",
 			tableName, nextPrimaryRangeValue.MinValue, this.MaxPrimaryRangeValueMap[tableName].MaxValue)
 
-		delete(this.NeedRowCopyTableMap, tableName)
+		this.FinishNeedRowCopyTable(tableName)
 		return false, nil
 	}
 
+	// 保存 chunk, 重启后只需要重新 row copy 没有完成的 chunk
+	if err := this.SaveRowCopyChunk(nextPrimaryRangeValue); err != nil {
+		return false, err
+	}
+
 	// 先将该主键值传输给缓存通道中.
 	addOrDelete := NewAddOrDelete(nextPrimaryRangeValue.Schema, nextPrimaryRangeValue.Table, nextPrimaryRangeValue.TimestampHash, AOD_TYPE_ADD, nextPrimaryRangeValue)
 	this.AddOrDelWatingTagCompleteChan <- addOrDelete
 
 	// 将该主键信息传输给消费者
 	this.PrimaryRangeValueChan <- nextPrimaryRangeValue
+	isSent = true
 
 	// 设置该表当前主键值已经生成到
 	this.CurrentPrimaryRangeValueMap[tableName] = nextPrimaryRangeValue
@@ -326,12 +458,21 @@ func (this *RowCopy) GeneratePrimaryRangeValue() (bool, error) {
 		logger.M.Infof("完成. 表: %v, 需要迁移的主键值已经全部生成完毕. 要求生成到 %v, 实际生成到 %v",
 			tableName, nextPrimaryRangeValue.MaxValue, this.MaxPrimaryRangeValueMap[tableName].MaxValue)
 
-		delete(this.NeedRowCopyTableMap, tableName)
+		this.FinishNeedRowCopyTable(tableName)
 	}
 
 	return false, nil
 }
 
+/* 表的主键范围值已经生成完, 从需要生成主键范围的表中移除, 并且不再参与调度
+Params:
+    _tableName: 表名 schema.table
+*/
+func (this *RowCopy) FinishNeedRowCopyTable(tableName string) {
+	delete(this.NeedRowCopyTableMap, tableName)
+	this.TableScheduler.Finish(tableName)
+}
+
 /* 循环消费, 进行row copy
 Params:
     _parallerTag: 并发标签, 代表是第几个并发协程的操作
@@ -340,46 +481,63 @@ func (this *RowCopy) LoopConsumePrimaryRangeValue(wg *sync.WaitGroup, parallerTa
 	defer wg.Done()
 	defer func() { // 完成后, 协程数减1
 		this.RowCopyComsumerCount.Dec()
-		if this.RowCopyComsumerCount.Load() == 0 { // 如果都消费完了,可以关闭掉row copy 主键处理的缓存
+		if this.ConsumerPool.Exit(parallerTag) { // 如果都消费完了,可以关闭掉row copy 主键处理的缓存
 			close(this.AddOrDelWatingTagCompleteChan)
 		}
 	}()
 
 	logger.M.Infof("成功. 启动第 %v 个并发进行消费", parallerTag)
 
-	errRetryCount := 0
-
 	// 循环获取主键值
-	for primaryRangeValue := range this.PrimaryRangeValueChan {
-		for {
-			if errRetryCount > this.Parser.ErrRetryCount {
-				logger.M.Errorf("错误. 协程 %v, row copy 消费发生错误. 并且重试次数已经达到上线 %v. 将退出消费 表: %v.%v, 最小值: %v, 最大值: %v.",
-					parallerTag, this.Parser.ErrRetryCount, primaryRangeValue.Schema, primaryRangeValue.Table, primaryRangeValue.MinValue, primaryRangeValue.MaxValue)
-				return
-			}
+	for {
+		if this.ConsumerPool.IsRetired(parallerTag) { // 调小了并发数
+			return
+		}
+		primaryRangeValue, ok := <-this.PrimaryRangeValueChan
+		if !ok {
+			this.ConsumerPool.Close()
+			break
+		}
 
-			// 真正进行 row copy 操作
-			err := this.ConsumePrimaryRangeValue_V2(parallerTag, primaryRangeValue)
-			if err != nil {
-				errRetryCount++
-				logger.M.Errorf("错误. 协程 %v, 重试第%v次. 需要重试%v次. 表: %v.%v, 最小值: %v, 最大值: %v. %v",
-					parallerTag, errRetryCount, this.Parser.ErrRetryCount, primaryRangeValue.Schema, primaryRangeValue.Table, primaryRangeValue.MinValue, primaryRangeValue.MaxValue, err)
+		if err := this.ConsumePrimaryRangeValueWithRetry(parallerTag, primaryRangeValue); err != nil {
+			logger.M.Errorf("错误. 协程 %v, row copy 消费发生错误. 并且重试次数已经达到上线 %v. 将退出消费 表: %v.%v, 最小值: %v, 最大值: %v. %v",
+				parallerTag, this.Parser.ErrRetryCount, primaryRangeValue.Schema, primaryRangeValue.Table, primaryRangeValue.MinValue, primaryRangeValue.MaxValue, err)
+			return
+		}
 
-				time.Sleep(time.Second * 1)
-				continue
-			}
+		// 一个范围的row copy完成后将通知checksum
+		if this.Parser.EnableChecksum {
+			this.ToChecksumChan <- primaryRangeValue
+		}
+	}
 
-			// 一个范围的row copy完成后将通知checksum
-			if this.Parser.EnableChecksum {
-				this.ToChecksumChan <- primaryRangeValue
-			}
+	logger.M.Infof("完成. 已经没有需要进行 row copy 的主键范围值了. 协程 %v 退出. 消费", parallerTag)
+}
 
-			errRetryCount = 0 // 设置当前错误重试次数为0, 代表没有错误
-			break
+/* 消费一个 row copy 的主键值, 失败会重试. 不管成功还是失败都会释放该表的并发数
+Params:
+    _parallerTag: 并发标记
+    _primaryRangeValue: 需要 row copy 的主键范围值
+*/
+func (this *RowCopy) ConsumePrimaryRangeValueWithRetry(parallerTag int, primaryRangeValue *matemap.PrimaryRangeValue) error {
+	// 生成主键值的时候已经获取了该表的并发数
+	defer this.TableScheduler.Release(common.FormatTableName(primaryRangeValue.Schema, primaryRangeValue.Table, ""))
+
+	var err error
+	for errRetryCount := 0; errRetryCount <= this.Parser.ErrRetryCount; errRetryCount++ {
+		if errRetryCount > 0 {
+			logger.M.Errorf("错误. 协程 %v, 重试第%v次. 需要重试%v次. 表: %v.%v, 最小值: %v, 最大值: %v. %v",
+				parallerTag, errRetryCount, this.Parser.ErrRetryCount, primaryRangeValue.Schema, primaryRangeValue.Table, primaryRangeValue.MinValue, primaryRangeValue.MaxValue, err)
+			time.Sleep(time.Second * 1)
+		}
+
+		// 真正进行 row copy 操作
+		if err = this.ConsumePrimaryRangeValue_V2(parallerTag, primaryRangeValue); err == nil {
+			return nil
 		}
 	}
 
-	logger.M.Infof("完成. 已经没有需要进行 row copy 的主键范围值了. 协程 %v 退出. 消费", parallerTag)
+	return err
 }
 
 /* 消费row copy 的主键值
@@ -400,8 +558,10 @@ func (this *RowCopy) ConsumePrimaryRangeValue_V2(parallerTag int, primaryRangeVa
 		}
 	}()
 
+	startTime := time.Now()
+
 	// 获取源表数据
-	rows, err := SelectRowCopyData_V3(this.ConfigMap.Source.Host.String, int(this.ConfigMap.Source.Port.Int64), primaryRangeValue)
+	rows, err := this.SelectRowCopyData(parallerTag, primaryRangeValue)
 	if err != nil {
 		return fmt.Errorf("失败. row copy 获取源表数据错误. 表: %v.%v 最小值: %v, 最大值: %v. %v:%v, %v",
 			primaryRangeValue.Schema, primaryRangeValue.Table, primaryRangeValue.MinValue, primaryRangeValue.MaxValue, this.ConfigMap.Source.Host.String, int(this.ConfigMap.Source.Port.Int64), err)
@@ -410,16 +570,30 @@ func (this *RowCopy) ConsumePrimaryRangeValue_V2(parallerTag int, primaryRangeVa
 		logger.M.Warnf("警告. row copy 没有获取到表数据. 默认此次row copy 完成. 表: %v.%v. 最小值: %v, 最大值: %v",
 			primaryRangeValue.Schema, primaryRangeValue.Table, primaryRangeValue.MinValue, primaryRangeValue.MaxValue)
 
+		this.TagRowCopyChunkComplete(primaryRangeValue, 0, time.Since(startTime))
 		return nil
 	}
 
+	// 限速, 等待的时间不计入本次 row copy 的耗时
+	byteCnt := GetRowsByteCount(rows)
+	waitStartTime := time.Now()
+	this.Throttler.WaitRowCopyRate(len(rows), byteCnt)
+	startTime = startTime.Add(time.Since(waitStartTime))
+
 	// 向目标表插入数据
-	err = InsertRowCopyData_V2(this.ConfigMap.Target.Host.String, int(this.ConfigMap.Target.Port.Int64), primaryRangeValue.Schema, primaryRangeValue.Table, rows)
+	err = this.WriteRowCopyData(primaryRangeValue.Schema, primaryRangeValue.Table, rows)
 	if err != nil {
 		return fmt.Errorf("失败. row copy 向目标数据库插入数据 表: %v.%v, 最小值: %v, 最大值: %v. %v:%v. %v",
 			primaryRangeValue.Schema, primaryRangeValue.Table, primaryRangeValue.MinValue, primaryRangeValue.MaxValue, this.ConfigMap.Source.Host.String, int(this.ConfigMap.Source.Port.Int64), err)
 	}
 
+	// 记录本次 row copy 耗时, 用于调整该表下一次 row copy 的行数
+	elapsed := time.Since(startTime)
+	this.ChunkSizer.Record(common.FormatTableName(primaryRangeValue.Schema, primaryRangeValue.Table, ""), len(rows), byteCnt, elapsed)
+
+	// 标记该 chunk 完成
+	this.TagRowCopyChunkComplete(primaryRangeValue, len(rows), elapsed)
+
 	logger.M.Infof("完成. 协程%v, 范围 row copy 已经完成. 表: %v.%v. 最小值: %v, 最大值 %v",
 		parallerTag, primaryRangeValue.Schema, primaryRangeValue.Table, primaryRangeValue.MinValue, primaryRangeValue.MaxValue)
 
@@ -440,7 +614,7 @@ func (this *RowCopy) LoopAddOrDeleteCache(wg *sync.WaitGroup) {
 	}()
 
 	for addOrDelete := range this.AddOrDelWatingTagCompleteChan {
-		tableName := common.FormatTableName(addOrDelete.Schema, addOrDelete.Table, "") // schema.table 没有带 反引号
+		tableName := GetPrimaryRangeValueKey(addOrDelete.PrimaryRangeValue) // schema.table 没有带 反引号, 拆分的表为 schema.table#1
 
 		switch addOrDelete.Type {
 		case AOD_TYPE_ADD: // 将刚刚生成的主键值保存起来, 等待完成后删除
@@ -534,16 +708,15 @@ ExistSaveProgress:
 					}
 
 					// 保存 row copy 最后的进度数据
-					schemaTable := strings.Split(tableName, ".")
-					schema := schemaTable[0]
-					table := schemaTable[1]
-					UpdateTableCurrPrimaryValue(this.ConfigMap.TaskUUID, schema, table, maxValueJson)
+					this.UpdateRowCopyKeyCurrPrimaryValue(tableName, maxValueJson)
 
 					// 标记该表 row copy 完成
-					TagTableRowCopyComplete(this.ConfigMap.TaskUUID, schema, table)
-					logger.M.Infof("完成. 标记表 row copy 完成. %v", tableName)
+					this.TagRowCopyKeyComplete(tableName)
 				}
 
+				// 等待没有主键的表 row copy 完成
+				this.NoKeyRowCopyWG.Wait()
+
 				// 标记该任务 row copy 完成
 				TagTaskRowCopyComplete(this.ConfigMap.TaskUUID)
 				logger.M.Infof("完成. 标记任务 row copy 完成. %v", this.ConfigMap.TaskUUID)
@@ -571,16 +744,13 @@ ExistSaveProgress:
 					}
 
 					// 保存 row copy 最后的进度数据
-					schemaTable := strings.Split(tableName, ".")
-					schema := schemaTable[0]
-					table := schemaTable[1]
-					UpdateTableCurrPrimaryValue(this.ConfigMap.TaskUUID, schema, table, minValueJson)
+					this.UpdateRowCopyKeyCurrPrimaryValue(tableName, minValueJson)
 
 					// 获取该表完成时候的 主键直大值
 					// 比较新生成的主键值是否 >= 最大的主键值
 					if helper.MapAGreaterOrEqualMapB(maxPrimaryRangeValue.MaxValue, this.MaxPrimaryRangeValueMap[tableName].MaxValue) {
 						// 标记该表 row copy 完成
-						TagTableRowCopyComplete(this.ConfigMap.TaskUUID, schema, table)
+						this.TagRowCopyKeyComplete(tableName)
 
 						// 记录该表完成row copy
 						this.RowCopyCompletedTableMap[tableName] = struct{}{}
@@ -1,6 +1,7 @@
 package mysqlrowcopy
 
 import (
+	"context"
 	"fmt"
 	"github.com/daiguadaidai/go-d-bus/common"
 	"github.com/daiguadaidai/go-d-bus/dao"
@@ -291,6 +292,19 @@ func TagTableRowCopyComplete(taskUUID, schema, table string) int {
 	return affected
 }
 
+/* 保存没有主键的表 row copy 使用的快照位点
+Params:
+    _taskUUID: 任务ID
+    _schema: 数据库名
+    _table: 表名
+    _snapshotPosition: 序列化后的快照位点
+*/
+func UpdateTableSnapshotPosition(taskUUID, schema, table, snapshotPosition string) int {
+	tableMapDao := new(dao.TableMapDao)
+	affected := tableMapDao.UpdateSnapshotPosition(taskUUID, schema, table, snapshotPosition)
+	return affected
+}
+
 /* 标记任务ID完成
 Params:
     _taskUUID: 任务ID
@@ -314,23 +328,69 @@ func SelectRowCopyData_V3(host string, port int, primaryRangeValue *matemap.Prim
 		return nil, err
 	}
 
-	// 获取 row copy, select sql 语句
-	selectSql := table.GetSelPerBatchSqlTpl()
-	// 获取 select where 占位符的值
-	whereValue := primaryRangeValue.GetMinMaxValueSlice(table.FindSourcePKColumnNames())
-
 	// 获取实例
 	instance, ok := gdbc.GetDynamicDBByHostPort(host, int64(port))
 	if !ok {
 		return nil, fmt.Errorf("缓存中不存在该实例(%v:%v). 获取 row copy select的数据", host, port)
 	}
 
+	return SelectRowCopyDataByQueryer(instance, table, primaryRangeValue)
+}
+
+/* 获取 row copy 数据, 开启了一致性快照则使用该协程的快照连接
+Params:
+    _parallerTag: row copy 协程标记
+    _primaryRangeValue: 主键范围值
+*/
+func (this *RowCopy) SelectRowCopyData(parallerTag int, primaryRangeValue *matemap.PrimaryRangeValue) ([][]interface{}, error) {
+	if this.Snapshot == nil {
+		host, port, err := GetReadHostPort(this.ReadReplica, this.ConfigMap)
+		if err != nil {
+			return nil, err
+		}
+		return SelectRowCopyData_V3(host, port, primaryRangeValue)
+	}
+
+	table, err := matemap.GetMigrationTableBySchemaTable(primaryRangeValue.Schema, primaryRangeValue.Table)
+	if err != nil {
+		return nil, err
+	}
+
+	return SelectRowCopyDataByQueryer(this.Snapshot.GetConn(parallerTag), table, primaryRangeValue)
+}
+
+/* 通过指定的连接获取 row copy 数据, 一致性快照的时候使用快照连接
+Params:
+    _queryer: 执行查询的实例或连接
+    _table: 需要迁移的表的元数据信息
+    _primaryRangeValue: 主键范围值
+*/
+func SelectRowCopyDataByQueryer(
+	queryer RowsQueryer,
+	table *matemap.Table,
+	primaryRangeValue *matemap.PrimaryRangeValue,
+) ([][]interface{}, error) {
+	// 获取 row copy, select sql 语句
+	selectSql := table.GetSelPerBatchSqlTpl()
+	// 获取 select where 占位符的值
+	whereValue := primaryRangeValue.GetMinMaxValueSlice(table.FindSourcePKColumnNames())
+
+	return SelectRowsByQueryer(queryer, selectSql, whereValue...)
+}
+
+/* 通过指定的连接执行 select 获取所有行
+Params:
+    _queryer: 执行查询的实例或连接
+    _selectSql: 查询语句
+    _args: 占位符的值
+*/
+func SelectRowsByQueryer(queryer RowsQueryer, selectSql string, args ...interface{}) ([][]interface{}, error) {
 	// 获取 所有行
-	rows, err := instance.Query(selectSql, whereValue...)
-	defer rows.Close()
+	rows, err := queryer.QueryContext(context.Background(), selectSql, args...)
 	if err != nil {
 		return nil, fmt.Errorf("row copy 批量获取源表数据出错. %v. %v", selectSql, err)
 	}
+	defer rows.Close()
 
 	rs, err := helper.GetRows(rows)
 	if err != nil {
@@ -419,3 +479,17 @@ func TaskRowCopyIsComplete(taskUUID string) (bool, error) {
 
 	return isComplete, err
 }
+
+/* 获取任务 row copy 并发数, 运行时修改 task.row_copy_paraller 可以调整并发数
+Params:
+	_taskUUID: 任务ID
+*/
+func GetTaskRowCopyParaller(taskUUID string) (int, error) {
+	taskDao := new(dao.TaskDao)
+	task, err := taskDao.GetByTaskUUID(taskUUID, "row_copy_paraller")
+	if err != nil {
+		return 0, fmt.Errorf("失败. 获取任务 row copy 并发数. %v. %v", taskUUID, err)
+	}
+
+	return int(task.RowCopyParaller.Int64), nil
+}
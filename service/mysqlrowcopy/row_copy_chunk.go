@@ -0,0 +1,169 @@
+package mysqlrowcopy
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/daiguadaidai/go-d-bus/common"
+	"github.com/daiguadaidai/go-d-bus/dao"
+	"github.com/daiguadaidai/go-d-bus/logger"
+	"github.com/daiguadaidai/go-d-bus/matemap"
+	"github.com/daiguadaidai/go-d-bus/model"
+	"github.com/daiguadaidai/go-d-bus/service/helper"
+	"strings"
+	"time"
+)
+
+/* 加载之前保存的 chunk 进度
+1. 还没有完成的 chunk 需要重新进行 row copy
+2. 表(或者范围)从最后生成的 chunk 之后继续生成主键范围值, 已经完成的 chunk 不需要重新 row copy
+*/
+func (this *RowCopy) LoadRowCopyChunks() error {
+	this.WaitingRowCopyChunks = make([]*matemap.PrimaryRangeValue, 0)
+
+	rowCopyChunkDao := new(dao.RowCopyChunkDao)
+	for _, key := range this.FindRowCopyKeys() {
+		tableName, rangeNo := ParseRangeKey(key)
+		schemaTable := strings.Split(tableName, ".")
+
+		lastChunk, err := rowCopyChunkDao.GetLastByTable(this.ConfigMap.TaskUUID, schemaTable[0], schemaTable[1], rangeNo)
+		if err != nil {
+			return fmt.Errorf("失败. 获取最后生成的 row copy chunk. %v. %v", key, err)
+		}
+		if lastChunk == nil { // 之前没有生成过 chunk
+			continue
+		}
+
+		table, err := matemap.GetMigrationTable(tableName)
+		if err != nil {
+			return fmt.Errorf("失败. 获取表元数据(加载 row copy chunk). %v. %v", tableName, err)
+		}
+		pkTypeMap := table.FindSourcePKColumnTypeMap()
+
+		// 还没有完成的 chunk
+		waitingChunks, err := rowCopyChunkDao.FindWaitingByTable(this.ConfigMap.TaskUUID, schemaTable[0], schemaTable[1], rangeNo)
+		if err != nil {
+			return fmt.Errorf("失败. 获取还没有完成的 row copy chunk. %v. %v", key, err)
+		}
+		for _, waitingChunk := range waitingChunks {
+			primaryRangeValue, err := RowCopyChunk2PrimaryRangeValue(waitingChunk, pkTypeMap)
+			if err != nil {
+				return fmt.Errorf("失败. 转换 row copy chunk. %v. %v", key, err)
+			}
+			if rangeNo > 0 {
+				primaryRangeValue.RangeKey = key
+			}
+			this.WaitingRowCopyChunks = append(this.WaitingRowCopyChunks, primaryRangeValue)
+		}
+
+		// 从最后生成的 chunk 之后继续生成
+		lastMaxValue, err := common.Json2MapBySqlType(lastChunk.MaxIDValue.String, pkTypeMap)
+		if err != nil {
+			return fmt.Errorf("失败. 转换json数据(最后生成的 chunk 最大值). %v. %v", key, err)
+		}
+		current := matemap.NewPrimaryRangeValue(table.SourceSchema, table.SourceName, lastMaxValue, lastMaxValue, lastMaxValue)
+		if rangeNo > 0 {
+			current.RangeKey = key
+			if rowCopyRange, ok := this.RowCopyRangeMap[key]; ok && helper.MapAGreaterMapB(lastMaxValue, rowCopyRange.Current.MaxValue) {
+				rowCopyRange.Current = current
+			}
+		} else if currPrimaryRangeValue, ok := this.CurrentPrimaryRangeValueMap[key]; ok && helper.MapAGreaterMapB(lastMaxValue, currPrimaryRangeValue.MaxValue) {
+			this.CurrentPrimaryRangeValueMap[key] = current
+		}
+
+		logger.M.Infof("成功. 加载 row copy chunk 进度. %v. 还没有完成的 chunk: %v 个. 最后生成的 chunk 最大值: %v",
+			key, len(waitingChunks), lastMaxValue)
+	}
+
+	return nil
+}
+
+/* 将 chunk 转化成主键范围值, 使用原来的时间戳
+Params:
+    _rowCopyChunk: 保存的 chunk
+    _pkTypeMap: 主键字段类型
+*/
+func RowCopyChunk2PrimaryRangeValue(rowCopyChunk *model.RowCopyChunk, pkTypeMap map[string]int) (*matemap.PrimaryRangeValue, error) {
+	minValue, err := common.Json2MapBySqlType(rowCopyChunk.MinIDValue.String, pkTypeMap)
+	if err != nil {
+		return nil, fmt.Errorf("转换json数据(chunk 最小值). %v", err)
+	}
+	maxValue, err := common.Json2MapBySqlType(rowCopyChunk.MaxIDValue.String, pkTypeMap)
+	if err != nil {
+		return nil, fmt.Errorf("转换json数据(chunk 最大值). %v", err)
+	}
+
+	return &matemap.PrimaryRangeValue{
+		TimestampHash: rowCopyChunk.ChunkHash.String,
+		Schema:        rowCopyChunk.Schema.String,
+		Table:         rowCopyChunk.Source.String,
+		MinValue:      minValue,
+		MaxValue:      maxValue,
+	}, nil
+}
+
+// 将之前还没有完成的 chunk 重新放入通道中进行 row copy, 需要在生成新的主键范围值之前调用
+func (this *RowCopy) SendWaitingRowCopyChunks() {
+	for _, primaryRangeValue := range this.WaitingRowCopyChunks {
+		logger.M.Infof("重新 row copy 之前没有完成的 chunk. 表: %v.%v. 最小值: %v, 最大值: %v",
+			primaryRangeValue.Schema, primaryRangeValue.Table, primaryRangeValue.MinValue, primaryRangeValue.MaxValue)
+
+		addOrDelete := NewAddOrDelete(primaryRangeValue.Schema, primaryRangeValue.Table, primaryRangeValue.TimestampHash, AOD_TYPE_ADD, primaryRangeValue)
+		this.AddOrDelWatingTagCompleteChan <- addOrDelete
+
+		this.TableScheduler.Acquire(common.FormatTableName(primaryRangeValue.Schema, primaryRangeValue.Table, ""))
+		this.PrimaryRangeValueChan <- primaryRangeValue
+	}
+
+	this.WaitingRowCopyChunks = nil
+}
+
+/* 保存新生成的 chunk, 需要在放入通道之前保存
+Params:
+    _primaryRangeValue: 新生成的主键范围值
+*/
+func (this *RowCopy) SaveRowCopyChunk(primaryRangeValue *matemap.PrimaryRangeValue) error {
+	minValueJson, err := common.Map2Json(primaryRangeValue.MinValue)
+	if err != nil {
+		return fmt.Errorf("失败. 保存 row copy chunk, 最小值转化为json. %v.%v. %v", primaryRangeValue.Schema, primaryRangeValue.Table, err)
+	}
+	maxValueJson, err := common.Map2Json(primaryRangeValue.MaxValue)
+	if err != nil {
+		return fmt.Errorf("失败. 保存 row copy chunk, 最大值转化为json. %v.%v. %v", primaryRangeValue.Schema, primaryRangeValue.Table, err)
+	}
+	_, rangeNo := ParseRangeKey(GetPrimaryRangeValueKey(primaryRangeValue))
+
+	rowCopyChunk := &model.RowCopyChunk{
+		TaskUUID:   sql.NullString{String: this.ConfigMap.TaskUUID, Valid: true},
+		Schema:     sql.NullString{String: primaryRangeValue.Schema, Valid: true},
+		Source:     sql.NullString{String: primaryRangeValue.Table, Valid: true},
+		RangeNo:    sql.NullInt64{Int64: int64(rangeNo), Valid: true},
+		ChunkHash:  sql.NullString{String: primaryRangeValue.TimestampHash, Valid: true},
+		MinIDValue: sql.NullString{String: minValueJson, Valid: true},
+		MaxIDValue: sql.NullString{String: maxValueJson, Valid: true},
+		Status:     sql.NullInt64{Int64: model.ROW_COPY_CHUNK_STATUS_WAITING, Valid: true},
+	}
+
+	rowCopyChunkDao := new(dao.RowCopyChunkDao)
+	if err := rowCopyChunkDao.Create(rowCopyChunk); err != nil {
+		return fmt.Errorf("失败. 保存 row copy chunk. %v.%v. 最小值: %v, 最大值: %v. %v",
+			primaryRangeValue.Schema, primaryRangeValue.Table, minValueJson, maxValueJson, err)
+	}
+
+	return nil
+}
+
+/* 标记 chunk row copy 完成, 保存失败只会导致重启后该 chunk 再 row copy 一次
+Params:
+    _primaryRangeValue: 完成的主键范围值
+    _rowCnt: row copy 的行数
+    _elapsed: 查询和插入的耗时
+*/
+func (this *RowCopy) TagRowCopyChunkComplete(primaryRangeValue *matemap.PrimaryRangeValue, rowCnt int, elapsed time.Duration) {
+	rowCopyChunkDao := new(dao.RowCopyChunkDao)
+	affected := rowCopyChunkDao.TagChunkComplete(this.ConfigMap.TaskUUID, primaryRangeValue.Schema, primaryRangeValue.Table,
+		primaryRangeValue.TimestampHash, rowCnt, elapsed.Nanoseconds()/int64(time.Millisecond))
+	if affected < 1 {
+		logger.M.Warnf("警告. 标记 row copy chunk 完成没有更新到数据. 表: %v.%v. 最小值: %v, 最大值: %v",
+			primaryRangeValue.Schema, primaryRangeValue.Table, primaryRangeValue.MinValue, primaryRangeValue.MaxValue)
+	}
+}
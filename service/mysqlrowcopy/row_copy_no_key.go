@@ -0,0 +1,284 @@
+package mysqlrowcopy
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/daiguadaidai/go-d-bus/common"
+	"github.com/daiguadaidai/go-d-bus/gdbc"
+	"github.com/daiguadaidai/go-d-bus/logger"
+	"github.com/daiguadaidai/go-d-bus/matemap"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+/* 将没有主键和唯一键的表从需要生成主键范围的表中移除
+Return:
+    没有主键的表 map: {"schema.table": true}
+*/
+func (this *RowCopy) SplitNoKeyRowCopyTables() map[string]bool {
+	noKeyTableMap := make(map[string]bool)
+
+	for tableName, _ := range this.NeedRowCopyTableMap {
+		table, err := matemap.GetMigrationTable(tableName)
+		if err != nil || !table.NoUniqueKey {
+			continue
+		}
+
+		noKeyTableMap[tableName] = true
+		delete(this.NeedRowCopyTableMap, tableName)
+	}
+
+	return noKeyTableMap
+}
+
+/* 循环对没有主键的表进行 row copy, 一个表一个表顺序拷贝
+没有主键的表不能断点续传, 每次拷贝前会清空目标表
+*/
+func (this *RowCopy) LoopCopyNoKeyTables(wg *sync.WaitGroup) {
+	defer wg.Done()
+	defer this.NoKeyRowCopyWG.Done()
+
+	tableNames := make([]string, 0, len(this.NoKeyRowCopyTableMap))
+	for tableName, _ := range this.NoKeyRowCopyTableMap {
+		tableNames = append(tableNames, tableName)
+	}
+	sort.Strings(tableNames)
+
+	for _, tableName := range tableNames {
+		errRetryCount := 0
+		for {
+			err := this.CopyNoKeyTable(tableName)
+			if err != nil {
+				errRetryCount++
+				if errRetryCount > this.Parser.ErrRetryCount {
+					logger.M.Fatalf("错误. 没有主键的表 row copy 失败, 并且超过重试上线值: %v. 退出迁移. %v. %v", this.Parser.ErrRetryCount, tableName, err)
+				}
+				logger.M.Errorf("错误. 没有主键的表 row copy, 重试第%v次. 需要重试%v次. %v. %v",
+					errRetryCount, this.Parser.ErrRetryCount, tableName, err)
+
+				time.Sleep(time.Second * 1)
+				continue
+			}
+
+			break
+		}
+
+		// 标记该表 row copy 完成
+		schemaTable := strings.Split(tableName, ".")
+		TagTableRowCopyComplete(this.ConfigMap.TaskUUID, schemaTable[0], schemaTable[1])
+		logger.M.Infof("完成. 标记没有主键的表 row copy 完成. %v", tableName)
+
+		// 没有主键的表整表进行checksum
+		if this.Parser.EnableChecksum {
+			this.ToChecksumChan <- matemap.NewPrimaryRangeValue(schemaTable[0], schemaTable[1],
+				map[string]interface{}{}, map[string]interface{}{}, nil)
+		}
+	}
+
+	logger.M.Infof("完成. 所有没有主键的表 row copy 完成. %v", tableNames)
+}
+
+/* 对一个没有主键的表进行 row copy
+Params:
+    _tableName: 表名 schema.table
+*/
+func (this *RowCopy) CopyNoKeyTable(tableName string) error {
+	table, err := matemap.GetMigrationTable(tableName)
+	if err != nil {
+		return err
+	}
+
+	// 获取快照连接, 保证多次查询读到的是同一个时间点的数据
+	conn, closeConn, err := this.GetNoKeySnapshotConn()
+	if err != nil {
+		return err
+	}
+	defer closeConn()
+
+	// 保存拷贝使用的快照位点, 应用binlog跳过该表在快照位点之前的事务. 重启时没有完成的表会从新的快照中重新拷贝, 应用binlog可能从更早的位点开始
+	snapshotPosition := this.Snapshot.GetLogFilePos().String()
+	UpdateTableSnapshotPosition(this.ConfigMap.TaskUUID, table.SourceSchema, table.SourceName, snapshotPosition)
+	logger.M.Infof("成功. 保存没有主键的表 row copy 使用的快照位点. %v. %v", tableName, snapshotPosition)
+
+	// 没有主键无法判断哪些行已经拷贝过, 需要清空目标表
+	if err := DeleteNoKeyTargetAll(this.ConfigMap.Target.Host.String, int(this.ConfigMap.Target.Port.Int64), table); err != nil {
+		return err
+	}
+	logger.M.Warnf("警告. 没有主键的表 row copy 前清空目标表. %v.%v", table.TargetSchema, table.TargetName)
+
+	if table.ChunkColumn == "" {
+		return this.CopyNoKeyTableByOffset(conn, table)
+	}
+
+	return this.CopyNoKeyTableByChunk(conn, table)
+}
+
+/* 获取没有主键的表 row copy 使用的快照连接
+必须开启一致性快照, 使用快照中的连接, 拷贝的数据和应用binlog的开始位点一致
+Return:
+    快照连接, 释放连接的方法, 错误
+*/
+func (this *RowCopy) GetNoKeySnapshotConn() (*sql.Conn, func(), error) {
+	if this.Snapshot == nil {
+		return nil, nil, fmt.Errorf("失败. 没有开启一致性快照(--enable-snapshot=true), 不能对没有主键的表进行 row copy")
+	}
+
+	return this.Snapshot.GetNoKeyConn(), func() {}, nil
+}
+
+/* 没有主键和分块字段的表, 在快照中使用 LIMIT OFFSET 全表扫描, 每次的行数和有主键的表一样自适应
+Params:
+    _conn: 快照连接
+    _table: 需要迁移的表
+*/
+func (this *RowCopy) CopyNoKeyTableByOffset(conn *sql.Conn, table *matemap.Table) error {
+	tableName := common.FormatTableName(table.SourceSchema, table.SourceName, "")
+
+	offset := 0
+	for {
+		limit := this.ChunkSizer.GetLimit(tableName)
+		startTime := time.Now()
+		rows, err := SelectRowsByQueryer(conn, table.GetSelNoKeyOffsetSqlTpl(), offset, limit)
+		if err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			break
+		}
+
+		waitTime, err := this.InsertNoKeyRows(table, rows, limit)
+		if err != nil {
+			return err
+		}
+		this.ChunkSizer.Record(tableName, len(rows), GetRowsByteCount(rows), time.Since(startTime)-waitTime)
+		offset += len(rows)
+		logger.M.Infof("成功. 没有主键的表 row copy 到第 %v 行. %v.%v", offset, table.SourceSchema, table.SourceName)
+
+		if len(rows) < limit {
+			break
+		}
+	}
+
+	return nil
+}
+
+/* 没有主键的表, 通过指定的分块字段进行 row copy, 每个分块的行数和有主键的表一样自适应
+分块字段值相同的行一定在同一个分块中, 先拷贝分块字段为 NULL 的行, 再按 (lower, upper] 拷贝
+Params:
+    _conn: 快照连接
+    _table: 需要迁移的表
+*/
+func (this *RowCopy) CopyNoKeyTableByChunk(conn *sql.Conn, table *matemap.Table) error {
+	tableName := common.FormatTableName(table.SourceSchema, table.SourceName, "")
+
+	// 分块字段为 NULL 的行
+	rows, err := SelectRowsByQueryer(conn, table.GetSelNoKeyNullChunkSql())
+	if err != nil {
+		return err
+	}
+	if _, err := this.InsertNoKeyRows(table, rows, this.ChunkSizer.GetLimit(tableName)); err != nil {
+		return err
+	}
+
+	var lower interface{}
+	hasLower := false
+	for {
+		boundArgs := make([]interface{}, 0, 1)
+		if hasLower {
+			boundArgs = append(boundArgs, lower)
+		}
+
+		// 获取本次分块的上边界, 没有则说明是最后一个分块
+		limit := this.ChunkSizer.GetLimit(tableName)
+		startTime := time.Now()
+		var upper interface{}
+		hasUpper := true
+		err := conn.QueryRowContext(context.Background(), table.GetSelNoKeyChunkBoundSql(hasLower, limit), boundArgs...).Scan(&upper)
+		if err == sql.ErrNoRows {
+			hasUpper = false
+		} else if err != nil {
+			return fmt.Errorf("失败. 没有主键的表获取分块边界. %v.%v. %v", table.SourceSchema, table.SourceName, err)
+		}
+		if upperBytes, ok := upper.([]byte); ok {
+			upper = string(upperBytes)
+		}
+
+		chunkArgs := boundArgs
+		if hasUpper {
+			chunkArgs = append(chunkArgs, upper)
+		}
+		rows, err := SelectRowsByQueryer(conn, table.GetSelNoKeyChunkSql(hasLower, hasUpper), chunkArgs...)
+		if err != nil {
+			return err
+		}
+		waitTime, err := this.InsertNoKeyRows(table, rows, limit)
+		if err != nil {
+			return err
+		}
+		this.ChunkSizer.Record(tableName, len(rows), GetRowsByteCount(rows), time.Since(startTime)-waitTime)
+		logger.M.Infof("成功. 没有主键的表 row copy 分块. %v.%v. %v: (%v, %v]",
+			table.SourceSchema, table.SourceName, table.ChunkColumn, lower, upper)
+
+		if !hasUpper {
+			break
+		}
+		lower = upper
+		hasLower = true
+	}
+
+	return nil
+}
+
+/* 将没有主键的表的数据插入目标表, 分批插入
+Params:
+    _table: 需要迁移的表
+    _rows: 需要插入的数据
+    _batchSize: 每批插入的行数
+Return:
+    限流等待的时间, 不计入自适应行数的耗时
+*/
+func (this *RowCopy) InsertNoKeyRows(table *matemap.Table, rows [][]interface{}, batchSize int) (time.Duration, error) {
+	var waitTime time.Duration
+	for start := 0; start < len(rows); start += batchSize {
+		end := start + batchSize
+		if end > len(rows) {
+			end = len(rows)
+		}
+
+		// 限流时暂停写入目标
+		waitStartTime := time.Now()
+		this.Throttler.WaitRowCopy()
+		this.Throttler.WaitRowCopyRate(end-start, GetRowsByteCount(rows[start:end]))
+		waitTime += time.Since(waitStartTime)
+
+		err := this.WriteRowCopyData(table.SourceSchema, table.SourceName, rows[start:end])
+		if err != nil {
+			return waitTime, fmt.Errorf("失败. 没有主键的表 row copy 向目标数据库插入数据. %v.%v. %v", table.SourceSchema, table.SourceName, err)
+		}
+	}
+
+	return waitTime, nil
+}
+
+/* 清空没有主键的目标表
+Params:
+    _host: 目标实例 host
+    _port: 目标实例 port
+    _table: 需要迁移的表
+*/
+func DeleteNoKeyTargetAll(host string, port int, table *matemap.Table) error {
+	instance, ok := gdbc.GetDynamicDBByHostPort(host, int64(port))
+	if !ok {
+		return fmt.Errorf("缓存中不存在该实例(%v:%v). 清空没有主键的目标表", host, port)
+	}
+
+	deleteSql := table.GetDelNoKeyTargetAllSql()
+	if _, err := instance.Exec(deleteSql); err != nil {
+		return fmt.Errorf("失败. 清空没有主键的目标表. %v. %v", deleteSql, err)
+	}
+
+	return nil
+}
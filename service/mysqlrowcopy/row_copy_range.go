@@ -0,0 +1,590 @@
+package mysqlrowcopy
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/daiguadaidai/go-d-bus/common"
+	"github.com/daiguadaidai/go-d-bus/dao"
+	"github.com/daiguadaidai/go-d-bus/dao/daohelper"
+	"github.com/daiguadaidai/go-d-bus/gdbc"
+	"github.com/daiguadaidai/go-d-bus/logger"
+	"github.com/daiguadaidai/go-d-bus/matemap"
+	"github.com/daiguadaidai/go-d-bus/model"
+	"github.com/daiguadaidai/go-d-bus/service/helper"
+	"math"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ROW_COPY_RANGE_KEY_SEP = "#" // 拆分后范围的 key: schema.table#1
+)
+
+// 大表拆分后的一个范围, 每个范围单独生成主键范围值
+type RowCopyRange struct {
+	Key       string                     // 范围 key: schema.table#1
+	TableName string                     // 表名 schema.table
+	RangeNo   int                        // 第几个范围
+	Current   *matemap.PrimaryRangeValue // 当前生成到的主键范围值
+	Max       *matemap.PrimaryRangeValue // 该范围 row copy 截止的主键值
+}
+
+/* 获取拆分后范围的 key
+Params:
+    _tableName: 表名 schema.table
+    _rangeNo: 第几个范围
+*/
+func GetRangeKey(tableName string, rangeNo int) string {
+	return fmt.Sprintf("%v%v%v", tableName, ROW_COPY_RANGE_KEY_SEP, rangeNo)
+}
+
+/* 通过范围 key 获取表名和第几个范围, 没有拆分的表返回表名和 0
+Params:
+    _key: schema.table#1 或 schema.table
+*/
+func ParseRangeKey(key string) (string, int) {
+	items := strings.SplitN(key, ROW_COPY_RANGE_KEY_SEP, 2)
+	if len(items) != 2 {
+		return key, 0
+	}
+
+	rangeNo, err := strconv.Atoi(items[1])
+	if err != nil {
+		return key, 0
+	}
+
+	return items[0], rangeNo
+}
+
+// 获取主键范围值保存进度时使用的 key, 拆分的表使用范围 key, 没有拆分的使用表名
+func GetPrimaryRangeValueKey(primaryRangeValue *matemap.PrimaryRangeValue) string {
+	if primaryRangeValue.RangeKey != "" {
+		return primaryRangeValue.RangeKey
+	}
+
+	return common.FormatTableName(primaryRangeValue.Schema, primaryRangeValue.Table, "")
+}
+
+/* 将需要拆分的大表拆分成多个范围, 从需要生成主键范围的表中移除, 每个范围单独生成主键范围值
+之前已经拆分过的表直接使用数据库中保存的范围和进度
+*/
+func (this *RowCopy) SplitRowCopyRanges() error {
+	this.RowCopyRangeMap = make(map[string]*RowCopyRange)
+	this.RowCopyRangeRemainMap = make(map[string]map[string]bool)
+
+	tableNames := make([]string, 0, len(this.NeedRowCopyTableMap))
+	for tableName, _ := range this.NeedRowCopyTableMap {
+		tableNames = append(tableNames, tableName)
+	}
+	sort.Strings(tableNames)
+
+	tableMapRangeDao := new(dao.TableMapRangeDao)
+	for _, tableName := range tableNames {
+		schemaTable := strings.Split(tableName, ".")
+		tableMapRanges, err := tableMapRangeDao.FindByTable(this.ConfigMap.TaskUUID, schemaTable[0], schemaTable[1])
+		if err != nil {
+			return fmt.Errorf("失败. 获取表拆分的范围. %v. %v", tableName, err)
+		}
+
+		// 之前没有拆分过, 判断是否需要拆分
+		if len(tableMapRanges) == 0 {
+			splitCount, ok := this.GetTableSplitCount(tableName)
+			if !ok {
+				continue
+			}
+
+			tableMapRanges, err = this.CreateTableRanges(tableName, splitCount)
+			if err != nil {
+				return err
+			}
+			if len(tableMapRanges) <= 1 {
+				logger.M.Warnf("警告. 表数据太少, 不进行拆分. %v", tableName)
+				continue
+			}
+		}
+
+		if err := this.ReplaceTableWithRanges(tableName, tableMapRanges); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/* 获取表需要拆分成多少个范围
+Params:
+    _tableName: 表名 schema.table
+Return:
+    1. 拆分成多少个范围
+    2. 是否需要拆分
+*/
+func (this *RowCopy) GetTableSplitCount(tableName string) (int, bool) {
+	// 表单独指定了拆分个数, 不需要判断表的大小
+	if tableMap, ok := this.ConfigMap.TableMapMap[tableName]; ok && tableMap.RowCopySplit.Int64 > 1 {
+		return int(tableMap.RowCopySplit.Int64), true
+	}
+
+	if this.Parser.RowCopySplitCount <= 1 {
+		return 0, false
+	}
+
+	schemaTable := strings.Split(tableName, ".")
+	tableRows, err := GetSourceTableRows(this.ConfigMap.Source.Host.String, int(this.ConfigMap.Source.Port.Int64), schemaTable[0], schemaTable[1])
+	if err != nil {
+		logger.M.Warnf("警告. 获取表行数失败, 不进行拆分. %v. %v", tableName, err)
+		return 0, false
+	}
+	if tableRows < int64(this.Parser.RowCopySplitMinRows) {
+		return 0, false
+	}
+
+	return this.Parser.RowCopySplitCount, true
+}
+
+/* 将表从当前进度到截止值拆分成多个范围, 并保存到数据库中
+Params:
+    _tableName: 表名 schema.table
+    _splitCount: 拆分成多少个范围
+*/
+func (this *RowCopy) CreateTableRanges(tableName string, splitCount int) ([]*model.TableMapRange, error) {
+	table, err := matemap.GetMigrationTable(tableName)
+	if err != nil {
+		return nil, fmt.Errorf("失败. 拆分表获取表元数据. %v. %v", tableName, err)
+	}
+
+	host := this.ConfigMap.Source.Host.String
+	port := int(this.ConfigMap.Source.Port.Int64)
+	instance, ok := gdbc.GetDynamicDBByHostPort(host, int64(port))
+	if !ok {
+		return nil, fmt.Errorf("缓存中不存在该实例(%v:%v). 拆分表 %v", host, port, tableName)
+	}
+
+	// 从当前 row copy 到的位置开始拆分, 已经拷贝的数据不需要再拷贝
+	minValue := this.CurrentPrimaryRangeValueMap[tableName].NextValue
+	maxValue := this.MaxPrimaryRangeValueMap[tableName].MaxValue
+
+	tableRows, err := GetSourceTableRows(host, port, table.SourceSchema, table.SourceName)
+	if err != nil {
+		return nil, err
+	}
+
+	startValues, err := GetRangeStartValues(instance, table, minValue, maxValue, splitCount, tableRows)
+	if err != nil {
+		return nil, err
+	}
+
+	pkNames := table.FindSourcePKColumnNames()
+	pkTypes := table.FindSourcePKColumnTypes()
+	tableMapRanges := make([]*model.TableMapRange, 0, len(startValues))
+	for i, startValue := range startValues {
+		// 每个范围的截止值是下一个范围开始值的前一个主键值, 最后一个范围截止到表的截止值
+		endValue := maxValue
+		if i < len(startValues)-1 {
+			nextStartSlice := make([]interface{}, 0, len(pkNames))
+			for _, pkName := range pkNames {
+				nextStartSlice = append(nextStartSlice, startValues[i+1][pkName])
+			}
+
+			endValue, err = daohelper.Row2Map(instance.QueryRow(table.GetSelPrevPKSql(), nextStartSlice...), pkNames, pkTypes)
+			if err != nil {
+				return nil, fmt.Errorf("失败. 拆分表获取范围截止值. %v. %v", tableName, err)
+			}
+			if endValue == nil { // 开始值之后没有数据, 该范围为空
+				endValue = startValue
+			}
+		}
+
+		startJson, err := common.Map2Json(startValue)
+		if err != nil {
+			return nil, fmt.Errorf("失败. 拆分表范围开始值转化为json. %v. %v", tableName, err)
+		}
+		endJson, err := common.Map2Json(endValue)
+		if err != nil {
+			return nil, fmt.Errorf("失败. 拆分表范围截止值转化为json. %v. %v", tableName, err)
+		}
+
+		tableMapRanges = append(tableMapRanges, &model.TableMapRange{
+			TaskUUID:    sql.NullString{String: this.ConfigMap.TaskUUID, Valid: true},
+			Schema:      sql.NullString{String: table.SourceSchema, Valid: true},
+			Source:      sql.NullString{String: table.SourceName, Valid: true},
+			RangeNo:     sql.NullInt64{Int64: int64(i + 1), Valid: true},
+			CurrIDValue: sql.NullString{String: startJson, Valid: true},
+			MaxIDValue:  sql.NullString{String: endJson, Valid: true},
+		})
+	}
+	if len(tableMapRanges) <= 1 {
+		return tableMapRanges, nil
+	}
+
+	tableMapRangeDao := new(dao.TableMapRangeDao)
+	if err := tableMapRangeDao.CreateRanges(tableMapRanges); err != nil {
+		return nil, fmt.Errorf("失败. 保存表拆分的范围. %v. %v", tableName, err)
+	}
+	logger.M.Infof("成功. 表拆分成 %v 个范围并发 row copy. %v", len(tableMapRanges), tableName)
+
+	return tableMapRanges, nil
+}
+
+/* 获取每个范围开始的主键值
+单个整型主键通过最小最大值计算, 其他通过主键索引每隔一定的行数采样
+Params:
+    _instance: 源实例
+    _table: 需要迁移的表
+    _minValue: 开始的主键值
+    _maxValue: 截止的主键值
+    _splitCount: 拆分成多少个范围
+    _tableRows: 表的行数(估算值)
+*/
+func GetRangeStartValues(
+	instance *sql.DB,
+	table *matemap.Table,
+	minValue map[string]interface{},
+	maxValue map[string]interface{},
+	splitCount int,
+	tableRows int64,
+) ([]map[string]interface{}, error) {
+	pkNames := table.FindSourcePKColumnNames()
+	pkTypes := table.FindSourcePKColumnTypes()
+	startValues := []map[string]interface{}{minValue}
+
+	// 整型主键的步长, 不是单个整型主键通过采样
+	var intStep int64
+	var minInt int64
+	isIntPK := false
+	if len(pkNames) == 1 {
+		var maxInt int64
+		var minOk, maxOk bool
+		minInt, minOk = pkValue2Int64(minValue[pkNames[0]])
+		maxInt, maxOk = pkValue2Int64(maxValue[pkNames[0]])
+		if minOk && maxOk {
+			isIntPK = true
+			intStep = (maxInt - minInt) / int64(splitCount)
+			if intStep <= 0 {
+				return startValues, nil
+			}
+		}
+	}
+
+	// 采样的步长, 通过表的行数估算
+	var rowStep int64
+	if !isIntPK {
+		rowStep = tableRows / int64(splitCount)
+		if rowStep <= 0 {
+			return startValues, nil
+		}
+	}
+
+	prevValue := minValue
+	for i := 1; i < splitCount; i++ {
+		var args []interface{}
+		var offset int64
+		if isIntPK { // 获取 >= 计算出来的值的第一个主键值
+			args = []interface{}{minInt + intStep*int64(i)}
+		} else { // 从上一个开始值往后采样
+			for _, pkName := range pkNames {
+				args = append(args, prevValue[pkName])
+			}
+			offset = rowStep
+		}
+
+		rows, err := instance.Query(table.GetSelCurrAndNextPKSqlTpl(int(offset)), args...)
+		if err != nil {
+			return nil, fmt.Errorf("失败. 获取拆分范围的开始值. %v.%v. %v", table.SourceSchema, table.SourceName, err)
+		}
+		rowMaps, err := daohelper.RowsToMaps(rows, pkNames, pkTypes)
+		rows.Close()
+		if err != nil {
+			return nil, fmt.Errorf("失败. 获取拆分范围的开始值(row装换map出错). %v.%v. %v", table.SourceSchema, table.SourceName, err)
+		}
+		if len(rowMaps) == 0 || helper.MapAGreaterMapB(rowMaps[0], maxValue) { // 已经超过截止值
+			break
+		}
+		if !helper.MapAGreaterMapB(rowMaps[0], prevValue) { // 和上一个范围重复
+			continue
+		}
+
+		startValues = append(startValues, rowMaps[0])
+		prevValue = rowMaps[0]
+	}
+
+	return startValues, nil
+}
+
+/* 使用拆分后的范围替换需要生成主键范围的表, 已经完成的范围不需要再 row copy
+Params:
+    _tableName: 表名 schema.table
+    _tableMapRanges: 表拆分后的范围
+*/
+func (this *RowCopy) ReplaceTableWithRanges(tableName string, tableMapRanges []*model.TableMapRange) error {
+	table, err := matemap.GetMigrationTable(tableName)
+	if err != nil {
+		return fmt.Errorf("失败. 获取表元数据(拆分范围). %v. %v", tableName, err)
+	}
+	pkTypeMap := table.FindSourcePKColumnTypeMap()
+
+	delete(this.NeedRowCopyTableMap, tableName)
+	delete(this.CurrentPrimaryRangeValueMap, tableName)
+	delete(this.MaxPrimaryRangeValueMap, tableName)
+
+	remainKeys := make(map[string]bool)
+	for _, tableMapRange := range tableMapRanges {
+		if tableMapRange.RowCopyComplete.Int64 == 1 {
+			continue
+		}
+
+		rangeNo := int(tableMapRange.RangeNo.Int64)
+		key := GetRangeKey(tableName, rangeNo)
+
+		currValue, err := common.Json2MapBySqlType(tableMapRange.CurrIDValue.String, pkTypeMap)
+		if err != nil {
+			return fmt.Errorf("失败. 转换json数据(拆分范围当前值). %v. %v", key, err)
+		}
+		maxValue, err := common.Json2MapBySqlType(tableMapRange.MaxIDValue.String, pkTypeMap)
+		if err != nil {
+			return fmt.Errorf("失败. 转换json数据(拆分范围截止值). %v. %v", key, err)
+		}
+
+		current := matemap.NewPrimaryRangeValue(table.SourceSchema, table.SourceName, currValue, currValue, currValue)
+		current.RangeKey = key
+		maxRangeValue := matemap.NewPrimaryRangeValue(table.SourceSchema, table.SourceName, maxValue, maxValue, maxValue)
+		maxRangeValue.RangeKey = key
+
+		this.RowCopyRangeMap[key] = &RowCopyRange{
+			Key:       key,
+			TableName: tableName,
+			RangeNo:   rangeNo,
+			Current:   current,
+			Max:       maxRangeValue,
+		}
+		this.MaxPrimaryRangeValueMap[key] = maxRangeValue
+		remainKeys[key] = true
+	}
+
+	// 所有范围都已经完成了, 直接标记表完成
+	if len(remainKeys) == 0 {
+		schemaTable := strings.Split(tableName, ".")
+		TagTableRowCopyComplete(this.ConfigMap.TaskUUID, schemaTable[0], schemaTable[1])
+		logger.M.Infof("完成. 表拆分的所有范围都已经 row copy 完成, 标记表 row copy 完成. %v", tableName)
+		return nil
+	}
+
+	this.RowCopyRangeRemainMap[tableName] = remainKeys
+	logger.M.Infof("成功. 初始化表拆分后还需要 row copy 的范围: %v", remainKeys)
+
+	return nil
+}
+
+// 获取需要 row copy 的表和拆分后的范围, 用于初始化保存进度相关的变量
+func (this *RowCopy) FindRowCopyKeys() []string {
+	keys := make([]string, 0, len(this.NeedRowCopyTableMap)+len(this.RowCopyRangeMap))
+	for tableName, _ := range this.NeedRowCopyTableMap {
+		keys = append(keys, tableName)
+	}
+	for key, _ := range this.RowCopyRangeMap {
+		keys = append(keys, key)
+	}
+
+	return keys
+}
+
+/* 循环生成拆分后一个范围的主键值, 每个范围一个协程
+Params:
+    _rowCopyRange: 拆分后的范围
+*/
+func (this *RowCopy) LoopGenerateRangePrimaryRangeValue(wg *sync.WaitGroup, rowCopyRange *RowCopyRange) {
+	defer wg.Done()
+	defer this.TableScheduler.Finish(rowCopyRange.TableName) // 出错退出也不再参与调度
+
+	errRetryCount := 0
+	for {
+		if errRetryCount > this.Parser.ErrRetryCount {
+			logger.M.Errorf("错误. row copy 生成范围主键值发生错误, 并且超过重试上线值: %v. 将退出生成主键值. %v", this.Parser.ErrRetryCount, rowCopyRange.Key)
+			return
+		}
+
+		// 限流时暂停生成主键范围值
+		this.Throttler.WaitRowCopy()
+
+		ok, err := this.GenerateRangePrimaryRangeValue(rowCopyRange)
+		if err != nil {
+			errRetryCount++
+			logger.M.Errorf("错误. 第 %v 次, 允许重试次数: %v. %v", errRetryCount, this.Parser.ErrRetryCount, err)
+			time.Sleep(time.Second)
+			continue
+		}
+		if ok { // 该范围已经生成完了
+			break
+		}
+
+		errRetryCount = 0
+	}
+
+	logger.M.Infof("完成. 范围的主键值已经全部生成完毕. %v", rowCopyRange.Key)
+}
+
+/* 生成拆分后一个范围的下一个主键范围值, 超过范围截止值的部分会被截断
+Params:
+    _rowCopyRange: 拆分后的范围
+Return:
+    该范围是否已经生成完
+*/
+func (this *RowCopy) GenerateRangePrimaryRangeValue(rowCopyRange *RowCopyRange) (bool, error) {
+	defer func() {
+		if err := recover(); err != nil {
+			logger.M.Fatalf("错误. 生成 row copy 范围主键值发生错误. %v. %v. %v", rowCopyRange.Key, err, string(debug.Stack()))
+		}
+	}()
+
+	// 按调度策略没有轮到该表, 或者该表正在进行的 row copy 达到了并发上限
+	if !this.TableScheduler.TryAcquire(rowCopyRange.TableName) {
+		time.Sleep(TABLE_SCHEDULER_WAIT_TIME)
+		return false, nil
+	}
+
+	// 已经获取了该表的一个并发数, 没有放入通道需要释放
+	isSent := false
+	defer func() {
+		if !isSent {
+			this.TableScheduler.Release(rowCopyRange.TableName)
+		}
+	}()
+
+	nextPrimaryRangeValue, err := rowCopyRange.Current.GetNextPrimaryRangeValue(this.ChunkSizer.GetLimit(rowCopyRange.TableName), this.ConfigMap.Source.Host.String, int(this.ConfigMap.Source.Port.Int64))
+	if err != nil {
+		return false, fmt.Errorf("row copy 生成范围的下一个主键值失败. %v. %v", rowCopyRange.Key, err)
+	}
+	if nextPrimaryRangeValue == nil || helper.MapAGreaterMapB(nextPrimaryRangeValue.MinValue, rowCopyRange.Max.MaxValue) {
+		return true, nil
+	}
+
+	// 超过该范围截止值的部分属于下一个范围
+	isLast := false
+	if helper.MapAGreaterOrEqualMapB(nextPrimaryRangeValue.MaxValue, rowCopyRange.Max.MaxValue) {
+		nextPrimaryRangeValue.MaxValue = rowCopyRange.Max.MaxValue
+		isLast = true
+	}
+	nextPrimaryRangeValue.RangeKey = rowCopyRange.Key
+	logger.M.Infof("成功. 生成范围主键ID值. %v. 最小值: %v, 最大值: %v, 截止值: %v",
+		rowCopyRange.Key, nextPrimaryRangeValue.MinValue, nextPrimaryRangeValue.MaxValue, rowCopyRange.Max.MaxValue)
+
+	if err := this.SaveRowCopyChunk(nextPrimaryRangeValue); err != nil {
+		return false, err
+	}
+
+	addOrDelete := NewAddOrDelete(nextPrimaryRangeValue.Schema, nextPrimaryRangeValue.Table, nextPrimaryRangeValue.TimestampHash, AOD_TYPE_ADD, nextPrimaryRangeValue)
+	this.AddOrDelWatingTagCompleteChan <- addOrDelete
+
+	this.PrimaryRangeValueChan <- nextPrimaryRangeValue
+	isSent = true
+
+	rowCopyRange.Current = nextPrimaryRangeValue
+
+	return isLast, nil
+}
+
+/* 保存表或者范围当前 row copy 到的主键值
+Params:
+    _key: 表名 schema.table 或者范围 key schema.table#1
+    _jsonData: 需要更新的数据
+*/
+func (this *RowCopy) UpdateRowCopyKeyCurrPrimaryValue(key string, jsonData string) {
+	tableName, rangeNo := ParseRangeKey(key)
+	schemaTable := strings.Split(tableName, ".")
+
+	if rangeNo == 0 {
+		UpdateTableCurrPrimaryValue(this.ConfigMap.TaskUUID, schemaTable[0], schemaTable[1], jsonData)
+		return
+	}
+
+	tableMapRangeDao := new(dao.TableMapRangeDao)
+	tableMapRangeDao.UpdateCurrIDValue(this.ConfigMap.TaskUUID, schemaTable[0], schemaTable[1], rangeNo, jsonData)
+}
+
+/* 标记表或者范围 row copy 完成, 表拆分的所有范围都完成后标记表完成
+Params:
+    _key: 表名 schema.table 或者范围 key schema.table#1
+*/
+func (this *RowCopy) TagRowCopyKeyComplete(key string) {
+	tableName, rangeNo := ParseRangeKey(key)
+	schemaTable := strings.Split(tableName, ".")
+
+	if rangeNo == 0 {
+		TagTableRowCopyComplete(this.ConfigMap.TaskUUID, schemaTable[0], schemaTable[1])
+		logger.M.Infof("完成. 标记表 row copy 完成. %v", tableName)
+		return
+	}
+
+	tableMapRangeDao := new(dao.TableMapRangeDao)
+	tableMapRangeDao.TagRangeRowCopyComplete(this.ConfigMap.TaskUUID, schemaTable[0], schemaTable[1], rangeNo)
+	logger.M.Infof("完成. 标记范围 row copy 完成. %v", key)
+
+	remainKeys, ok := this.RowCopyRangeRemainMap[tableName]
+	if !ok {
+		return
+	}
+	delete(remainKeys, key)
+	if len(remainKeys) == 0 {
+		TagTableRowCopyComplete(this.ConfigMap.TaskUUID, schemaTable[0], schemaTable[1])
+		delete(this.RowCopyRangeRemainMap, tableName)
+		logger.M.Infof("完成. 表拆分的所有范围都已经 row copy 完成, 标记表 row copy 完成. %v", tableName)
+	}
+}
+
+/* 获取源表的行数(估算值), 用于判断是否需要拆分和采样
+Params:
+    _host: 实例 host
+    _port: 实例 port
+    _schema: 数据库名
+    _table: 表名
+*/
+func GetSourceTableRows(host string, port int, schema string, table string) (int64, error) {
+	instance, ok := gdbc.GetDynamicDBByHostPort(host, int64(port))
+	if !ok {
+		return 0, fmt.Errorf("缓存中不存在该实例(%v:%v). 获取源表行数", host, port)
+	}
+
+	selectSql := `
+        /* go-d-bus */ SELECT TABLE_ROWS
+        FROM information_schema.TABLES
+        WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ?
+    `
+
+	var tableRows sql.NullInt64
+	if err := instance.QueryRow(selectSql, schema, table).Scan(&tableRows); err != nil {
+		return 0, fmt.Errorf("失败. 获取源表行数. %v.%v. %v:%v. %v", schema, table, host, port, err)
+	}
+
+	return tableRows.Int64, nil
+}
+
+// 将整型的主键值转化为 int64, 不是整型或者超过 int64 范围返回 false
+func pkValue2Int64(value interface{}) (int64, bool) {
+	switch v := value.(type) {
+	case int:
+		return int64(v), true
+	case int8:
+		return int64(v), true
+	case int16:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case uint:
+		return int64(v), uint64(v) <= math.MaxInt64
+	case uint8:
+		return int64(v), true
+	case uint16:
+		return int64(v), true
+	case uint32:
+		return int64(v), true
+	case uint64:
+		return int64(v), v <= math.MaxInt64
+	}
+
+	return 0, false
+}
@@ -0,0 +1,271 @@
+package mysqlrowcopy
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/daiguadaidai/go-d-bus/gdbc"
+	"github.com/daiguadaidai/go-d-bus/logger"
+	"github.com/daiguadaidai/go-d-bus/service/mysqlapplybinlog"
+	"strings"
+	"sync"
+)
+
+// 可以执行查询的对象, *sql.DB 和 *sql.Conn 都满足
+type RowsQueryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+/* 一致性快照
+在同一个时间点对源实例开启 N 个 START TRANSACTION WITH CONSISTENT SNAPSHOT 的连接,
+每个 row copy 协程使用其中一个连接读取数据, 读取到的都是同一个时间点的数据.
+LogFile, LogPos 是快照对应的 binlog 位点, 应用binlog从这里开始就不会遗漏也不会多应用
+*/
+type Snapshot struct {
+	Host string
+	Port int
+
+	LogFile string
+	LogPos  int
+	GTIDSet string
+
+	Conns []*sql.Conn // 每个 row copy 协程一个快照连接
+
+	closeOnce sync.Once
+}
+
+/* 创建一个一致性快照
+Params:
+    _host: 源实例 host
+    _port: 源实例 port
+    _count: 需要开启多少个快照连接
+加全局读锁 -> 开启快照 -> show master status -> 解锁. 快照和位点完全一致
+*/
+func NewSnapshot(_host string, _port int, _count int) (*Snapshot, error) {
+	if _count < 1 {
+		return nil, fmt.Errorf("失败. 创建一致性快照, 快照连接数必须 > 0. %v", _count)
+	}
+
+	instance, ok := gdbc.GetDynamicDBByHostPort(_host, int64(_port))
+	if !ok {
+		return nil, fmt.Errorf("缓存中不存在该实例(%v:%v). 创建一致性快照失败", _host, _port)
+	}
+
+	snapshot := &Snapshot{
+		Host:  _host,
+		Port:  _port,
+		Conns: make([]*sql.Conn, 0, _count),
+	}
+
+	ctx := context.Background()
+
+	// 用于加锁的连接, 快照建立完成后就释放
+	lockConn, err := instance.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("失败. 创建一致性快照, 获取加锁连接. %v:%v. %v", _host, _port, err)
+	}
+	defer lockConn.Close()
+
+	lockSql, unlockSql := snapshot.getLockSqls()
+	if _, err := lockConn.ExecContext(ctx, lockSql); err != nil {
+		return nil, fmt.Errorf("失败. 创建一致性快照, 加锁. %v. %v:%v. %v", lockSql, _host, _port, err)
+	}
+	logger.M.Infof("成功. 创建一致性快照, 加锁. %v", lockSql)
+
+	err = snapshot.startWithLock(ctx, instance, lockConn, _count)
+
+	// 不管成功与否都需要尽快释放锁
+	if _, unlockErr := lockConn.ExecContext(ctx, unlockSql); unlockErr != nil {
+		logger.M.Errorf("失败. 创建一致性快照, 解锁. %v. %v:%v. %v", unlockSql, _host, _port, unlockErr)
+		if err == nil {
+			err = unlockErr
+		}
+	} else {
+		logger.M.Infof("成功. 创建一致性快照, 解锁. %v", unlockSql)
+	}
+
+	if err != nil {
+		snapshot.Close()
+		return nil, err
+	}
+
+	logger.M.Infof("成功. 创建一致性快照. 快照连接数: %v, 位点: %v:%v, GTID: %v",
+		len(snapshot.Conns), snapshot.LogFile, snapshot.LogPos, snapshot.GTIDSet)
+
+	return snapshot, nil
+}
+
+// 获取加锁和解锁的sql
+func (this *Snapshot) getLockSqls() (string, string) {
+	return "/* go-d-bus */ FLUSH TABLES WITH READ LOCK", "/* go-d-bus */ UNLOCK TABLES"
+}
+
+/* 在持有锁的情况下获取位点并开启快照连接
+Params:
+    _ctx: context
+    _instance: 源实例
+    _lockConn: 持有锁的连接
+    _count: 需要开启多少个快照连接
+*/
+func (this *Snapshot) startWithLock(_ctx context.Context, _instance *sql.DB, _lockConn *sql.Conn, _count int) error {
+	for i := 0; i < _count; i++ {
+		conn, err := StartSnapshotConn(_ctx, _instance)
+		if err != nil {
+			return fmt.Errorf("失败. 创建一致性快照, 第 %v 个快照连接. %v:%v. %v", i, this.Host, this.Port, err)
+		}
+		this.Conns = append(this.Conns, conn)
+	}
+
+	// 全局读锁阻塞了所有写, 此时的位点就是快照的位点
+	if err := this.setMasterStatus(_ctx, _lockConn); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+/* 获取一个连接并开启 START TRANSACTION WITH CONSISTENT SNAPSHOT
+Params:
+    _ctx: context
+    _instance: 源实例
+*/
+func StartSnapshotConn(_ctx context.Context, _instance *sql.DB) (*sql.Conn, error) {
+	conn, err := _instance.Conn(_ctx)
+	if err != nil {
+		return nil, fmt.Errorf("获取连接. %v", err)
+	}
+
+	if err := startSnapshot(_ctx, conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+/* 在已有的连接上加全局读锁, 开启快照并获取 binlog 位点后解锁.
+和 mysqldump --single-transaction --master-data 一样, 快照和位点完全一致. 连接上之前的快照事务会被提交
+Params:
+    _ctx: context
+    _conn: 开启快照的连接
+Return: binlog 文件, binlog 位置, GTID 集合, 错误
+*/
+func StartLockedSnapshot(_ctx context.Context, _conn *sql.Conn) (string, int, string, error) {
+	lockSql, unlockSql := "/* go-d-bus */ FLUSH TABLES WITH READ LOCK", "/* go-d-bus */ UNLOCK TABLES"
+	if _, err := _conn.ExecContext(_ctx, lockSql); err != nil {
+		return "", 0, "", fmt.Errorf("加锁. %v. %v", lockSql, err)
+	}
+
+	var logFile, gtidSet string
+	var logPos int
+	err := startSnapshot(_ctx, _conn)
+	if err == nil {
+		logFile, logPos, gtidSet, err = showMasterStatus(_ctx, _conn)
+	}
+
+	// 不管成功与否都需要尽快释放锁, 全局读锁不会因为开启事务释放
+	if _, unlockErr := _conn.ExecContext(_ctx, unlockSql); unlockErr != nil && err == nil {
+		err = fmt.Errorf("解锁. %v. %v", unlockSql, unlockErr)
+	}
+
+	return logFile, logPos, gtidSet, err
+}
+
+/* 在连接上开启 START TRANSACTION WITH CONSISTENT SNAPSHOT
+Params:
+    _ctx: context
+    _conn: 开启快照的连接
+*/
+func startSnapshot(_ctx context.Context, _conn *sql.Conn) error {
+	isolationSql := "/* go-d-bus */ SET SESSION TRANSACTION ISOLATION LEVEL REPEATABLE READ"
+	if _, err := _conn.ExecContext(_ctx, isolationSql); err != nil {
+		return fmt.Errorf("设置隔离级别. %v. %v", isolationSql, err)
+	}
+
+	startSql := "/* go-d-bus */ START TRANSACTION WITH CONSISTENT SNAPSHOT"
+	if _, err := _conn.ExecContext(_ctx, startSql); err != nil {
+		return fmt.Errorf("开启快照. %v. %v", startSql, err)
+	}
+
+	return nil
+}
+
+/* 获取当前 binlog 位点
+Params:
+    _ctx: context
+    _conn: 执行 show master status 的连接
+*/
+func (this *Snapshot) setMasterStatus(_ctx context.Context, _conn *sql.Conn) error {
+	logFile, logPos, gtidSet, err := showMasterStatus(_ctx, _conn)
+	if err != nil {
+		return fmt.Errorf("失败. 创建一致性快照, %v. %v:%v", err, this.Host, this.Port)
+	}
+
+	this.LogFile = logFile
+	this.LogPos = logPos
+	this.GTIDSet = gtidSet
+
+	return nil
+}
+
+/* 执行 show master status 获取 binlog 位点
+Params:
+    _ctx: context
+    _conn: 执行 show master status 的连接
+Return: binlog 文件, binlog 位置, GTID 集合, 错误
+*/
+func showMasterStatus(_ctx context.Context, _conn *sql.Conn) (string, int, string, error) {
+	showSql := "/* go-d-bus */ SHOW MASTER STATUS"
+
+	var file sql.NullString
+	var position sql.NullInt64
+	var binlogDoDB sql.NullString
+	var binlogIgnoreDB sql.NullString
+	var executedGtidSet sql.NullString
+
+	err := _conn.QueryRowContext(_ctx, showSql).Scan(&file, &position, &binlogDoDB, &binlogIgnoreDB, &executedGtidSet)
+	if err != nil {
+		return "", 0, "", fmt.Errorf("获取 binlog 位点. %v", err)
+	}
+
+	if !file.Valid || !position.Valid || strings.TrimSpace(file.String) == "" || position.Int64 <= 0 {
+		return "", 0, "", fmt.Errorf("没有获得到binlog位点信息")
+	}
+
+	return file.String, int(position.Int64), executedGtidSet.String, nil
+}
+
+// 快照对应的位点, 源实例开启了 GTID 时包含快照时已经执行的 GTID 集合
+func (this *Snapshot) GetLogFilePos() *mysqlapplybinlog.LogFilePos {
+	logFilePos := mysqlapplybinlog.NewLogFilePos(this.LogFile, this.LogPos)
+	logFilePos.SetGTIDSet(this.GTIDSet)
+
+	return logFilePos
+}
+
+/* 获取 row copy 协程对应的快照连接
+Params:
+    _parallerTag: row copy 协程标记
+*/
+func (this *Snapshot) GetConn(_parallerTag int) *sql.Conn {
+	return this.Conns[_parallerTag%len(this.Conns)]
+}
+
+// 获取没有主键的表 row copy 使用的快照连接, 最后一个连接专门给没有主键的表使用
+func (this *Snapshot) GetNoKeyConn() *sql.Conn {
+	return this.Conns[len(this.Conns)-1]
+}
+
+// 结束所有快照事务并释放连接
+func (this *Snapshot) Close() {
+	this.closeOnce.Do(func() {
+		ctx := context.Background()
+		for i, conn := range this.Conns {
+			if _, err := conn.ExecContext(ctx, "/* go-d-bus */ COMMIT"); err != nil {
+				logger.M.Warnf("警告. 关闭一致性快照, 第 %v 个快照连接结束事务失败. %v", i, err)
+			}
+			conn.Close()
+		}
+		logger.M.Infof("完成. 关闭一致性快照, 释放 %v 个快照连接", len(this.Conns))
+	})
+}
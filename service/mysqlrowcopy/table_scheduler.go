@@ -0,0 +1,288 @@
+package mysqlrowcopy
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/daiguadaidai/go-d-bus/common"
+	"github.com/daiguadaidai/go-d-bus/config"
+	"github.com/daiguadaidai/go-d-bus/gdbc"
+	"github.com/daiguadaidai/go-d-bus/logger"
+	"github.com/daiguadaidai/go-d-bus/parser"
+	"go.uber.org/atomic"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	TABLE_SCHEDULER_WAIT_TIME = 100 * time.Millisecond // 所有表都达到并发上限时, 等待多久再次调度
+)
+
+/* row copy 表调度器, 决定下一个生成主键范围值的是哪个表.
+没有拆分的表由一个协程通过 Next 获取, 拆分后的每个范围一个协程通过 TryAcquire 获取, 都按同一个调度策略排队
+*/
+type TableScheduler struct {
+	Policy string // 调度策略
+
+	lock sync.Mutex // 选择表和获取并发数需要是原子操作
+	// 每个表还在生成主键范围值的协程个数, 没有拆分的表是 1, 拆分的表是还没有生成完的范围个数
+	PendingCountMap map[string]int
+
+	// 按调度策略排好序的表, random 策略不使用
+	OrderedTableNames []string
+	// round-robin 下一次从第几个表开始
+	nextIndex int
+
+	// 每个表最多同时进行 row copy 的范围个数, 0 不限制 map: {"schema.table": 4}
+	TableParallerMap map[string]int
+	// 每个表正在进行 row copy 的范围个数 map: {"schema.table": 2}
+	RunningCountMap map[string]*atomic.Int64
+}
+
+/* 创建表调度器
+Params:
+    _runParser: 命令行解析的信息
+    _configMap: 配置信息
+    _pendingCountMap: 需要 row copy 的表以及生成主键范围值的协程个数 map: {"schema.table": 1}
+*/
+func NewTableScheduler(
+	runParser *parser.RunParser,
+	configMap *config.ConfigMap,
+	pendingCountMap map[string]int,
+) (*TableScheduler, error) {
+	scheduler := &TableScheduler{
+		Policy:           runParser.RowCopySchedule,
+		PendingCountMap:  pendingCountMap,
+		TableParallerMap: make(map[string]int),
+		RunningCountMap:  make(map[string]*atomic.Int64),
+	}
+
+	tableNames := make([]string, 0, len(pendingCountMap))
+	for tableName, _ := range pendingCountMap {
+		tableNames = append(tableNames, tableName)
+
+		// 表单独设置的并发上限优先
+		scheduler.TableParallerMap[tableName] = runParser.RowCopyTableParaller
+		if tableMap, ok := configMap.TableMapMap[tableName]; ok && tableMap.RowCopyParaller.Int64 > 0 {
+			scheduler.TableParallerMap[tableName] = int(tableMap.RowCopyParaller.Int64)
+		}
+		scheduler.RunningCountMap[tableName] = atomic.NewInt64(0)
+	}
+	sort.Strings(tableNames)
+
+	switch scheduler.Policy {
+	case parser.ROW_COPY_SCHEDULE_SMALLEST_FIRST, parser.ROW_COPY_SCHEDULE_LARGEST_FIRST:
+		tableSizeMap := make(map[string]int64)
+		for _, tableName := range tableNames {
+			schemaTable := strings.Split(tableName, ".")
+			size, err := GetSourceTableSize(configMap.Source.Host.String, int(configMap.Source.Port.Int64), schemaTable[0], schemaTable[1])
+			if err != nil {
+				return nil, err
+			}
+			tableSizeMap[tableName] = size
+		}
+
+		largestFirst := scheduler.Policy == parser.ROW_COPY_SCHEDULE_LARGEST_FIRST
+		sort.SliceStable(tableNames, func(i, j int) bool {
+			if largestFirst {
+				return tableSizeMap[tableNames[i]] > tableSizeMap[tableNames[j]]
+			}
+			return tableSizeMap[tableNames[i]] < tableSizeMap[tableNames[j]]
+		})
+	case parser.ROW_COPY_SCHEDULE_PRIORITY:
+		sort.SliceStable(tableNames, func(i, j int) bool {
+			return getTableRowCopyPriority(configMap, tableNames[i]) > getTableRowCopyPriority(configMap, tableNames[j])
+		})
+	}
+	scheduler.OrderedTableNames = tableNames
+
+	logger.M.Infof("成功. 初始化 row copy 表调度器. 策略: %v. 表顺序: %v. 每个表并发上限: %v",
+		scheduler.Policy, scheduler.OrderedTableNames, scheduler.TableParallerMap)
+
+	return scheduler, nil
+}
+
+/* 获取下一个需要生成主键范围值的没有拆分的表, 并获取该表的一个并发数, 只能在一个协程中调用.
+按调度策略轮到拆分的表时不返回表, 等待该表的范围协程获取
+Params:
+    _needRowCopyTableMap: 还需要生成主键范围值的没有拆分的表
+Return:
+    1. 表名
+    2. 是否获取到表, 有表但都达到并发上限或者轮到拆分的表也返回 false
+    3. 是否还有需要生成主键范围值的表
+*/
+func (this *TableScheduler) Next(needRowCopyTableMap map[string]bool) (string, bool, bool) {
+	if len(needRowCopyTableMap) == 0 {
+		return "", false, false
+	}
+
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	if this.Policy == parser.ROW_COPY_SCHEDULE_RANDOM {
+		if tableName, ok := common.GetRandomMapKey(needRowCopyTableMap); ok && !this.isFull(tableName) {
+			this.acquire(tableName)
+			return tableName, true, true
+		}
+		for tableName, _ := range needRowCopyTableMap {
+			if !this.isFull(tableName) {
+				this.acquire(tableName)
+				return tableName, true, true
+			}
+		}
+
+		return "", false, true
+	}
+
+	tableName, ok := this.turnTableName()
+	if !ok {
+		return "", false, true
+	}
+	if _, ok := needRowCopyTableMap[tableName]; !ok { // 轮到拆分的表
+		return "", false, true
+	}
+	this.acquire(tableName)
+
+	return tableName, true, true
+}
+
+/* 拆分后的范围协程获取表的一个并发数, 按调度策略没有轮到该表或者达到并发上限返回 false
+Params:
+    _tableName: 表名 schema.table
+*/
+func (this *TableScheduler) TryAcquire(tableName string) bool {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	if this.isFull(tableName) {
+		return false
+	}
+
+	if this.Policy != parser.ROW_COPY_SCHEDULE_RANDOM {
+		if turnTableName, ok := this.turnTableName(); !ok || turnTableName != tableName {
+			return false
+		}
+	}
+	this.acquire(tableName)
+
+	return true
+}
+
+/* 表的一个协程已经生成完主键范围值, 所有协程都生成完后该表不再参与调度
+Params:
+    _tableName: 表名 schema.table
+*/
+func (this *TableScheduler) Finish(tableName string) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	if this.PendingCountMap[tableName] > 1 {
+		this.PendingCountMap[tableName]--
+		return
+	}
+	delete(this.PendingCountMap, tableName)
+}
+
+// 按调度策略轮到的表: 还在生成主键范围值并且没有达到并发上限的第一个表, round-robin 从上一次的下一个表开始
+func (this *TableScheduler) turnTableName() (string, bool) {
+	startIndex := 0
+	if this.Policy == parser.ROW_COPY_SCHEDULE_ROUND_ROBIN {
+		startIndex = this.nextIndex
+	}
+
+	tableCount := len(this.OrderedTableNames)
+	for i := 0; i < tableCount; i++ {
+		tableName := this.OrderedTableNames[(startIndex+i)%tableCount]
+		if _, ok := this.PendingCountMap[tableName]; !ok || this.isFull(tableName) {
+			continue
+		}
+
+		return tableName, true
+	}
+
+	return "", false
+}
+
+// 表生成了一个主键范围值, 正在进行的个数加1, round-robin 下一次从该表的下一个表开始. 需要持有锁
+func (this *TableScheduler) acquire(tableName string) {
+	if runningCount, ok := this.RunningCountMap[tableName]; ok {
+		runningCount.Inc()
+	}
+
+	if this.Policy != parser.ROW_COPY_SCHEDULE_ROUND_ROBIN {
+		return
+	}
+	for index, orderedTableName := range this.OrderedTableNames {
+		if orderedTableName == tableName {
+			this.nextIndex = (index + 1) % len(this.OrderedTableNames)
+			break
+		}
+	}
+}
+
+// 重新 row copy 之前没有完成的 chunk, 不受调度策略和并发上限限制, 正在进行的个数加1
+func (this *TableScheduler) Acquire(tableName string) {
+	if runningCount, ok := this.RunningCountMap[tableName]; ok {
+		runningCount.Inc()
+	}
+}
+
+// 表完成了一个主键范围值的 row copy, 或者生成的主键范围值没有放入通道, 正在进行的个数减1
+func (this *TableScheduler) Release(tableName string) {
+	if runningCount, ok := this.RunningCountMap[tableName]; ok {
+		runningCount.Dec()
+	}
+}
+
+// 表正在进行的 row copy 是否达到了并发上限
+func (this *TableScheduler) isFull(tableName string) bool {
+	paraller := this.TableParallerMap[tableName]
+	if paraller <= 0 {
+		return false
+	}
+
+	runningCount, ok := this.RunningCountMap[tableName]
+	if !ok {
+		return false
+	}
+
+	return runningCount.Load() >= int64(paraller)
+}
+
+// 获取表在 table_map 中设置的 row copy 优先级
+func getTableRowCopyPriority(configMap *config.ConfigMap, tableName string) int64 {
+	tableMap, ok := configMap.TableMapMap[tableName]
+	if !ok {
+		return 0
+	}
+
+	return tableMap.RowCopyPriority.Int64
+}
+
+/* 获取源表数据大小, 用于按表大小进行调度
+Params:
+    _host: 实例 host
+    _port: 实例 port
+    _schema: 数据库名
+    _table: 表名
+*/
+func GetSourceTableSize(host string, port int, schema string, table string) (int64, error) {
+	instance, ok := gdbc.GetDynamicDBByHostPort(host, int64(port))
+	if !ok {
+		return 0, fmt.Errorf("缓存中不存在该实例(%v:%v). 获取源表数据大小", host, port)
+	}
+
+	selectSql := `
+        /* go-d-bus */ SELECT DATA_LENGTH
+        FROM information_schema.TABLES
+        WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ?
+    `
+
+	var size sql.NullInt64
+	if err := instance.QueryRow(selectSql, schema, table).Scan(&size); err != nil {
+		return 0, fmt.Errorf("失败. 获取源表数据大小. %v.%v. %v:%v. %v", schema, table, host, port, err)
+	}
+
+	return size.Int64, nil
+}
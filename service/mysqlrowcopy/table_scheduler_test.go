@@ -0,0 +1,110 @@
+package mysqlrowcopy
+
+import (
+	"github.com/daiguadaidai/go-d-bus/parser"
+	"go.uber.org/atomic"
+	"sync"
+	"testing"
+)
+
+func newTestTableScheduler(policy string, paraller int, pendingCountMap map[string]int, tableNames ...string) *TableScheduler {
+	scheduler := &TableScheduler{
+		Policy:            policy,
+		PendingCountMap:   pendingCountMap,
+		OrderedTableNames: tableNames,
+		TableParallerMap:  make(map[string]int),
+		RunningCountMap:   make(map[string]*atomic.Int64),
+	}
+	for _, tableName := range tableNames {
+		scheduler.TableParallerMap[tableName] = paraller
+		scheduler.RunningCountMap[tableName] = atomic.NewInt64(0)
+	}
+
+	return scheduler
+}
+
+func TestTableScheduler_TryAcquireParaller(t *testing.T) {
+	scheduler := newTestTableScheduler(parser.ROW_COPY_SCHEDULE_RANDOM, 2, map[string]int{"db.a": 8}, "db.a")
+
+	// 多个范围协程同时获取, 不能超过并发上限
+	acquiredCount := atomic.NewInt64(0)
+	wg := new(sync.WaitGroup)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if scheduler.TryAcquire("db.a") {
+				acquiredCount.Inc()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if acquiredCount.Load() != 2 {
+		t.Fatalf("期望获取到 2 个并发数, 实际 %v", acquiredCount.Load())
+	}
+
+	scheduler.Release("db.a")
+	if !scheduler.TryAcquire("db.a") {
+		t.Fatal("释放后应该可以再次获取")
+	}
+}
+
+func TestTableScheduler_PriorityWithRange(t *testing.T) {
+	// db.a 拆分成 2 个范围, 优先级高; db.b 没有拆分
+	scheduler := newTestTableScheduler(parser.ROW_COPY_SCHEDULE_PRIORITY, 2, map[string]int{"db.a": 2, "db.b": 1}, "db.a", "db.b")
+	needRowCopyTableMap := map[string]bool{"db.b": true}
+
+	if _, ok, _ := scheduler.Next(needRowCopyTableMap); ok {
+		t.Fatal("轮到拆分的表 db.a, 不应该获取到 db.b")
+	}
+	if scheduler.TryAcquire("db.b") {
+		t.Fatal("没有轮到 db.b")
+	}
+	if !scheduler.TryAcquire("db.a") || !scheduler.TryAcquire("db.a") {
+		t.Fatal("应该轮到 db.a")
+	}
+
+	// db.a 达到并发上限后轮到 db.b
+	if tableName, ok, _ := scheduler.Next(needRowCopyTableMap); !ok || tableName != "db.b" {
+		t.Fatalf("期望获取到 db.b, 实际 %v, %v", tableName, ok)
+	}
+
+	// db.a 释放后又轮到 db.a
+	scheduler.Release("db.a")
+	if _, ok, _ := scheduler.Next(needRowCopyTableMap); ok {
+		t.Fatal("db.a 释放后不应该获取到 db.b")
+	}
+
+	// db.a 的所有范围都生成完后轮到 db.b
+	scheduler.Finish("db.a")
+	if _, ok, _ := scheduler.Next(needRowCopyTableMap); ok {
+		t.Fatal("db.a 还有一个范围没有生成完")
+	}
+	scheduler.Finish("db.a")
+	if tableName, ok, _ := scheduler.Next(needRowCopyTableMap); !ok || tableName != "db.b" {
+		t.Fatalf("期望获取到 db.b, 实际 %v, %v", tableName, ok)
+	}
+}
+
+func TestTableScheduler_RoundRobinWithRange(t *testing.T) {
+	scheduler := newTestTableScheduler(parser.ROW_COPY_SCHEDULE_ROUND_ROBIN, 0, map[string]int{"db.a": 2, "db.b": 1}, "db.a", "db.b")
+	needRowCopyTableMap := map[string]bool{"db.b": true}
+
+	if !scheduler.TryAcquire("db.a") {
+		t.Fatal("应该轮到 db.a")
+	}
+	if scheduler.TryAcquire("db.a") {
+		t.Fatal("db.a 获取后应该轮到 db.b")
+	}
+	if tableName, ok, _ := scheduler.Next(needRowCopyTableMap); !ok || tableName != "db.b" {
+		t.Fatalf("期望获取到 db.b, 实际 %v, %v", tableName, ok)
+	}
+	if !scheduler.TryAcquire("db.a") {
+		t.Fatal("db.b 获取后应该轮到 db.a")
+	}
+
+	if scheduler.RunningCountMap["db.a"].Load() != 2 || scheduler.RunningCountMap["db.b"].Load() != 1 {
+		t.Fatalf("正在进行的个数不正确. db.a: %v, db.b: %v", scheduler.RunningCountMap["db.a"].Load(), scheduler.RunningCountMap["db.b"].Load())
+	}
+}
@@ -0,0 +1,63 @@
+package service
+
+import (
+	"github.com/daiguadaidai/go-d-bus/config"
+	"github.com/daiguadaidai/go-d-bus/logger"
+	"github.com/daiguadaidai/go-d-bus/matemap"
+	"github.com/daiguadaidai/go-d-bus/parser"
+	mysqlcs "github.com/daiguadaidai/go-d-bus/service/mysqlchecksum"
+	"os"
+)
+
+/* 生成任务的 checksum 报告, 输出到文件或标准输出
+Params:
+    _reportParser: 启动参数
+Return: 生成的报告
+*/
+func StartReport(reportParser *parser.ReportParser) *mysqlcs.ChecksumReport {
+	// 获取配置映射信息
+	configMap, err := config.NewConfigMap(reportParser.TaskUUID)
+	if err != nil {
+		logger.M.Fatal(err)
+	}
+
+	// 获取随机其中一个schemaMap
+	randSchemaMap := configMap.GetRandSchemaMap()
+	if randSchemaMap == nil {
+		logger.M.Fatal("随机获取一个数据库映射信息失败, 没有数据库映射信息")
+	}
+
+	// 链接原数据数据库
+	if err := InitSourceDB(configMap.Source, randSchemaMap.Source.String); err != nil {
+		logger.M.Fatalf("初始化(源)数据库链接出错, %v", err)
+	}
+
+	// 初始化目标连接数
+	if err := InitTargetDB(configMap.Target, randSchemaMap.Target.String); err != nil {
+		logger.M.Fatalf("初始化(目标)数据库链接出错, %v", err)
+	}
+
+	// 初始化需要迁移的表
+	if err := matemap.InitMigrationTableMap(configMap); err != nil {
+		logger.M.Fatal(err)
+	}
+
+	report, err := mysqlcs.NewChecksumReport(configMap, reportParser.CountRows)
+	if err != nil {
+		logger.M.Fatal(err)
+	}
+
+	// 输出报告, 没有指定文件输出到标准输出
+	output := os.Stdout
+	if reportParser.Output != "" {
+		if output, err = os.Create(reportParser.Output); err != nil {
+			logger.M.Fatalf("失败. 创建报告文件. %v. %v", reportParser.Output, err)
+		}
+		defer output.Close()
+	}
+	if err := report.Write(reportParser.Format, output); err != nil {
+		logger.M.Fatal(err)
+	}
+
+	return report
+}
@@ -0,0 +1,97 @@
+package throttler
+
+import (
+	"sync"
+	"time"
+)
+
+/* 令牌桶限速器, 每秒生成 rate 个令牌, 最多积攒 1 秒的令牌
+一次需要的令牌比桶中的多时, 先扣成负数, 调用者等待到令牌补齐为止, 多个协程一起使用时总的速度不会超过 rate
+*/
+type RateLimiter struct {
+	mu     sync.Mutex
+	rate   float64   // 每秒生成的令牌数, <= 0 不限速
+	tokens float64   // 桶中剩余的令牌数, 可以为负数
+	last   time.Time // 上一次计算令牌的时间
+}
+
+/* 创建一个限速器
+Params:
+    _rate: 每秒生成的令牌数, <= 0 不限速
+*/
+func NewRateLimiter(rate int64) *RateLimiter {
+	return &RateLimiter{
+		rate:   float64(rate),
+		tokens: float64(rate),
+		last:   time.Now(),
+	}
+}
+
+// 获取当前每秒生成的令牌数
+func (this *RateLimiter) GetRate() int64 {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	return int64(this.rate)
+}
+
+/* 修改每秒生成的令牌数, 运行时修改立刻生效
+Params:
+    _rate: 每秒生成的令牌数, <= 0 不限速
+*/
+func (this *RateLimiter) SetRate(rate int64) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if float64(rate) == this.rate {
+		return
+	}
+
+	this.refill(time.Now())
+	this.rate = float64(rate)
+	if this.rate <= 0 || this.tokens > this.rate {
+		this.tokens = this.rate
+	}
+	if this.tokens < -this.rate { // 调小了速度, 之前欠下的令牌最多等待 1 秒
+		this.tokens = -this.rate
+	}
+}
+
+/* 获取 n 个令牌, 令牌不够则等待
+Params:
+    _n: 需要的令牌数
+*/
+func (this *RateLimiter) Wait(n int) {
+	if this == nil || n <= 0 {
+		return
+	}
+
+	this.mu.Lock()
+	if this.rate <= 0 {
+		this.mu.Unlock()
+		return
+	}
+
+	this.refill(time.Now())
+	this.tokens -= float64(n)
+	var waitTime time.Duration
+	if this.tokens < 0 {
+		waitTime = time.Duration(-this.tokens / this.rate * float64(time.Second))
+	}
+	this.mu.Unlock()
+
+	if waitTime > 0 {
+		time.Sleep(waitTime)
+	}
+}
+
+// 按上一次计算到现在的时间补充令牌, 调用者需要持有锁
+func (this *RateLimiter) refill(now time.Time) {
+	if this.rate > 0 {
+		this.tokens += now.Sub(this.last).Seconds() * this.rate
+		if this.tokens > this.rate {
+			this.tokens = this.rate
+		}
+	}
+	this.last = now
+}
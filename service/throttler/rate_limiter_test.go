@@ -0,0 +1,32 @@
+package throttler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiter_Wait(t *testing.T) {
+	rateLimiter := NewRateLimiter(100)
+
+	// 桶中有 1 秒的令牌, 不需要等待
+	startTime := time.Now()
+	rateLimiter.Wait(100)
+	if elapsed := time.Since(startTime); elapsed > 50*time.Millisecond {
+		t.Fatalf("桶中令牌足够, 不应该等待. 等待了 %v", elapsed)
+	}
+
+	// 令牌用完, 50 个令牌需要等待 0.5 秒
+	startTime = time.Now()
+	rateLimiter.Wait(50)
+	if elapsed := time.Since(startTime); elapsed < 400*time.Millisecond {
+		t.Fatalf("令牌不够, 应该等待 0.5 秒左右. 等待了 %v", elapsed)
+	}
+
+	// 不限速
+	rateLimiter.SetRate(0)
+	startTime = time.Now()
+	rateLimiter.Wait(100000)
+	if elapsed := time.Since(startTime); elapsed > 50*time.Millisecond {
+		t.Fatalf("不限速, 不应该等待. 等待了 %v", elapsed)
+	}
+}
@@ -0,0 +1,487 @@
+package throttler
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/daiguadaidai/go-d-bus/common"
+	"github.com/daiguadaidai/go-d-bus/config"
+	"github.com/daiguadaidai/go-d-bus/dao"
+	"github.com/daiguadaidai/go-d-bus/gdbc"
+	"github.com/daiguadaidai/go-d-bus/logger"
+	"github.com/daiguadaidai/go-d-bus/parser"
+	"github.com/daiguadaidai/go-d-bus/service/helper"
+	"github.com/daiguadaidai/go-d-bus/setting"
+	"go.uber.org/atomic"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	THROTTLE_CHECK_INTERVAL = time.Second            // 多久检测一次是否需要限流
+	THROTTLE_WAIT_INTERVAL  = 100 * time.Millisecond // 限流时多久检测一次是否可以继续
+)
+
+// 限流的阈值, 命令行指定初始值, task_throttle 中不为 NULL 的值覆盖命令行的值
+type ThrottleSetting struct {
+	MaxSourceThreadsRunning int                // 源实例 Threads_running 超过该值进行限流, 0 不检测
+	MaxTargetThreadsRunning int                // 目标实例 Threads_running 超过该值进行限流, 0 不检测
+	MaxReplicaLag           int                // 目标从库延时(秒)超过该值进行限流, 0 不检测
+	Replicas                []*common.HostPort // 需要检测延时的目标从库
+	Query                   string             // 在目标实例执行的自定义检测sql, 返回值大于0进行限流
+	ThrottleBinlogApply     bool               // 限流时是否暂停应用binlog
+	ForceThrottle           bool               // 手动限流
+}
+
+/* 限流器, 原理和 gh-ost 相同
+一个协程定时检测源实例和目标实例的负载, 以及目标从库的延时, 超过阈值则标记为限流
+row copy 在生成主键范围值之前, 应用binlog 在分配事件之前检测是否限流, 限流则等待
+*/
+type Throttler struct {
+	TaskUUID string
+
+	SourceHost string
+	SourcePort int
+	TargetHost string
+	TargetPort int
+
+	// 链接目标从库使用目标实例的用户名和密码
+	targetUserName string
+	targetPassword string
+
+	parser *parser.RunParser
+
+	settingMu sync.Mutex
+	setting   *ThrottleSetting
+
+	throttled *atomic.Bool   // 当前是否正在限流
+	reason    *atomic.String // 当前限流的原因
+
+	// 限速, 和负载无关的硬性上限, 多个任务共用一个目标集群时控制每个任务的写入量
+	RowCopyRowsLimiter     *RateLimiter // row copy 每秒从源读取的行数
+	RowCopyBytesLimiter    *RateLimiter // row copy 每秒从源读取的字节数
+	ApplyBinlogRowsLimiter *RateLimiter // 应用binlog 每秒写入目标的行数
+}
+
+/* 创建限流器
+Params:
+    _runParser: 命令行解析的信息
+    _configMap: 配置信息
+*/
+func NewThrottler(runParser *parser.RunParser, configMap *config.ConfigMap) (*Throttler, error) {
+	throttler := &Throttler{
+		TaskUUID:       configMap.TaskUUID,
+		SourceHost:     configMap.Source.Host.String,
+		SourcePort:     int(configMap.Source.Port.Int64),
+		TargetHost:     configMap.Target.Host.String,
+		TargetPort:     int(configMap.Target.Port.Int64),
+		targetUserName: configMap.Target.UserName.String,
+		targetPassword: configMap.Target.Password.String,
+		parser:         runParser,
+		throttled:      atomic.NewBool(false),
+		reason:         atomic.NewString(""),
+
+		RowCopyRowsLimiter:     NewRateLimiter(runParser.RowCopyMaxRowsPerSec),
+		RowCopyBytesLimiter:    NewRateLimiter(runParser.RowCopyMaxBytesPerSec),
+		ApplyBinlogRowsLimiter: NewRateLimiter(runParser.ApplyBinlogMaxRowsPerSec),
+	}
+
+	// 保证任务有限流记录, 用于在运行时修改阈值和查看限流状态
+	if err := new(dao.TaskThrottleDao).FirstOrCreate(throttler.TaskUUID); err != nil {
+		return nil, fmt.Errorf("失败. 初始化任务限流记录. %v. %v", throttler.TaskUUID, err)
+	}
+	new(dao.TaskThrottleDao).UpdateState(throttler.TaskUUID, false, "")
+
+	if err := throttler.ReloadSetting(); err != nil {
+		return nil, err
+	}
+	if err := throttler.ReloadRateLimit(); err != nil {
+		return nil, err
+	}
+
+	return throttler, nil
+}
+
+// 开始定时检测是否需要限流
+func (this *Throttler) Start() {
+	throttleSetting := this.GetSetting()
+	logger.M.Infof("开始限流检测. 源 Threads_running: %v, 目标 Threads_running: %v, 从库延时: %v 秒, 从库: %v, 自定义sql: %v, 暂停应用binlog: %v",
+		throttleSetting.MaxSourceThreadsRunning, throttleSetting.MaxTargetThreadsRunning, throttleSetting.MaxReplicaLag,
+		throttleSetting.Replicas, throttleSetting.Query, throttleSetting.ThrottleBinlogApply)
+
+	go this.LoopCheck()
+}
+
+// 循环检测是否需要限流, 每次检测前重新获取 task_throttle 中的阈值
+func (this *Throttler) LoopCheck() {
+	for {
+		if err := this.ReloadSetting(); err != nil {
+			logger.M.Errorf("错误. 重新获取限流设置. 继续使用之前的设置. %v", err)
+		}
+		if err := this.ReloadRateLimit(); err != nil {
+			logger.M.Errorf("错误. 重新获取限速设置. 继续使用之前的设置. %v", err)
+		}
+
+		isThrottled, reason := this.Check()
+		this.SetState(isThrottled, reason)
+
+		time.Sleep(THROTTLE_CHECK_INTERVAL)
+	}
+}
+
+// 获取 task_throttle 中的阈值, 不为 NULL 的值覆盖命令行的值
+func (this *Throttler) ReloadSetting() error {
+	throttleSetting := &ThrottleSetting{
+		MaxSourceThreadsRunning: this.parser.MaxSourceThreadsRunning,
+		MaxTargetThreadsRunning: this.parser.MaxTargetThreadsRunning,
+		MaxReplicaLag:           this.parser.MaxReplicaLag,
+		Query:                   this.parser.ThrottleQuery,
+		ThrottleBinlogApply:     this.parser.ThrottleBinlogApply,
+	}
+	replicas := this.parser.ThrottleReplicas
+
+	taskThrottle, err := new(dao.TaskThrottleDao).GetByTaskUUID(this.TaskUUID)
+	if err != nil {
+		return fmt.Errorf("失败. 获取任务限流设置. %v. %v", this.TaskUUID, err)
+	}
+	if taskThrottle != nil {
+		if taskThrottle.MaxSourceThreadsRunning.Valid {
+			throttleSetting.MaxSourceThreadsRunning = int(taskThrottle.MaxSourceThreadsRunning.Int64)
+		}
+		if taskThrottle.MaxTargetThreadsRunning.Valid {
+			throttleSetting.MaxTargetThreadsRunning = int(taskThrottle.MaxTargetThreadsRunning.Int64)
+		}
+		if taskThrottle.MaxReplicaLag.Valid {
+			throttleSetting.MaxReplicaLag = int(taskThrottle.MaxReplicaLag.Int64)
+		}
+		if taskThrottle.ThrottleReplicas.Valid {
+			replicas = taskThrottle.ThrottleReplicas.String
+		}
+		if taskThrottle.ThrottleQuery.Valid {
+			throttleSetting.Query = strings.TrimSpace(taskThrottle.ThrottleQuery.String)
+		}
+		if taskThrottle.ThrottleBinlogApply.Valid {
+			throttleSetting.ThrottleBinlogApply = taskThrottle.ThrottleBinlogApply.Int64 == 1
+		}
+		throttleSetting.ForceThrottle = taskThrottle.ForceThrottle.Int64 == 1
+	}
+
+	if throttleSetting.Replicas, err = common.ParseHostPorts(replicas); err != nil {
+		return fmt.Errorf("失败. 需要检测延时的从库格式不正确. %v", err)
+	}
+
+	this.settingMu.Lock()
+	this.setting = throttleSetting
+	this.settingMu.Unlock()
+
+	return nil
+}
+
+// 获取 task 中的限速设置, 不为 NULL 的值覆盖命令行的值
+func (this *Throttler) ReloadRateLimit() error {
+	rowCopyRowsRate := this.parser.RowCopyMaxRowsPerSec
+	rowCopyBytesRate := this.parser.RowCopyMaxBytesPerSec
+	applyBinlogRowsRate := this.parser.ApplyBinlogMaxRowsPerSec
+
+	columnStr := "row_copy_max_rows_per_sec, row_copy_max_bytes_per_sec, binlog_max_rows_per_sec"
+	task, err := new(dao.TaskDao).GetByTaskUUID(this.TaskUUID, columnStr)
+	if err != nil {
+		return fmt.Errorf("失败. 获取任务限速设置. %v. %v", this.TaskUUID, err)
+	}
+	if task != nil {
+		if task.RowCopyMaxRowsPerSec.Valid {
+			rowCopyRowsRate = task.RowCopyMaxRowsPerSec.Int64
+		}
+		if task.RowCopyMaxBytesPerSec.Valid {
+			rowCopyBytesRate = task.RowCopyMaxBytesPerSec.Int64
+		}
+		if task.BinlogMaxRowsPerSec.Valid {
+			applyBinlogRowsRate = task.BinlogMaxRowsPerSec.Int64
+		}
+	}
+
+	setRate(this.RowCopyRowsLimiter, "row copy 每秒行数", rowCopyRowsRate)
+	setRate(this.RowCopyBytesLimiter, "row copy 每秒字节数", rowCopyBytesRate)
+	setRate(this.ApplyBinlogRowsLimiter, "应用binlog 每秒行数", applyBinlogRowsRate)
+
+	return nil
+}
+
+// 修改限速器的速度, 发生变化时记录日志
+func setRate(rateLimiter *RateLimiter, name string, rate int64) {
+	if rate < 0 {
+		rate = 0
+	}
+
+	oldRate := rateLimiter.GetRate()
+	if oldRate == rate {
+		return
+	}
+
+	rateLimiter.SetRate(rate)
+	logger.M.Infof("修改限速. %v: %v -> %v (0 不限制)", name, oldRate, rate)
+}
+
+// 获取当前的限流阈值
+func (this *Throttler) GetSetting() *ThrottleSetting {
+	this.settingMu.Lock()
+	defer this.settingMu.Unlock()
+
+	return this.setting
+}
+
+/* 检测是否需要限流, 有一个指标超过阈值就需要限流
+Return:
+    1. 是否需要限流
+    2. 限流的原因
+*/
+func (this *Throttler) Check() (bool, string) {
+	throttleSetting := this.GetSetting()
+
+	if throttleSetting.ForceThrottle {
+		return true, "手动限流(task_throttle.force_throttle=1)"
+	}
+
+	if throttleSetting.MaxSourceThreadsRunning > 0 {
+		threadsRunning, err := GetThreadsRunning(this.SourceHost, this.SourcePort)
+		if err != nil {
+			return true, err.Error()
+		}
+		if threadsRunning > throttleSetting.MaxSourceThreadsRunning {
+			return true, fmt.Sprintf("源实例 %v:%v Threads_running=%v 超过了 %v",
+				this.SourceHost, this.SourcePort, threadsRunning, throttleSetting.MaxSourceThreadsRunning)
+		}
+	}
+
+	if throttleSetting.MaxTargetThreadsRunning > 0 {
+		threadsRunning, err := GetThreadsRunning(this.TargetHost, this.TargetPort)
+		if err != nil {
+			return true, err.Error()
+		}
+		if threadsRunning > throttleSetting.MaxTargetThreadsRunning {
+			return true, fmt.Sprintf("目标实例 %v:%v Threads_running=%v 超过了 %v",
+				this.TargetHost, this.TargetPort, threadsRunning, throttleSetting.MaxTargetThreadsRunning)
+		}
+	}
+
+	if throttleSetting.MaxReplicaLag > 0 {
+		for _, replica := range throttleSetting.Replicas {
+			// 获取不到从库延时也进行限流, 防止从库复制停止后延时越来越大
+			lag, err := this.GetReplicaLag(replica)
+			if err != nil {
+				return true, err.Error()
+			}
+			if lag > throttleSetting.MaxReplicaLag {
+				return true, fmt.Sprintf("目标从库 %v 延时 %v 秒 超过了 %v 秒", replica, lag, throttleSetting.MaxReplicaLag)
+			}
+		}
+	}
+
+	if throttleSetting.Query != "" {
+		result, err := GetThrottleQueryResult(this.TargetHost, this.TargetPort, throttleSetting.Query)
+		if err != nil {
+			return true, err.Error()
+		}
+		if result > 0 {
+			return true, fmt.Sprintf("自定义限流sql返回 %v. %v", result, throttleSetting.Query)
+		}
+	}
+
+	return false, ""
+}
+
+/* 设置限流状态, 状态发生变化时记录日志并保存到 task_throttle
+Params:
+    _isThrottled: 是否需要限流
+    _reason: 限流原因
+*/
+func (this *Throttler) SetState(isThrottled bool, reason string) {
+	wasThrottled := this.throttled.Load()
+	oldReason := this.reason.Load()
+
+	this.reason.Store(reason)
+	this.throttled.Store(isThrottled)
+
+	if wasThrottled == isThrottled && oldReason == reason {
+		return
+	}
+
+	if isThrottled {
+		logger.M.Warnf("开始限流. %v", reason)
+	} else {
+		logger.M.Infof("解除限流. 之前的原因: %v", oldReason)
+	}
+
+	if len(reason) > 500 {
+		reason = reason[:500]
+	}
+	new(dao.TaskThrottleDao).UpdateState(this.TaskUUID, isThrottled, reason)
+}
+
+// 当前是否正在限流, 以及限流原因
+func (this *Throttler) IsThrottled() (bool, string) {
+	return this.throttled.Load(), this.reason.Load()
+}
+
+// row copy 限流时等待, 没有开启限流器(nil)直接返回
+func (this *Throttler) WaitRowCopy() {
+	if this == nil {
+		return
+	}
+
+	this.wait("row copy", func() bool { return true })
+}
+
+// 应用binlog 限流时等待, 只有设置了限流时暂停应用binlog才等待
+func (this *Throttler) WaitApplyBinlog() {
+	if this == nil {
+		return
+	}
+
+	this.wait("应用binlog", func() bool { return this.GetSetting().ThrottleBinlogApply })
+}
+
+// 滚动校验 限流时等待, 没有开启限流器(nil)直接返回
+func (this *Throttler) WaitRollingChecksum() {
+	if this == nil {
+		return
+	}
+
+	this.wait("滚动校验", func() bool { return true })
+}
+
+/* 滚动校验 限速, 和 row copy 共用从源读取的行数上限, 没有开启限流器(nil)直接返回
+Params:
+    _rowCnt: 读取的行数
+*/
+func (this *Throttler) WaitRollingChecksumRate(rowCnt int) {
+	if this == nil {
+		return
+	}
+
+	this.RowCopyRowsLimiter.Wait(rowCnt)
+}
+
+/* row copy 限速, 从源读取的行数和字节数超过了上限则等待, 没有开启限流器(nil)直接返回
+Params:
+    _rowCnt: 读取的行数
+    _byteCnt: 读取的字节数
+*/
+func (this *Throttler) WaitRowCopyRate(rowCnt int, byteCnt int) {
+	if this == nil {
+		return
+	}
+
+	this.RowCopyRowsLimiter.Wait(rowCnt)
+	this.RowCopyBytesLimiter.Wait(byteCnt)
+}
+
+/* 应用binlog 限速, 写入目标的行数超过了上限则等待, 没有开启限流器(nil)直接返回
+Params:
+    _rowCnt: 写入的行数
+*/
+func (this *Throttler) WaitApplyBinlogRate(rowCnt int) {
+	if this == nil {
+		return
+	}
+
+	this.ApplyBinlogRowsLimiter.Wait(rowCnt)
+}
+
+/* 限流时一直等待, 直到解除限流
+Params:
+    _name: 被限流的操作名称, 用于记录日志
+    _enabled: 该操作是否需要限流, 每次检测都调用, 运行时修改了设置可以立刻生效
+*/
+func (this *Throttler) wait(name string, enabled func() bool) {
+	waitStart := time.Time{}
+	for {
+		isThrottled, reason := this.IsThrottled()
+		if !isThrottled || !enabled() {
+			break
+		}
+
+		if waitStart.IsZero() {
+			waitStart = time.Now()
+			logger.M.Warnf("%v 被限流, 暂停. 原因: %v", name, reason)
+		}
+		time.Sleep(THROTTLE_WAIT_INTERVAL)
+	}
+
+	if !waitStart.IsZero() {
+		logger.M.Infof("%v 解除限流, 继续. 暂停了 %v", name, time.Since(waitStart))
+	}
+}
+
+/* 获取目标从库的延时(秒), 从库没有链接则使用目标实例的用户名和密码创建
+Params:
+    _replica: 目标从库
+*/
+func (this *Throttler) GetReplicaLag(replica *common.HostPort) (int, error) {
+	if _, ok := gdbc.GetDynamicDBByHostPort(replica.Host, int64(replica.Port)); !ok {
+		cfg := setting.NewMysqlConfig(replica.Host, int64(replica.Port), this.targetUserName, this.targetPassword, "", 2, 1)
+		db, err := gdbc.GetMySQLDB(cfg)
+		if err != nil {
+			return 0, fmt.Errorf("失败. 链接需要检测延时的目标从库 %v. %v", replica, err)
+		}
+		gdbc.AddInstanceToCache(replica.Host, int64(replica.Port), db)
+	}
+
+	statusMap, err := helper.GetReplicaStatus(replica.Host, replica.Port)
+	if err != nil {
+		return 0, err
+	}
+
+	secondsBehind := helper.GetReplicaStatusValue(statusMap, "Seconds_Behind_Master")
+	if !secondsBehind.Valid {
+		return 0, fmt.Errorf("目标从库 %v 复制没有运行, 获取不到延时", replica)
+	}
+	lag, err := strconv.Atoi(secondsBehind.String)
+	if err != nil {
+		return 0, fmt.Errorf("失败. 解析目标从库 %v 延时 %v. %v", replica, secondsBehind.String, err)
+	}
+
+	return lag, nil
+}
+
+/* 获取实例当前的 Threads_running
+Params:
+    _host: 实例 host
+    _port: 实例 port
+*/
+func GetThreadsRunning(host string, port int) (int, error) {
+	instance, ok := gdbc.GetDynamicDBByHostPort(host, int64(port))
+	if !ok {
+		return 0, fmt.Errorf("缓存中不存在该实例(%v:%v). 获取 Threads_running", host, port)
+	}
+
+	var variableName string
+	var value int
+	err := instance.QueryRow("/* go-d-bus */ SHOW GLOBAL STATUS LIKE 'Threads_running'").Scan(&variableName, &value)
+	if err != nil {
+		return 0, fmt.Errorf("失败. 获取 Threads_running. %v:%v. %v", host, port, err)
+	}
+
+	return value, nil
+}
+
+/* 在实例上执行自定义限流检测sql, 获取返回的第一个值
+Params:
+    _host: 实例 host
+    _port: 实例 port
+    _query: 自定义限流检测sql
+*/
+func GetThrottleQueryResult(host string, port int, query string) (int64, error) {
+	instance, ok := gdbc.GetDynamicDBByHostPort(host, int64(port))
+	if !ok {
+		return 0, fmt.Errorf("缓存中不存在该实例(%v:%v). 执行自定义限流sql", host, port)
+	}
+
+	var result sql.NullInt64
+	if err := instance.QueryRow(query).Scan(&result); err != nil {
+		return 0, fmt.Errorf("失败. 执行自定义限流sql. %v:%v. %v. %v", host, port, query, err)
+	}
+
+	return result.Int64, nil
+}